@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// traceTransport logs each request to the Docker daemon with its status and
+// duration. The lines are logged at INFO, so they can be read with
+// TF_LOG=INFO instead of the whole DEBUG output of terraform.
+type traceTransport struct {
+	next http.RoundTripper
+	// resource is the resource operation the client makes the requests for
+	resource string
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	// a streamed response, like the progress of a pull, takes longer than
+	// its headers, which the duration is measured until
+	duration := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("[INFO] Docker API %s: %s %s failed after %s: %s", t.resource, req.Method, req.URL.Path, duration, err)
+		return resp, err
+	}
+	log.Printf("[INFO] Docker API %s: %s %s %d in %s", t.resource, req.Method, req.URL.Path, resp.StatusCode, duration)
+	return resp, err
+}
+
+// traceResources wraps the operations of the resources so that, with
+// trace_api_calls, the requests of each operation are traced with the
+// resource. The operation gets a client of its own for that, as the requests
+// of the resources the client of the provider is shared by carry no context
+// of their resource.
+func traceResources(resources map[string]*schema.Resource) {
+	for resourceType, r := range resources {
+		r.Create = traceResourceFunc(resourceType, "create", r.Create)
+		r.Read = traceResourceFunc(resourceType, "read", r.Read)
+		r.Update = traceResourceFunc(resourceType, "update", r.Update)
+		r.Delete = traceResourceFunc(resourceType, "delete", r.Delete)
+	}
+}
+
+func traceResourceFunc(resourceType, operation string, f func(*schema.ResourceData, interface{}) error) func(*schema.ResourceData, interface{}) error {
+	if f == nil {
+		return nil
+	}
+	return func(d *schema.ResourceData, meta interface{}) error {
+		providerConfig := meta.(*ProviderConfig)
+		if providerConfig.traceConfig == nil {
+			return f(d, meta)
+		}
+
+		config := *providerConfig.traceConfig
+		config.traceResource = fmt.Sprintf("%s %s %s", operation, resourceType, traceResourceName(d))
+		cli, err := config.NewClient()
+		if err != nil {
+			return fmt.Errorf("Error initializing Docker client: %s", err)
+		}
+		defer cli.Close()
+		traced := *providerConfig
+		traced.DockerClient = cli
+
+		start := time.Now()
+		err = f(d, &traced)
+		log.Printf("[INFO] Docker API %s: done in %s", config.traceResource, time.Since(start).Round(time.Millisecond))
+		return err
+	}
+}
+
+// traceResourceName names the resource by its name, or by its ID if it has
+// no name
+func traceResourceName(d *schema.ResourceData) string {
+	if name, ok := d.Get("name").(string); ok && name != "" {
+		return fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("%q", d.Id())
+}
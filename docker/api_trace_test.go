@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func TestTraceResourceFunc(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.40")
+		w.Write([]byte("OK"))
+	}))
+	defer daemon.Close()
+	host := "tcp://" + strings.TrimPrefix(daemon.URL, "http://")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	ping := traceResourceFunc("docker_volume", "create", func(d *schema.ResourceData, meta interface{}) error {
+		_, err := meta.(*ProviderConfig).DockerClient.Ping(context.Background())
+		return err
+	})
+	d := schema.TestResourceDataRaw(t, resourceDockerVolume().Schema, map[string]interface{}{"name": "data"})
+
+	cli, err := (&Config{Host: host}).NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ping(d, &ProviderConfig{DockerClient: cli}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.Contains(logs.String(), "Docker API") {
+		t.Errorf("expected no traces without trace_api_calls, got %s", logs.String())
+	}
+
+	if err := ping(d, &ProviderConfig{traceConfig: &Config{Host: host, TraceAPICalls: true, MaxRetries: 2}}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, trace := range []string{
+		`Docker API create docker_volume "data": (HEAD|GET) /_ping 200 in [0-9.]+m?s`,
+		`Docker API create docker_volume "data": done in`,
+	} {
+		if !regexp.MustCompile(trace).MatchString(logs.String()) {
+			t.Errorf("expected a trace matching %s, got %s", trace, logs.String())
+		}
+	}
+}
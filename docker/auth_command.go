@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// authCommandTimeout bounds a run of the auth_command, e.g. one waiting for
+// a login which never completes
+const authCommandTimeout = 5 * time.Minute
+
+// authCommandLifetime is how long credentials without an expires_at are
+// reused, they are only requested again if the registry rejects them
+const authCommandLifetime = 24 * time.Hour
+
+// authCommandOutput is the JSON the auth_command prints
+type authCommandOutput struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identity_token"`
+	RegistryToken string `json:"registry_token"`
+	ExpiresAt     string `json:"expires_at"`
+}
+
+// authCommandTokenSource returns the source of the credentials the command
+// prints for the registry of the address, which it gets in the
+// DOCKER_REGISTRY_ADDRESS environment variable
+func authCommandTokenSource(address string, command []string) (registryTokenSource, error) {
+	if len(command) == 0 || command[0] == "" {
+		return nil, fmt.Errorf("The auth_command of %s must name the program to run", address)
+	}
+	return func() (types.AuthConfig, time.Time, error) {
+		log.Printf("[DEBUG] Running %s for the credentials of %s", command[0], address)
+		ctx, cancel := context.WithTimeout(context.Background(), authCommandTimeout)
+		defer cancel()
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Env = append(os.Environ(), "DOCKER_REGISTRY_ADDRESS="+address)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return types.AuthConfig{}, time.Time{}, fmt.Errorf("Unable to get the credentials of %s from %s: %s\n\n%s", address, command[0], err, strings.TrimSpace(stderr.String()))
+		}
+
+		output := authCommandOutput{}
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			return types.AuthConfig{}, time.Time{}, fmt.Errorf("Unable to parse the credentials of %s printed by %s: %s", address, command[0], err)
+		}
+		if output.Password == "" && output.IdentityToken == "" && output.RegistryToken == "" {
+			return types.AuthConfig{}, time.Time{}, fmt.Errorf("%s printed no password, identity_token or registry_token for %s", command[0], address)
+		}
+		expiresAt := time.Now().Add(authCommandLifetime)
+		if output.ExpiresAt != "" {
+			var err error
+			if expiresAt, err = time.Parse(time.RFC3339, output.ExpiresAt); err != nil {
+				return types.AuthConfig{}, time.Time{}, fmt.Errorf("Unable to parse the expires_at of the credentials of %s printed by %s: %s", address, command[0], err)
+			}
+		}
+		return types.AuthConfig{
+			Username:      output.Username,
+			Password:      output.Password,
+			IdentityToken: output.IdentityToken,
+			RegistryToken: output.RegistryToken,
+		}, expiresAt, nil
+	}, nil
+}
@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthCommandTokenSource(t *testing.T) {
+	command := []string{"sh", "-c", `echo "{\"username\": \"sso\", \"password\": \"token-for-$DOCKER_REGISTRY_ADDRESS\", \"expires_at\": \"2030-01-02T15:04:05Z\"}"`}
+	source, err := authCommandTokenSource("registry.example.com", command)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	authConfig, expiresAt, err := source()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if authConfig.Username != "sso" || authConfig.Password != "token-for-registry.example.com" {
+		t.Errorf("expected the printed credentials, got %+v", authConfig)
+	}
+	if !expiresAt.Equal(time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected the printed expiry, got %s", expiresAt)
+	}
+
+	// credentials without an expiry are reused until the registry rejects them
+	source, _ = authCommandTokenSource("registry.example.com", []string{"sh", "-c", `echo '{"identity_token": "refresh"}'`})
+	token := newRegistryToken(source)
+	authConfig, err = token.get(false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if authConfig.IdentityToken != "refresh" || time.Until(token.expiresAt) <= registryTokenRefreshWindow {
+		t.Errorf("expected the identity token to be cached, got %+v until %s", authConfig, token.expiresAt)
+	}
+
+	cases := []struct {
+		command []string
+		err     string
+	}{
+		{[]string{"sh", "-c", "echo 'login required' >&2; exit 1"}, "login required"},
+		{[]string{"sh", "-c", "echo 'not json'"}, "Unable to parse the credentials"},
+		{[]string{"sh", "-c", `echo '{"username": "sso"}'`}, "printed no password"},
+		{[]string{"sh", "-c", `echo '{"password": "secret", "expires_at": "tomorrow"}'`}, "Unable to parse the expires_at"},
+	}
+	for _, c := range cases {
+		source, _ := authCommandTokenSource("registry.example.com", c.command)
+		if _, _, err := source(); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expected %q for %v, got %v", c.err, c.command, err)
+		}
+	}
+	if _, err := authCommandTokenSource("registry.example.com", []string{""}); err == nil {
+		t.Error("expected an error for a command without program")
+	}
+}
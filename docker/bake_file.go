@@ -0,0 +1,484 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const bakeDefaultGroup = "default"
+
+// bakeTarget is a target of a bake file. Unset attributes are nil, so
+// inherited values are only overridden by attributes set in the target.
+type bakeTarget struct {
+	Name             string            `hcl:"name,label"`
+	Inherits         []string          `hcl:"inherits,optional"`
+	Context          *string           `hcl:"context,optional"`
+	Dockerfile       *string           `hcl:"dockerfile,optional"`
+	DockerfileInline *string           `hcl:"dockerfile-inline,optional"`
+	Tags             []string          `hcl:"tags,optional"`
+	Args             map[string]string `hcl:"args,optional"`
+	Labels           map[string]string `hcl:"labels,optional"`
+	Target           *string           `hcl:"target,optional"`
+	Platforms        []string          `hcl:"platforms,optional"`
+	CacheFrom        []string          `hcl:"cache-from,optional"`
+	CacheTo          []string          `hcl:"cache-to,optional"`
+	NoCache          *bool             `hcl:"no-cache,optional"`
+	Pull             *bool             `hcl:"pull,optional"`
+}
+
+type bakeGroup struct {
+	Name    string   `hcl:"name,label"`
+	Targets []string `hcl:"targets"`
+}
+
+// bakeFile are the groups and targets of a docker-bake.hcl, docker-bake.json
+// or the build sections of a compose file
+type bakeFile struct {
+	Groups  []bakeGroup  `hcl:"group,block"`
+	Targets []bakeTarget `hcl:"target,block"`
+
+	dir string
+}
+
+type bakeVariable struct {
+	Name    string         `hcl:"name,label"`
+	Default hcl.Expression `hcl:"default,optional"`
+}
+
+// readBakeFile parses the bake file, compose files are detected by their
+// extension
+func readBakeFile(path string) (*bakeFile, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read bake file %s: %s", path, err)
+	}
+
+	var file *bakeFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		file, err = parseComposeBakeFile(src, path)
+	default:
+		file, err = parseHCLBakeFile(src, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file.dir = filepath.Dir(path)
+	return file, nil
+}
+
+// parseHCLBakeFile parses bake files in the HCL or JSON format. Variables
+// are set by their default or the environment variable of the same name.
+func parseHCLBakeFile(src []byte, path string) (*bakeFile, error) {
+	parser := hclparse.NewParser()
+	var f *hcl.File
+	var diags hcl.Diagnostics
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		f, diags = parser.ParseJSON(src, path)
+	} else {
+		f, diags = parser.ParseHCL(src, path)
+	}
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("Unable to parse bake file %s: %s", path, diags)
+	}
+
+	content, body, diags := f.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}},
+	})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("Unable to parse bake file %s: %s", path, diags)
+	}
+	variables := map[string]cty.Value{}
+	for _, block := range content.Blocks {
+		var variable bakeVariable
+		if diags := gohcl.DecodeBody(block.Body, nil, &variable); diags.HasErrors() {
+			return nil, fmt.Errorf("Unable to parse variable %s of bake file %s: %s", block.Labels[0], path, diags)
+		}
+		name := block.Labels[0]
+		if value, ok := os.LookupEnv(name); ok {
+			variables[name] = cty.StringVal(value)
+			continue
+		}
+		value := cty.StringVal("")
+		if variable.Default != nil {
+			defaultValue, diags := variable.Default.Value(nil)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("Unable to parse variable %s of bake file %s: %s", name, path, diags)
+			}
+			if !defaultValue.IsNull() {
+				if value, err := convert.Convert(defaultValue, cty.String); err == nil {
+					variables[name] = value
+					continue
+				}
+				return nil, fmt.Errorf("The default of variable %s of bake file %s is not a string", name, path)
+			}
+		}
+		variables[name] = value
+	}
+
+	file := &bakeFile{}
+	ctx := &hcl.EvalContext{Variables: variables}
+	if diags := gohcl.DecodeBody(body, ctx, file); diags.HasErrors() {
+		return nil, fmt.Errorf("Unable to parse bake file %s: %s", path, diags)
+	}
+	return file, nil
+}
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image string        `yaml:"image"`
+	Build *composeBuild `yaml:"build"`
+}
+
+type composeBuild struct {
+	Context    string      `yaml:"context"`
+	Dockerfile string      `yaml:"dockerfile"`
+	Args       interface{} `yaml:"args"`
+	Labels     interface{} `yaml:"labels"`
+	Target     string      `yaml:"target"`
+	CacheFrom  []string    `yaml:"cache_from"`
+}
+
+// UnmarshalYAML supports the short syntax, where build is the context
+func (b *composeBuild) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var context string
+	if err := unmarshal(&context); err == nil {
+		b.Context = context
+		return nil
+	}
+	type rawComposeBuild composeBuild
+	return unmarshal((*rawComposeBuild)(b))
+}
+
+// composeMapping returns mappings which compose allows as map or as list of
+// 'key=value' entries
+func composeMapping(raw interface{}) (map[string]string, error) {
+	mapping := map[string]string{}
+	switch raw := raw.(type) {
+	case nil:
+	case map[interface{}]interface{}:
+		for k, v := range raw {
+			if v == nil {
+				v = ""
+			}
+			mapping[fmt.Sprint(k)] = fmt.Sprint(v)
+		}
+	case []interface{}:
+		for _, entry := range raw {
+			parts := strings.SplitN(fmt.Sprint(entry), "=", 2)
+			if len(parts) == 1 {
+				parts = append(parts, "")
+			}
+			mapping[parts[0]] = parts[1]
+		}
+	default:
+		return nil, fmt.Errorf("expected a map or a list, got %v", raw)
+	}
+	return mapping, nil
+}
+
+// parseComposeBakeFile turns each service of a compose file with a build
+// section into a target. Services without image are named like compose
+// names them, '<project>-<service>' with the directory as project.
+func parseComposeBakeFile(src []byte, path string) (*bakeFile, error) {
+	var compose composeFile
+	if err := yaml.Unmarshal(src, &compose); err != nil {
+		return nil, fmt.Errorf("Unable to parse compose file %s: %s", path, err)
+	}
+	project, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	project = strings.ToLower(filepath.Base(project))
+
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	file := &bakeFile{}
+	for _, name := range names {
+		service := compose.Services[name]
+		if service.Build == nil {
+			continue
+		}
+		build := service.Build
+		args, err := composeMapping(build.Args)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse build args of service %s of compose file %s: %s", name, path, err)
+		}
+		labels, err := composeMapping(build.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse build labels of service %s of compose file %s: %s", name, path, err)
+		}
+		image := service.Image
+		if image == "" {
+			image = project + "-" + name
+		}
+		target := bakeTarget{
+			Name:      name,
+			Tags:      []string{image},
+			Args:      args,
+			Labels:    labels,
+			CacheFrom: build.CacheFrom,
+		}
+		if build.Context != "" {
+			target.Context = &build.Context
+		}
+		if build.Dockerfile != "" {
+			target.Dockerfile = &build.Dockerfile
+		}
+		if build.Target != "" {
+			target.Target = &build.Target
+		}
+		file.Targets = append(file.Targets, target)
+	}
+	return file, nil
+}
+
+func (f *bakeFile) target(name string) *bakeTarget {
+	for i := range f.Targets {
+		if f.Targets[i].Name == name {
+			return &f.Targets[i]
+		}
+	}
+	return nil
+}
+
+func (f *bakeFile) group(name string) *bakeGroup {
+	for i := range f.Groups {
+		if f.Groups[i].Name == name {
+			return &f.Groups[i]
+		}
+	}
+	return nil
+}
+
+// resolve returns the targets of names, which are targets or groups, with
+// their inherited attributes. Without names the default group is built, or
+// all targets if the file has none.
+func (f *bakeFile) resolve(names []string) ([]bakeTarget, error) {
+	if len(names) == 0 {
+		if f.group(bakeDefaultGroup) != nil {
+			names = []string{bakeDefaultGroup}
+		} else {
+			for _, t := range f.Targets {
+				names = append(names, t.Name)
+			}
+		}
+	}
+
+	targets := []bakeTarget{}
+	seen := map[string]bool{}
+	var add func(name string, groups []string) error
+	add = func(name string, groups []string) error {
+		if group := f.group(name); group != nil {
+			for _, g := range groups {
+				if g == name {
+					return fmt.Errorf("Group %s of the bake file includes itself", name)
+				}
+			}
+			for _, member := range group.Targets {
+				if err := add(member, append(groups, name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if seen[name] {
+			return nil
+		}
+		target, err := f.inherit(name, nil)
+		if err != nil {
+			return err
+		}
+		seen[name] = true
+		targets = append(targets, *target)
+		return nil
+	}
+	for _, name := range names {
+		if err := add(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("The bake file has no targets to build")
+	}
+	return targets, nil
+}
+
+// inherit returns the target with the attributes of the targets it
+// inherits from, where later targets and the target itself take precedence
+func (f *bakeFile) inherit(name string, chain []string) (*bakeTarget, error) {
+	for _, c := range chain {
+		if c == name {
+			return nil, fmt.Errorf("Target %s of the bake file inherits from itself", name)
+		}
+	}
+	target := f.target(name)
+	if target == nil {
+		return nil, fmt.Errorf("The bake file has no target or group %s", name)
+	}
+
+	merged := bakeTarget{Name: name}
+	for _, parent := range target.Inherits {
+		inherited, err := f.inherit(parent, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		merged.merge(inherited)
+	}
+	merged.merge(target)
+	merged.Inherits = nil
+	return &merged, nil
+}
+
+func (t *bakeTarget) merge(o *bakeTarget) {
+	if o.Context != nil {
+		t.Context = o.Context
+	}
+	if o.Dockerfile != nil {
+		t.Dockerfile = o.Dockerfile
+	}
+	if o.DockerfileInline != nil {
+		t.DockerfileInline = o.DockerfileInline
+	}
+	if o.Tags != nil {
+		t.Tags = o.Tags
+	}
+	if o.Target != nil {
+		t.Target = o.Target
+	}
+	if o.Platforms != nil {
+		t.Platforms = o.Platforms
+	}
+	if o.CacheFrom != nil {
+		t.CacheFrom = o.CacheFrom
+	}
+	if o.CacheTo != nil {
+		t.CacheTo = o.CacheTo
+	}
+	if o.NoCache != nil {
+		t.NoCache = o.NoCache
+	}
+	if o.Pull != nil {
+		t.Pull = o.Pull
+	}
+	// args and labels are merged key by key, like bake does
+	for k, v := range o.Args {
+		if t.Args == nil {
+			t.Args = map[string]string{}
+		}
+		t.Args[k] = v
+	}
+	for k, v := range o.Labels {
+		if t.Labels == nil {
+			t.Labels = map[string]string{}
+		}
+		t.Labels[k] = v
+	}
+}
+
+// imageName is the first tag of the target, or its name if it has no tags
+func (t *bakeTarget) imageName() string {
+	if len(t.Tags) > 0 {
+		return t.Tags[0]
+	}
+	return t.Name
+}
+
+// rawBuild returns the target in the format of the build block of
+// docker_image, so it is built the same way. Relative contexts are resolved
+// against dir, the directory of the bake file.
+func (t *bakeTarget) rawBuild(dir, builderVersion string, noCache bool) (map[string]interface{}, error) {
+	stringOr := func(s *string, fallback string) string {
+		if s == nil {
+			return fallback
+		}
+		return *s
+	}
+	toList := func(values []string) []interface{} {
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			list[i] = v
+		}
+		return list
+	}
+	toMap := func(values map[string]string) map[string]interface{} {
+		m := make(map[string]interface{}, len(values))
+		for k, v := range values {
+			m[k] = v
+		}
+		return m
+	}
+
+	cacheTo := ""
+	for _, c := range t.CacheTo {
+		if c != "inline" && c != "type=inline" {
+			return nil, fmt.Errorf("cache-to %s of target %s is not supported, only the inline cache is", c, t.Name)
+		}
+		cacheTo = "inline"
+	}
+	contextDir := stringOr(t.Context, ".")
+	if !filepath.IsAbs(contextDir) && !isRemoteBuildContext(contextDir) {
+		contextDir = filepath.Join(dir, contextDir)
+	}
+	tags := []string{}
+	if len(t.Tags) > 1 {
+		tags = t.Tags[1:]
+	}
+	if t.NoCache != nil && *t.NoCache {
+		noCache = true
+	}
+
+	return map[string]interface{}{
+		"path":                contextDir,
+		"dockerfile":          stringOr(t.Dockerfile, "Dockerfile"),
+		"dockerfile_contents": stringOr(t.DockerfileInline, ""),
+		"excludes":            []interface{}{},
+		"builder":             []interface{}{},
+		"builder_version":     builderVersion,
+		"progress":            "",
+		"tag":                 toList(tags),
+		"force_remove":        false,
+		"remove":              true,
+		"no_cache":            noCache,
+		"pull_parent":         t.Pull != nil && *t.Pull,
+		"target":              stringOr(t.Target, ""),
+		"platform":            "",
+		"platforms":           toList(t.Platforms),
+		"cpu_shares":          0,
+		"cpu_quota":           0,
+		"cpu_period":          0,
+		"memory":              0,
+		"memory_swap":         0,
+		"shm_size":            0,
+		"cgroup_parent":       "",
+		"isolation":           "",
+		"network_mode":        "",
+		"extra_hosts":         []interface{}{},
+		"cache_from":          toList(t.CacheFrom),
+		"cache_to":            cacheTo,
+		"build_arg":           toMap(t.Args),
+		"label":               toMap(t.Labels),
+		"secrets":             []interface{}{},
+		"ssh":                 []interface{}{},
+		"output":              []interface{}{},
+	}, nil
+}
@@ -0,0 +1,227 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestBakeFile(t *testing.T, name, contents string) string {
+	dir, err := ioutil.TempDir("", "tf-provider-docker-bake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadBakeFileHCL(t *testing.T) {
+	path := writeTestBakeFile(t, "docker-bake.hcl", `
+variable "TAG" {
+  default = "latest"
+}
+
+variable "REGISTRY" {
+  default = "localhost:5000"
+}
+
+group "default" {
+  targets = ["app", "tools"]
+}
+
+group "all" {
+  targets = ["default", "docs"]
+}
+
+target "base" {
+  context = "./src"
+  args = {
+    GO_VERSION = "1.15"
+  }
+  labels = {
+    team = "platform"
+  }
+}
+
+target "app" {
+  inherits  = ["base"]
+  tags      = ["${REGISTRY}/app:${TAG}", "${REGISTRY}/app:stable"]
+  args      = {
+    MODE = "release"
+  }
+  platforms = ["linux/amd64", "linux/arm64"]
+  cache-to  = ["type=inline"]
+}
+
+target "tools" {
+  inherits   = ["base"]
+  dockerfile = "Dockerfile.tools"
+  target     = "tools"
+  no-cache   = true
+  pull       = true
+}
+
+target "docs" {
+  dockerfile-inline = "FROM scratch"
+}
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer os.Setenv("TAG", os.Getenv("TAG"))
+	os.Setenv("TAG", "1.0")
+	os.Unsetenv("REGISTRY")
+
+	file, err := readBakeFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	targets, err := file.resolve(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(targets) != 2 || targets[0].Name != "app" || targets[1].Name != "tools" {
+		t.Fatalf("expected the targets of the default group, got %+v", targets)
+	}
+
+	app, err := targets[0].rawBuild(file.dir, "2", false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if name := targets[0].imageName(); name != "localhost:5000/app:1.0" {
+		t.Errorf("expected the first tag as image name, got %s", name)
+	}
+	expected := map[string]interface{}{
+		"path":       filepath.Join(filepath.Dir(path), "src"),
+		"dockerfile": "Dockerfile",
+		"tag":        []interface{}{"localhost:5000/app:stable"},
+		"platforms":  []interface{}{"linux/amd64", "linux/arm64"},
+		"build_arg":  map[string]interface{}{"GO_VERSION": "1.15", "MODE": "release"},
+		"label":      map[string]interface{}{"team": "platform"},
+		"cache_to":   "inline",
+		"no_cache":   false,
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(app[k], v) {
+			t.Errorf("expected %s of app to be %v, got %v", k, v, app[k])
+		}
+	}
+
+	tools, err := targets[1].rawBuild(file.dir, "2", false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if targets[1].imageName() != "tools" || tools["dockerfile"] != "Dockerfile.tools" || tools["target"] != "tools" || tools["no_cache"] != true || tools["pull_parent"] != true {
+		t.Errorf("unexpected build of tools %v", tools)
+	}
+
+	targets, err = file.resolve([]string{"all", "app"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(targets) != 3 || targets[2].Name != "docs" || *targets[2].DockerfileInline != "FROM scratch" {
+		t.Errorf("expected the nested groups to be resolved once, got %+v", targets)
+	}
+
+	if _, err := file.resolve([]string{"missing"}); err == nil {
+		t.Error("expected an error for a missing target")
+	}
+}
+
+func TestReadBakeFileJSON(t *testing.T) {
+	path := writeTestBakeFile(t, "docker-bake.json", `{
+  "target": {
+    "app": {"context": ".", "tags": ["app:1.0"], "cache-to": ["type=registry,ref=app:cache"]}
+  }
+}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := readBakeFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	targets, err := file.resolve(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(targets) != 1 || targets[0].imageName() != "app:1.0" {
+		t.Fatalf("expected all targets without default group, got %+v", targets)
+	}
+	if _, err := targets[0].rawBuild(file.dir, "2", false); err == nil {
+		t.Error("expected an error for the registry cache")
+	}
+}
+
+func TestReadBakeFileInheritCycle(t *testing.T) {
+	path := writeTestBakeFile(t, "docker-bake.hcl", `
+target "a" {
+  inherits = ["b"]
+}
+
+target "b" {
+  inherits = ["a"]
+}
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := readBakeFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := file.resolve(nil); err == nil {
+		t.Error("expected an error for the inheritance cycle")
+	}
+}
+
+func TestReadBakeFileCompose(t *testing.T) {
+	path := writeTestBakeFile(t, "docker-compose.yml", `
+version: "3.8"
+services:
+  web:
+    image: example/web:1.0
+    build:
+      context: ./web
+      dockerfile: Dockerfile.web
+      args:
+        - MODE=release
+      target: prod
+      cache_from:
+        - example/web:latest
+  worker:
+    build: ./worker
+  db:
+    image: postgres
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	file, err := readBakeFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	targets, err := file.resolve(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(targets) != 2 || targets[0].Name != "web" || targets[1].Name != "worker" {
+		t.Fatalf("expected the services with a build section, got %+v", targets)
+	}
+
+	web, err := targets[0].rawBuild(file.dir, "", false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if targets[0].imageName() != "example/web:1.0" || web["path"] != filepath.Join(filepath.Dir(path), "web") ||
+		web["dockerfile"] != "Dockerfile.web" || web["target"] != "prod" ||
+		!reflect.DeepEqual(web["build_arg"], map[string]interface{}{"MODE": "release"}) ||
+		!reflect.DeepEqual(web["cache_from"], []interface{}{"example/web:latest"}) {
+		t.Errorf("unexpected build of web %v", web)
+	}
+
+	project := filepath.Base(filepath.Dir(path))
+	if name := targets[1].imageName(); name != project+"-worker" {
+		t.Errorf("expected the compose name of worker, got %s", name)
+	}
+}
@@ -0,0 +1,231 @@
+package docker
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/cli/cli/command/image/build"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/docker/docker/pkg/urlutil"
+	"github.com/docker/go-units"
+)
+
+// buildContextExcludes returns the patterns of the .dockerignore of the
+// context and the additional excludes of the build. The Dockerfile is never
+// excluded, as the daemon needs it.
+func buildContextExcludes(contextDir, dockerfile string, extraExcludes []string) ([]string, error) {
+	excludes, err := build.ReadDockerignore(contextDir)
+	if err != nil {
+		return nil, err
+	}
+	excludes = append(excludes, extraExcludes...)
+	return build.TrimBuildFilesFromExcludes(excludes, dockerfile, false), nil
+}
+
+// isRemoteBuildContext returns whether the context is a git repository or an
+// URL of a tarball which the daemon fetches, like 'docker build <url>'
+func isRemoteBuildContext(contextPath string) bool {
+	return urlutil.IsGitURL(contextPath) || urlutil.IsURL(contextPath)
+}
+
+// checkBuildContextEntry checks a file of the build context. It returns the
+// link target for symlinks and whether the file has to be skipped because it
+// cannot be sent to the daemon, e.g. sockets or devices. Relative symlinks
+// pointing outside of the context are an error, as the daemon cannot resolve
+// them. Absolute symlinks, e.g. to /etc/localtime, point into the image.
+func checkBuildContextEntry(contextDir, file string, info os.FileInfo) (string, bool, error) {
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(file)
+		if err != nil {
+			return "", false, err
+		}
+		if filepath.IsAbs(target) {
+			return target, false, nil
+		}
+		rel, err := filepath.Rel(contextDir, filepath.Join(filepath.Dir(file), target))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false, fmt.Errorf("symlink %s points to %s which is outside of the build context %s", file, target, contextDir)
+		}
+		return target, false, nil
+	case mode.IsRegular(), mode.IsDir():
+		return "", false, nil
+	default:
+		log.Printf("[WARN] Skipping %s of the build context: files of type %v are not supported", file, mode.Type())
+		return "", true, nil
+	}
+}
+
+// inspectBuildContext walks the build context without reading the files and
+// returns the size of the regular files which are not excluded
+func inspectBuildContext(contextDir string, excludes []string) (int64, error) {
+	contextDir, err := filepath.Abs(contextDir)
+	if err != nil {
+		return 0, err
+	}
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	err = filepath.Walk(contextDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("Unable to read build context: %s", err)
+		}
+		rel, err := filepath.Rel(contextDir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		if excluded, err := pm.Matches(rel); err != nil {
+			return err
+		} else if excluded {
+			if info.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, _, err := checkBuildContextEntry(contextDir, file, info); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// buildContextHashPrefix marks hashes of hashBuildContext. Hashes of earlier
+// versions also covered modification times and ignored files.
+const buildContextHashPrefix = "files:sha256:"
+
+// hashBuildContext hashes the paths, modes, link targets and contents of the
+// files of the build context which are not excluded by the .dockerignore
+// patterns. Modification times are ignored, so a fresh checkout of the same
+// sources has the same hash.
+func hashBuildContext(contextDir string, excludes []string) (string, error) {
+	contextDir, err := filepath.Abs(contextDir)
+	if err != nil {
+		return "", err
+	}
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	err = filepath.Walk(contextDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("Unable to read build context: %s", err)
+		}
+		rel, err := filepath.Rel(contextDir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		if excluded, err := pm.Matches(rel); err != nil {
+			return err
+		} else if excluded {
+			if info.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		link, skip, err := checkBuildContextEntry(contextDir, file, info)
+		if err != nil || skip {
+			return err
+		}
+
+		fmt.Fprintf(hasher, "%s\x00%o\x00%s\x00", filepath.ToSlash(rel), info.Mode(), link)
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(hasher, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return buildContextHashPrefix + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// warnOnLargeBuildContext logs a warning if the context is bigger than the
+// context_size_warning_threshold of the provider
+func warnOnLargeBuildContext(contextDir string, size, threshold int64) {
+	if threshold > 0 && size > threshold {
+		log.Printf("[WARN] The build context %s has a size of %s which exceeds %s. Consider excluding files with a .dockerignore file",
+			contextDir, units.HumanSize(float64(size)), units.HumanSize(float64(threshold)))
+	}
+}
+
+// buildContextProgressStep is the minimum amount of bytes between two
+// progress log messages of a build context upload
+const buildContextProgressStep = 64 * 1024 * 1024
+
+// progressReader logs the progress of a build context upload while it is
+// streamed to the daemon
+type progressReader struct {
+	reader io.Reader
+	name   string
+	total  int64
+	read   int64
+	next   int64
+	step   int64
+}
+
+func newProgressReader(reader io.Reader, name string, total int64) *progressReader {
+	step := total / 10
+	if step < buildContextProgressStep {
+		step = buildContextProgressStep
+	}
+	return &progressReader{reader: reader, name: name, total: total, next: step, step: step}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read >= r.next {
+		log.Printf("[INFO] Uploaded %s of %s of the build context %s",
+			units.HumanSize(float64(r.read)), units.HumanSize(float64(r.total)), r.name)
+		r.next = r.read + r.step
+	}
+	if err == io.EOF {
+		log.Printf("[DEBUG] Uploaded build context %s: %s", r.name, units.HumanSize(float64(r.read)))
+	}
+	return n, err
+}
+
+// inlineDockerfileName is the name of the dockerfile_contents of a build in
+// the build context
+const inlineDockerfileName = ".terraform.Dockerfile"
+
+// addDockerfileToBuildContext adds the inline Dockerfile contents to the
+// build context stream, replacing a file with the same name
+func addDockerfileToBuildContext(buildContext io.ReadCloser, contents string) io.ReadCloser {
+	return archive.ReplaceFileTarWrapper(buildContext, map[string]archive.TarModifierFunc{
+		inlineDockerfileName: func(_ string, _ *tar.Header, _ io.Reader) (*tar.Header, []byte, error) {
+			header := &tar.Header{
+				Name:     inlineDockerfileName,
+				Mode:     0600,
+				ModTime:  time.Now(),
+				Typeflag: tar.TypeReg,
+			}
+			return header, []byte(contents), nil
+		},
+	})
+}
@@ -0,0 +1,209 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBuildContextDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "docker-build-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(testDockerFileExample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "data", "big.bin"), make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data/big.bin", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestInspectBuildContext(t *testing.T) {
+	dir := testBuildContextDir(t)
+	defer os.RemoveAll(dir)
+
+	// sockets cannot be sent to the daemon and are skipped
+	listener, err := net.Listen("unix", filepath.Join(dir, "daemon.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	size, err := inspectBuildContext(dir, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if expected := int64(1024 + len(testDockerFileExample)); size != expected {
+		t.Errorf("expected a context size of %d, got %d", expected, size)
+	}
+
+	size, err = inspectBuildContext(dir, []string{"data"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if expected := int64(len(testDockerFileExample)); size != expected {
+		t.Errorf("expected a context size of %d with excludes, got %d", expected, size)
+	}
+
+	if err := os.Symlink("/etc/localtime", filepath.Join(dir, "data", "localtime")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inspectBuildContext(dir, nil); err != nil {
+		t.Fatalf("expected an absolute symlink to be kept, got %s", err)
+	}
+
+	if err := os.Symlink("../../etc/passwd", filepath.Join(dir, "data", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = inspectBuildContext(dir, nil)
+	if err == nil || !strings.Contains(err.Error(), "outside of the build context") {
+		t.Fatalf("expected a symlink escape error, got %v", err)
+	}
+	if _, err := buildDockerImageContextTar(dir); err == nil || !strings.Contains(err.Error(), "outside of the build context") {
+		t.Fatalf("expected a symlink escape error for the context tar, got %v", err)
+	}
+}
+
+func TestBuildDockerImageContextTar(t *testing.T) {
+	dir := testBuildContextDir(t)
+	defer os.RemoveAll(dir)
+
+	tarPath, err := buildDockerImageContextTar(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(tarPath)
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	links := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		links[header.Name] = header.Linkname
+	}
+	if target, ok := links["link"]; !ok || target != "data/big.bin" {
+		t.Errorf("expected the symlink to point to data/big.bin, got %q", target)
+	}
+	if _, ok := links[filepath.Join("data", "big.bin")]; !ok {
+		t.Errorf("expected data/big.bin in the context tar, got %v", links)
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	content := make([]byte, 3*buildContextProgressStep)
+	reader := newProgressReader(bytes.NewReader(content), "test", int64(len(content)))
+	n, err := io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != int64(len(content)) || reader.read != n {
+		t.Errorf("expected %d bytes to be read, got %d", len(content), reader.read)
+	}
+}
+
+func TestAddDockerfileToBuildContext(t *testing.T) {
+	dir := testBuildContextDir(t)
+	defer os.RemoveAll(dir)
+
+	buildContext, err := getBuildContext(dir, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	buildContext = addDockerfileToBuildContext(buildContext, "FROM alpine:3.11\n")
+	defer buildContext.Close()
+
+	tr := tar.NewReader(buildContext)
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+	if content := files[inlineDockerfileName]; content != "FROM alpine:3.11\n" {
+		t.Errorf("expected the inline Dockerfile in the context, got %q", content)
+	}
+	if _, ok := files["Dockerfile"]; !ok {
+		t.Errorf("expected the context to be kept, got %v", files)
+	}
+}
+
+func TestIsRemoteBuildContext(t *testing.T) {
+	cases := map[string]bool{
+		".":                                   false,
+		"/tmp/context":                        false,
+		"~/context":                           false,
+		"https://github.com/foo/bar.git#main": true,
+		"git@github.com:foo/bar.git":          true,
+		"github.com/foo/bar":                  true,
+		"https://example.com/context.tar.gz":  true,
+		"http://example.com/context.tar.gz":   true,
+	}
+	for contextPath, expected := range cases {
+		if remote := isRemoteBuildContext(contextPath); remote != expected {
+			t.Errorf("expected %v for %s, got %v", expected, contextPath, remote)
+		}
+	}
+}
+
+func TestHashBuildContext(t *testing.T) {
+	dir := testBuildContextDir(t)
+	defer os.RemoveAll(dir)
+
+	hash, err := hashBuildContext(dir, []string{"ignored"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(hash, buildContextHashPrefix) {
+		t.Errorf("expected the hash to start with %s, got %s", buildContextHashPrefix, hash)
+	}
+
+	// ignored files and modification times do not change the hash
+	if err := ioutil.WriteFile(filepath.Join(dir, "ignored"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "Dockerfile"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if unchanged, err := hashBuildContext(dir, []string{"ignored"}); err != nil || unchanged != hash {
+		t.Errorf("expected the hash to stay %s, got %s (%v)", hash, unchanged, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "data", "big.bin"), make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := hashBuildContext(dir, []string{"ignored"}); err != nil || changed == hash {
+		t.Errorf("expected the hash to change after a file changed, got %s (%v)", changed, err)
+	}
+}
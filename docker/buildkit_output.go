@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/pkg/archive"
+	homedir "github.com/mitchellh/go-homedir"
+	"google.golang.org/grpc"
+)
+
+const (
+	buildOutputTypeTar   = "tar"
+	buildOutputTypeLocal = "local"
+)
+
+// buildOutput is the output of the build block which writes the files of
+// the built image to disk
+type buildOutput struct {
+	Type string
+	Dest string
+}
+
+func buildOutputFromList(rawOutputs []interface{}) (*buildOutput, error) {
+	if len(rawOutputs) == 0 || rawOutputs[0] == nil {
+		return nil, nil
+	}
+	rawOutput := rawOutputs[0].(map[string]interface{})
+	dest, err := homedir.Expand(rawOutput["dest"].(string))
+	if err != nil {
+		return nil, err
+	}
+	return &buildOutput{
+		Type: rawOutput["type"].(string),
+		Dest: dest,
+	}, nil
+}
+
+// open returns the writer for the tar stream of the exported files. Local
+// outputs are extracted to the destination directory.
+func (o *buildOutput) open() (io.WriteCloser, func() error, error) {
+	if o.Type == buildOutputTypeTar {
+		if err := os.MkdirAll(filepath.Dir(o.Dest), 0755); err != nil {
+			return nil, nil, err
+		}
+		f, err := os.Create(o.Dest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, func() error { return nil }, nil
+	}
+
+	if err := os.MkdirAll(o.Dest, 0755); err != nil {
+		return nil, nil, err
+	}
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := archive.Untar(r, o.Dest, &archive.TarOptions{NoLchown: true})
+		r.CloseWithError(err)
+		done <- err
+	}()
+	return w, func() error { return <-done }, nil
+}
+
+type fileSendServer interface {
+	DiffCopy(grpc.ServerStream) error
+}
+
+// buildOutputServer receives the exported files of a build, which the daemon
+// sends as tar stream
+type buildOutputServer struct {
+	output *buildOutput
+}
+
+func (s *buildOutputServer) DiffCopy(stream grpc.ServerStream) error {
+	w, wait, err := s.output.open()
+	if err != nil {
+		return fmt.Errorf("Unable to write build output to %s: %s", s.output.Dest, err)
+	}
+	for {
+		msg := &bytesMessage{}
+		if err := stream.RecvMsg(msg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			w.Close()
+			return err
+		}
+		if _, err := w.Write(msg.Data); err != nil {
+			w.Close()
+			return fmt.Errorf("Unable to write build output to %s: %s", s.output.Dest, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := wait(); err != nil {
+		return fmt.Errorf("Unable to extract build output to %s: %s", s.output.Dest, err)
+	}
+	log.Printf("[DEBUG] Wrote build output to %s", s.output.Dest)
+	return nil
+}
+
+func diffCopyHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(fileSendServer).DiffCopy(stream)
+}
+
+var fileSendServiceDesc = grpc.ServiceDesc{
+	ServiceName: "moby.filesync.v1.FileSend",
+	HandlerType: (*fileSendServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DiffCopy",
+			Handler:       diffCopyHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "filesync.proto",
+}
+
+// addOutput receives the exported files of the build in the session
+func (s *buildSession) addOutput(output *buildOutput) {
+	if output == nil {
+		return
+	}
+	s.server.RegisterService(&fileSendServiceDesc, &buildOutputServer{output: output})
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"google.golang.org/grpc"
+)
+
+func testBuildOutputTar(t *testing.T) []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	content := []byte("built")
+	if err := tw.WriteHeader(&tar.Header{Name: "app/bin", Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(content)
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestBuildSessionOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tf-provider-docker-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exported := testBuildOutputTar(t)
+
+	for _, outputType := range []string{buildOutputTypeTar, buildOutputTypeLocal} {
+		output := &buildOutput{Type: outputType, Dest: filepath.Join(dir, outputType, "out")}
+
+		server, conns, headers := testDaemonSession(t)
+		cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(server.URL, "http://")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, err := newBuildSession(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.addOutput(output)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := session.start(ctx, cli); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		header := <-headers
+		method := "/moby.filesync.v1.FileSend/DiffCopy"
+		if !strings.Contains(strings.Join(header["X-Docker-Expose-Session-Grpc-Method"], ","), method) {
+			t.Errorf("expected method %s to be exposed, got %v", method, header["X-Docker-Expose-Session-Grpc-Method"])
+		}
+
+		// the daemon sends the exported tar stream in chunks
+		conn := <-conns
+		grpcConn, err := grpc.DialContext(ctx, "session", grpc.WithInsecure(), grpc.WithBlock(),
+			grpc.WithDialer(func(string, time.Duration) (net.Conn, error) { return conn, nil }))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		stream, err := grpcConn.NewStream(ctx, &fileSendServiceDesc.Streams[0], method)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		for i := 0; i < len(exported); i += 512 {
+			end := i + 512
+			if end > len(exported) {
+				end = len(exported)
+			}
+			if err := stream.SendMsg(&bytesMessage{Data: exported[i:end]}); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+		stream.CloseSend()
+		if err := stream.RecvMsg(&bytesMessage{}); err != io.EOF {
+			t.Errorf("expected the output of type %s to be written, got %v", outputType, err)
+		}
+
+		grpcConn.Close()
+		session.close()
+		cancel()
+		server.Close()
+
+		switch outputType {
+		case buildOutputTypeTar:
+			written, err := ioutil.ReadFile(output.Dest)
+			if err != nil || !bytes.Equal(written, exported) {
+				t.Errorf("expected the tarball to be written to %s, got %v", output.Dest, err)
+			}
+		case buildOutputTypeLocal:
+			content, err := ioutil.ReadFile(filepath.Join(output.Dest, "app", "bin"))
+			if err != nil || string(content) != "built" {
+				t.Errorf("expected the files to be extracted to %s, got %q (%v)", output.Dest, content, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// buildkitTraceID is the id of the messages which carry the BuildKit progress
+// of a build as protobuf encoded moby.buildkit.v1.StatusResponse
+const buildkitTraceID = "moby.buildkit.trace"
+
+// The following types are the subset of the BuildKit control API which is
+// needed to display the progress of a build
+
+type buildkitStatusResponse struct {
+	Vertexes []*buildkitVertex    `protobuf:"bytes,1,rep,name=vertexes,proto3" json:"vertexes,omitempty"`
+	Logs     []*buildkitVertexLog `protobuf:"bytes,3,rep,name=logs,proto3" json:"logs,omitempty"`
+}
+
+func (m *buildkitStatusResponse) Reset()         { *m = buildkitStatusResponse{} }
+func (m *buildkitStatusResponse) String() string { return proto.CompactTextString(m) }
+func (*buildkitStatusResponse) ProtoMessage()    {}
+
+type buildkitVertex struct {
+	Digest    string               `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"`
+	Name      string               `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Cached    bool                 `protobuf:"varint,4,opt,name=cached,proto3" json:"cached,omitempty"`
+	Started   *timestamp.Timestamp `protobuf:"bytes,5,opt,name=started,proto3" json:"started,omitempty"`
+	Completed *timestamp.Timestamp `protobuf:"bytes,6,opt,name=completed,proto3" json:"completed,omitempty"`
+	Error     string               `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (m *buildkitVertex) Reset()         { *m = buildkitVertex{} }
+func (m *buildkitVertex) String() string { return proto.CompactTextString(m) }
+func (*buildkitVertex) ProtoMessage()    {}
+
+type buildkitVertexLog struct {
+	Vertex string `protobuf:"bytes,1,opt,name=vertex,proto3" json:"vertex,omitempty"`
+	Msg    []byte `protobuf:"bytes,4,opt,name=msg,proto3" json:"msg,omitempty"`
+}
+
+func (m *buildkitVertexLog) Reset()         { *m = buildkitVertexLog{} }
+func (m *buildkitVertexLog) String() string { return proto.CompactTextString(m) }
+func (*buildkitVertexLog) ProtoMessage()    {}
+
+const (
+	buildkitProgressAuto  = "auto"
+	buildkitProgressPlain = "plain"
+	buildkitProgressTTY   = "tty"
+	buildkitProgressQuiet = "quiet"
+)
+
+// buildkitProgress renders the BuildKit trace messages of a build similar to
+// the progress output of the docker cli. The plain progress is rendered as the
+// messages arrive, the tty and quiet progress once the build finished.
+type buildkitProgress struct {
+	mode      string
+	indexes   map[string]int
+	started   map[string]bool
+	completed map[string]bool
+	vertexes  map[string]*buildkitVertex
+	logs      map[string][]string
+}
+
+func newBuildkitProgress(mode string) *buildkitProgress {
+	if mode == "" || mode == buildkitProgressAuto {
+		// terraform does not run the build in a terminal
+		mode = buildkitProgressPlain
+	}
+	return &buildkitProgress{
+		mode:      mode,
+		indexes:   make(map[string]int),
+		started:   make(map[string]bool),
+		completed: make(map[string]bool),
+		vertexes:  make(map[string]*buildkitVertex),
+		logs:      make(map[string][]string),
+	}
+}
+
+func (p *buildkitProgress) index(digest string) int {
+	if _, ok := p.indexes[digest]; !ok {
+		p.indexes[digest] = len(p.indexes) + 1
+	}
+	return p.indexes[digest]
+}
+
+// write decodes the aux value of a trace message and writes the plain
+// progress to buf
+func (p *buildkitProgress) write(buf *bytes.Buffer, aux json.RawMessage) error {
+	var encoded []byte
+	if err := json.Unmarshal(aux, &encoded); err != nil {
+		return fmt.Errorf("Problem decoding BuildKit trace: %s", err)
+	}
+	status := buildkitStatusResponse{}
+	if err := proto.Unmarshal(encoded, &status); err != nil {
+		return fmt.Errorf("Problem decoding BuildKit trace: %s", err)
+	}
+
+	for _, v := range status.Vertexes {
+		i := p.index(v.Digest)
+		p.vertexes[v.Digest] = v
+		if v.Started != nil && !p.started[v.Digest] {
+			p.started[v.Digest] = true
+			fmt.Fprintf(buf, "#%d %s\n", i, v.Name)
+		}
+		if v.Completed == nil || p.completed[v.Digest] {
+			continue
+		}
+		p.completed[v.Digest] = true
+		switch {
+		case v.Error != "":
+			fmt.Fprintf(buf, "#%d ERROR: %s\n", i, v.Error)
+		case v.Cached:
+			fmt.Fprintf(buf, "#%d CACHED\n", i)
+		default:
+			fmt.Fprintf(buf, "#%d DONE\n", i)
+		}
+	}
+	for _, l := range status.Logs {
+		i := p.index(l.Vertex)
+		for _, line := range strings.Split(strings.TrimRight(string(l.Msg), "\n"), "\n") {
+			p.logs[l.Vertex] = append(p.logs[l.Vertex], line)
+			fmt.Fprintf(buf, "#%d %s\n", i, line)
+		}
+	}
+	return nil
+}
+
+// plain returns whether the progress is rendered as the messages arrive
+func (p *buildkitProgress) plain() bool {
+	return p.mode == buildkitProgressPlain
+}
+
+// digests returns the digests of the vertexes in the order they appeared
+func (p *buildkitProgress) digests() []string {
+	digests := make([]string, len(p.indexes))
+	for digest, i := range p.indexes {
+		digests[i-1] = digest
+	}
+	return digests
+}
+
+// render writes the summary of the build for the tty progress and the
+// failed steps for the tty and quiet progress to buf
+func (p *buildkitProgress) render(buf *bytes.Buffer) {
+	if p.plain() {
+		return
+	}
+	digests := p.digests()
+
+	if p.mode == buildkitProgressTTY {
+		var first, last time.Time
+		completed, failed := 0, false
+		for _, digest := range digests {
+			v, ok := p.vertexes[digest]
+			if !ok {
+				continue
+			}
+			if v.Started != nil && (first.IsZero() || timestampTime(v.Started).Before(first)) {
+				first = timestampTime(v.Started)
+			}
+			if v.Completed != nil {
+				completed++
+				if timestampTime(v.Completed).After(last) {
+					last = timestampTime(v.Completed)
+				}
+			}
+			failed = failed || v.Error != ""
+		}
+		state := "FINISHED"
+		if failed {
+			state = "ERROR"
+		}
+		fmt.Fprintf(buf, "[+] Building %.1fs (%d/%d) %s\n", durationBetween(first, last).Seconds(), completed, len(p.vertexes), state)
+		for _, digest := range digests {
+			v, ok := p.vertexes[digest]
+			if !ok {
+				continue
+			}
+			prefix := ""
+			switch {
+			case v.Error != "":
+				prefix = "ERROR "
+			case v.Cached:
+				prefix = "CACHED "
+			}
+			duration := ""
+			if v.Started != nil && v.Completed != nil && !v.Cached {
+				duration = fmt.Sprintf(" %.1fs", durationBetween(timestampTime(v.Started), timestampTime(v.Completed)).Seconds())
+			}
+			fmt.Fprintf(buf, " => %s%s%s\n", prefix, v.Name, duration)
+		}
+	}
+
+	for _, digest := range digests {
+		v, ok := p.vertexes[digest]
+		if !ok || v.Error == "" {
+			continue
+		}
+		fmt.Fprintf(buf, "------\n > %s:\n", v.Name)
+		for _, line := range p.logs[digest] {
+			fmt.Fprintf(buf, "%s\n", line)
+		}
+		fmt.Fprintf(buf, "------\n%s\n", v.Error)
+	}
+}
+
+func timestampTime(t *timestamp.Timestamp) time.Time {
+	return time.Unix(t.Seconds, int64(t.Nanos)).UTC()
+}
+
+func durationBetween(start, end time.Time) time.Duration {
+	if start.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+func testBuildkitTraceMessage(t *testing.T, status *buildkitStatusResponse) string {
+	encoded, err := proto.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aux, _ := json.Marshal(encoded)
+	return fmt.Sprintf(`{"id":"moby.buildkit.trace","aux":%s}`, aux)
+}
+
+func TestDecodeBuildMessagesBuildkit(t *testing.T) {
+	now := &timestamp.Timestamp{Seconds: 1}
+	messages := strings.Join([]string{
+		testBuildkitTraceMessage(t, &buildkitStatusResponse{
+			Vertexes: []*buildkitVertex{
+				{Digest: "sha256:1", Name: "[1/2] FROM docker.io/library/alpine", Started: now},
+			},
+		}),
+		testBuildkitTraceMessage(t, &buildkitStatusResponse{
+			Vertexes: []*buildkitVertex{
+				{Digest: "sha256:1", Name: "[1/2] FROM docker.io/library/alpine", Started: now, Completed: now, Cached: true},
+				{Digest: "sha256:2", Name: "[2/2] RUN --mount=type=cache,target=/root echo hello", Started: now},
+			},
+			Logs: []*buildkitVertexLog{
+				{Vertex: "sha256:2", Msg: []byte("hello\n")},
+			},
+		}),
+		testBuildkitTraceMessage(t, &buildkitStatusResponse{
+			Vertexes: []*buildkitVertex{
+				{Digest: "sha256:2", Name: "[2/2] RUN --mount=type=cache,target=/root echo hello", Started: now, Completed: now},
+			},
+		}),
+		`{"aux":{"ID":"sha256:3333"},"id":"moby.image.id"}`,
+	}, "\n")
+
+	output, err := decodeBuildMessages(types.ImageBuildResponse{Body: ioutil.NopCloser(strings.NewReader(messages))}, "foo", "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := `#1 [1/2] FROM docker.io/library/alpine
+#1 CACHED
+#2 [2/2] RUN --mount=type=cache,target=/root echo hello
+#2 hello
+#2 DONE
+`
+	if output != expected {
+		t.Errorf("expected output\n%s\ngot\n%s", expected, output)
+	}
+}
+
+func TestDecodeBuildMessagesBuildkitProgress(t *testing.T) {
+	started := &timestamp.Timestamp{Seconds: 1}
+	completed := &timestamp.Timestamp{Seconds: 3, Nanos: 500000000}
+	messages := strings.Join([]string{
+		testBuildkitTraceMessage(t, &buildkitStatusResponse{
+			Vertexes: []*buildkitVertex{
+				{Digest: "sha256:1", Name: "[1/2] FROM docker.io/library/alpine", Started: started, Completed: started, Cached: true},
+				{Digest: "sha256:2", Name: "[2/2] RUN exit 1", Started: started},
+			},
+			Logs: []*buildkitVertexLog{
+				{Vertex: "sha256:2", Msg: []byte("failing\n")},
+			},
+		}),
+		testBuildkitTraceMessage(t, &buildkitStatusResponse{
+			Vertexes: []*buildkitVertex{
+				{Digest: "sha256:2", Name: "[2/2] RUN exit 1", Started: started, Completed: completed, Error: "exit code: 1"},
+			},
+		}),
+	}, "\n")
+
+	cases := map[string]string{
+		buildkitProgressTTY: `[+] Building 2.5s (2/2) ERROR
+ => CACHED [1/2] FROM docker.io/library/alpine
+ => ERROR [2/2] RUN exit 1 2.5s
+------
+ > [2/2] RUN exit 1:
+failing
+------
+exit code: 1
+`,
+		buildkitProgressQuiet: `------
+ > [2/2] RUN exit 1:
+failing
+------
+exit code: 1
+`,
+	}
+	for mode, expected := range cases {
+		output, err := decodeBuildMessages(types.ImageBuildResponse{Body: ioutil.NopCloser(strings.NewReader(messages))}, "foo", mode)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if output != expected {
+			t.Errorf("expected %s output\n%s\ngot\n%s", mode, expected, output)
+		}
+	}
+}
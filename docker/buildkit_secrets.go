@@ -0,0 +1,128 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	homedir "github.com/mitchellh/go-homedir"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// buildSecret is a secret of the build block which is exposed to RUN
+// instructions with --mount=type=secret,id=<id>
+type buildSecret struct {
+	ID  string
+	Src string
+	Env string
+}
+
+func buildSecretsFromList(rawSecrets []interface{}) ([]buildSecret, error) {
+	secrets := make([]buildSecret, 0, len(rawSecrets))
+	for _, rawSecret := range rawSecrets {
+		rawSecret := rawSecret.(map[string]interface{})
+		secret := buildSecret{
+			ID:  rawSecret["id"].(string),
+			Src: rawSecret["src"].(string),
+			Env: rawSecret["env"].(string),
+		}
+		if (secret.Src == "") == (secret.Env == "") {
+			return nil, fmt.Errorf("Exactly one of src or env has to be set for build secret '%s'", secret.ID)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// value reads the secret when the daemon requests it, so it is never stored
+func (s buildSecret) value() ([]byte, error) {
+	if s.Env != "" {
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s of build secret '%s' is not set", s.Env, s.ID)
+		}
+		return []byte(value), nil
+	}
+	src, err := homedir.Expand(s.Src)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(src)
+}
+
+// The following types are the moby.buildkit.secrets.v1 API
+
+type getSecretRequest struct {
+	ID          string            `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	Annotations map[string]string `protobuf:"bytes,2,rep,name=annotations,proto3" json:"annotations,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *getSecretRequest) Reset()         { *m = getSecretRequest{} }
+func (m *getSecretRequest) String() string { return proto.CompactTextString(m) }
+func (*getSecretRequest) ProtoMessage()    {}
+
+type getSecretResponse struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *getSecretResponse) Reset()         { *m = getSecretResponse{} }
+func (m *getSecretResponse) String() string { return "data:<redacted>" }
+func (*getSecretResponse) ProtoMessage()    {}
+
+type secretsServer interface {
+	GetSecret(context.Context, *getSecretRequest) (*getSecretResponse, error)
+}
+
+// buildSecretsServer serves the secrets of a build to the daemon
+type buildSecretsServer struct {
+	secrets map[string]buildSecret
+}
+
+func (s *buildSecretsServer) GetSecret(ctx context.Context, req *getSecretRequest) (*getSecretResponse, error) {
+	secret, ok := s.secrets[req.ID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.ID)
+	}
+	data, err := secret.value()
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "%s", err)
+	}
+	return &getSecretResponse{Data: data}, nil
+}
+
+func getSecretHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(getSecretRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	return srv.(secretsServer).GetSecret(ctx, req)
+}
+
+var secretsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "moby.buildkit.secrets.v1.Secrets",
+	HandlerType: (*secretsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSecret",
+			Handler:    getSecretHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "secrets.proto",
+}
+
+// addSecrets serves the given secrets in the session
+func (s *buildSession) addSecrets(secrets []buildSecret) {
+	if len(secrets) == 0 {
+		return
+	}
+	server := &buildSecretsServer{secrets: make(map[string]buildSecret, len(secrets))}
+	for _, secret := range secrets {
+		server.secrets[secret.ID] = secret
+	}
+	s.server.RegisterService(&secretsServiceDesc, server)
+}
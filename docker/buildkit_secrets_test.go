@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBuildSecretsFromList(t *testing.T) {
+	secrets, err := buildSecretsFromList([]interface{}{
+		map[string]interface{}{"id": "token", "src": "", "env": "TOKEN"},
+		map[string]interface{}{"id": "npmrc", "src": "~/.npmrc", "env": ""},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []buildSecret{{ID: "token", Env: "TOKEN"}, {ID: "npmrc", Src: "~/.npmrc"}}
+	if !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("expected %v, got %v", expected, secrets)
+	}
+
+	for _, raw := range []map[string]interface{}{
+		{"id": "none", "src": "", "env": ""},
+		{"id": "both", "src": "/tmp/secret", "env": "TOKEN"},
+	} {
+		if _, err := buildSecretsFromList([]interface{}{raw}); err == nil {
+			t.Errorf("expected an error for secret %s", raw["id"])
+		}
+	}
+}
+
+func TestBuildSessionSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tf-provider-docker-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(src, []byte("file-secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TF_DOCKER_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("TF_DOCKER_TEST_SECRET")
+
+	server, conns, headers := testDaemonSession(t)
+	defer server.Close()
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(server.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := newBuildSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.addSecrets([]buildSecret{
+		{ID: "file", Src: src},
+		{ID: "env", Env: "TF_DOCKER_TEST_SECRET"},
+		{ID: "unset", Env: "TF_DOCKER_TEST_SECRET_UNSET"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := session.start(ctx, cli); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer session.close()
+
+	header := <-headers
+	method := "/moby.buildkit.secrets.v1.Secrets/GetSecret"
+	if !strings.Contains(strings.Join(header["X-Docker-Expose-Session-Grpc-Method"], ","), method) {
+		t.Errorf("expected method %s to be exposed, got %v", method, header["X-Docker-Expose-Session-Grpc-Method"])
+	}
+
+	conn := <-conns
+	grpcConn, err := grpc.DialContext(ctx, "session", grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) { return conn, nil }))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer grpcConn.Close()
+
+	for id, expected := range map[string]string{"file": "file-secret", "env": "env-secret"} {
+		resp := &getSecretResponse{}
+		if err := grpcConn.Invoke(ctx, method, &getSecretRequest{ID: id}, resp); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(resp.Data) != expected {
+			t.Errorf("expected secret %s to be %q, got %q", id, expected, resp.Data)
+		}
+	}
+
+	for _, id := range []string{"unset", "missing"} {
+		err := grpcConn.Invoke(ctx, method, &getSecretRequest{ID: id}, &getSecretResponse{})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("expected secret %s to be not found, got %v", id, err)
+		}
+	}
+}
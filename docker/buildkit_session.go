@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// buildSession is the client side of a BuildKit session. The daemon connects
+// to the gRPC services of the session over a hijacked /session connection,
+// e.g. to check its health or to fetch secrets during the build.
+type buildSession struct {
+	id        string
+	name      string
+	sharedKey string
+	server    *grpc.Server
+	conn      net.Conn
+	done      chan struct{}
+}
+
+// newBuildSession creates a session with the health service which the daemon
+// requires. Further services have to be registered on session.server before
+// the session is started.
+func newBuildSession(sharedKey string) (*buildSession, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("Unable to create build session id: %s", err)
+	}
+
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+
+	return &buildSession{
+		id:        hex.EncodeToString(id),
+		name:      "terraform-provider-docker",
+		sharedKey: sharedKey,
+		server:    server,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// methods returns the full names of the gRPC methods the session serves
+func (s *buildSession) methods() []string {
+	methods := []string{}
+	for service, info := range s.server.GetServiceInfo() {
+		for _, method := range info.Methods {
+			methods = append(methods, "/"+service+"/"+method.Name)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// start attaches the session to the daemon and serves it in the background
+// until close is called
+func (s *buildSession) start(ctx context.Context, client *client.Client) error {
+	headers := map[string][]string{
+		"X-Docker-Expose-Session-Uuid":        {s.id},
+		"X-Docker-Expose-Session-Name":        {s.name},
+		"X-Docker-Expose-Session-Sharedkey":   {s.sharedKey},
+		"X-Docker-Expose-Session-Grpc-Method": s.methods(),
+	}
+
+	conn, err := client.DialHijack(ctx, "/session", "h2c", headers)
+	if err != nil {
+		return fmt.Errorf("Unable to start BuildKit session: %s", err)
+	}
+	s.conn = conn
+	log.Printf("[DEBUG] Started BuildKit session %s with methods %v", s.id, s.methods())
+
+	go func() {
+		defer close(s.done)
+		// the daemon is the HTTP/2 client of the hijacked connection
+		(&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{
+			Handler: http.Handler(s.server),
+		})
+	}()
+	return nil
+}
+
+// close stops serving the session and detaches it from the daemon
+func (s *buildSession) close() {
+	s.server.Stop()
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	<-s.done
+	log.Printf("[DEBUG] Closed BuildKit session %s", s.id)
+}
@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testDaemonSession accepts a session like the daemon does and returns the
+// hijacked connection together with the headers of the request
+func testDaemonSession(t *testing.T) (*httptest.Server, chan net.Conn, chan http.Header) {
+	conns := make(chan net.Conn, 1)
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/session") || r.Header.Get("Upgrade") != "h2c" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %s", err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"))
+		headers <- r.Header
+		conns <- conn
+	}))
+	return server, conns, headers
+}
+
+func TestBuildSession(t *testing.T) {
+	server, conns, headers := testDaemonSession(t)
+	defer server.Close()
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(server.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := newBuildSession("/tmp/context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := session.start(ctx, cli); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer session.close()
+
+	header := <-headers
+	if header.Get("X-Docker-Expose-Session-Uuid") != session.id {
+		t.Errorf("expected session id %s, got %s", session.id, header.Get("X-Docker-Expose-Session-Uuid"))
+	}
+	if header.Get("X-Docker-Expose-Session-Sharedkey") != "/tmp/context" {
+		t.Errorf("expected shared key /tmp/context, got %s", header.Get("X-Docker-Expose-Session-Sharedkey"))
+	}
+	expectedMethods := []string{"/grpc.health.v1.Health/Check", "/grpc.health.v1.Health/Watch"}
+	if methods := header["X-Docker-Expose-Session-Grpc-Method"]; !reflect.DeepEqual(methods, expectedMethods) {
+		t.Errorf("expected methods %v, got %v", expectedMethods, methods)
+	}
+
+	// the daemon acts as gRPC client of the session
+	conn := <-conns
+	grpcConn, err := grpc.DialContext(ctx, "session", grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) { return conn, nil }))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer grpcConn.Close()
+
+	resp, err := grpc_health_v1.NewHealthClient(grpcConn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("expected session to be serving, got %v", resp.Status)
+	}
+}
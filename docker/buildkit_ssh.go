@@ -0,0 +1,201 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	homedir "github.com/mitchellh/go-homedir"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// buildSSHDefaultID is the id used by RUN --mount=type=ssh without an id
+const buildSSHDefaultID = "default"
+
+// buildSSHIDKey is the metadata key of ForwardAgent carrying the id
+const buildSSHIDKey = "buildkit.ssh.id"
+
+// buildSSH is an SSH agent of the build block which is forwarded to RUN
+// instructions with --mount=type=ssh,id=<id>
+type buildSSH struct {
+	ID     string
+	Socket string
+}
+
+func buildSSHFromList(rawSSHs []interface{}) ([]buildSSH, error) {
+	sshs := make([]buildSSH, 0, len(rawSSHs))
+	for _, rawSSH := range rawSSHs {
+		rawSSH := rawSSH.(map[string]interface{})
+		ssh := buildSSH{
+			ID:     rawSSH["id"].(string),
+			Socket: rawSSH["socket"].(string),
+		}
+		if ssh.Socket == "" {
+			ssh.Socket = os.Getenv("SSH_AUTH_SOCK")
+			if ssh.Socket == "" {
+				return nil, fmt.Errorf("No socket is set for build ssh '%s' and SSH_AUTH_SOCK is not set", ssh.ID)
+			}
+		}
+		socket, err := homedir.Expand(ssh.Socket)
+		if err != nil {
+			return nil, err
+		}
+		ssh.Socket = socket
+		sshs = append(sshs, ssh)
+	}
+	return sshs, nil
+}
+
+// The following types are the moby.sshforward.v1 API
+
+type checkAgentRequest struct {
+	ID string `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+}
+
+func (m *checkAgentRequest) Reset()         { *m = checkAgentRequest{} }
+func (m *checkAgentRequest) String() string { return proto.CompactTextString(m) }
+func (*checkAgentRequest) ProtoMessage()    {}
+
+type checkAgentResponse struct{}
+
+func (m *checkAgentResponse) Reset()         { *m = checkAgentResponse{} }
+func (m *checkAgentResponse) String() string { return proto.CompactTextString(m) }
+func (*checkAgentResponse) ProtoMessage()    {}
+
+type bytesMessage struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *bytesMessage) Reset()         { *m = bytesMessage{} }
+func (m *bytesMessage) String() string { return proto.CompactTextString(m) }
+func (*bytesMessage) ProtoMessage()    {}
+
+type sshServer interface {
+	CheckAgent(context.Context, *checkAgentRequest) (*checkAgentResponse, error)
+	ForwardAgent(grpc.ServerStream) error
+}
+
+// buildSSHServer forwards the SSH agents of a build to the daemon
+type buildSSHServer struct {
+	sockets map[string]string
+}
+
+func (s *buildSSHServer) socket(id string) (string, error) {
+	if id == "" {
+		id = buildSSHDefaultID
+	}
+	socket, ok := s.sockets[id]
+	if !ok {
+		return "", status.Errorf(codes.NotFound, "unset ssh forward key %s", id)
+	}
+	return socket, nil
+}
+
+func (s *buildSSHServer) CheckAgent(ctx context.Context, req *checkAgentRequest) (*checkAgentResponse, error) {
+	socket, err := s.socket(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return nil, status.Errorf(codes.NotFound, "ssh agent socket of %s: %s", req.ID, err)
+	}
+	return &checkAgentResponse{}, nil
+}
+
+// ForwardAgent proxies the agent protocol between the stream and the socket
+func (s *buildSSHServer) ForwardAgent(stream grpc.ServerStream) error {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		if v := md.Get(buildSSHIDKey); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	socket, err := s.socket(id)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to connect to ssh agent of %s: %s", id, err)
+	}
+	defer conn.Close()
+
+	go func() {
+		for {
+			msg := &bytesMessage{}
+			if err := stream.RecvMsg(msg); err != nil {
+				conn.(*net.UnixConn).CloseWrite()
+				return
+			}
+			if _, err := conn.Write(msg.Data); err != nil {
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if err := stream.SendMsg(&bytesMessage{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func checkAgentHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(checkAgentRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	return srv.(sshServer).CheckAgent(ctx, req)
+}
+
+func forwardAgentHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(sshServer).ForwardAgent(stream)
+}
+
+var sshServiceDesc = grpc.ServiceDesc{
+	ServiceName: "moby.sshforward.v1.SSH",
+	HandlerType: (*sshServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckAgent",
+			Handler:    checkAgentHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ForwardAgent",
+			Handler:       forwardAgentHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ssh.proto",
+}
+
+// addSSH forwards the given SSH agents in the session
+func (s *buildSession) addSSH(sshs []buildSSH) {
+	if len(sshs) == 0 {
+		return
+	}
+	server := &buildSSHServer{sockets: make(map[string]string, len(sshs))}
+	for _, ssh := range sshs {
+		server.sockets[ssh.ID] = ssh.Socket
+	}
+	s.server.RegisterService(&sshServiceDesc, server)
+}
@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBuildSSHFromList(t *testing.T) {
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+
+	sshs, err := buildSSHFromList([]interface{}{
+		map[string]interface{}{"id": "default", "socket": ""},
+		map[string]interface{}{"id": "github", "socket": "/tmp/github.sock"},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(sshs) != 2 || sshs[0].Socket != "/tmp/agent.sock" || sshs[1].Socket != "/tmp/github.sock" {
+		t.Errorf("unexpected sockets %v", sshs)
+	}
+
+	os.Unsetenv("SSH_AUTH_SOCK")
+	if _, err := buildSSHFromList([]interface{}{map[string]interface{}{"id": "default", "socket": ""}}); err == nil {
+		t.Error("expected an error without SSH_AUTH_SOCK")
+	}
+}
+
+func TestBuildSessionSSH(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tf-provider-docker-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the fake agent echoes the requests
+	socket := filepath.Join(dir, "agent.sock")
+	agent, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	go func() {
+		for {
+			conn, err := agent.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	server, conns, headers := testDaemonSession(t)
+	defer server.Close()
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(server.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := newBuildSession(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.addSSH([]buildSSH{{ID: "default", Socket: socket}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := session.start(ctx, cli); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer session.close()
+
+	header := <-headers
+	methods := strings.Join(header["X-Docker-Expose-Session-Grpc-Method"], ",")
+	for _, method := range []string{"/moby.sshforward.v1.SSH/CheckAgent", "/moby.sshforward.v1.SSH/ForwardAgent"} {
+		if !strings.Contains(methods, method) {
+			t.Errorf("expected method %s to be exposed, got %s", method, methods)
+		}
+	}
+
+	conn := <-conns
+	grpcConn, err := grpc.DialContext(ctx, "session", grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) { return conn, nil }))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer grpcConn.Close()
+
+	if err := grpcConn.Invoke(ctx, "/moby.sshforward.v1.SSH/CheckAgent", &checkAgentRequest{}, &checkAgentResponse{}); err != nil {
+		t.Errorf("expected default agent to be available, got %s", err)
+	}
+	err = grpcConn.Invoke(ctx, "/moby.sshforward.v1.SSH/CheckAgent", &checkAgentRequest{ID: "missing"}, &checkAgentResponse{})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected agent missing to be not found, got %v", err)
+	}
+
+	streamCtx := metadata.AppendToOutgoingContext(ctx, buildSSHIDKey, "default")
+	stream, err := grpcConn.NewStream(streamCtx, &sshServiceDesc.Streams[0], "/moby.sshforward.v1.SSH/ForwardAgent")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := stream.SendMsg(&bytesMessage{Data: []byte("ping")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	msg := &bytesMessage{}
+	if err := stream.RecvMsg(msg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(msg.Data) != "ping" {
+		t.Errorf("expected the agent to answer ping, got %q", msg.Data)
+	}
+	stream.CloseSend()
+}
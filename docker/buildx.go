@@ -0,0 +1,268 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/mitchellh/go-homedir"
+)
+
+// defaultBuildxCommand runs buildx as a plugin of the docker CLI, the
+// arguments of the build are appended
+var defaultBuildxCommand = []string{"docker", "buildx"}
+
+// buildxUnsupportedOptions are the options of the build block which buildx
+// has no flag for
+var buildxUnsupportedOptions = []string{"excludes", "platforms", "output", "cpu_shares", "cpu_quota", "cpu_period", "memory", "memory_swap", "isolation"}
+
+// buildxBuilder runs the builds of a build block with a builder block
+type buildxBuilder struct {
+	command []string
+	// name is the name of the buildx builder, the one created for an
+	// endpoint if it is not set in the builder block
+	name     string
+	endpoint string
+}
+
+func buildxBuilderFromList(rawBuilders []interface{}) (*buildxBuilder, error) {
+	if len(rawBuilders) == 0 || rawBuilders[0] == nil {
+		return nil, nil
+	}
+	rawBuilder := rawBuilders[0].(map[string]interface{})
+	builder := &buildxBuilder{
+		command:  stringListToStringSlice(rawBuilder["command"].([]interface{})),
+		name:     rawBuilder["name"].(string),
+		endpoint: rawBuilder["endpoint"].(string),
+	}
+	if (builder.name == "") == (builder.endpoint == "") {
+		return nil, fmt.Errorf("Exactly one of name or endpoint has to be set for the builder")
+	}
+	if len(builder.command) == 0 {
+		builder.command = defaultBuildxCommand
+	}
+	if builder.endpoint != "" {
+		builder.name = buildxEndpointBuilderName(builder.endpoint)
+	}
+	return builder, nil
+}
+
+// buildxEndpointBuilderName is the name of the buildx builder the provider
+// creates for the endpoint, so all builds for the endpoint share it and its
+// cache
+func buildxEndpointBuilderName(endpoint string) string {
+	hash := sha256.Sum256([]byte(endpoint))
+	return "terraform-" + hex.EncodeToString(hash[:])[:12]
+}
+
+// run runs buildx with the arguments and writes its output to output. The
+// output is part of the error if output is nil.
+func (b *buildxBuilder) run(ctx context.Context, output io.Writer, args ...string) error {
+	args = append(append([]string{}, b.command[1:]...), args...)
+	log.Printf("[DEBUG] Running %s %s", b.command[0], strings.Join(args, " "))
+	var combined bytes.Buffer
+	if output == nil {
+		output = &combined
+	}
+	cmd := exec.CommandContext(ctx, b.command[0], args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		if combined.Len() > 0 {
+			return fmt.Errorf("%s\n\n%s", err, combined.String())
+		}
+		return err
+	}
+	return nil
+}
+
+// ensure creates the builder of an endpoint if it does not exist yet. A
+// tcp:// endpoint is a BuildKit daemon, which the remote driver connects to,
+// and an ssh:// endpoint a Docker host, on which the docker-container
+// driver runs BuildKit.
+func (b *buildxBuilder) ensure(ctx context.Context) error {
+	if b.endpoint == "" {
+		return nil
+	}
+	if err := b.run(ctx, ioutil.Discard, "inspect", b.name); err == nil {
+		return nil
+	}
+	driver := "remote"
+	if strings.HasPrefix(b.endpoint, "ssh://") {
+		driver = "docker-container"
+	}
+	log.Printf("[INFO] Creating the buildx builder %s for %s", b.name, b.endpoint)
+	if err := b.run(ctx, nil, "create", "--name", b.name, "--driver", driver, b.endpoint); err != nil {
+		return fmt.Errorf("Unable to create a buildx builder for %s: %s", b.endpoint, err)
+	}
+	return nil
+}
+
+// buildArgs returns the arguments of 'docker buildx build' for the build,
+// which writes the image as a 'docker save' archive to dest. Secrets are
+// passed by their file or environment variable, buildx reads them itself.
+func (b *buildxBuilder) buildArgs(rawBuild map[string]interface{}, imageName, dockerfilePath, dest string) ([]string, error) {
+	for _, option := range buildxUnsupportedOptions {
+		if isSetBuildOption(rawBuild[option]) {
+			return nil, fmt.Errorf("Build %s is not supported with a builder", option)
+		}
+	}
+
+	args := []string{"build", "--builder", b.name, "--progress", "plain", "--output", "type=docker,dest=" + dest}
+	if dockerfilePath != "" {
+		args = append(args, "--file", dockerfilePath)
+	}
+	for _, tag := range append([]string{imageName}, stringListToStringSlice(rawBuild["tag"].([]interface{}))...) {
+		args = append(args, "--tag", tag)
+	}
+	for _, k := range sortedMapKeys(rawBuild["build_arg"].(map[string]interface{})) {
+		args = append(args, "--build-arg", k+"="+rawBuild["build_arg"].(map[string]interface{})[k].(string))
+	}
+	for _, k := range sortedMapKeys(rawBuild["label"].(map[string]interface{})) {
+		args = append(args, "--label", k+"="+rawBuild["label"].(map[string]interface{})[k].(string))
+	}
+	if target := rawBuild["target"].(string); target != "" {
+		args = append(args, "--target", target)
+	}
+	if platform := rawBuild["platform"].(string); platform != "" {
+		args = append(args, "--platform", platform)
+	}
+	if rawBuild["no_cache"].(bool) {
+		args = append(args, "--no-cache")
+	}
+	if rawBuild["pull_parent"].(bool) {
+		args = append(args, "--pull")
+	}
+	if networkMode := rawBuild["network_mode"].(string); networkMode != "" {
+		args = append(args, "--network", networkMode)
+	}
+	for _, host := range stringListToStringSlice(rawBuild["extra_hosts"].([]interface{})) {
+		args = append(args, "--add-host", host)
+	}
+	if shmSize := rawBuild["shm_size"].(int); shmSize > 0 {
+		args = append(args, "--shm-size", fmt.Sprintf("%d", shmSize))
+	}
+	if cgroupParent := rawBuild["cgroup_parent"].(string); cgroupParent != "" {
+		args = append(args, "--cgroup-parent", cgroupParent)
+	}
+	for _, cacheFrom := range stringListToStringSlice(rawBuild["cache_from"].([]interface{})) {
+		args = append(args, "--cache-from", cacheFrom)
+	}
+	if rawBuild["cache_to"].(string) != "" {
+		args = append(args, "--cache-to", "type=inline")
+	}
+
+	secrets, err := buildSecretsFromList(rawBuild["secrets"].([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		if secret.Src != "" {
+			src, _ := homedir.Expand(secret.Src)
+			args = append(args, "--secret", "id="+secret.ID+",src="+src)
+		} else {
+			args = append(args, "--secret", "id="+secret.ID+",env="+secret.Env)
+		}
+	}
+	sshs, err := buildSSHFromList(rawBuild["ssh"].([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	for _, ssh := range sshs {
+		id := ssh.ID
+		if id == "" {
+			id = buildSSHDefaultID
+		}
+		args = append(args, "--ssh", id+"="+ssh.Socket)
+	}
+
+	contextDir := rawBuild["path"].(string)
+	if !isRemoteBuildContext(contextDir) {
+		contextDir, _ = homedir.Expand(contextDir)
+	}
+	return append(args, contextDir), nil
+}
+
+// isSetBuildOption returns true if the value of the build option is not the
+// zero value of its type
+func isSetBuildOption(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v != ""
+	case int:
+		return v != 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// build builds the image with the builder and loads it into the daemon of
+// the provider. It returns the output of buildx.
+func (b *buildxBuilder) build(ctx context.Context, rawBuild map[string]interface{}, imageName string, client *client.Client, operations *operationLimit) (string, error) {
+	dir, err := ioutil.TempDir("", "docker-buildx")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	// buildx reads the Dockerfile relative to the working directory, not to
+	// the context, and also from outside of the context
+	dockerfilePath := ""
+	if contents := rawBuild["dockerfile_contents"].(string); contents != "" {
+		dockerfilePath = filepath.Join(dir, inlineDockerfileName)
+		if err := ioutil.WriteFile(dockerfilePath, []byte(contents), 0600); err != nil {
+			return "", err
+		}
+	} else if dockerfile := rawBuild["dockerfile"].(string); dockerfile != "" && !isRemoteBuildContext(rawBuild["path"].(string)) {
+		contextDir, _ := homedir.Expand(rawBuild["path"].(string))
+		dockerfilePath = filepath.Join(contextDir, dockerfile)
+	}
+
+	archivePath := filepath.Join(dir, "image.tar")
+	args, err := b.buildArgs(rawBuild, imageName, dockerfilePath, archivePath)
+	if err != nil {
+		return "", err
+	}
+	if err := b.ensure(ctx); err != nil {
+		return "", err
+	}
+
+	release, err := operations.acquire(ctx, "build of "+imageName)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	log.Printf("[INFO] Building image %s with the buildx builder %s", imageName, b.name)
+	var output bytes.Buffer
+	logWriter := newBuildLogWriter(imageName)
+	defer logWriter.Flush()
+	if err := b.run(ctx, io.MultiWriter(&output, logWriter), args...); err != nil {
+		return output.String(), fmt.Errorf("Unable to build image %s with the builder %s: %s", imageName, b.name, err)
+	}
+	if err := loadImageFile(ctx, client, archivePath); err != nil {
+		return output.String(), err
+	}
+	return output.String(), nil
+}
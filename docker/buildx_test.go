@@ -0,0 +1,138 @@
+package docker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func testBuildxRawBuild(t *testing.T, rawBuild map[string]interface{}) map[string]interface{} {
+	d := schema.TestResourceDataRaw(t, resourceDockerImage().Schema, map[string]interface{}{
+		"name":  "foo:1.0",
+		"build": []interface{}{rawBuild},
+	})
+	return d.Get("build").(*schema.Set).List()[0].(map[string]interface{})
+}
+
+func TestBuildxBuilderFromList(t *testing.T) {
+	if builder, err := buildxBuilderFromList(nil); builder != nil || err != nil {
+		t.Errorf("expected no builder without a builder block, got %v, %v", builder, err)
+	}
+
+	builder, err := buildxBuilderFromList([]interface{}{map[string]interface{}{"name": "ci", "endpoint": "", "command": []interface{}{}}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if builder.name != "ci" || !reflect.DeepEqual(builder.command, defaultBuildxCommand) {
+		t.Errorf("expected the named builder run by docker buildx, got %+v", builder)
+	}
+
+	builder, err = buildxBuilderFromList([]interface{}{map[string]interface{}{"name": "", "endpoint": "tcp://buildkitd:1234", "command": []interface{}{"buildx"}}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if builder.name != buildxEndpointBuilderName("tcp://buildkitd:1234") || !strings.HasPrefix(builder.name, "terraform-") {
+		t.Errorf("expected the builder of the endpoint, got %s", builder.name)
+	}
+
+	if _, err := buildxBuilderFromList([]interface{}{map[string]interface{}{"name": "ci", "endpoint": "tcp://buildkitd:1234", "command": []interface{}{}}}); err == nil {
+		t.Error("expected an error for a builder with a name and an endpoint")
+	}
+}
+
+func TestBuildxBuildArgs(t *testing.T) {
+	builder := &buildxBuilder{command: defaultBuildxCommand, name: "ci"}
+	rawBuild := testBuildxRawBuild(t, map[string]interface{}{
+		"path":        "/src",
+		"tag":         []interface{}{"foo:stable"},
+		"build_arg":   map[string]interface{}{"B": "2", "A": "1"},
+		"target":      "release",
+		"no_cache":    true,
+		"extra_hosts": []interface{}{"registry:10.0.0.1"},
+		"cache_to":    "inline",
+		"secrets": []interface{}{
+			map[string]interface{}{"id": "npmrc", "env": "NPM_TOKEN"},
+		},
+	})
+	args, err := builder.buildArgs(rawBuild, "foo:1.0", "/src/Dockerfile", "/tmp/image.tar")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{
+		"build", "--builder", "ci", "--progress", "plain", "--output", "type=docker,dest=/tmp/image.tar",
+		"--file", "/src/Dockerfile", "--tag", "foo:1.0", "--tag", "foo:stable",
+		"--build-arg", "A=1", "--build-arg", "B=2", "--target", "release", "--no-cache",
+		"--add-host", "registry:10.0.0.1", "--cache-to", "type=inline", "--secret", "id=npmrc,env=NPM_TOKEN", "/src",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	rawBuild = testBuildxRawBuild(t, map[string]interface{}{
+		"path":      "/src",
+		"platforms": []interface{}{"linux/amd64", "linux/arm64"},
+	})
+	if _, err := builder.buildArgs(rawBuild, "foo:1.0", "", "/tmp/image.tar"); err == nil || !strings.Contains(err.Error(), "platforms is not supported") {
+		t.Errorf("expected an error for platforms, got %v", err)
+	}
+}
+
+func TestBuildxBuilderBuild(t *testing.T) {
+	dir := testBuildContextDir(t)
+	defer os.RemoveAll(dir)
+	calls := filepath.Join(dir, "calls")
+
+	loaded := ""
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/images/load") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		loaded = string(body)
+		w.Write([]byte(`{"stream":"Loaded image: foo:1.0\n"}`))
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the arguments are appended to the script, sh passes them as $0 and $@.
+	// The builder of the endpoint does not exist, the build writes the
+	// archive to the dest of the output.
+	script := `echo "$0" >> ` + calls + `
+case "$0" in
+inspect) exit 1 ;;
+build) echo "#1 DONE"; for arg in "$@"; do case "$arg" in type=docker,dest=*) echo image-tarball > "${arg#type=docker,dest=}" ;; esac; done ;;
+esac`
+	builder := &buildxBuilder{command: []string{"sh", "-c", script}, endpoint: "tcp://buildkitd:1234", name: buildxEndpointBuilderName("tcp://buildkitd:1234")}
+	rawBuild := testBuildxRawBuild(t, map[string]interface{}{"path": dir})
+
+	output, err := builder.build(context.Background(), rawBuild, "foo:1.0", cli, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(output, "#1 DONE") {
+		t.Errorf("expected the output of buildx, got %q", output)
+	}
+	if loaded != "image-tarball\n" {
+		t.Errorf("expected the archive of the build to be loaded, got %q", loaded)
+	}
+	called, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(called) != "inspect\ncreate\nbuild\n" {
+		t.Errorf("expected the builder to be created before the build, got %q", called)
+	}
+}
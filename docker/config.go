@@ -1,39 +1,75 @@
 package docker
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/cli/cli/connhelper"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"golang.org/x/net/http/httpproxy"
 )
 
 // Config is the structure that stores the configuration to talk to a
 // Docker API compatible host.
 type Config struct {
-	Host     string
-	Ca       string
-	Cert     string
-	Key      string
-	CertPath string
+	Host         string
+	Ca           string
+	Cert         string
+	Key          string
+	CertPath     string
+	MaxRetries   int
+	RetryBackoff time.Duration
+	APIVersion   string
+	// ConnectTimeout bounds the ping of a host, if set
+	ConnectTimeout time.Duration
+	// ConnectMaxRetries and ConnectRetryBackoff retry the connect while the
+	// daemon is not reachable yet, e.g. while its host is provisioned
+	ConnectMaxRetries   int
+	ConnectRetryBackoff time.Duration
+	// Proxy and NoProxy override the proxy environment variables for the
+	// connections to a tcp host
+	Proxy   string
+	NoProxy string
+	// TraceAPICalls logs the requests of the client to the daemon
+	TraceAPICalls bool
+	// traceResource is the resource operation the requests are traced for
+	traceResource string
+}
+
+// apiVersionOpt pins the API version of the client to the configured one,
+// otherwise the client negotiates the highest version both it and the
+// daemon support on the first request
+func (c *Config) apiVersionOpt() client.Opt {
+	if c.APIVersion != "" {
+		return client.WithVersion(c.APIVersion)
+	}
+	return client.WithAPIVersionNegotiation()
 }
 
 // buildHTTPClientFromBytes builds the http client from bytes (content of the files)
 func buildHTTPClientFromBytes(caPEMCert, certPEMBlock, keyPEMBlock []byte) (*http.Client, error) {
 	tlsConfig := &tls.Config{}
-	if certPEMBlock != nil && keyPEMBlock != nil {
+	if len(certPEMBlock) > 0 && len(keyPEMBlock) > 0 {
 		tlsCert, err := tls.X509KeyPair(certPEMBlock, keyPEMBlock)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Error parsing cert_material and key_material: %s", err)
 		}
 		tlsConfig.Certificates = []tls.Certificate{tlsCert}
 	}
@@ -43,7 +79,7 @@ func buildHTTPClientFromBytes(caPEMCert, certPEMBlock, keyPEMBlock []byte) (*htt
 	} else {
 		caPool := x509.NewCertPool()
 		if !caPool.AppendCertsFromPEM(caPEMCert) {
-			return nil, errors.New("Could not add RootCA pem")
+			return nil, errors.New("Could not add RootCA pem: ca_material contains no PEM encoded certificate")
 		}
 		tlsConfig.RootCAs = caPool
 	}
@@ -82,6 +118,190 @@ func defaultPooledTransport() *http.Transport {
 
 // NewClient returns a new Docker client.
 func (c *Config) NewClient() (*client.Client, error) {
+	host, err := npipeHost(c.Host, runtime.GOOS)
+	if err != nil {
+		return nil, err
+	}
+	clientConfig := *c
+	clientConfig.Host = host
+	cli, err := clientConfig.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// the transports of unix sockets and ssh connections must not be proxied
+	if (c.Proxy != "" || c.NoProxy != "") && (strings.HasPrefix(c.Host, "tcp://") || strings.HasPrefix(c.Host, "http")) {
+		transport, ok := cli.HTTPClient().Transport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("cannot configure the proxy for transport: %T", cli.HTTPClient().Transport)
+		}
+		transport.Proxy = proxyFunc(c.Proxy, c.NoProxy)
+	}
+
+	// each retry is traced
+	var wrap func(next http.RoundTripper) http.RoundTripper
+	if c.TraceAPICalls {
+		wrap = func(next http.RoundTripper) http.RoundTripper {
+			return &traceTransport{next: next, resource: c.traceResource}
+		}
+	}
+	if c.MaxRetries > 0 {
+		traced := wrap
+		wrap = func(next http.RoundTripper) http.RoundTripper {
+			if traced != nil {
+				next = traced(next)
+			}
+			return &retryTransport{next: next, maxRetries: c.MaxRetries, backoff: c.RetryBackoff}
+		}
+	}
+	if wrap != nil {
+		if err := configureRoundTripper(cli, wrap); err != nil {
+			return nil, err
+		}
+	}
+	return cli, nil
+}
+
+// hostPingTimeout bounds the ping of a Docker host when there are more hosts
+// to fail over to and no connect timeout is configured, so an unreachable one
+// does not block the provider for the whole dial timeout and its retries
+const hostPingTimeout = 10 * time.Second
+
+// splitHosts returns the comma separated hosts of the host argument
+func splitHosts(host string) []string {
+	hosts := []string{}
+	for _, h := range strings.Split(host, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// maxConnectRetryBackoff caps the exponential backoff between the retries of
+// the connect, so a daemon coming up late is still found soon after
+const maxConnectRetryBackoff = 30 * time.Second
+
+// Connect returns a client of the first of the comma separated hosts of the
+// config which answers a ping, e.g. one of the managers of a Swarm. The host
+// of the config is set to the one connected to. As long as no host is
+// reachable yet, the connect is retried up to ConnectMaxRetries times.
+func (c *Config) Connect(ctx context.Context) (*client.Client, error) {
+	for attempt := 0; ; attempt++ {
+		cli, unreachable, err := c.connect(ctx)
+		if err == nil || !unreachable || attempt >= c.ConnectMaxRetries {
+			return cli, err
+		}
+
+		wait := c.ConnectRetryBackoff << uint(attempt)
+		if wait > maxConnectRetryBackoff || wait < 0 {
+			wait = maxConnectRetryBackoff
+		}
+		log.Printf("[INFO] Docker host %s is not reachable yet, retrying in %s: %s", c.Host, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// connect makes one attempt of Connect. It reports whether it failed because
+// no daemon answered, unlike e.g. a configuration error it may succeed later.
+func (c *Config) connect(ctx context.Context) (*client.Client, bool, error) {
+	hosts := splitHosts(c.Host)
+	if len(hosts) <= 1 {
+		cli, err := c.NewClient()
+		if err != nil {
+			return nil, false, fmt.Errorf("Error initializing Docker client: %s", err)
+		}
+		var pingCtx context.Context
+		var cancel context.CancelFunc
+		if c.ConnectTimeout > 0 {
+			pingCtx, cancel = context.WithTimeout(ctx, c.ConnectTimeout)
+		} else {
+			pingCtx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+		if _, err := cli.Ping(pingCtx); err != nil {
+			cli.Close()
+			return nil, isDaemonUnreachableError(err), classifyError(fmt.Errorf("Error pinging Docker server: %s", err), "host")
+		}
+		return cli, false, nil
+	}
+
+	pingTimeout := hostPingTimeout
+	if c.ConnectTimeout > 0 {
+		pingTimeout = c.ConnectTimeout
+	}
+	failures := []string{}
+	unreachable := false
+	for _, host := range hosts {
+		hostConfig := *c
+		hostConfig.Host = host
+		cli, err := hostConfig.NewClient()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: Error initializing Docker client: %s", host, err))
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		_, err = cli.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			log.Printf("[WARN] Docker host %s is not reachable, failing over to the next host: %s", host, err)
+			failures = append(failures, fmt.Sprintf("%s: Error pinging Docker server: %s", host, err))
+			unreachable = unreachable || isDaemonUnreachableError(err)
+			cli.Close()
+			continue
+		}
+		log.Printf("[DEBUG] Connected to Docker host %s", host)
+		c.Host = host
+		return cli, false, nil
+	}
+	return nil, unreachable, fmt.Errorf("None of the Docker hosts is reachable:\n%s", strings.Join(failures, "\n"))
+}
+
+// isDaemonUnreachableError reports whether the ping failed because nothing
+// answered at the address of the daemon, e.g. because the daemon or its host
+// is still starting, rather than e.g. because of its certificate
+func isDaemonUnreachableError(err error) bool {
+	if client.IsErrConnectionFailed(err) || isTransientConnectionError(err) {
+		return true
+	}
+	// a missing named pipe is ERROR_FILE_NOT_FOUND on Windows, which is not
+	// syscall.ENOENT there
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) || errors.Is(err, os.ErrNotExist) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	msg := err.Error()
+	for _, unreachable := range []string{"connection refused", "no such file or directory", "cannot find the file specified", "no such host", "no route to host", "i/o timeout", "context deadline exceeded"} {
+		if strings.Contains(msg, unreachable) {
+			return true
+		}
+	}
+	return false
+}
+
+// newClientFromBytes returns a client connecting with the PEM encoded TLS
+// material of the config, so it can come from variables or a secret store
+// without being written to disk
+func (c *Config) newClientFromBytes() (*client.Client, error) {
+	httpClient, err := buildHTTPClientFromBytes([]byte(c.Ca), []byte(c.Cert), []byte(c.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	// Note: don't change the order here, because the custom client
+	// needs to be set first them we overwrite the other options: host, version
+	return client.NewClientWithOpts(
+		client.WithHTTPClient(httpClient),
+		client.WithHost(c.Host),
+		c.apiVersionOpt(),
+	)
+}
+
+func (c *Config) newClient() (*client.Client, error) {
 	if c.Cert != "" || c.Key != "" {
 		if c.Cert == "" || c.Key == "" {
 			return nil, fmt.Errorf("cert_material, and key_material must be specified")
@@ -91,18 +311,13 @@ func (c *Config) NewClient() (*client.Client, error) {
 			return nil, fmt.Errorf("cert_path must not be specified")
 		}
 
-		httpClient, err := buildHTTPClientFromBytes([]byte(c.Ca), []byte(c.Cert), []byte(c.Key))
-		if err != nil {
-			return nil, err
-		}
+		return c.newClientFromBytes()
+	}
 
-		// Note: don't change the order here, because the custom client
-		// needs to be set first them we overwrite the other options: host, version
-		return client.NewClientWithOpts(
-			client.WithHTTPClient(httpClient),
-			client.WithHost(c.Host),
-			client.WithAPIVersionNegotiation(),
-		)
+	// a CA certificate alone verifies the daemon without a client certificate,
+	// e.g. if the daemon is behind a proxy authenticating the clients otherwise
+	if c.Ca != "" && c.CertPath == "" {
+		return c.newClientFromBytes()
 	}
 
 	if c.CertPath != "" {
@@ -113,7 +328,7 @@ func (c *Config) NewClient() (*client.Client, error) {
 		return client.NewClientWithOpts(
 			client.WithHost(c.Host),
 			client.WithTLSClientConfig(ca, cert, key),
-			client.WithAPIVersionNegotiation(),
+			c.apiVersionOpt(),
 		)
 	}
 
@@ -126,17 +341,163 @@ func (c *Config) NewClient() (*client.Client, error) {
 		return client.NewClientWithOpts(
 			client.WithHost(helper.Host),
 			client.WithDialContext(helper.Dialer),
-			client.WithAPIVersionNegotiation(),
+			c.apiVersionOpt(),
 		)
 	}
 
 	// If there is no ssh://, then just return the direct client
 	return client.NewClientWithOpts(
 		client.WithHost(c.Host),
-		client.WithAPIVersionNegotiation(),
+		c.apiVersionOpt(),
 	)
 }
 
+// retryTransport retries requests to the Docker daemon which failed with
+// a transient connection error, such as an EOF or a connection reset. Only
+// requests which cannot have been run by the daemon are retried, see
+// isRetryableRequest.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+}
+
+// configureRoundTripper routes the requests of the client through the round
+// tripper wrap returns, e.g. a retryTransport. The transport of the client
+// has to stay a *http.Transport because the client relies on it for hijacked
+// connections, so the round tripper is registered for the schemes the client
+// uses and delegates to a clone of the original transport. A transport only
+// takes one round tripper per scheme, so all of them are chained by wrap.
+func configureRoundTripper(cli *client.Client, wrap func(next http.RoundTripper) http.RoundTripper) error {
+	transport, ok := cli.HTTPClient().Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("cannot configure the round tripper of transport: %T", cli.HTTPClient().Transport)
+	}
+
+	rt := wrap(transport.Clone())
+	transport.RegisterProtocol("http", rt)
+	transport.RegisterProtocol("https", rt)
+	return nil
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err == nil || attempt >= t.maxRetries || !isRetryableRequest(req, err) {
+			return resp, err
+		}
+
+		// streamed bodies, like build contexts, cannot be sent again
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		wait := t.backoff << uint(attempt)
+		if t.backoff > 0 {
+			wait += time.Duration(rand.Int63n(int64(t.backoff)))
+		}
+		log.Printf("[DEBUG] Retrying %s %s in %s after transient error: %s", req.Method, req.URL.Path, wait, err)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// isRetryableRequest reports whether the request failed with an error it
+// can be sent again for. A request which failed to dial was never written,
+// so it is retried whatever its method. Other requests are only retried if
+// they are idempotent, a POST like a container create or an exec start may
+// have been run by the daemon before the connection dropped.
+func isRetryableRequest(req *http.Request, err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return isTransientConnectionError(err)
+}
+
+// registryRetries retries pulls and pushes which failed with a transient
+// error of the registry, such as a 503 or a timeout. Unlike the retries of
+// retryTransport, the daemon reports these errors in the streamed messages.
+type registryRetries struct {
+	maxRetries int
+	backoff    time.Duration
+}
+
+func (r registryRetries) do(ctx context.Context, operation string, f func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= r.maxRetries || !isTransientRegistryError(err) {
+			return err
+		}
+
+		wait := r.backoff << uint(attempt)
+		if r.backoff > 0 {
+			wait += time.Duration(rand.Int63n(int64(r.backoff)))
+		}
+		log.Printf("[DEBUG] Retrying %s in %s after transient registry error: %s", operation, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// isTransientRegistryError reports whether the error is caused by a
+// temporary failure of the registry or the network to it
+func isTransientRegistryError(err error) bool {
+	if isTransientConnectionError(err) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, transient := range []string{
+		"Internal Server Error", "Bad Gateway", "Service Unavailable", "Gateway Timeout",
+		"unexpected HTTP status: 5", "TLS handshake timeout", "i/o timeout", "connection refused", "unexpected EOF",
+		"net/http: request canceled while waiting for connection",
+	} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransientConnectionError reports whether the error is caused by the
+// daemon dropping the connection, which generally succeeds when retried.
+func isTransientConnectionError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, transient := range []string{"connection reset by peer", "broken pipe", "resource temporarily unavailable"} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
+
 // Data structure for holding data that we fetch from Docker.
 type Data struct {
 	DockerImages map[string]*types.ImageSummary
@@ -146,6 +507,29 @@ type Data struct {
 type ProviderConfig struct {
 	DockerClient *client.Client
 	AuthConfigs  *AuthConfigs
+	TimingReport *timingReport
+
+	ContextSizeWarningThreshold int64
+	RegistryRetries             registryRetries
+	// LayerCopies bounds the layers copied in parallel by the provider
+	LayerCopies int
+	// Operations bounds the pulls, pushes and builds running at once
+	Operations *operationLimit
+	// RegistryMirrors are tried in order for pulls of Docker Hub images
+	RegistryMirrors []string
+	// DisableRemotePull fails the pulls of images missing in the daemon
+	DisableRemotePull bool
+	DefaultTimeouts   operationTimeouts
+	// Engine is the engine serving the API, docker or podman
+	Engine string
+	// traceConfig is the config of the clients of the resource operations
+	// with trace_api_calls, nil otherwise
+	traceConfig *Config
+	// DefaultLabels are merged into the labels of the containers, networks,
+	// volumes and image builds
+	DefaultLabels map[string]string
+	// Features are the opt-in behavior changes of the features block
+	Features providerFeatures
 }
 
 // The registry address can be referenced in various places (registry auth, docker config file, image name)
@@ -156,3 +540,129 @@ func normalizeRegistryAddress(address string) string {
 	}
 	return address
 }
+
+// registryTransport holds the options of the provider registry_auth for the
+// connections of the provider to a registry
+type registryTransport struct {
+	insecureSkipVerify bool
+	plainHTTP          bool
+}
+
+// registryTransports are the registryTransport of the registries of the
+// registry_auth of a provider by hostname. Like the insecure-registries of
+// the daemon they apply to all the resources of the provider.
+type registryTransports struct {
+	byHostname map[string]registryTransport
+	// proxy and noProxy are the proxy of the requests to registries and to
+	// the token services of ECR and GCR, if the provider overrides the proxy
+	// of the environment
+	proxy   string
+	noProxy string
+}
+
+func newRegistryTransports(proxy, noProxy string) *registryTransports {
+	return &registryTransports{
+		byHostname: make(map[string]registryTransport),
+		proxy:      proxy,
+		noProxy:    noProxy,
+	}
+}
+
+func (t *registryTransports) set(hostname string, transport registryTransport) {
+	if transport == (registryTransport{}) {
+		delete(t.byHostname, hostname)
+		return
+	}
+	t.byHostname[hostname] = transport
+}
+
+func (t *registryTransports) get(hostname string) registryTransport {
+	if t == nil {
+		return registryTransport{}
+	}
+	if transport, ok := t.byHostname[hostname]; ok {
+		return transport
+	}
+	// the options of a registry_auth with wildcards apply to all the
+	// registries it matches
+	for pattern, transport := range t.byHostname {
+		if isRegistryAddressPattern(pattern) && matchRegistryHostname(pattern, hostname) {
+			return transport
+		}
+	}
+	return registryTransport{}
+}
+
+// normalizeRegistryAddress is normalizeRegistryAddress with http:// for the
+// registries with plain_http
+func (t *registryTransports) normalizeRegistryAddress(address string) string {
+	if !strings.HasPrefix(address, "https://") && !strings.HasPrefix(address, "http://") && t.get(convertToHostname(address)).plainHTTP {
+		return "http://" + address
+	}
+	return normalizeRegistryAddress(address)
+}
+
+// plainHTTPTransport sends the requests to a registry with plain_http over
+// HTTP, as the addresses of images are normalized to https://
+type plainHTTPTransport struct {
+	http.RoundTripper
+	hostname string
+}
+
+func (t *plainHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" && req.URL.Host == t.hostname {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = "http"
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// proxyFunc returns the proxy of a request. The proxy and the hosts which
+// are not proxied default to the ones of HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY. The proxy may be a socks5:// proxy.
+func proxyFunc(proxy, noProxy string) func(*http.Request) (*url.URL, error) {
+	if proxy == "" && noProxy == "" {
+		return http.ProxyFromEnvironment
+	}
+	config := httpproxy.FromEnvironment()
+	if proxy != "" {
+		config.HTTPProxy, config.HTTPSProxy = proxy, proxy
+	}
+	if noProxy != "" {
+		config.NoProxy = noProxy
+	}
+	proxyURL := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyURL(req.URL)
+	}
+}
+
+// registryHTTPClient returns the client for requests to the registry of the
+// hostname with the transport options of the provider
+func registryHTTPClient(transports *registryTransports, hostname string) *http.Client {
+	transport := transports.get(hostname)
+	insecure := transport.insecureSkipVerify
+	proxy, noProxy := "", ""
+	if transports != nil {
+		proxy, noProxy = transports.proxy, transports.noProxy
+	}
+
+	// Allow insecure registries for ACC tests
+	// cuz we don't have a valid certs for this case
+	if env, okEnv := os.LookupEnv("TF_ACC"); okEnv {
+		if i, errConv := strconv.Atoi(env); errConv == nil && i >= 1 {
+			insecure = true
+		}
+	}
+	if !insecure && !transport.plainHTTP && proxy == "" && noProxy == "" {
+		return http.DefaultClient
+	}
+	var roundTripper http.RoundTripper = &http.Transport{
+		Proxy:           proxyFunc(proxy, noProxy),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}
+	if transport.plainHTTP {
+		roundTripper = &plainHTTPTransport{RoundTripper: roundTripper, hostname: hostname}
+	}
+	return &http.Client{Transport: roundTripper}
+}
@@ -0,0 +1,310 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryTransport(t *testing.T) {
+	calls := 0
+	failures := 2
+	var failure error = io.EOF
+	rt := &retryTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls <= failures {
+				return nil, failure
+			}
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		maxRetries: 3,
+	}
+
+	req, _ := http.NewRequest("GET", "http://docker/containers/json", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Fatalf("expected success after 3 calls, got %d calls", calls)
+	}
+
+	calls = 0
+	req, _ = http.NewRequest("POST", "http://docker/containers/create", strings.NewReader("{}"))
+	if _, err := rt.RoundTrip(req); err != io.EOF {
+		t.Fatalf("expected EOF for a POST the daemon may have run, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single call for a POST the daemon may have run, got %d", calls)
+	}
+
+	calls = 0
+	failure = &net.OpError{Op: "dial", Net: "unix", Err: errors.New("connect: connection refused")}
+	req, _ = http.NewRequest("POST", "http://docker/containers/create", strings.NewReader("{}"))
+	if _, err := rt.RoundTrip(req); err != nil || calls != 3 {
+		t.Fatalf("expected success of a POST after failed dials, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	req, _ = http.NewRequest("POST", "http://docker/build", io.MultiReader(strings.NewReader("context")))
+	if _, err := rt.RoundTrip(req); err != failure {
+		t.Fatalf("expected the dial error for a body which cannot be replayed, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single call for a body which cannot be replayed, got %d", calls)
+	}
+}
+
+func TestIsTransientConnectionError(t *testing.T) {
+	if !isTransientConnectionError(errors.New("read unix @->/var/run/docker.sock: read: connection reset by peer")) {
+		t.Fatal("expected connection reset to be transient")
+	}
+	if !isTransientConnectionError(fmt.Errorf("read response: %w", io.ErrUnexpectedEOF)) {
+		t.Fatal("expected a wrapped unexpected EOF to be transient")
+	}
+	if isTransientConnectionError(errors.New("No such image: EOF-tool:latest")) {
+		t.Fatal("expected missing image not to be transient")
+	}
+}
+
+func TestRegistryRetries(t *testing.T) {
+	retries := registryRetries{maxRetries: 2}
+
+	calls := 0
+	err := retries.do(context.Background(), "pull of foo", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("received unexpected HTTP status: 503 Service Unavailable")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success after 3 calls, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	err = retries.do(context.Background(), "pull of foo", func() error {
+		calls++
+		return errors.New("Get https://registry/v2/: net/http: TLS handshake timeout")
+	})
+	if err == nil || calls != 3 {
+		t.Fatalf("expected the error after the retries, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	err = retries.do(context.Background(), "pull of foo", func() error {
+		calls++
+		return errors.New("pull access denied for foo, repository does not exist")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("expected no retries of a permanent error, got %d calls", calls)
+	}
+}
+
+func TestConfigConnectFailover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downHost := "tcp://" + strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_ping") {
+			w.Header().Set("API-Version", "1.40")
+			w.Write([]byte("OK"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer up.Close()
+	upHost := "tcp://" + strings.TrimPrefix(up.URL, "http://")
+
+	config := Config{Host: downHost + ", " + upHost}
+	if _, err := config.Connect(context.Background()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Host != upHost {
+		t.Errorf("expected to fail over to %s, got %s", upHost, config.Host)
+	}
+
+	config = Config{Host: downHost + "," + downHost}
+	if _, err := config.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "None of the Docker hosts is reachable") {
+		t.Errorf("expected an error listing the hosts, got %v", err)
+	}
+
+	if hosts := splitHosts(" tcp://a:2376, ,tcp://b:2376 "); !reflect.DeepEqual(hosts, []string{"tcp://a:2376", "tcp://b:2376"}) {
+		t.Errorf("unexpected hosts %v", hosts)
+	}
+}
+
+func TestConfigConnectRetries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := "tcp://" + listener.Addr().String()
+	listener.Close()
+
+	config := Config{Host: host}
+	if _, err := config.Connect(context.Background()); err == nil {
+		t.Fatal("expected the connect to fail without retries")
+	}
+
+	// the daemon comes up while the provider retries
+	daemon := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.40")
+		w.Write([]byte("OK"))
+	}))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		listener, err := net.Listen("tcp", strings.TrimPrefix(host, "tcp://"))
+		if err != nil {
+			return
+		}
+		daemon.Listener = listener
+		daemon.Start()
+	}()
+	defer daemon.Close()
+
+	config = Config{Host: host, ConnectMaxRetries: 5, ConnectRetryBackoff: 100 * time.Millisecond}
+	if _, err := config.Connect(context.Background()); err != nil {
+		t.Fatalf("expected the connect to succeed once the daemon is up, got %s", err)
+	}
+
+	// a configuration error is not retried
+	config = Config{Host: host, CertPath: "/nonexistent", ConnectMaxRetries: 5, ConnectRetryBackoff: time.Hour}
+	if _, err := config.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "Error initializing Docker client") {
+		t.Errorf("expected the client error, got %v", err)
+	}
+}
+
+func TestConfigTLSMaterial(t *testing.T) {
+	clientCert := ""
+	daemon := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			clientCert = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		w.Header().Set("API-Version", "1.40")
+		w.Write([]byte("OK"))
+	}))
+	daemon.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	daemon.StartTLS()
+	defer daemon.Close()
+	host := "tcp://" + strings.TrimPrefix(daemon.URL, "https://")
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: daemon.Certificate().Raw}))
+
+	config := Config{Host: host, Ca: ca}
+	if _, err := config.Connect(context.Background()); err != nil {
+		t.Fatalf("expected ca_material alone to verify the daemon, got %s", err)
+	}
+
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "terraform"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	config = Config{
+		Host: host,
+		Ca:   ca,
+		Cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Key:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+	if _, err := config.Connect(context.Background()); err != nil || clientCert != "terraform" {
+		t.Fatalf("expected the client certificate to be sent, got %q and %v", clientCert, err)
+	}
+
+	for _, config := range []Config{
+		{Host: host, Ca: "not a certificate"},
+		{Host: host, Cert: config.Cert, Key: "not a key"},
+		{Host: host, Cert: config.Cert},
+	} {
+		if _, err := config.NewClient(); err == nil {
+			t.Errorf("expected an error for invalid material %+v", config)
+		}
+	}
+}
+
+func TestConfigAPIVersion(t *testing.T) {
+	paths := []string{}
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("API-Version", "1.38")
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			w.Write([]byte(`{"ApiVersion":"1.38"}`))
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer daemon.Close()
+	host := "tcp://" + strings.TrimPrefix(daemon.URL, "http://")
+
+	for apiVersion, expected := range map[string]string{"": "/v1.38/version", "1.30": "/v1.30/version"} {
+		paths = []string{}
+		config := Config{Host: host, APIVersion: apiVersion}
+		cli, err := config.Connect(context.Background())
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := cli.ServerVersion(context.Background()); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if paths[len(paths)-1] != expected {
+			t.Errorf("expected %s for api_version %q, got %v", expected, apiVersion, paths)
+		}
+	}
+}
+
+func TestConfigProxy(t *testing.T) {
+	proxied := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Host+r.URL.Path)
+		w.Header().Set("API-Version", "1.40")
+		w.Write([]byte("OK"))
+	}))
+	defer proxy.Close()
+
+	config := Config{Host: "tcp://docker.internal:2375", Proxy: proxy.URL}
+	if _, err := config.Connect(context.Background()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(proxied, []string{"docker.internal:2375/_ping"}) {
+		t.Errorf("expected the ping to be proxied, got %v", proxied)
+	}
+
+	transports := newRegistryTransports(proxy.URL, "registry.internal")
+	proxied = []string{}
+	for _, registry := range []string{"registry.example.com", "registry.internal"} {
+		registryHTTPClient(transports, registry).Get("http://" + registry + "/v2/")
+	}
+	if !reflect.DeepEqual(proxied, []string{"registry.example.com/v2/"}) {
+		t.Errorf("expected only the registry outside of no_proxy to be proxied, got %v", proxied)
+	}
+
+	req, _ := http.NewRequest("GET", "https://registry.example.com/v2/", nil)
+	if proxyURL, err := proxyFunc("socks5://proxy:1080", "")(req); err != nil || proxyURL.String() != "socks5://proxy:1080" {
+		t.Errorf("expected the socks5 proxy, got %v, %v", proxyURL, err)
+	}
+}
@@ -0,0 +1,371 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	ociManifestMediaType       = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType         = "application/vnd.oci.image.config.v1+json"
+	cosignSimpleSigningType    = "application/vnd.dev.cosign.simplesigning.v1+json"
+	cosignSignatureAnnotation  = "dev.cosignproject.cosign/signature"
+	cosignSignaturePayloadType = "cosign container image signature"
+	cosignEncryptedKeyType     = "ENCRYPTED COSIGN PRIVATE KEY"
+	sigstoreEncryptedKeyType   = "ENCRYPTED SIGSTORE PRIVATE KEY"
+)
+
+type cosignPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// cosignEncryptedKey is the content of encrypted cosign keys, created by
+// 'cosign generate-key-pair'
+type cosignEncryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// parseCosignKey parses a PEM encoded ECDSA private key. Encrypted cosign
+// keys are decrypted with the password.
+func parseCosignKey(key, password string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, fmt.Errorf("The signing key is not PEM encoded")
+	}
+
+	der := block.Bytes
+	switch block.Type {
+	case cosignEncryptedKeyType, sigstoreEncryptedKeyType:
+		var err error
+		if der, err = decryptCosignKey(block.Bytes, password); err != nil {
+			return nil, err
+		}
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	case "PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("Unsupported signing key type %s", block.Type)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the signing key: %s", err)
+	}
+	privateKey, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("The signing key is not an ECDSA key")
+	}
+	return privateKey, nil
+}
+
+func decryptCosignKey(content []byte, password string) ([]byte, error) {
+	var encrypted cosignEncryptedKey
+	if err := json.Unmarshal(content, &encrypted); err != nil {
+		return nil, fmt.Errorf("Unable to parse the encrypted signing key: %s", err)
+	}
+	if encrypted.KDF.Name != "scrypt" || encrypted.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("Unsupported encryption %s with %s of the signing key", encrypted.Cipher.Name, encrypted.KDF.Name)
+	}
+	if len(encrypted.Cipher.Nonce) != 24 {
+		return nil, fmt.Errorf("Invalid nonce of the encrypted signing key")
+	}
+
+	derived, err := scrypt.Key([]byte(password), encrypted.KDF.Salt, encrypted.KDF.Params.N, encrypted.KDF.Params.R, encrypted.KDF.Params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to derive the key of the signing key: %s", err)
+	}
+	var secretKey [32]byte
+	var nonce [24]byte
+	copy(secretKey[:], derived)
+	copy(nonce[:], encrypted.Cipher.Nonce)
+	der, ok := secretbox.Open(nil, encrypted.Ciphertext, &nonce, &secretKey)
+	if !ok {
+		return nil, fmt.Errorf("Unable to decrypt the signing key, the password is wrong")
+	}
+	return der, nil
+}
+
+// cosignDockerReference is the repository of the image as cosign names it
+func cosignDockerReference(opts internalImageOptions) string {
+	registry := opts.Registry
+	if registry == "registry.hub.docker.com" {
+		registry = "index.docker.io"
+	}
+	return registry + "/" + opts.Repository
+}
+
+// cosignSignatureTag is the tag cosign stores the signatures of the
+// manifest with the digest at, e.g. sha256-abc.sig
+func cosignSignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// cosignSigner signs the payloads of signatures, with a key or keyless
+type cosignSigner interface {
+	// sign returns the annotations of the signature layer of the payload
+	sign(payload []byte) (map[string]string, error)
+	// hasSigned reports whether the layer of the payload with the hash is a
+	// signature of the signer
+	hasSigned(layer ociDescriptor, payloadHash []byte) bool
+}
+
+// cosignKeySigner signs like 'cosign sign --key'
+type cosignKeySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s cosignKeySigner) sign(payload []byte) (map[string]string, error) {
+	payloadHash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, payloadHash[:])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to sign the payload: %s", err)
+	}
+	return map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)}, nil
+}
+
+func (s cosignKeySigner) hasSigned(layer ociDescriptor, payloadHash []byte) bool {
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+	return err == nil && ecdsa.VerifyASN1(&s.key.PublicKey, payloadHash, signature)
+}
+
+// signImage signs the pushed manifest with the digest like 'cosign sign'
+// and adds the signature to the ones pushed next to the image already. It
+// returns the reference of the signatures.
+func signImage(transports *registryTransports, opts internalImageOptions, username, password string, signer cosignSigner, digest string) (string, error) {
+	payload := cosignPayload{}
+	payload.Critical.Identity.DockerReference = cosignDockerReference(opts)
+	payload.Critical.Image.DockerManifestDigest = digest
+	payload.Critical.Type = cosignSignaturePayloadType
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("Error encoding signature payload: %s", err)
+	}
+	payloadHash := sha256.Sum256(payloadBytes)
+	payloadDigest := fmt.Sprintf("sha256:%x", payloadHash)
+
+	tag := cosignSignatureTag(digest)
+	signatureRef := cosignDockerReference(opts) + ":" + tag
+	layers, err := getSignatureLayers(transports, opts, username, password, tag)
+	if err != nil {
+		return "", err
+	}
+	for _, layer := range layers {
+		if layer.Digest == payloadDigest && signer.hasSigned(layer, payloadHash[:]) {
+			log.Printf("[DEBUG] %s@%s is signed already", opts.FqName, digest)
+			return signatureRef, nil
+		}
+	}
+
+	annotations, err := signer.sign(payloadBytes)
+	if err != nil {
+		return "", fmt.Errorf("Unable to sign %s: %s", digest, err)
+	}
+	layers = append(layers, ociDescriptor{
+		MediaType:   cosignSimpleSigningType,
+		Size:        int64(len(payloadBytes)),
+		Digest:      payloadDigest,
+		Annotations: annotations,
+	})
+
+	diffIDs := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		diffIDs = append(diffIDs, layer.Digest)
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "",
+		"os":           "",
+		"config":       map[string]interface{}{},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": diffIDs,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error encoding signature config: %s", err)
+	}
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(config))
+
+	for blobDigest, blob := range map[string][]byte{payloadDigest: payloadBytes, configDigest: config} {
+		if err := pushRegistryBlob(transports, opts, username, password, blobDigest, blob); err != nil {
+			return "", err
+		}
+	}
+
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config: ociDescriptor{
+			MediaType: ociConfigMediaType,
+			Size:      int64(len(config)),
+			Digest:    configDigest,
+		},
+		Layers: layers,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error encoding signature manifest: %s", err)
+	}
+
+	resp, err := doRegistryRequest(transports, func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", opts.NormalizedRegistry+"/v2/"+opts.Repository+"/manifests/"+tag, bytes.NewReader(manifest))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", ociManifestMediaType)
+		return req, nil
+	}, username, password)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("Unable to push signature of %s: %s %s", opts.FqName, resp.Status, msg)
+	}
+
+	log.Printf("[DEBUG] Pushed signature of %s@%s", opts.FqName, digest)
+	return signatureRef, nil
+}
+
+// getSignatureLayers returns the signatures pushed to the tag of the
+// signatures already, none if the tag does not exist
+func getSignatureLayers(transports *registryTransports, opts internalImageOptions, username, password, tag string) ([]ociDescriptor, error) {
+	resp, err := doRegistryRequest(transports, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", opts.NormalizedRegistry+"/v2/"+opts.Repository+"/manifests/"+tag, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", ociManifestMediaType+", application/vnd.docker.distribution.manifest.v2+json")
+		return req, nil
+	}, username, password)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response body: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to get the signatures of %s: %s %s", opts.FqName, resp.Status, body)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("Unable to parse the signatures of %s: %s", opts.FqName, err)
+	}
+	return manifest.Layers, nil
+}
+
+// pushRegistryBlob uploads the blob, unless the registry has it already
+func pushRegistryBlob(transports *registryTransports, opts internalImageOptions, username, password, digest string, blob []byte) error {
+	endpoint := registryEndpoint{opts: opts, username: username, password: password, transports: transports}
+	ctx := context.Background()
+	exists, err := endpoint.hasBlob(ctx, digest)
+	if err != nil || exists {
+		return err
+	}
+	return endpoint.uploadBlob(ctx, digest, int64(len(blob)), func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(blob)), nil
+	})
+}
+
+// signDockerImage signs the pushed image with the key or the identity token
+// of the sign block, if the image has one
+func signDockerImage(d *schema.ResourceData, authConfigs *AuthConfigs, imageName, digest string) error {
+	rawSigns := d.Get("sign").([]interface{})
+	if len(rawSigns) == 0 || rawSigns[0] == nil {
+		return nil
+	}
+	rawSign := rawSigns[0].(map[string]interface{})
+	if digest == "" {
+		return fmt.Errorf("Unable to sign image %s, the digest of the push is unknown", imageName)
+	}
+
+	var signer cosignSigner
+	key, identityToken := rawSign["key"].(string), rawSign["identity_token"].(string)
+	switch {
+	case (key == "") == (identityToken == ""):
+		return classifyError(fmt.Errorf("Exactly one of key or identity_token has to be set to sign image %s", imageName), "sign")
+	case key != "":
+		privateKey, err := parseCosignKey(key, rawSign["password"].(string))
+		if err != nil {
+			return classifyError(err, "sign")
+		}
+		signer = cosignKeySigner{key: privateKey}
+	default:
+		signer = cosignKeylessSigner{
+			identityToken: identityToken,
+			fulcioURL:     rawSign["fulcio_url"].(string),
+			rekorURL:      rawSign["rekor_url"].(string),
+			transports:    authConfigs.transports,
+		}
+	}
+
+	pushOpts := createPushImageOptions(imageName)
+	username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+	if err != nil {
+		return err
+	}
+	signatureRef, err := signImage(authConfigs.transports, pushOpts, username, password, signer, digest)
+	if err != nil {
+		return classifyError(err, "sign")
+	}
+	d.Set("signature_ref", signatureRef)
+	return nil
+}
@@ -0,0 +1,254 @@
+package docker
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultFulcioURL             = "https://fulcio.sigstore.dev"
+	defaultRekorURL              = "https://rekor.sigstore.dev"
+	cosignCertificateAnnotation  = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation        = "dev.sigstore.cosign/chain"
+	cosignBundleAnnotation       = "dev.sigstore.cosign/bundle"
+	rekorHashedRekordKind        = "hashedrekord"
+	rekorHashedRekordAPIVersion  = "0.0.1"
+	fulcioSigningCertificatePath = "/api/v2/signingCert"
+	rekorLogEntriesPath          = "/api/v1/log/entries"
+)
+
+type fulcioCertificateChain struct {
+	Chain struct {
+		Certificates []string `json:"certificates"`
+	} `json:"chain"`
+}
+
+type fulcioSigningCertificate struct {
+	SignedCertificateEmbeddedSct *fulcioCertificateChain `json:"signedCertificateEmbeddedSct"`
+	SignedCertificateDetachedSct *fulcioCertificateChain `json:"signedCertificateDetachedSct"`
+}
+
+type rekorLogEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+	} `json:"verification"`
+}
+
+// cosignBundle is the proof of the transparency log entry of a keyless
+// signature, which cosign verifies offline
+type cosignBundle struct {
+	SignedEntryTimestamp string `json:"SignedEntryTimestamp"`
+	Payload              struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogIndex       int64  `json:"logIndex"`
+		LogID          string `json:"logID"`
+	} `json:"Payload"`
+}
+
+// cosignKeylessSigner signs like 'cosign sign' without a key: an ephemeral
+// key is certified by Fulcio for the identity of the OIDC token and the
+// signature is recorded in the Rekor transparency log.
+type cosignKeylessSigner struct {
+	identityToken string
+	fulcioURL     string
+	rekorURL      string
+	transports    *registryTransports
+}
+
+func (s cosignKeylessSigner) sign(payload []byte) (map[string]string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to generate the ephemeral signing key: %s", err)
+	}
+	chain, err := s.requestCertificate(key)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, payloadHash[:])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to sign the payload: %s", err)
+	}
+	bundle, err := s.uploadLogEntry(chain[0], payloadHash[:], signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		cosignSignatureAnnotation:   base64.StdEncoding.EncodeToString(signature),
+		cosignCertificateAnnotation: chain[0],
+		cosignChainAnnotation:       strings.Join(chain[1:], ""),
+		cosignBundleAnnotation:      bundle,
+	}, nil
+}
+
+// hasSigned is always false, as the key of each signature is another one
+func (s cosignKeylessSigner) hasSigned(layer ociDescriptor, payloadHash []byte) bool {
+	return false
+}
+
+// requestCertificate requests the certificate of the public key for the
+// identity of the token from Fulcio. It returns the PEM encoded chain,
+// starting with the certificate of the key.
+func (s cosignKeylessSigner) requestCertificate(key *ecdsa.PrivateKey) ([]string, error) {
+	subject, err := identityTokenSubject(s.identityToken)
+	if err != nil {
+		return nil, err
+	}
+	subjectHash := sha256.Sum256([]byte(subject))
+	proof, err := ecdsa.SignASN1(rand.Reader, key, subjectHash[:])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to sign the proof of possession of the ephemeral key: %s", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode the ephemeral public key: %s", err)
+	}
+
+	request := map[string]interface{}{
+		"credentials": map[string]string{"oidcIdentityToken": s.identityToken},
+		"publicKeyRequest": map[string]interface{}{
+			"publicKey": map[string]string{
+				"algorithm": "ECDSA",
+				"content":   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+			},
+			"proofOfPossession": base64.StdEncoding.EncodeToString(proof),
+		},
+	}
+	var certificate fulcioSigningCertificate
+	if err := s.postJSON(s.fulcioURL, fulcioSigningCertificatePath, request, &certificate, http.StatusCreated, http.StatusOK); err != nil {
+		return nil, fmt.Errorf("Unable to get a signing certificate from Fulcio: %s", err)
+	}
+
+	chain := certificate.SignedCertificateEmbeddedSct
+	if chain == nil {
+		chain = certificate.SignedCertificateDetachedSct
+	}
+	if chain == nil || len(chain.Chain.Certificates) == 0 {
+		return nil, fmt.Errorf("Fulcio returned no signing certificate")
+	}
+	return chain.Chain.Certificates, nil
+}
+
+// uploadLogEntry records the signature of the payload hash in Rekor and
+// returns the cosign bundle of the entry
+func (s cosignKeylessSigner) uploadLogEntry(certificate string, payloadHash, signature []byte) (string, error) {
+	request := map[string]interface{}{
+		"apiVersion": rekorHashedRekordAPIVersion,
+		"kind":       rekorHashedRekordKind,
+		"spec": map[string]interface{}{
+			"signature": map[string]interface{}{
+				"content":   base64.StdEncoding.EncodeToString(signature),
+				"publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString([]byte(certificate))},
+			},
+			"data": map[string]interface{}{
+				"hash": map[string]string{"algorithm": "sha256", "value": fmt.Sprintf("%x", payloadHash)},
+			},
+		},
+	}
+	var entries map[string]rekorLogEntry
+	if err := s.postJSON(s.rekorURL, rekorLogEntriesPath, request, &entries, http.StatusCreated); err != nil {
+		return "", fmt.Errorf("Unable to record the signature in Rekor: %s", err)
+	}
+	if len(entries) != 1 {
+		return "", fmt.Errorf("Rekor returned %d entries for the signature", len(entries))
+	}
+
+	bundle := cosignBundle{}
+	for _, entry := range entries {
+		bundle.SignedEntryTimestamp = entry.Verification.SignedEntryTimestamp
+		bundle.Payload.Body = entry.Body
+		bundle.Payload.IntegratedTime = entry.IntegratedTime
+		bundle.Payload.LogIndex = entry.LogIndex
+		bundle.Payload.LogID = entry.LogID
+	}
+	encoded, err := json.Marshal(bundle)
+	if err != nil {
+		return "", fmt.Errorf("Error encoding the bundle of the signature: %s", err)
+	}
+	return string(encoded), nil
+}
+
+// postJSON posts the request to the path of the server and decodes the
+// response, if its status is one of the expected ones
+func (s cosignKeylessSigner) postJSON(server, path string, request, response interface{}, statuses ...int) error {
+	endpoint, err := url.Parse(strings.TrimSuffix(server, "/") + path)
+	if err != nil {
+		return fmt.Errorf("Invalid URL %s: %s", server, err)
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("Error encoding request: %s", err)
+	}
+	req, err := http.NewRequest("POST", endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Error creating request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := registryHTTPClient(s.transports, endpoint.Host).Do(req)
+	if err != nil {
+		return fmt.Errorf("Error during request: %s", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading response body: %s", err)
+	}
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			if err := json.Unmarshal(respBody, response); err != nil {
+				return fmt.Errorf("Error parsing response: %s", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s", resp.Status, respBody)
+}
+
+// identityTokenSubject returns the identity Fulcio certifies for the OIDC
+// token, its email or else its subject. The token is not verified, Fulcio
+// does.
+func identityTokenSubject(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("The identity token is not a JWT")
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("Unable to decode the claims of the identity token: %s", err)
+	}
+	var claims struct {
+		Email   string `json:"email"`
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return "", fmt.Errorf("Unable to parse the claims of the identity token: %s", err)
+	}
+	if claims.Email != "" {
+		return claims.Email, nil
+	}
+	if claims.Subject == "" {
+		return "", fmt.Errorf("The identity token has neither an email nor a subject")
+	}
+	return claims.Subject, nil
+}
@@ -0,0 +1,195 @@
+package docker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testIdentityToken(claims string) string {
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestIdentityTokenSubject(t *testing.T) {
+	cases := map[string]string{
+		`{"sub":"1234","email":"dev@example.com"}`:   "dev@example.com",
+		`{"sub":"repo:foo/bar:ref:refs/heads/main"}`: "repo:foo/bar:ref:refs/heads/main",
+	}
+	for claims, expected := range cases {
+		subject, err := identityTokenSubject(testIdentityToken(claims))
+		if err != nil {
+			t.Errorf("%s: err: %s", claims, err)
+		} else if subject != expected {
+			t.Errorf("%s: expected subject %s, got %s", claims, expected, subject)
+		}
+	}
+
+	if _, err := identityTokenSubject(testIdentityToken(`{}`)); err == nil {
+		t.Error("expected an error for a token without subject")
+	}
+	if _, err := identityTokenSubject("not a token"); err == nil {
+		t.Error("expected an error for a token which is not a JWT")
+	}
+}
+
+func TestCosignKeylessSignerSign(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+
+	var leafPEM string
+	fulcio := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Credentials struct {
+				OIDCIdentityToken string `json:"oidcIdentityToken"`
+			} `json:"credentials"`
+			PublicKeyRequest struct {
+				PublicKey struct {
+					Content string `json:"content"`
+				} `json:"publicKey"`
+				ProofOfPossession string `json:"proofOfPossession"`
+			} `json:"publicKeyRequest"`
+		}
+		if r.URL.Path != fulcioSigningCertificatePath || json.NewDecoder(r.Body).Decode(&request) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		block, _ := pem.Decode([]byte(request.PublicKeyRequest.PublicKey.Content))
+		if block == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		proof, _ := base64.StdEncoding.DecodeString(request.PublicKeyRequest.ProofOfPossession)
+		subjectHash := sha256.Sum256([]byte("dev@example.com"))
+		if !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), subjectHash[:], proof) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		leafTemplate := &x509.Certificate{
+			SerialNumber:   big.NewInt(2),
+			NotBefore:      time.Now().Add(-time.Minute),
+			NotAfter:       time.Now().Add(10 * time.Minute),
+			EmailAddresses: []string{"dev@example.com"},
+			KeyUsage:       x509.KeyUsageDigitalSignature,
+		}
+		leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caTemplate, publicKey, caKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		leafPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"signedCertificateEmbeddedSct":{"chain":{"certificates":[%q,%q]}}}`, leafPEM, caPEM)
+	}))
+	defer fulcio.Close()
+
+	var entryBody []byte
+	rekor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry struct {
+			Kind string `json:"kind"`
+			Spec struct {
+				Signature struct {
+					PublicKey struct {
+						Content string `json:"content"`
+					} `json:"publicKey"`
+				} `json:"signature"`
+				Data struct {
+					Hash struct {
+						Value string `json:"value"`
+					} `json:"hash"`
+				} `json:"data"`
+			} `json:"spec"`
+		}
+		if r.URL.Path != rekorLogEntriesPath || json.NewDecoder(r.Body).Decode(&entry) != nil || entry.Kind != rekorHashedRekordKind {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		certificate, _ := base64.StdEncoding.DecodeString(entry.Spec.Signature.PublicKey.Content)
+		if string(certificate) != leafPEM {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		entryBody, _ = json.Marshal(entry)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"1234":{"body":%q,"integratedTime":1700000000,"logID":"abcd","logIndex":42,"verification":{"signedEntryTimestamp":"c2V0"}}}`,
+			base64.StdEncoding.EncodeToString(entryBody))
+	}))
+	defer rekor.Close()
+
+	signer := cosignKeylessSigner{
+		identityToken: testIdentityToken(`{"sub":"1234","email":"dev@example.com"}`),
+		fulcioURL:     fulcio.URL,
+		rekorURL:      rekor.URL + "/",
+	}
+	payload := []byte(`{"critical":{}}`)
+	annotations, err := signer.sign(payload)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if annotations[cosignCertificateAnnotation] != leafPEM || annotations[cosignChainAnnotation] != caPEM {
+		t.Errorf("unexpected certificate annotations %v", annotations)
+	}
+	block, _ := pem.Decode([]byte(leafPEM))
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(annotations[cosignSignatureAnnotation])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	hash := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(leaf.PublicKey.(*ecdsa.PublicKey), hash[:], signature) {
+		t.Error("expected the signature to be valid for the certificate")
+	}
+
+	var bundle cosignBundle
+	if err := json.Unmarshal([]byte(annotations[cosignBundleAnnotation]), &bundle); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bundle.SignedEntryTimestamp != "c2V0" || bundle.Payload.LogIndex != 42 || bundle.Payload.LogID != "abcd" ||
+		bundle.Payload.IntegratedTime != 1700000000 || bundle.Payload.Body != base64.StdEncoding.EncodeToString(entryBody) {
+		t.Errorf("unexpected bundle %s", annotations[cosignBundleAnnotation])
+	}
+	if signer.hasSigned(ociDescriptor{Digest: fmt.Sprintf("sha256:%x", hash), Annotations: annotations}, hash[:]) {
+		t.Error("expected a keyless signer to sign again")
+	}
+
+	signer.identityToken = testIdentityToken(`{"email":"other@example.com"}`)
+	if _, err := signer.sign(payload); err == nil {
+		t.Error("expected an error for a certificate request Fulcio rejects")
+	}
+}
@@ -0,0 +1,201 @@
+package docker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+func TestParseCosignKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := cosignEncryptedKey{}
+	encrypted.KDF.Name = "scrypt"
+	encrypted.KDF.Params.N, encrypted.KDF.Params.R, encrypted.KDF.Params.P = 1024, 8, 1
+	encrypted.KDF.Salt = []byte("0123456789abcdef0123456789abcdef")
+	encrypted.Cipher.Name = "nacl/secretbox"
+	encrypted.Cipher.Nonce = []byte("0123456789abcdef01234567")
+	derived, err := scrypt.Key([]byte("secret"), encrypted.KDF.Salt, 1024, 8, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secretKey [32]byte
+	var nonce [24]byte
+	copy(secretKey[:], derived)
+	copy(nonce[:], encrypted.Cipher.Nonce)
+	encrypted.Ciphertext = secretbox.Seal(nil, pkcs8, &nonce, &secretKey)
+	encryptedContent, err := json.Marshal(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]*pem.Block{
+		"pkcs8":     {Type: "PRIVATE KEY", Bytes: pkcs8},
+		"ec":        {Type: "EC PRIVATE KEY", Bytes: ec},
+		"encrypted": {Type: cosignEncryptedKeyType, Bytes: encryptedContent},
+	}
+	for name, block := range cases {
+		parsed, err := parseCosignKey(string(pem.EncodeToMemory(block)), "secret")
+		if err != nil {
+			t.Errorf("%s: err: %s", name, err)
+			continue
+		}
+		if parsed.D.Cmp(key.D) != 0 {
+			t.Errorf("%s: expected the generated key", name)
+		}
+	}
+
+	if _, err := parseCosignKey(string(pem.EncodeToMemory(cases["encrypted"])), "wrong"); err == nil {
+		t.Error("expected an error for the wrong password")
+	}
+	if _, err := parseCosignKey(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY"})), ""); err == nil {
+		t.Error("expected an error for an unsupported key")
+	}
+	if _, err := parseCosignKey("not a key", ""); err == nil {
+		t.Error("expected an error for a key which is not PEM encoded")
+	}
+}
+
+func TestSignImage(t *testing.T) {
+	var mutex sync.Mutex
+	blobs := make(map[string][]byte)
+	var manifest []byte
+	var manifestPath string
+	var puts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.Method == "HEAD" && strings.HasPrefix(r.URL.Path, "/v2/foo/blobs/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "POST" && r.URL.Path == "/v2/foo/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/blobs/uploads/1234?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "PUT" && r.URL.Path == "/v2/foo/blobs/uploads/1234":
+			if r.URL.Query().Get("state") != "abc" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blobs[r.URL.Query().Get("digest")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "GET" && r.URL.Path == manifestPath:
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			w.Write(manifest)
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/v2/foo/manifests/"):
+			manifest = body
+			manifestPath = r.URL.Path
+			puts++
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := internalImageOptions{
+		Registry:           "localhost:5000",
+		NormalizedRegistry: server.URL,
+		Repository:         "foo",
+		Tag:                "1.0",
+		FqName:             "localhost:5000/foo:1.0",
+	}
+	ref, err := signImage(nil, opts, "", "", cosignKeySigner{key: key}, "sha256:1234")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ref != "localhost:5000/foo:sha256-1234.sig" || manifestPath != "/v2/foo/manifests/sha256-1234.sig" {
+		t.Errorf("unexpected signature reference %s pushed to %s", ref, manifestPath)
+	}
+
+	var pushed ociManifest
+	if err := json.Unmarshal(manifest, &pushed); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := blobs[pushed.Config.Digest]; !ok || len(pushed.Layers) != 1 {
+		t.Fatalf("unexpected signature manifest %s", manifest)
+	}
+	layer := pushed.Layers[0]
+	payload, ok := blobs[layer.Digest]
+	if !ok || layer.MediaType != cosignSimpleSigningType {
+		t.Fatalf("unexpected signature layer %+v", layer)
+	}
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	hash := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(&key.PublicKey, hash[:], signature) {
+		t.Error("expected the signature to be valid for the payload")
+	}
+
+	var signed cosignPayload
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if signed.Critical.Image.DockerManifestDigest != "sha256:1234" || signed.Critical.Identity.DockerReference != "localhost:5000/foo" {
+		t.Errorf("unexpected signature payload %s", payload)
+	}
+
+	if _, err := signImage(nil, opts, "", "", cosignKeySigner{key: key}, "sha256:1234"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if puts != 1 {
+		t.Errorf("expected no push for a digest signed with the key already, got %d pushes", puts)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signImage(nil, opts, "", "", cosignKeySigner{key: otherKey}, "sha256:1234"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var appended ociManifest
+	if err := json.Unmarshal(manifest, &appended); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(appended.Layers) != 2 || appended.Layers[0].Annotations[cosignSignatureAnnotation] != layer.Annotations[cosignSignatureAnnotation] {
+		t.Fatalf("expected the signature to be added to the existing one, got %s", manifest)
+	}
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(blobs[appended.Config.Digest], &config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(config.RootFS.DiffIDs) != 2 {
+		t.Errorf("expected a diff id for each signature, got %v", config.RootFS.DiffIDs)
+	}
+}
@@ -0,0 +1,207 @@
+package docker
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/docker/api/types"
+)
+
+// dockerHubAuthAddress is the address docker login stores the credentials
+// of Docker Hub under, in the auths of the config file as well as in the
+// credential helpers
+const dockerHubAuthAddress = "https://index.docker.io/v1/"
+
+// defaultRegistryConfigFile is the default config_file of a registry_auth
+const defaultRegistryConfigFile = "~/.docker/config.json"
+
+// defaultDockerConfig is the default docker config file of a provider, its
+// config_file or config_file_content or else the file docker login writes to
+type defaultDockerConfig struct {
+	filePath string
+	content  string
+	// authConfigs caches the credentials resolved from the file by registry
+	// hostname, so a credential helper, which might ask for a passphrase or
+	// access the keychain, is only invoked once per registry
+	authConfigs sync.Map
+}
+
+func newDefaultDockerConfig(filePath, content string) *defaultDockerConfig {
+	return &defaultDockerConfig{filePath: filePath, content: content}
+}
+
+func (c *defaultDockerConfig) load() (*configfile.ConfigFile, error) {
+	return loadDefaultConfigFile(c.filePath, c.content)
+}
+
+// loadDefaultConfigFile loads the docker config file docker login writes to,
+// unless the provider has a config_file or config_file_content.
+// It is a variable, so tests do not depend on the config of the machine.
+var loadDefaultConfigFile = func(filePath, content string) (*configfile.ConfigFile, error) {
+	if content != "" {
+		return loadConfigFile(strings.NewReader(content))
+	}
+	if filePath == "" {
+		configDir, err := dockerConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		filePath = configDir
+	}
+	return loadConfigFilePath(filePath)
+}
+
+// loadConfigFilePath loads the config file of the path, which may start with
+// ~ or be the directory of the file like DOCKER_CONFIG
+func loadConfigFilePath(filePath string) (*configfile.ConfigFile, error) {
+	filePath, err := expandHomeDir(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		filePath = filepath.Join(filePath, "config.json")
+	}
+	r, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return loadConfigFile(r)
+}
+
+// homeDir returns the home directory of the user. HOME takes precedence over
+// the home directory in the user database, which the arbitrary users CI
+// containers run as often have none or a read-only one in.
+func homeDir() (string, error) {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home, nil
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return usr.HomeDir, nil
+}
+
+// expandHomeDir replaces a leading ~ of the path by the home directory
+func expandHomeDir(filePath string) (string, error) {
+	if filePath != "~" && !strings.HasPrefix(filePath, "~/") {
+		return filePath, nil
+	}
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, filePath[1:]), nil
+}
+
+// isDockerHubRegistry reports whether the hostname is one of the names of
+// Docker Hub
+func isDockerHubRegistry(registryHostname string) bool {
+	switch registryHostname {
+	case "", "docker.io", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return true
+	}
+	return false
+}
+
+// getAuthConfigFromConfigFile returns the credentials of the registry from
+// the auths of the config file or, if it has a credsStore or credHelpers, by
+// invoking the docker-credential-<helper> binary. docker login stores the
+// credentials of Docker Hub under its v1 address, so that one is tried for
+// all the names of Docker Hub.
+func getAuthConfigFromConfigFile(c *configfile.ConfigFile, registryHostname string) (types.AuthConfig, error) {
+	authConfig, err := c.GetAuthConfig(registryHostname)
+	if err == nil && authConfig.Username == "" && authConfig.IdentityToken == "" && isDockerHubRegistry(registryHostname) {
+		authConfig, err = c.GetAuthConfig(dockerHubAuthAddress)
+	}
+	return types.AuthConfig{
+		Username:      authConfig.Username,
+		Password:      authConfig.Password,
+		Auth:          authConfig.Auth,
+		ServerAddress: authConfig.ServerAddress,
+		IdentityToken: authConfig.IdentityToken,
+		RegistryToken: authConfig.RegistryToken,
+	}, err
+}
+
+// registryAuth resolves the credentials of a registry without a
+// registry_auth from the default docker config file, so the registries
+// logged in with docker login can be used without any configuration.
+func (c *defaultDockerConfig) registryAuth(transports *registryTransports, registryHostname string) (types.AuthConfig, bool) {
+	if c == nil {
+		return types.AuthConfig{}, false
+	}
+	if isDockerHubRegistry(registryHostname) {
+		registryHostname = "registry.hub.docker.com"
+	}
+	if cached, ok := c.authConfigs.Load(registryHostname); ok {
+		authConfig := cached.(types.AuthConfig)
+		return authConfig, authConfig.Username != "" || authConfig.IdentityToken != ""
+	}
+
+	authConfig := types.AuthConfig{}
+	configFile, err := c.load()
+	if err != nil {
+		log.Printf("[DEBUG] Not using the default docker config for registry '%s': %s", registryHostname, err)
+	} else if authConfig, err = getAuthConfigFromConfigFile(configFile, registryHostname); err != nil {
+		log.Printf("[WARN] Couldn't get the credentials of registry '%s' from the default docker config: %s", registryHostname, err)
+		authConfig = types.AuthConfig{}
+	}
+	authConfig.ServerAddress = transports.normalizeRegistryAddress(registryHostname)
+	c.authConfigs.Store(registryHostname, authConfig)
+	return authConfig, authConfig.Username != "" || authConfig.IdentityToken != ""
+}
+
+// registryAuthConfig returns the credentials of a registry, with "" meaning
+// Docker Hub. The registry_auth of the provider and the resources take
+// precedence over the default docker config file, a registry_auth with the
+// address of the registry over one with wildcards matching it.
+func registryAuthConfig(authConfigs *AuthConfigs, registry string) (types.AuthConfig, error) {
+	registryHostname := convertToHostname(registry)
+	var transports *registryTransports
+	var defaultConfig *defaultDockerConfig
+	if authConfigs != nil {
+		transports, defaultConfig = authConfigs.transports, authConfigs.defaultConfig
+		address := transports.normalizeRegistryAddress(registry)
+		if authConfig, ok := authConfigs.Configs[address]; ok && registry != "" {
+			return authConfig, nil
+		}
+		if isDockerHubRegistry(registryHostname) {
+			if authConfig, ok := authConfigs.Configs["https://registry.hub.docker.com"]; ok {
+				return authConfig, nil
+			}
+		}
+		for _, pattern := range authConfigs.patterns {
+			if registry == "" || !matchRegistryHostname(pattern.hostname, registryHostname) {
+				continue
+			}
+			match, err := pattern.resolve(address)
+			if err != nil {
+				return types.AuthConfig{}, fmt.Errorf("Error getting the credentials of registry '%s' from the registry_auth of '%s': %s", registryHostname, pattern.hostname, err)
+			}
+			if !match.ok {
+				continue
+			}
+			log.Printf("[DEBUG] Using the registry auth of '%s' for: %s", pattern.hostname, address)
+			// the credentials are kept like the ones of an address, so they are
+			// refreshed the same way if the registry rejects them
+			authConfigs.Configs[address] = match.authConfig
+			if match.token != nil {
+				authConfigs.tokens[address] = match.token
+			}
+			return match.authConfig, nil
+		}
+	}
+	if authConfig, ok := defaultConfig.registryAuth(transports, registryHostname); ok {
+		log.Println("[DEBUG] Using the default docker config for registry auths:", authConfig.ServerAddress)
+		return authConfig, nil
+	}
+	return types.AuthConfig{}, nil
+}
@@ -0,0 +1,153 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/docker/api/types"
+)
+
+// testCredentialHelper installs a docker-credential-test binary, which
+// returns credentials for registry.example.com, Docker Hub and the hosts of
+// mirror.example.com only
+func testCredentialHelper(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "credential-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+read server
+case "$server" in
+registry.example.com) echo '{"Username":"helper","Secret":"secret"}' ;;
+https://index.docker.io/v1/) echo '{"Username":"hub","Secret":"hubsecret"}' ;;
+*.mirror.example.com) echo "{\"Username\":\"mirror\",\"Secret\":\"$server\"}" ;;
+*) echo 'credentials not found in native keychain'; exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(path.Join(dir, "docker-credential-test"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	return func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetAuthConfigFromConfigFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test credential helper is a shell script")
+	}
+	defer testCredentialHelper(t)()
+
+	c, err := loadConfigFile(strings.NewReader(`{
+		"auths": {"registry.file.com": {"auth": "dXNlcjpwYXNz"}},
+		"credHelpers": {"registry.example.com": "test"},
+		"credsStore": "test"
+	}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cases := map[string][2]string{
+		"registry.example.com":    {"helper", "secret"},
+		"registry.hub.docker.com": {"hub", "hubsecret"},
+		"docker.io":               {"hub", "hubsecret"},
+		"registry.other.com":      {"", ""},
+	}
+	for registry, expected := range cases {
+		authConfig, err := getAuthConfigFromConfigFile(c, registry)
+		if err != nil {
+			t.Errorf("err for %s: %s", registry, err)
+			continue
+		}
+		if actual := [2]string{authConfig.Username, authConfig.Password}; actual != expected {
+			t.Errorf("expected %v for %s, got %v", expected, registry, actual)
+		}
+	}
+
+	c, _ = loadConfigFile(strings.NewReader(`{"auths": {"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNz"}}}`))
+	if authConfig, _ := getAuthConfigFromConfigFile(c, "registry.hub.docker.com"); authConfig.Username != "user" || authConfig.Password != "pass" {
+		t.Errorf("expected the auth of docker login for Docker Hub, got %+v", authConfig)
+	}
+}
+
+func TestRegistryAuthConfigDefaultConfigFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test credential helper is a shell script")
+	}
+	defer testCredentialHelper(t)()
+	loads := 0
+	load := loadDefaultConfigFile
+	defer func() { loadDefaultConfigFile = load }()
+	loadDefaultConfigFile = func(filePath, content string) (*configfile.ConfigFile, error) {
+		loads++
+		return loadConfigFile(strings.NewReader(`{"credsStore": "test"}`))
+	}
+
+	defaultConfig := newDefaultDockerConfig("", "")
+	authConfigs := &AuthConfigs{Configs: map[string]types.AuthConfig{
+		"https://registry.hub.docker.com": {Username: "provider"},
+	}, defaultConfig: defaultConfig}
+	defaults := &AuthConfigs{defaultConfig: defaultConfig}
+	if authConfig, _ := registryAuthConfig(authConfigs, ""); authConfig.Username != "provider" {
+		t.Errorf("expected the registry_auth to take precedence, got %+v", authConfig)
+	}
+	if authConfig, _ := registryAuthConfig(authConfigs, "registry.example.com"); authConfig.Username != "helper" || authConfig.ServerAddress != "https://registry.example.com" {
+		t.Errorf("expected the credentials of the helper, got %+v", authConfig)
+	}
+	if authConfig, _ := registryAuthConfig(defaults, "registry.hub.docker.com"); authConfig.Username != "hub" {
+		t.Errorf("expected the credentials of docker login for Docker Hub, got %+v", authConfig)
+	}
+	if authConfig, _ := registryAuthConfig(defaults, "registry.other.com"); authConfig.Username != "" {
+		t.Errorf("expected no credentials, got %+v", authConfig)
+	}
+	registryAuthConfig(defaults, "registry.example.com")
+	if loads != 3 {
+		t.Errorf("expected the credentials to be cached by registry, got %d loads", loads)
+	}
+	// every provider configuration has its own cache
+	registryAuthConfig(&AuthConfigs{defaultConfig: newDefaultDockerConfig("", "")}, "registry.example.com")
+	if loads != 4 {
+		t.Errorf("expected the credentials to be cached per provider configuration, got %d loads", loads)
+	}
+}
+
+func TestDefaultConfigFile(t *testing.T) {
+	home, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	oldHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", oldHome)
+	os.Setenv("HOME", home)
+
+	if err := os.MkdirAll(path.Join(home, "ci"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `{"auths": {"registry.file.com": {"auth": "dXNlcjpwYXNz"}}}`
+	if err := ioutil.WriteFile(path.Join(home, "ci", "config.json"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, configFile := range [][2]string{{"~/ci/config.json", ""}, {"~/ci", ""}, {"", content}} {
+		authConfigs := &AuthConfigs{defaultConfig: newDefaultDockerConfig(configFile[0], configFile[1])}
+		if authConfig, _ := registryAuthConfig(authConfigs, "registry.file.com"); authConfig.Username != "user" || authConfig.Password != "pass" {
+			t.Errorf("expected the credentials of %v, got %+v", configFile, authConfig)
+		}
+	}
+
+	missing := newDefaultDockerConfig("~/missing/config.json", "")
+	if _, err := missing.load(); err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+	if authConfig, _ := registryAuthConfig(&AuthConfigs{defaultConfig: missing}, "registry.file.com"); authConfig.Username != "" {
+		t.Errorf("expected no credentials without a config file, got %+v", authConfig)
+	}
+}
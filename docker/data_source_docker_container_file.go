@@ -0,0 +1,128 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func dataSourceDockerContainerFile() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceDockerContainerFileRead,
+
+		Schema: map[string]*schema.Schema{
+			"container": {
+				Type:        schema.TypeString,
+				Description: "ID or name of the container the file is read from",
+				Required:    true,
+			},
+
+			"path": {
+				Type:         schema.TypeString,
+				Description:  "Absolute path of the file in the container",
+				Required:     true,
+				ValidateFunc: validateDockerContainerPath,
+			},
+
+			"container_id": {
+				Type:        schema.TypeString,
+				Description: "ID of the container the file was read from",
+				Computed:    true,
+			},
+
+			"content": {
+				Type:        schema.TypeString,
+				Description: "Content of the file",
+				Computed:    true,
+				Sensitive:   true,
+			},
+
+			"content_base64": {
+				Type:        schema.TypeString,
+				Description: "Base64 encoded content of the file, for binary files",
+				Computed:    true,
+				Sensitive:   true,
+			},
+
+			"mode": {
+				Type:        schema.TypeString,
+				Description: "Octal file mode of the file",
+				Computed:    true,
+			},
+
+			"size": {
+				Type:        schema.TypeInt,
+				Description: "Size of the file in bytes",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceDockerContainerFileRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*ProviderConfig).DockerClient
+	ctx := context.Background()
+
+	containerName := d.Get("container").(string)
+	container, err := client.ContainerInspect(ctx, containerName)
+	if err != nil {
+		return fmt.Errorf("Unable to inspect container %s: %s", containerName, err)
+	}
+
+	path := d.Get("path").(string)
+	stat, err := client.ContainerStatPath(ctx, container.ID, path)
+	if err != nil {
+		return fmt.Errorf("Unable to stat %s in container %s: %s", path, containerName, err)
+	}
+	// the daemon archives a symlink itself, not the file it points to
+	if stat.LinkTarget != "" {
+		path = stat.LinkTarget
+	}
+	if stat.Mode.IsDir() {
+		return fmt.Errorf("%s in container %s is a directory, only files can be read", path, containerName)
+	}
+
+	r, _, err := client.CopyFromContainer(ctx, container.ID, path)
+	if err != nil {
+		return fmt.Errorf("Unable to copy %s from container %s: %s", path, containerName, err)
+	}
+	defer r.Close()
+	content, header, err := readFileFromTar(r)
+	if err != nil {
+		return fmt.Errorf("Unable to read %s from container %s: %s", path, containerName, err)
+	}
+
+	d.SetId(container.ID + ":" + d.Get("path").(string))
+	d.Set("container_id", container.ID)
+	d.Set("content", string(content))
+	d.Set("content_base64", base64.StdEncoding.EncodeToString(content))
+	d.Set("mode", fmt.Sprintf("%04o", header.Mode&0777))
+	d.Set("size", len(content))
+	return nil
+}
+
+// readFileFromTar returns the content and the header of the single file of
+// the archive returned by CopyFromContainer
+func readFileFromTar(r io.Reader) ([]byte, *tar.Header, error) {
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("the archive is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+		return nil, nil, fmt.Errorf("%s is not a regular file", header.Name)
+	}
+	content, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, header, nil
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+)
+
+func TestReadFileFromTar(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "cert.pem", Mode: 0600, Size: 3, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("foo"))
+	tw.Close()
+
+	content, header, err := readFileFromTar(buf)
+	if err != nil {
+		t.Fatalf("Unable to read the file: %s", err)
+	}
+	if string(content) != "foo" || header.Mode != 0600 {
+		t.Errorf("expected foo with mode 0600, got %q with mode %o", content, header.Mode)
+	}
+
+	buf = new(bytes.Buffer)
+	tw = tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "certs", Mode: 0755, Typeflag: tar.TypeDir})
+	tw.Close()
+	if _, _, err := readFileFromTar(buf); err == nil {
+		t.Error("expected an error for a directory")
+	}
+
+	if _, _, err := readFileFromTar(new(bytes.Buffer)); err == nil {
+		t.Error("expected an error for an empty archive")
+	}
+}
+
+func TestAccDockerContainerFileDataSource_basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccDockerContainerFileDataSourceConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.docker_container_file.hostname", "content", "tf-test-file\n"),
+					resource.TestCheckResourceAttr("data.docker_container_file.hostname", "content_base64", "dGYtdGVzdC1maWxlCg=="),
+					resource.TestCheckResourceAttr("data.docker_container_file.hostname", "size", "13"),
+					resource.TestCheckResourceAttrPair("data.docker_container_file.hostname", "container_id", "docker_container.foo", "id"),
+				),
+			},
+		},
+	})
+}
+
+const testAccDockerContainerFileDataSourceConfig = `
+resource "docker_image" "foo" {
+	name         = "nginx:latest"
+	keep_locally = true
+}
+
+resource "docker_container" "foo" {
+	name     = "tf-test"
+	image    = "${docker_image.foo.latest}"
+	hostname = "tf-test-file"
+}
+
+data "docker_container_file" "hostname" {
+	container = "${docker_container.foo.id}"
+	path      = "/etc/hostname"
+}
+`
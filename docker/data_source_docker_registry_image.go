@@ -2,14 +2,11 @@ package docker
 
 import (
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
@@ -29,13 +26,22 @@ func dataSourceDockerRegistryImage() *schema.Resource {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+
+			"repo_digest": {
+				Type:        schema.TypeString,
+				Description: "Name of the image pinned to the digest, e.g. alpine@sha256:...",
+				Computed:    true,
+			},
 		},
 	}
 }
 
 func dataSourceDockerRegistryImageRead(d *schema.ResourceData, meta interface{}) error {
 	pullOpts := parseImageOptions(d.Get("name").(string))
-	authConfig := meta.(*ProviderConfig).AuthConfigs
+	authConfig, err := providerAuthConfigs(meta)
+	if err != nil {
+		return err
+	}
 
 	// Use the official Docker Hub if a registry isn't specified
 	if pullOpts.Registry == "" {
@@ -56,18 +62,17 @@ func dataSourceDockerRegistryImageRead(d *schema.ResourceData, meta interface{})
 		pullOpts.Tag = "latest"
 	}
 
-	username := ""
-	password := ""
-
-	if auth, ok := authConfig.Configs[normalizeRegistryAddress(pullOpts.Registry)]; ok {
-		username = auth.Username
-		password = auth.Password
+	auth, err := registryAuthConfig(authConfig, pullOpts.Registry)
+	if err != nil {
+		return err
 	}
+	username := auth.Username
+	password := auth.Password
 
-	digest, err := getImageDigest(pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, username, password, false)
+	digest, err := getImageDigest(authConfig.transports, pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, username, password, false)
 
 	if err != nil {
-		digest, err = getImageDigest(pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, username, password, true)
+		digest, err = getImageDigest(authConfig.transports, pullOpts.Registry, pullOpts.Repository, pullOpts.Tag, username, password, true)
 		if err != nil {
 			return fmt.Errorf("Got error when attempting to fetch image version from registry: %s", err)
 		}
@@ -75,27 +80,15 @@ func dataSourceDockerRegistryImageRead(d *schema.ResourceData, meta interface{})
 
 	d.SetId(digest)
 	d.Set("sha256_digest", digest)
+	d.Set("repo_digest", familiarRepository(d.Get("name").(string))+"@"+digest)
 
 	return nil
 }
 
-func getImageDigest(registry, image, tag, username, password string, fallback bool) (string, error) {
-	client := http.DefaultClient
-
-	// Allow insecure registries only for ACC tests
-	// cuz we don't have a valid certs for this case
-	if env, okEnv := os.LookupEnv("TF_ACC"); okEnv {
-		if i, errConv := strconv.Atoi(env); errConv == nil && i >= 1 {
-			cfg := &tls.Config{
-				InsecureSkipVerify: true,
-			}
-			client.Transport = &http.Transport{
-				TLSClientConfig: cfg,
-			}
-		}
-	}
+func getImageDigest(transports *registryTransports, registry, image, tag, username, password string, fallback bool) (string, error) {
+	client := registryHTTPClient(transports, registry)
 
-	req, err := http.NewRequest("GET", "https://"+registry+"/v2/"+image+"/manifests/"+tag, nil)
+	req, err := http.NewRequest("GET", transports.normalizeRegistryAddress(registry)+"/v2/"+image+"/manifests/"+tag, nil)
 	if err != nil {
 		return "", fmt.Errorf("Error creating registry request: %s", err)
 	}
@@ -22,6 +22,7 @@ func TestAccDockerRegistryImage_basic(t *testing.T) {
 				Config: testAccDockerImageDataSourceConfig,
 				Check: resource.ComposeTestCheckFunc(
 					resource.TestMatchResourceAttr("data.docker_registry_image.foo", "sha256_digest", registryDigestRegexp),
+					resource.TestMatchResourceAttr("data.docker_registry_image.foo", "repo_digest", regexp.MustCompile(`\Aalpine@sha256:[A-Fa-f0-9]+\z`)),
 				),
 			},
 		},
@@ -0,0 +1,63 @@
+package docker
+
+// withDefaultLabels merges the labels of a resource into the default_labels
+// of the provider, a label of the resource overrides the default one
+func withDefaultLabels(meta interface{}, labels map[string]string) map[string]string {
+	defaultLabels := meta.(*ProviderConfig).DefaultLabels
+	if len(defaultLabels) == 0 {
+		return labels
+	}
+	merged := make(map[string]string, len(defaultLabels)+len(labels))
+	for label, value := range defaultLabels {
+		merged[label] = value
+	}
+	for label, value := range labels {
+		merged[label] = value
+	}
+	return merged
+}
+
+// withoutDefaultLabels removes the default_labels from the labels the daemon
+// reports for a resource, unless the resource sets them itself. The state
+// then only holds the labels of the configuration, so the default_labels do
+// not show up as a diff.
+func withoutDefaultLabels(meta interface{}, labels map[string]string, configured map[string]string) map[string]string {
+	defaultLabels := meta.(*ProviderConfig).DefaultLabels
+	if len(defaultLabels) == 0 {
+		return labels
+	}
+	filtered := make(map[string]string, len(labels))
+	for label, value := range labels {
+		if defaultValue, ok := defaultLabels[label]; ok && defaultValue == value {
+			if _, ok := configured[label]; !ok {
+				continue
+			}
+		}
+		filtered[label] = value
+	}
+	return filtered
+}
+
+// withDefaultBuildLabels returns a copy of the build block with the
+// default_labels merged into its labels of the key
+func withDefaultBuildLabels(meta interface{}, rawBuild map[string]interface{}, key string) map[string]interface{} {
+	defaultLabels := meta.(*ProviderConfig).DefaultLabels
+	if len(defaultLabels) == 0 {
+		return rawBuild
+	}
+	build := make(map[string]interface{}, len(rawBuild))
+	for k, v := range rawBuild {
+		build[k] = v
+	}
+	labels := make(map[string]interface{}, len(defaultLabels))
+	for label, value := range defaultLabels {
+		labels[label] = value
+	}
+	if rawLabels, ok := rawBuild[key].(map[string]interface{}); ok {
+		for label, value := range rawLabels {
+			labels[label] = value
+		}
+	}
+	build[key] = labels
+	return build
+}
@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultLabels(t *testing.T) {
+	meta := &ProviderConfig{DefaultLabels: map[string]string{"team": "platform", "cost-center": "42"}}
+
+	labels := withDefaultLabels(meta, map[string]string{"team": "data", "app": "web"})
+	expected := map[string]string{"team": "data", "cost-center": "42", "app": "web"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v, got %v", expected, labels)
+	}
+
+	// the daemon reports the merged labels, only the configured ones are kept
+	labels = withoutDefaultLabels(meta, map[string]string{"team": "platform", "cost-center": "42", "app": "web"}, map[string]string{"team": "platform", "app": "web"})
+	expected = map[string]string{"team": "platform", "app": "web"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v, got %v", expected, labels)
+	}
+	// a default label changed outside of terraform is a diff
+	labels = withoutDefaultLabels(meta, map[string]string{"cost-center": "43"}, map[string]string{})
+	if labels["cost-center"] != "43" {
+		t.Errorf("expected the changed default label to be kept, got %v", labels)
+	}
+
+	rawBuild := map[string]interface{}{"context": ".", "label": map[string]interface{}{"team": "data"}}
+	build := withDefaultBuildLabels(meta, rawBuild, "label")
+	expectedBuild := map[string]interface{}{"team": "data", "cost-center": "42"}
+	if !reflect.DeepEqual(build["label"], expectedBuild) || build["context"] != "." {
+		t.Errorf("expected the labels %v, got %v", expectedBuild, build)
+	}
+	if len(rawBuild["label"].(map[string]interface{})) != 1 {
+		t.Errorf("expected the build block not to be modified, got %v", rawBuild)
+	}
+
+	if labels := withDefaultLabels(&ProviderConfig{}, nil); labels != nil {
+		t.Errorf("expected no labels without default_labels, got %v", labels)
+	}
+}
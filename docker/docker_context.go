@@ -0,0 +1,125 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// defaultDockerContext is the name of the context of the docker CLI which
+// uses DOCKER_HOST, it has no metadata
+const defaultDockerContext = "default"
+
+// dockerContextMeta is the meta.json of a context in the context store of
+// the docker CLI.
+// Copied from github.com/docker/cli/cli/context/store to reduce dependencies.
+type dockerContextMeta struct {
+	Name      string                               `json:",omitempty"`
+	Endpoints map[string]dockerContextEndpointMeta `json:",omitempty"`
+}
+
+// dockerContextEndpointMeta is the metadata of the docker endpoint of a
+// context
+type dockerContextEndpointMeta struct {
+	Host          string `json:",omitempty"`
+	SkipTLSVerify bool
+}
+
+// dockerContextEndpoint is the daemon endpoint of a context with the TLS
+// material stored for it by docker context create
+type dockerContextEndpoint struct {
+	Host          string
+	SkipTLSVerify bool
+	Ca            string
+	Cert          string
+	Key           string
+}
+
+// dockerConfigDir is the directory of the config of the docker CLI, the
+// DOCKER_CONFIG of the provider may also be the config file itself
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			return filepath.Dir(dir), nil
+		}
+		return dir, nil
+	}
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+// loadDockerContext reads the endpoint of the named context from the
+// context store in the config directory, like docker --context does. The
+// store keeps the metadata and the TLS files of a context in directories
+// named by the SHA-256 of its name.
+func loadDockerContext(configDir, name string) (*dockerContextEndpoint, error) {
+	id := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+	content, err := ioutil.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Docker context '%s' does not exist, see 'docker context ls'", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading Docker context '%s': %s", name, err)
+	}
+	meta := dockerContextMeta{}
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("Error parsing the metadata of Docker context '%s': %s", name, err)
+	}
+	endpointMeta, ok := meta.Endpoints["docker"]
+	if !ok || endpointMeta.Host == "" {
+		return nil, fmt.Errorf("Docker context '%s' has no docker endpoint", name)
+	}
+
+	endpoint := &dockerContextEndpoint{Host: endpointMeta.Host, SkipTLSVerify: endpointMeta.SkipTLSVerify}
+	tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+	for file, material := range map[string]*string{"ca.pem": &endpoint.Ca, "cert.pem": &endpoint.Cert, "key.pem": &endpoint.Key} {
+		content, err := ioutil.ReadFile(filepath.Join(tlsDir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the TLS material of Docker context '%s': %s", name, err)
+		}
+		*material = string(content)
+	}
+	return endpoint, nil
+}
+
+// dockerContextName returns the name of the context of the provider. Like
+// for the docker CLI, DOCKER_CONTEXT is only used if the host is not set in
+// the provider or by DOCKER_HOST.
+func dockerContextName(name, host string) string {
+	if name == "" && host == defaultDockerHost && os.Getenv("DOCKER_HOST") == "" {
+		return os.Getenv("DOCKER_CONTEXT")
+	}
+	return name
+}
+
+// applyDockerContext replaces the host and TLS options of the config by the
+// ones of the named context, the default context keeps them
+func (c *Config) applyDockerContext(name string) error {
+	if name == "" || name == defaultDockerContext {
+		return nil
+	}
+	configDir, err := dockerConfigDir()
+	if err != nil {
+		return err
+	}
+	endpoint, err := loadDockerContext(configDir, name)
+	if err != nil {
+		return err
+	}
+	c.Host = endpoint.Host
+	c.Ca, c.Cert, c.Key, c.CertPath = endpoint.Ca, endpoint.Cert, endpoint.Key, ""
+	if endpoint.SkipTLSVerify {
+		// the client does not verify the daemon without a CA certificate
+		c.Ca = ""
+	}
+	return nil
+}
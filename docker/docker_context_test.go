@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLoadDockerContext(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+	writeContext := func(name, meta string, tlsFiles ...string) {
+		id := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+		os.MkdirAll(path.Join(configDir, "contexts", "meta", id), 0755)
+		ioutil.WriteFile(path.Join(configDir, "contexts", "meta", id, "meta.json"), []byte(meta), 0644)
+		tlsDir := path.Join(configDir, "contexts", "tls", id, "docker")
+		os.MkdirAll(tlsDir, 0700)
+		for _, file := range tlsFiles {
+			ioutil.WriteFile(path.Join(tlsDir, file), []byte("content of "+file), 0600)
+		}
+	}
+	writeContext("swarm", `{"Name":"swarm","Metadata":{"Description":"managers"},"Endpoints":{"docker":{"Host":"tcp://manager:2376","SkipTLSVerify":false}}}`, "ca.pem", "cert.pem", "key.pem")
+	writeContext("remote", `{"Name":"remote","Metadata":{},"Endpoints":{"docker":{"Host":"ssh://user@remote","SkipTLSVerify":false}}}`)
+	writeContext("kubernetes", `{"Name":"kubernetes","Metadata":{},"Endpoints":{"kubernetes":{"Host":"https://cluster"}}}`)
+
+	endpoint, err := loadDockerContext(configDir, "swarm")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := dockerContextEndpoint{Host: "tcp://manager:2376", Ca: "content of ca.pem", Cert: "content of cert.pem", Key: "content of key.pem"}
+	if *endpoint != expected {
+		t.Errorf("expected %+v, got %+v", expected, *endpoint)
+	}
+	if endpoint, err := loadDockerContext(configDir, "remote"); err != nil || *endpoint != (dockerContextEndpoint{Host: "ssh://user@remote"}) {
+		t.Errorf("expected the endpoint without TLS material, got %+v, %v", endpoint, err)
+	}
+	for _, name := range []string{"kubernetes", "missing"} {
+		if _, err := loadDockerContext(configDir, name); err == nil {
+			t.Errorf("expected an error for context %s", name)
+		}
+	}
+
+	oldConfig := os.Getenv("DOCKER_CONFIG")
+	defer os.Setenv("DOCKER_CONFIG", oldConfig)
+	os.Setenv("DOCKER_CONFIG", configDir)
+	config := Config{Host: "unix:///var/run/docker.sock", CertPath: "/certs"}
+	if err := config.applyDockerContext("default"); err != nil || config.Host != "unix:///var/run/docker.sock" {
+		t.Errorf("expected the default context to keep the host, got %s, %v", config.Host, err)
+	}
+	if err := config.applyDockerContext("swarm"); err != nil || config.Host != "tcp://manager:2376" || config.CertPath != "" || config.Cert != "content of cert.pem" {
+		t.Errorf("expected the endpoint of the context, got %+v, %v", config, err)
+	}
+}
+
+func TestDockerContextName(t *testing.T) {
+	for _, env := range []string{"DOCKER_CONTEXT", "DOCKER_HOST"} {
+		old, ok := os.LookupEnv(env)
+		if ok {
+			defer os.Setenv(env, old)
+		} else {
+			defer os.Unsetenv(env)
+		}
+	}
+	os.Setenv("DOCKER_CONTEXT", "swarm")
+	os.Unsetenv("DOCKER_HOST")
+
+	if name := dockerContextName("", defaultDockerHost); name != "swarm" {
+		t.Errorf("expected DOCKER_CONTEXT without a host, got %q", name)
+	}
+	if name := dockerContextName("", "tcp://docker:2376"); name != "" {
+		t.Errorf("expected DOCKER_CONTEXT to be ignored with a host, got %q", name)
+	}
+	if name := dockerContextName("remote", "tcp://docker:2376"); name != "remote" {
+		t.Errorf("expected the context of the provider to override the host, got %q", name)
+	}
+	os.Setenv("DOCKER_HOST", "tcp://docker:2376")
+	if name := dockerContextName("", defaultDockerHost); name != "" {
+		t.Errorf("expected DOCKER_CONTEXT to be ignored with DOCKER_HOST, got %q", name)
+	}
+}
@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/docker/docker/api/types"
+)
+
+// ecrRegistryPattern matches the address of an ECR registry and captures the
+// ID of the registry and its region
+var ecrRegistryPattern = regexp.MustCompile(`^(?:https://)?([0-9]{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?/?$`)
+
+// getECRAuthorizationToken exchanges the AWS credentials of the default
+// credential chain for an authorization token of the registry
+var getECRAuthorizationToken = func(client *http.Client, region, registryID string) (*ecr.AuthorizationData, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(region), HTTPClient: client},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load the AWS credentials: %s", err)
+	}
+	output, err := ecr.New(sess).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(registryID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("No authorization data returned for registry %s", registryID)
+	}
+	return output.AuthorizationData[0], nil
+}
+
+// ecrTokenSource returns the source of the authorization tokens of the ECR
+// registry of the address
+func ecrTokenSource(transports *registryTransports, address string) (registryTokenSource, error) {
+	match := ecrRegistryPattern.FindStringSubmatch(address)
+	if match == nil {
+		return nil, fmt.Errorf("%s is not the address of an ECR registry, e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com", address)
+	}
+	return func() (types.AuthConfig, time.Time, error) {
+		log.Printf("[DEBUG] Requesting an ECR authorization token for %s", address)
+		data, err := getECRAuthorizationToken(registryHTTPClient(transports, ""), match[2], match[1])
+		if err != nil {
+			return types.AuthConfig{}, time.Time{}, fmt.Errorf("Unable to get an ECR authorization token for %s: %s", address, err)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+		if err != nil {
+			return types.AuthConfig{}, time.Time{}, fmt.Errorf("Unable to decode the ECR authorization token for %s: %s", address, err)
+		}
+		credentials := strings.SplitN(string(decoded), ":", 2)
+		if len(credentials) != 2 {
+			return types.AuthConfig{}, time.Time{}, fmt.Errorf("Invalid ECR authorization token for %s", address)
+		}
+		return types.AuthConfig{Username: credentials[0], Password: credentials[1]}, aws.TimeValue(data.ExpiresAt), nil
+	}, nil
+}
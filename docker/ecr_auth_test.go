@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/docker/docker/api/types"
+)
+
+func TestECRTokenSource(t *testing.T) {
+	requests := 0
+	expiresAt := time.Now().Add(12 * time.Hour)
+	getToken := getECRAuthorizationToken
+	defer func() { getECRAuthorizationToken = getToken }()
+	getECRAuthorizationToken = func(client *http.Client, region, registryID string) (*ecr.AuthorizationData, error) {
+		if region != "eu-west-1" || registryID != "123456789012" {
+			return nil, errors.New("unexpected registry")
+		}
+		requests++
+		return &ecr.AuthorizationData{
+			AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:token"))),
+			ExpiresAt:          &expiresAt,
+		}, nil
+	}
+	address := "https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+
+	source, err := ecrTokenSource(nil, address)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	token := newRegistryToken(source)
+	authConfig, err := token.get(false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if authConfig.Username != "AWS" || authConfig.Password != "token" {
+		t.Errorf("expected the credentials of the token, got %+v", authConfig)
+	}
+	if _, err := token.get(false); err != nil || requests != 1 {
+		t.Errorf("expected the cached token to be used, got %d requests", requests)
+	}
+	if _, err := token.get(true); err != nil || requests != 2 {
+		t.Errorf("expected the token to be refreshed, got %d requests", requests)
+	}
+
+	expiresAt = time.Now().Add(10 * time.Minute)
+	token.get(true)
+	authConfigs := &AuthConfigs{
+		Configs: map[string]types.AuthConfig{
+			address:                     {Username: "AWS", Password: "expired"},
+			"https://registry.local:80": {Username: "user"},
+		},
+		tokens: map[string]*registryToken{address: token},
+	}
+	if err := refreshRegistryTokens(authConfigs); err != nil || requests != 4 || authConfigs.Configs[address].Password != "token" {
+		t.Errorf("expected the expiring token to be replaced, got %d requests and %v", requests, err)
+	}
+	if authConfigs.Configs["https://registry.local:80"].Username != "user" {
+		t.Error("expected other registries to be kept")
+	}
+
+	attempts := 0
+	err = retryWithRefreshedAuth(authConfigs, address, types.AuthConfig{Username: "AWS", Password: "expired"}, func(auth types.AuthConfig) error {
+		if attempts++; attempts == 1 {
+			return errors.New("denied: Your authorization token has expired. Reauthenticate and try again.")
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 || requests != 5 {
+		t.Errorf("expected a retry with a new token, got %d attempts and %v", attempts, err)
+	}
+
+	if _, err := ecrTokenSource(nil, "registry.example.com"); err == nil {
+		t.Error("expected an error for a registry which is not an ECR registry")
+	}
+}
+
+func TestIsRegistryAuthError(t *testing.T) {
+	if !isRegistryAuthError(errors.New("denied: Your authorization token has expired. Reauthenticate and try again.")) {
+		t.Error("expected an expired token to be an auth error")
+	}
+	if isRegistryAuthError(errors.New("received unexpected HTTP status: 503 Service Unavailable")) {
+		t.Error("expected a 503 not to be an auth error")
+	}
+}
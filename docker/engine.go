@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	engineDocker = "docker"
+	enginePodman = "podman"
+)
+
+// defaultDockerHost is the default of the host argument of the provider
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// windowsDockerHost is the named pipe of Docker Desktop and of the daemon of
+// Windows Server
+const windowsDockerHost = "npipe:////./pipe/docker_engine"
+
+// podmanHost returns the socket of the Docker-compatible API of Podman. The
+// socket of the rootless service of the user is preferred over the one of
+// the system service, like podman-remote does.
+func podmanHost() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		socket := filepath.Join(runtimeDir, "podman", "podman.sock")
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
+// dockerHost returns the first socket of a Docker daemon which exists: the
+// one of the system daemon, the one of a rootless daemon of the user, which
+// the daemon creates in XDG_RUNTIME_DIR, and the one of Docker Desktop in
+// the home directory. The socket of the system daemon is returned if none
+// exists, so the error names the usual one. On Windows the daemon listens on
+// its named pipe instead.
+func dockerHost() string {
+	if runtime.GOOS == "windows" {
+		return windowsDockerHost
+	}
+	sockets := []string{strings.TrimPrefix(defaultDockerHost, "unix://")}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		sockets = append(sockets, filepath.Join(runtimeDir, "docker.sock"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		sockets = append(sockets, filepath.Join(home, ".docker", "run", "docker.sock"))
+	}
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return defaultDockerHost
+}
+
+// npipeHost returns the named pipe host in the form the client dials, which
+// needs the UNC path of the pipe, so npipe://./pipe/docker_engine, as the
+// host is often written, works like npipe:////./pipe/docker_engine.
+// Named pipes only exist on Windows, elsewhere they are an error instead of
+// the "protocol not available" of the client.
+func npipeHost(host, goos string) (string, error) {
+	if !strings.HasPrefix(host, "npipe:") {
+		return host, nil
+	}
+	if goos != "windows" {
+		return "", fmt.Errorf("The named pipe host %s is only supported on Windows, use a unix://, tcp:// or ssh:// host of the daemon instead", host)
+	}
+	pipe := strings.ReplaceAll(strings.TrimPrefix(host, "npipe:"), `\`, "/")
+	return "npipe:////" + strings.TrimLeft(pipe, "/"), nil
+}
+
+// engineHost returns the host of the engine if neither the host argument nor
+// DOCKER_HOST is set
+func engineHost(engine string) string {
+	if engine == enginePodman {
+		return podmanHost()
+	}
+	return dockerHost()
+}
+
+// requireDockerEngine returns an error if the provider manages Podman, which
+// does not implement the feature in its Docker-compatible API
+func requireDockerEngine(meta interface{}, feature string) error {
+	if meta.(*ProviderConfig).Engine == enginePodman {
+		return fmt.Errorf("%s is not supported by Podman, the provider is configured with engine = \"podman\"", feature)
+	}
+	return nil
+}
+
+// qualifiedImageNames are the names Podman reports an image without a
+// registry by: docker.io/library/alpine:latest for the pulled alpine and
+// localhost/foo:latest for the built or loaded foo
+func qualifiedImageNames(imageName string) []string {
+	if parseImageOptions(imageName).Registry != "" {
+		return nil
+	}
+	if !strings.Contains(imageName, ":") && !strings.Contains(imageName, "@") {
+		imageName += ":latest"
+	}
+	hubName := "docker.io/" + imageName
+	if !strings.Contains(imageName, "/") {
+		hubName = "docker.io/library/" + imageName
+	}
+	return []string{hubName, "localhost/" + imageName}
+}
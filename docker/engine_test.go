@@ -0,0 +1,116 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestPodmanHost(t *testing.T) {
+	runtimeDir, err := ioutil.TempDir("", "runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+	oldRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	defer os.Setenv("XDG_RUNTIME_DIR", oldRuntimeDir)
+	os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	if host := podmanHost(); host != "unix:///run/podman/podman.sock" {
+		t.Errorf("expected the socket of the system service, got %s", host)
+	}
+	os.MkdirAll(path.Join(runtimeDir, "podman"), 0700)
+	ioutil.WriteFile(path.Join(runtimeDir, "podman", "podman.sock"), nil, 0600)
+	if host := podmanHost(); host != "unix://"+path.Join(runtimeDir, "podman", "podman.sock") {
+		t.Errorf("expected the socket of the rootless service, got %s", host)
+	}
+}
+
+func TestDockerHost(t *testing.T) {
+	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
+		t.Skip("the socket of the system daemon takes precedence")
+	}
+	runtimeDir, err := ioutil.TempDir("", "runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+	oldRuntimeDir, oldHome := os.Getenv("XDG_RUNTIME_DIR"), os.Getenv("HOME")
+	defer func() {
+		os.Setenv("XDG_RUNTIME_DIR", oldRuntimeDir)
+		os.Setenv("HOME", oldHome)
+	}()
+	os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	os.Setenv("HOME", runtimeDir)
+
+	if host := engineHost(engineDocker); host != defaultDockerHost {
+		t.Errorf("expected the socket of the system daemon if there is no other, got %s", host)
+	}
+	os.MkdirAll(path.Join(runtimeDir, ".docker", "run"), 0700)
+	ioutil.WriteFile(path.Join(runtimeDir, ".docker", "run", "docker.sock"), nil, 0600)
+	if host := engineHost(engineDocker); host != "unix://"+path.Join(runtimeDir, ".docker", "run", "docker.sock") {
+		t.Errorf("expected the socket of Docker Desktop, got %s", host)
+	}
+	ioutil.WriteFile(path.Join(runtimeDir, "docker.sock"), nil, 0600)
+	if host := engineHost(engineDocker); host != "unix://"+path.Join(runtimeDir, "docker.sock") {
+		t.Errorf("expected the socket of the rootless daemon, got %s", host)
+	}
+}
+
+func TestRequireDockerEngine(t *testing.T) {
+	if err := requireDockerEngine(&ProviderConfig{Engine: engineDocker}, "docker_service"); err != nil {
+		t.Errorf("expected Docker to support all features, got %s", err)
+	}
+	if err := requireDockerEngine(&ProviderConfig{Engine: enginePodman}, "docker_service"); err == nil {
+		t.Error("expected an error for Podman")
+	}
+}
+
+func TestSearchLocalImagesQualifiedNames(t *testing.T) {
+	cases := map[string][]string{
+		"alpine":                   {"docker.io/library/alpine:latest", "localhost/alpine:latest"},
+		"example/app:1.0":          {"docker.io/example/app:1.0", "localhost/example/app:1.0"},
+		"registry.example.com/app": nil,
+	}
+	for imageName, expected := range cases {
+		if names := qualifiedImageNames(imageName); !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected %v for %s, got %v", expected, imageName, names)
+		}
+	}
+
+	pulled := &types.ImageSummary{ID: "sha256:1111"}
+	built := &types.ImageSummary{ID: "sha256:2222"}
+	data := Data{DockerImages: map[string]*types.ImageSummary{
+		"docker.io/library/alpine:3.11": pulled,
+		"localhost/app:latest":          built,
+	}}
+	if image := searchLocalImages(data, "alpine:3.11"); image != pulled {
+		t.Errorf("expected the pulled image, got %v", image)
+	}
+	if image := searchLocalImages(data, "app"); image != built {
+		t.Errorf("expected the built image, got %v", image)
+	}
+}
+
+func TestNpipeHost(t *testing.T) {
+	for _, host := range []string{"npipe://./pipe/docker_engine", "npipe:////./pipe/docker_engine", `npipe:\\.\pipe\docker_engine`} {
+		npipe, err := npipeHost(host, "windows")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if npipe != windowsDockerHost {
+			t.Errorf("expected %s for %s, got %s", windowsDockerHost, host, npipe)
+		}
+	}
+	if host, _ := npipeHost("tcp://localhost:2375", "linux"); host != "tcp://localhost:2375" {
+		t.Errorf("expected other hosts to be kept, got %s", host)
+	}
+	if _, err := npipeHost("npipe://./pipe/docker_engine", "linux"); err == nil || !strings.Contains(err.Error(), "only supported on Windows") {
+		t.Errorf("expected named pipes to be rejected outside of Windows, got %v", err)
+	}
+}
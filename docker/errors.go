@@ -0,0 +1,121 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClassifiedError is returned for well-known errors of the daemon or a
+// registry. It keeps the original error and adds a remediation hint and
+// the attribute of the resource causing it.
+type ClassifiedError struct {
+	Class     string
+	Attribute string
+	Hint      string
+	Err       error
+}
+
+// Error the original error followed by the class, attribute and hint
+func (err *ClassifiedError) Error() string {
+	if err.Attribute == "" {
+		return fmt.Sprintf("%s\n\n%s: %s", err.Err, err.Class, err.Hint)
+	}
+	return fmt.Sprintf("%s\n\n%s (attribute '%s'): %s", err.Err, err.Class, err.Attribute, err.Hint)
+}
+
+type errorClass struct {
+	name    string
+	matches func(msg string) bool
+	hint    string
+}
+
+func containsAny(msg string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorClasses are checked in order, the first matching one is used
+var errorClasses = []errorClass{
+	{
+		name: "Docker socket permission denied",
+		matches: func(msg string) bool {
+			return strings.Contains(msg, "dial unix") && strings.Contains(msg, "permission denied")
+		},
+		hint: "the user running terraform is not allowed to access the Docker socket. " +
+			"Add the user to the 'docker' group or set 'host' to a daemon it can reach.",
+	},
+	{
+		name: "API version not supported",
+		matches: func(msg string) bool {
+			return strings.Contains(msg, "client version") && containsAny(msg, "is too new", "is too old")
+		},
+		hint: "the daemon does not support the API version of the provider. Set 'api_version' of the provider " +
+			"to a version between the minimum and maximum API version of 'docker version', or remove it to negotiate the version.",
+	},
+	{
+		name: "Registry authentication required",
+		matches: func(msg string) bool {
+			return containsAny(strings.ToLower(msg), "authentication required", "unauthorized", "no basic auth credentials", "denied: requested access")
+		},
+		hint: "the registry rejected the credentials. Check the 'registry_auth' of the provider or the resource " +
+			"and that the user has access to the repository.",
+	},
+	{
+		name: "Manifest unknown",
+		matches: func(msg string) bool {
+			return containsAny(msg, "manifest unknown", "not found: manifest")
+		},
+		hint: "the tag or digest does not exist in the registry. Check the image name and that the image was pushed.",
+	},
+	{
+		name: "Name conflict",
+		matches: func(msg string) bool {
+			return containsAny(msg, "is already in use", "already exists")
+		},
+		hint: "an object with the same name exists but is not managed by this resource. " +
+			"Remove it, choose another name or import it with 'terraform import'.",
+	},
+	{
+		name: "Timeout exceeded",
+		matches: func(msg string) bool {
+			return strings.Contains(msg, "context deadline exceeded")
+		},
+		hint: "the operation did not finish in time and was cancelled. " +
+			"Increase the create or update timeout in the 'timeouts' block of the resource if it needs more time.",
+	},
+	{
+		name: "No space left on device",
+		matches: func(msg string) bool {
+			return strings.Contains(msg, "no space left on device")
+		},
+		hint: "the Docker host ran out of disk space. Free space, e.g. with 'docker system prune', and retry.",
+	},
+}
+
+// classifyError returns a ClassifiedError for err if it is a well-known error
+// and err itself otherwise. attribute is the attribute of the resource the
+// error is reported for.
+func classifyError(err error, attribute string) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ClassifiedError); ok {
+		return err
+	}
+	msg := err.Error()
+	for _, class := range errorClasses {
+		if class.matches(msg) {
+			return &ClassifiedError{
+				Class:     class.name,
+				Attribute: attribute,
+				Hint:      class.hint,
+				Err:       err,
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err   string
+		class string
+	}{
+		{"Got permission denied while trying to connect to the Docker daemon socket at unix:///var/run/docker.sock: Get http://%2Fvar%2Frun%2Fdocker.sock/_ping: dial unix /var/run/docker.sock: connect: permission denied", "Docker socket permission denied"},
+		{"Error response from daemon: Get https://registry.example.com/v2/foo/manifests/1.0: unauthorized: authentication required", "Registry authentication required"},
+		{"Error response from daemon: Get https://123.dkr.ecr.eu-west-1.amazonaws.com/v2/foo/manifests/1.0: no basic auth credentials", "Registry authentication required"},
+		{"Error response from daemon: manifest for alpine:0.0 not found: manifest unknown: manifest unknown", "Manifest unknown"},
+		{"Error response from daemon: Conflict. The container name \"/foo\" is already in use by container \"1234\"", "Name conflict"},
+		{"Error response from daemon: network with name foo already exists", "Name conflict"},
+		{"Error building docker image: Post http://%2Fvar%2Frun%2Fdocker.sock/v1.40/build: context deadline exceeded", "Timeout exceeded"},
+		{"write /var/lib/docker/tmp/GetImageBlob123: no space left on device", "No space left on device"},
+		{"Error response from daemon: client version 1.41 is too new. Maximum supported API version is 1.39", "API version not supported"},
+		{"Error response from daemon: open /foo: permission denied", ""},
+		{"Error response from daemon: No such image: alpine:3.1", ""},
+	}
+
+	for _, c := range cases {
+		err := classifyError(errors.New(c.err), "name")
+		classified, ok := err.(*ClassifiedError)
+		if c.class == "" {
+			if ok {
+				t.Errorf("expected %q not to be classified, got %q", c.err, classified.Class)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("expected %q to be classified as %q", c.err, c.class)
+			continue
+		}
+		if classified.Class != c.class {
+			t.Errorf("expected %q to be classified as %q, got %q", c.err, c.class, classified.Class)
+		}
+		if !strings.HasPrefix(err.Error(), c.err) || !strings.Contains(err.Error(), "attribute 'name'") {
+			t.Errorf("expected the original error and the attribute in %q", err.Error())
+		}
+	}
+
+	if classifyError(nil, "name") != nil {
+		t.Errorf("expected nil error to stay nil")
+	}
+}
@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gcrScope is the OAuth scope of the access tokens for gcr.io and Artifact
+// Registry
+const gcrScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// gcrTokenSource returns the source of the access tokens for gcr.io and
+// Artifact Registry. The tokens are created with the service account key if
+// it is set and with the Application Default Credentials otherwise.
+func gcrTokenSource(transports *registryTransports, address, credentials string) (registryTokenSource, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, registryHTTPClient(transports, ""))
+	var tokenSource oauth2.TokenSource
+	if credentials != "" {
+		config, err := google.CredentialsFromJSON(ctx, []byte(credentials), gcrScope)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the Google credentials for %s: %s", address, err)
+		}
+		tokenSource = config.TokenSource
+	} else {
+		config, err := google.FindDefaultCredentials(ctx, gcrScope)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find the Application Default Credentials for %s: %s", address, err)
+		}
+		tokenSource = config.TokenSource
+	}
+
+	return func() (types.AuthConfig, time.Time, error) {
+		log.Printf("[DEBUG] Requesting a Google access token for %s", address)
+		token, err := tokenSource.Token()
+		if err != nil {
+			return types.AuthConfig{}, time.Time{}, fmt.Errorf("Unable to get a Google access token for %s: %s", address, err)
+		}
+		return types.AuthConfig{Username: "oauth2accesstoken", Password: token.AccessToken}, token.Expiry, nil
+	}, nil
+}
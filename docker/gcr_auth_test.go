@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGCRTokenSource(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || r.FormValue("assertion") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"ya29.token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "pusher@project.iam.gserviceaccount.com",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":      tokenServer.URL,
+	})
+
+	source, err := gcrTokenSource(nil, "https://europe-docker.pkg.dev", string(credentials))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	authConfig, expiresAt, err := source()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if authConfig.Username != "oauth2accesstoken" || authConfig.Password != "ya29.token" || expiresAt.IsZero() {
+		t.Errorf("expected the access token, got %+v expiring at %s", authConfig, expiresAt)
+	}
+
+	if _, err := gcrTokenSource(nil, "https://gcr.io", "{"); err == nil {
+		t.Error("expected an error for invalid credentials")
+	}
+}
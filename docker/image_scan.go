@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// defaultScanCommand scans the image with trivy, the name of the image is
+// appended
+var defaultScanCommand = []string{"trivy", "image", "--format", "json", "--quiet"}
+
+// scanSeverities are the severities of trivy in ascending order
+var scanSeverities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+type scanVulnerability struct {
+	VulnerabilityID  string
+	PkgName          string
+	InstalledVersion string
+	FixedVersion     string
+	Severity         string
+}
+
+type scanResult struct {
+	Target          string
+	Vulnerabilities []scanVulnerability
+}
+
+// scanReport is the JSON report of trivy. Older versions of trivy report
+// the list of results only.
+type scanReport struct {
+	Results []scanResult
+}
+
+func (r *scanReport) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, &r.Results)
+	}
+	type report scanReport
+	return json.Unmarshal(data, (*report)(r))
+}
+
+func scanSeverityRank(severity string) int {
+	for i, s := range scanSeverities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return 0
+}
+
+// scanFindings counts the vulnerabilities of the report by severity and
+// returns the ones at or above the threshold
+func scanFindings(report *scanReport, threshold string, ignoreUnfixed bool) (map[string]interface{}, []string) {
+	counts := make(map[string]interface{}, len(scanSeverities))
+	for _, severity := range scanSeverities {
+		counts[severity] = 0
+	}
+	findings := []string{}
+	for _, result := range report.Results {
+		for _, vulnerability := range result.Vulnerabilities {
+			if ignoreUnfixed && vulnerability.FixedVersion == "" {
+				continue
+			}
+			severity := scanSeverities[scanSeverityRank(vulnerability.Severity)]
+			counts[severity] = counts[severity].(int) + 1
+			if scanSeverityRank(severity) >= scanSeverityRank(threshold) {
+				findings = append(findings, fmt.Sprintf("%s %s in %s %s (%s)", severity, vulnerability.VulnerabilityID,
+					vulnerability.PkgName, vulnerability.InstalledVersion, result.Target))
+			}
+		}
+	}
+	sort.Strings(findings)
+	return counts, findings
+}
+
+// scanDockerImage scans the image with the command of the scan block and
+// fails if it has vulnerabilities at or above the severity threshold
+func scanDockerImage(ctx context.Context, d *schema.ResourceData, imageName string) error {
+	rawScans := d.Get("scan").([]interface{})
+	if len(rawScans) == 0 || rawScans[0] == nil {
+		return nil
+	}
+	rawScan := rawScans[0].(map[string]interface{})
+
+	command := stringListToStringSlice(rawScan["command"].([]interface{}))
+	if len(command) == 0 {
+		command = defaultScanCommand
+	}
+	args := append(append([]string{}, command[1:]...), imageName)
+	log.Printf("[DEBUG] Scanning image %s with %s", imageName, strings.Join(command, " "))
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return classifyError(fmt.Errorf("Unable to scan image %s: %s\n\n%s", imageName, err, stderr.String()), "scan")
+	}
+
+	report := &scanReport{}
+	if err := json.Unmarshal(stdout.Bytes(), report); err != nil {
+		return classifyError(fmt.Errorf("Unable to parse the scan report of image %s: %s", imageName, err), "scan")
+	}
+	threshold := rawScan["severity_threshold"].(string)
+	if threshold == "" {
+		threshold = "HIGH"
+	}
+	counts, findings := scanFindings(report, threshold, rawScan["ignore_unfixed"].(bool))
+	d.Set("scan_results", counts)
+	if len(findings) > 0 {
+		return classifyError(fmt.Errorf("Image %s has %d vulnerabilities with severity %s or above:\n%s",
+			imageName, len(findings), threshold, strings.Join(findings, "\n")), "scan")
+	}
+	return nil
+}
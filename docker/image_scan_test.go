@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+const testScanReport = `{
+  "SchemaVersion": 2,
+  "Results": [
+    {
+      "Target": "alpine:3.11 (alpine 3.11.6)",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2020-0001", "PkgName": "openssl", "InstalledVersion": "1.1.1g-r0", "FixedVersion": "1.1.1i-r0", "Severity": "HIGH"},
+        {"VulnerabilityID": "CVE-2020-0002", "PkgName": "musl", "InstalledVersion": "1.1.24-r2", "Severity": "CRITICAL"},
+        {"VulnerabilityID": "CVE-2020-0003", "PkgName": "zlib", "InstalledVersion": "1.2.11-r3", "FixedVersion": "1.2.12-r0", "Severity": "LOW"}
+      ]
+    }
+  ]
+}`
+
+func TestScanFindings(t *testing.T) {
+	report := &scanReport{}
+	if err := json.Unmarshal([]byte(testScanReport), report); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	counts, findings := scanFindings(report, "HIGH", false)
+	expectedCounts := map[string]interface{}{"UNKNOWN": 0, "LOW": 1, "MEDIUM": 0, "HIGH": 1, "CRITICAL": 1}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("expected counts %v, got %v", expectedCounts, counts)
+	}
+	if len(findings) != 2 || !strings.HasPrefix(findings[0], "CRITICAL CVE-2020-0002 in musl") {
+		t.Errorf("expected the critical and high vulnerabilities, got %v", findings)
+	}
+
+	if _, findings := scanFindings(report, "HIGH", true); len(findings) != 1 || !strings.Contains(findings[0], "CVE-2020-0001") {
+		t.Errorf("expected the unfixed vulnerability to be ignored, got %v", findings)
+	}
+	if _, findings := scanFindings(report, "CRITICAL", true); len(findings) != 0 {
+		t.Errorf("expected no findings, got %v", findings)
+	}
+
+	legacy := &scanReport{}
+	if err := json.Unmarshal([]byte(`[{"Target": "alpine", "Vulnerabilities": [{"VulnerabilityID": "CVE-2020-0004", "Severity": "MEDIUM"}]}]`), legacy); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, findings := scanFindings(legacy, "MEDIUM", false); len(findings) != 1 {
+		t.Errorf("expected the vulnerability of the legacy report, got %v", findings)
+	}
+}
+
+func TestScanDockerImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-image-scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	reportPath := filepath.Join(dir, "report.json")
+	if err := ioutil.WriteFile(reportPath, []byte(testScanReport), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the name of the image is appended to the command, sh ignores it as $0
+	d := schema.TestResourceDataRaw(t, resourceDockerImage().Schema, map[string]interface{}{
+		"name": "alpine:3.11",
+		"scan": []interface{}{
+			map[string]interface{}{
+				"command":            []interface{}{"sh", "-c", "cat " + reportPath},
+				"severity_threshold": "CRITICAL",
+			},
+		},
+	})
+	err = scanDockerImage(context.Background(), d, "alpine:3.11")
+	if err == nil || !strings.Contains(err.Error(), "1 vulnerabilities with severity CRITICAL") {
+		t.Errorf("expected the scan to fail for the critical vulnerability, got %v", err)
+	}
+	if d.Get("scan_results.HIGH").(int) != 1 {
+		t.Errorf("expected the counts of the scan, got %v", d.Get("scan_results"))
+	}
+
+	d.Set("scan", []interface{}{
+		map[string]interface{}{
+			"command":        []interface{}{"sh", "-c", "cat " + reportPath},
+			"ignore_unfixed": true,
+		},
+	})
+	if err := scanDockerImage(context.Background(), d, "alpine:3.11"); err == nil {
+		t.Error("expected the scan to fail for the fixed high vulnerability")
+	}
+
+	d.Set("scan", []interface{}{
+		map[string]interface{}{
+			"command": []interface{}{"sh", "-c", "exit 1"},
+		},
+	})
+	if err := scanDockerImage(context.Background(), d, "alpine:3.11"); err == nil || !strings.Contains(err.Error(), "Unable to scan image") {
+		t.Errorf("expected an error of the failed command, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package docker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	manifestV2MediaType   = "application/vnd.docker.distribution.manifest.v2+json"
+	manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+type manifestPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type manifestDescriptor struct {
+	MediaType string            `json:"mediaType"`
+	Size      int64             `json:"size"`
+	Digest    string            `json:"digest"`
+	Platform  *manifestPlatform `json:"platform,omitempty"`
+}
+
+type manifestList struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Manifests     []manifestDescriptor `json:"manifests"`
+}
+
+// parsePlatform parses a platform in the 'os/arch[/variant]' format
+func parsePlatform(platform string) *manifestPlatform {
+	parts := strings.SplitN(platform, "/", 3)
+	p := &manifestPlatform{OS: parts[0]}
+	if len(parts) > 1 {
+		p.Architecture = parts[1]
+	}
+	if len(parts) > 2 {
+		p.Variant = parts[2]
+	}
+	return p
+}
+
+// platformImageName is the name of the image built for one platform of a
+// multi-platform build, e.g. foo:1.0-linux-arm64 for foo:1.0 and linux/arm64
+func platformImageName(imageName, platform string) string {
+	opts := parseImageOptions(imageName)
+	tag := opts.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return fmt.Sprintf("%s:%s-%s", opts.Repository, tag, strings.Replace(platform, "/", "-", -1))
+}
+
+// doRegistryRequest sends the request created by newRequest and retries it
+// with a bearer token if the registry requires OAuth
+func doRegistryRequest(transports *registryTransports, newRequest func() (*http.Request, error), username, password string) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+	client := registryHTTPClient(transports, req.URL.Host)
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error during registry request: %s", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("www-authenticate"), "Bearer") {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	auth := parseAuthHeader(resp.Header.Get("www-authenticate"))
+	params := url.Values{}
+	params.Set("service", auth["service"])
+	params.Set("scope", auth["scope"])
+	tokenRequest, err := http.NewRequest("GET", auth["realm"]+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+	if username != "" {
+		tokenRequest.SetBasicAuth(username, password)
+	}
+	tokenResponse, err := client.Do(tokenRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Error during registry request: %s", err)
+	}
+	defer tokenResponse.Body.Close()
+	if tokenResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Got bad response from registry: " + tokenResponse.Status)
+	}
+	body, err := ioutil.ReadAll(tokenResponse.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response body: %s", err)
+	}
+	token := &TokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("Error parsing OAuth token response: %s", err)
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating registry request: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error during registry request: %s", err)
+	}
+	return resp, nil
+}
+
+// getManifestDescriptor returns the descriptor of the pushed manifest of opts
+func getManifestDescriptor(transports *registryTransports, opts internalImageOptions, username, password string) (*manifestDescriptor, error) {
+	resp, err := doRegistryRequest(transports, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", opts.NormalizedRegistry+"/v2/"+opts.Repository+"/manifests/"+opts.Tag, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", manifestV2MediaType)
+		return req, nil
+	}, username, password)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Got bad response from registry for manifest of %s: %s", opts.FqName, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading registry response body: %s", err)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	mediaType := resp.Header.Get("Content-Type")
+	if mediaType == "" {
+		mediaType = manifestV2MediaType
+	}
+	return &manifestDescriptor{
+		MediaType: mediaType,
+		Size:      int64(len(body)),
+		Digest:    digest,
+	}, nil
+}
+
+// putManifestList pushes the manifest list to the tag of opts and returns
+// its digest
+func putManifestList(transports *registryTransports, opts internalImageOptions, username, password string, list manifestList) (string, error) {
+	list.SchemaVersion = 2
+	list.MediaType = manifestListMediaType
+	body, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("Error encoding manifest list: %s", err)
+	}
+
+	resp, err := doRegistryRequest(transports, func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", opts.NormalizedRegistry+"/v2/"+opts.Repository+"/manifests/"+opts.Tag, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", manifestListMediaType)
+		return req, nil
+	}, username, password)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("Unable to push manifest list %s: %s %s", opts.FqName, resp.Status, msg)
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	log.Printf("[DEBUG] Pushed manifest list %s with digest %s", opts.FqName, digest)
+	return digest, nil
+}
@@ -0,0 +1,97 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlatformImageName(t *testing.T) {
+	cases := map[string]string{
+		"foo":                         "foo:latest-linux-arm64",
+		"foo:1.0":                     "foo:1.0-linux-arm64",
+		"localhost:5000/foo/bar:1.0":  "localhost:5000/foo/bar:1.0-linux-arm64",
+		"registry.example.com/foo:v1": "registry.example.com/foo:v1-linux-arm64",
+	}
+	for imageName, expected := range cases {
+		if name := platformImageName(imageName, "linux/arm64"); name != expected {
+			t.Errorf("expected %s for %s, got %s", expected, imageName, name)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	expected := &manifestPlatform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	if p := parsePlatform("linux/arm/v7"); !reflect.DeepEqual(p, expected) {
+		t.Errorf("expected %v, got %v", expected, p)
+	}
+	expected = &manifestPlatform{OS: "linux", Architecture: "amd64"}
+	if p := parsePlatform("linux/amd64"); !reflect.DeepEqual(p, expected) {
+		t.Errorf("expected %v, got %v", expected, p)
+	}
+}
+
+func TestPutManifestList(t *testing.T) {
+	platformManifest := `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`
+	var pushed manifestList
+	var contentType string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2/foo/manifests/1.0-linux-arm64":
+			w.Header().Set("Content-Type", manifestV2MediaType)
+			w.Header().Set("Docker-Content-Digest", "sha256:1111")
+			w.Write([]byte(platformManifest))
+		case r.Method == "PUT" && r.URL.Path == "/v2/foo/manifests/1.0":
+			contentType = r.Header.Get("Content-Type")
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &pushed)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// the registry requests only skip the certificate check for ACC tests
+	defaultTransport := http.DefaultClient.Transport
+	defer func() { http.DefaultClient.Transport = defaultTransport }()
+	tfAcc, tfAccSet := os.LookupEnv("TF_ACC")
+	os.Setenv("TF_ACC", "1")
+	defer func() {
+		if tfAccSet {
+			os.Setenv("TF_ACC", tfAcc)
+		} else {
+			os.Unsetenv("TF_ACC")
+		}
+	}()
+
+	registry := strings.TrimPrefix(server.URL, "https://")
+	descriptor, err := getManifestDescriptor(nil, createPushImageOptions(registry+"/foo:1.0-linux-arm64"), "", "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := &manifestDescriptor{MediaType: manifestV2MediaType, Size: int64(len(platformManifest)), Digest: "sha256:1111"}
+	if !reflect.DeepEqual(descriptor, expected) {
+		t.Errorf("expected descriptor %v, got %v", expected, descriptor)
+	}
+
+	descriptor.Platform = parsePlatform("linux/arm64")
+	digest, err := putManifestList(nil, createPushImageOptions(registry+"/foo:1.0"), "", "", manifestList{Manifests: []manifestDescriptor{*descriptor}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		t.Errorf("expected a sha256 digest, got %s", digest)
+	}
+	if contentType != manifestListMediaType {
+		t.Errorf("expected content type %s, got %s", manifestListMediaType, contentType)
+	}
+	if pushed.SchemaVersion != 2 || len(pushed.Manifests) != 1 || pushed.Manifests[0].Platform.Architecture != "arm64" {
+		t.Errorf("unexpected manifest list %+v", pushed)
+	}
+}
@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// operationLimit limits the pulls, pushes and builds of a provider running
+// at once to its max_concurrent_operations, so an apply with many images
+// does not saturate the daemon or the uplink. A nil limit or one without
+// slots is no limit.
+type operationLimit struct {
+	slots chan struct{}
+}
+
+func newOperationLimit(max int) *operationLimit {
+	limit := &operationLimit{}
+	if max > 0 {
+		limit.slots = make(chan struct{}, max)
+	}
+	return limit
+}
+
+// acquire waits until less than max_concurrent_operations are running and
+// returns the func releasing the slot of the operation
+func (l *operationLimit) acquire(ctx context.Context, operation string) (func(), error) {
+	if l == nil || l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		log.Printf("[DEBUG] Waiting to start the %s, %d operations are running already", operation, cap(l.slots))
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Timeout waiting to start the %s, %d operations are running already: %s", operation, cap(l.slots), ctx.Err())
+		}
+	}
+	return func() { <-l.slots }, nil
+}
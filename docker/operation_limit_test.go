@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOperationLimit(t *testing.T) {
+	limit := newOperationLimit(2)
+
+	first, err := limit.acquire(context.Background(), "pull of alpine:latest")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := limit.acquire(context.Background(), "pull of nginx:latest"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limit.acquire(ctx, "push of app:1.0"); err == nil || !strings.Contains(err.Error(), "2 operations are running") {
+		t.Errorf("expected the push to wait for a slot, got %v", err)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		release, err := limit.acquire(context.Background(), "push of app:1.0")
+		if err == nil {
+			release()
+		}
+		close(started)
+	}()
+	first()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Error("expected the push to start once the pull released its slot")
+	}
+
+	for _, limit := range []*operationLimit{newOperationLimit(0), nil} {
+		for i := 0; i < 10; i++ {
+			if _, err := limit.acquire(context.Background(), "build of app:1.0"); err != nil {
+				t.Fatalf("expected no limit, got %s", err)
+			}
+		}
+	}
+}
@@ -6,27 +6,43 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/user"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/docker/cli/cli/config/configfile"
 	"github.com/docker/docker/api/types"
 
+	"github.com/docker/go-units"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
 )
 
 // Provider creates the Docker provider
 func Provider() terraform.ResourceProvider {
-	return &schema.Provider{
+	provider := &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"host": {
 				Type:        schema.TypeString,
 				Required:    true,
-				DefaultFunc: schema.EnvDefaultFunc("DOCKER_HOST", "unix:///var/run/docker.sock"),
+				DefaultFunc: schema.EnvDefaultFunc("DOCKER_HOST", defaultDockerHost),
 				Description: "The Docker daemon address",
 			},
 
+			"engine": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      engineDocker,
+				ValidateFunc: validateStringMatchesPattern(`^(docker|podman)$`),
+				Description:  "Engine serving the API, 'docker' or 'podman' for the Docker-compatible API of Podman",
+			},
+
+			"context": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Name of a context of the docker CLI to read the daemon address and TLS material from, overriding host and the certificates",
+			},
+
 			"ca_material": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -53,6 +69,213 @@ func Provider() terraform.ResourceProvider {
 				Description: "Path to directory with Docker TLS config",
 			},
 
+			"api_version": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DOCKER_API_VERSION", ""),
+				ValidateFunc: validateStringMatchesPattern(`^(1\.[0-9]+)?$`),
+				Description:  "Version of the Docker API to use, e.g. 1.40. The version is negotiated with the daemon if not set",
+			},
+
+			"proxy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateStringMatchesPattern(`^((https?|socks5)://.+)?$`),
+				Description:  "Proxy of the connections to a tcp host and to registries, e.g. http://proxy:3128 or socks5://proxy:1080. Defaults to HTTPS_PROXY and HTTP_PROXY",
+			},
+
+			"no_proxy": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Comma separated hosts, domains and CIDRs which are connected to without the proxy. Defaults to NO_PROXY",
+			},
+
+			"trace_api_calls": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOCKER_TRACE_API_CALLS", false),
+				Description: "Log each request to the Docker daemon with the resource it is made for, its status and duration",
+			},
+
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      3,
+				ValidateFunc: validateIntegerGeqThan(0),
+				Description:  "Maximum number of retries of Docker API calls failing with a transient connection error",
+			},
+
+			"retry_backoff": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "500ms",
+				ValidateFunc: validateDurationGeq0(),
+				Description:  "Initial backoff between the retries of Docker API calls (ms|s|m|h)",
+			},
+
+			"connect_max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validateIntegerGeqThan(0),
+				Description:  "Maximum number of retries of the connect to the Docker host while it is not reachable, e.g. while it is provisioned in the same run",
+			},
+
+			"connect_retry_backoff": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1s",
+				ValidateFunc: validateDurationGeq0(),
+				Description:  "Initial backoff between the retries of the connect to the Docker host (ms|s|m|h), it doubles up to 30s",
+			},
+
+			"wait_for_daemon": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Wait for the daemon to answer and check that the provider can manage it before any operation",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"timeout": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "5m",
+							ValidateFunc: validateDurationGeq0(),
+							Description:  "Maximum time to wait for the daemon (ms|s|m|h)",
+						},
+						"os": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateStringMatchesPattern(`^(linux|windows)?$`),
+							Description:  "Operating system of the containers the daemon has to run, linux or windows",
+						},
+					},
+				},
+			},
+
+			"registry_max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      3,
+				ValidateFunc: validateIntegerGeqThan(0),
+				Description:  "Maximum number of retries of pulls and pushes failing with a transient registry error",
+			},
+
+			"max_concurrent_layer_copies": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      3,
+				ValidateFunc: validateIntegerGeqThan(1),
+				Description:  "Maximum number of layers the provider copies in parallel for a docker_image_copy",
+			},
+
+			"registry_retry_backoff": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1s",
+				ValidateFunc: validateDurationGeq0(),
+				Description:  "Initial backoff between the retries of pulls and pushes (ms|s|m|h)",
+			},
+
+			"registry_mirrors": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Registries mirroring Docker Hub which images of Docker Hub are pulled from, e.g. mirror.example.com",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateStringMatchesPattern(`^(https?://)?[^/:]+(:[0-9]+)?(/[^:@]+)?/?$`),
+				},
+			},
+
+			"config_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"config_file_content"},
+				Description:   "Path to the docker config file, or its directory, with the credentials of the registries without a registry_auth. Defaults to the one of DOCKER_CONFIG or ~/.docker/config.json",
+			},
+
+			"config_file_content": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"config_file"},
+				Description:   "Plain content of the docker config file with the credentials of the registries without a registry_auth",
+			},
+
+			"default_labels": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Labels added to all the containers, networks, volumes and image builds, the labels of a resource take precedence",
+			},
+
+			"features": providerFeaturesSchema,
+
+			"disable_remote_pull": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOCKER_DISABLE_REMOTE_PULL", false),
+				Description: "Fail instead of pulling images which are missing in the daemon, for air-gapped hosts",
+			},
+
+			"max_concurrent_operations": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validateIntegerGeqThan(0),
+				Description:  "Maximum number of image pulls, pushes and builds running at once, 0 for no limit",
+			},
+
+			"context_size_warning_threshold": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1GB",
+				ValidateFunc: validateStringIsHumanSize(),
+				Description:  "Size of a build context above which a warning is logged, e.g. 500MB. 0 disables the warning",
+			},
+
+			"default_timeouts": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Default timeouts of the operations of all resources (ms|s|m|h)",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"connect": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDurationGeq0(),
+							Description:  "Timeout of the ping of the Docker host when the provider connects",
+						},
+						"pull": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDurationGeq0(),
+							Description:  "Timeout of a pull of an image",
+						},
+						"push": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDurationGeq0(),
+							Description:  "Timeout of a push of an image",
+						},
+						"build": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDurationGeq0(),
+							Description:  "Timeout of a build of an image",
+						},
+					},
+				},
+			},
+
+			"timing_report_path": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOCKER_TIMING_REPORT_PATH", ""),
+				Description: "Path of a JSON file the durations of the build, pull, push and create operations of an apply are written to",
+			},
+
 			"registry_auth": {
 				Type:     schema.TypeSet,
 				Optional: true,
@@ -67,6 +290,7 @@ func Provider() terraform.ResourceProvider {
 						"username": {
 							Type:          schema.TypeString,
 							Optional:      true,
+							Sensitive:     true,
 							ConflictsWith: []string{"registry_auth.config_file", "registry_auth.config_file_content"},
 							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_REGISTRY_USER", ""),
 							Description:   "Username for the registry",
@@ -85,16 +309,63 @@ func Provider() terraform.ResourceProvider {
 							Type:          schema.TypeString,
 							Optional:      true,
 							ConflictsWith: []string{"registry_auth.username", "registry_auth.password", "registry_auth.config_file_content"},
-							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_CONFIG", "~/.docker/config.json"),
+							DefaultFunc:   schema.EnvDefaultFunc("DOCKER_CONFIG", defaultRegistryConfigFile),
 							Description:   "Path to docker json file for registry auth",
 						},
 
 						"config_file_content": {
 							Type:          schema.TypeString,
 							Optional:      true,
+							Sensitive:     true,
 							ConflictsWith: []string{"registry_auth.username", "registry_auth.password", "registry_auth.config_file"},
 							Description:   "Plain content of the docker json file for registry auth",
 						},
+
+						"credential_helper": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Name of the docker-credential-<name> binary which returns the credentials of the registry",
+						},
+
+						"insecure_skip_verify": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Skip the verification of the TLS certificate of the registry, e.g. a self-signed one",
+						},
+
+						"plain_http": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Connect to the registry with plain HTTP instead of HTTPS",
+						},
+
+						"ecr_auth": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Exchange the AWS credentials for an authorization token of the ECR registry",
+						},
+
+						"gcr_auth": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Authenticate to gcr.io or Artifact Registry with Google access tokens",
+						},
+
+						"gcr_credentials": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "JSON key of the service account of gcr_auth, the Application Default Credentials are used if not set",
+						},
+
+						"auth_command": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "Command printing the credentials of the registry as JSON, run when they are needed",
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
 					},
 				},
 			},
@@ -102,7 +373,11 @@ func Provider() terraform.ResourceProvider {
 
 		ResourcesMap: map[string]*schema.Resource{
 			"docker_container":      resourceDockerContainer(),
+			"docker_container_exec": resourceDockerContainerExec(),
 			"docker_image":          resourceDockerImage(),
+			"docker_image_bake":     resourceDockerImageBake(),
+			"docker_image_copy":     resourceDockerImageCopy(),
+			"docker_tag":            resourceDockerTag(),
 			"docker_registry_image": resourceDockerRegistryImage(),
 			"docker_network":        resourceDockerNetwork(),
 			"docker_volume":         resourceDockerVolume(),
@@ -114,45 +389,118 @@ func Provider() terraform.ResourceProvider {
 		DataSourcesMap: map[string]*schema.Resource{
 			"docker_registry_image": dataSourceDockerRegistryImage(),
 			"docker_network":        dataSourceDockerNetwork(),
+			"docker_container_file": dataSourceDockerContainerFile(),
 		},
 
 		ConfigureFunc: providerConfigure,
 	}
+	traceResources(provider.ResourcesMap)
+	traceResources(provider.DataSourcesMap)
+	return provider
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
-	config := Config{
-		Host:     d.Get("host").(string),
-		Ca:       d.Get("ca_material").(string),
-		Cert:     d.Get("cert_material").(string),
-		Key:      d.Get("key_material").(string),
-		CertPath: d.Get("cert_path").(string),
+	retryBackoff, err := time.ParseDuration(d.Get("retry_backoff").(string))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing retry_backoff: %s", err)
 	}
 
-	client, err := config.NewClient()
+	connectRetryBackoff, err := time.ParseDuration(d.Get("connect_retry_backoff").(string))
 	if err != nil {
-		return nil, fmt.Errorf("Error initializing Docker client: %s", err)
+		return nil, fmt.Errorf("Error parsing connect_retry_backoff: %s", err)
 	}
 
-	ctx := context.Background()
-	_, err = client.Ping(ctx)
+	registryRetryBackoff, err := time.ParseDuration(d.Get("registry_retry_backoff").(string))
 	if err != nil {
-		return nil, fmt.Errorf("Error pinging Docker server: %s", err)
+		return nil, fmt.Errorf("Error parsing registry_retry_backoff: %s", err)
 	}
 
-	authConfigs := &AuthConfigs{}
+	contextSizeWarningThreshold, err := units.FromHumanSize(d.Get("context_size_warning_threshold").(string))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing context_size_warning_threshold: %s", err)
+	}
+
+	defaultTimeouts, err := providerSetToOperationTimeouts(d.Get("default_timeouts").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
+	config := Config{
+		Host:         d.Get("host").(string),
+		Ca:           d.Get("ca_material").(string),
+		Cert:         d.Get("cert_material").(string),
+		Key:          d.Get("key_material").(string),
+		CertPath:     d.Get("cert_path").(string),
+		MaxRetries:   d.Get("max_retries").(int),
+		RetryBackoff: retryBackoff,
+		APIVersion:   d.Get("api_version").(string),
+
+		ConnectTimeout:      defaultTimeouts["connect"],
+		ConnectMaxRetries:   d.Get("connect_max_retries").(int),
+		ConnectRetryBackoff: connectRetryBackoff,
+		Proxy:               d.Get("proxy").(string),
+		NoProxy:             d.Get("no_proxy").(string),
+		TraceAPICalls:       d.Get("trace_api_calls").(bool),
+		traceResource:       "configure provider",
+	}
+	defaultConfig := newDefaultDockerConfig(d.Get("config_file").(string), d.Get("config_file_content").(string))
+	if d.Get("config_file").(string) != "" || d.Get("config_file_content").(string) != "" {
+		if _, err := defaultConfig.load(); err != nil {
+			return nil, fmt.Errorf("Error loading the docker config file: %s", err)
+		}
+	}
+	contextName := dockerContextName(d.Get("context").(string), config.Host)
+	engine := d.Get("engine").(string)
+	if config.Host == defaultDockerHost && os.Getenv("DOCKER_HOST") == "" {
+		config.Host = engineHost(engine)
+	}
+	if err := config.applyDockerContext(contextName); err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] Connecting to the Docker host %s", config.Host)
+
+	wait, err := providerSetToWaitForDaemon(d.Get("wait_for_daemon").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	client, err := wait.connect(context.Background(), &config, engine)
+	if err != nil {
+		return nil, err
+	}
+
+	transports := newRegistryTransports(config.Proxy, config.NoProxy)
+	authConfigs := &AuthConfigs{transports: transports}
 
 	if v, ok := d.GetOk("registry_auth"); ok { // TODO load them anyway
-		authConfigs, err = providerSetToRegistryAuth(v.(*schema.Set))
+		authConfigs, err = providerSetToRegistryAuth(v.(*schema.Set), transports)
 
 		if err != nil {
 			return nil, fmt.Errorf("Error loading registry auth config: %s", err)
 		}
 	}
+	authConfigs.defaultConfig = defaultConfig
 
 	providerConfig := ProviderConfig{
 		DockerClient: client,
 		AuthConfigs:  authConfigs,
+		TimingReport: newTimingReport(d.Get("timing_report_path").(string)),
+
+		ContextSizeWarningThreshold: contextSizeWarningThreshold,
+		RegistryRetries: registryRetries{
+			maxRetries: d.Get("registry_max_retries").(int),
+			backoff:    registryRetryBackoff,
+		},
+		LayerCopies:       d.Get("max_concurrent_layer_copies").(int),
+		Operations:        newOperationLimit(d.Get("max_concurrent_operations").(int)),
+		RegistryMirrors:   stringListToStringSlice(d.Get("registry_mirrors").([]interface{})),
+		DisableRemotePull: d.Get("disable_remote_pull").(bool),
+		DefaultTimeouts:   defaultTimeouts,
+		Engine:            engine,
+		DefaultLabels:     mapTypeMapValsToString(d.Get("default_labels").(map[string]interface{})),
+		Features:          providerSetToFeatures(d.Get("features").([]interface{})),
+	}
+	if config.TraceAPICalls {
+		providerConfig.traceConfig = &config
 	}
 
 	return &providerConfig, nil
@@ -162,81 +510,324 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 // PushImage method accommodating the new X-Registry-Config header
 type AuthConfigs struct {
 	Configs map[string]types.AuthConfig `json:"configs"`
+	// tokens are the short-lived tokens of the registries with ecr_auth,
+	// gcr_auth or an auth_command by address
+	tokens map[string]*registryToken
+	// patterns are the registry_auth blocks with wildcards in the address,
+	// the most specific first
+	patterns []*registryAuthPattern
+	// transports are the transport options of the registries of the provider
+	transports *registryTransports
+	// defaultConfig resolves the credentials of the registries without a
+	// registry_auth
+	defaultConfig *defaultDockerConfig
 }
 
 // Take the given registry_auth schemas and return a map of registry auth configurations
-func providerSetToRegistryAuth(authSet *schema.Set) (*AuthConfigs, error) {
+func providerSetToRegistryAuth(authSet *schema.Set, transports *registryTransports) (*AuthConfigs, error) {
 	authConfigs := AuthConfigs{
-		Configs: make(map[string]types.AuthConfig),
+		Configs:    make(map[string]types.AuthConfig),
+		tokens:     make(map[string]*registryToken),
+		transports: transports,
 	}
 
 	for _, authInt := range authSet.List() {
 		auth := authInt.(map[string]interface{})
-		authConfig := types.AuthConfig{}
-		authConfig.ServerAddress = normalizeRegistryAddress(auth["address"].(string))
-		registryHostname := convertToHostname(authConfig.ServerAddress)
-
-		// For each registry_auth block, generate an AuthConfiguration using either
-		// username/password or the given config file
-		if username, ok := auth["username"]; ok && username.(string) != "" {
-			log.Println("[DEBUG] Using username for registry auths:", username)
-			authConfig.Username = auth["username"].(string)
-			authConfig.Password = auth["password"].(string)
-
-			// Note: check for config_file_content first because config_file has a default which would be used
-			// nevertheless config_file_content is set or not. The default has to be kept to check for the
-			// environment variable and to be backwards compatible
-		} else if configFileContent, ok := auth["config_file_content"]; ok && configFileContent.(string) != "" {
-			log.Println("[DEBUG] Parsing file content for registry auths:", configFileContent.(string))
-			r := strings.NewReader(configFileContent.(string))
-
-			c, err := loadConfigFile(r)
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing docker registry config json: %v", err)
-			}
-			authFileConfig, err := c.GetAuthConfig(registryHostname)
-			if err != nil {
-				return nil, fmt.Errorf("Couldn't find registry config for '%s' in file content", registryHostname)
-			}
-			authConfig.Username = authFileConfig.Username
-			authConfig.Password = authFileConfig.Password
-
-			// As last step we check if a config file path is given
-		} else if configFile, ok := auth["config_file"]; ok && configFile.(string) != "" {
-			filePath := configFile.(string)
-			log.Println("[DEBUG] Parsing file for registry auths:", filePath)
-
-			// We manually expand the path and do not use the 'pathexpand' interpolation function
-			// because in the default of this varable we refer to '~/.docker/config.json'
-			if strings.HasPrefix(filePath, "~/") {
-				usr, err := user.Current()
-				if err != nil {
-					return nil, err
-				}
-				filePath = strings.Replace(filePath, "~", usr.HomeDir, 1)
-			}
-			r, err := os.Open(filePath)
-			if err != nil {
-				continue
-			}
-			c, err := loadConfigFile(r)
-			if err != nil {
-				continue
-			}
-			authFileConfig, err := c.GetAuthConfig(registryHostname)
-			if err != nil {
-				continue
-			}
-			authConfig.Username = authFileConfig.Username
-			authConfig.Password = authFileConfig.Password
+		registryHostname := convertToHostname(auth["address"].(string))
+		// only the registry_auth of the provider has transport options. They
+		// are registered first, so the addresses of plain HTTP registries are
+		// normalized to http://
+		plainHTTP, ok := auth["plain_http"].(bool)
+		if ok {
+			transports.set(registryHostname, registryTransport{
+				insecureSkipVerify: auth["insecure_skip_verify"].(bool),
+				plainHTTP:          plainHTTP,
+			})
 		}
 
+		// the credentials of an address with wildcards are resolved for each
+		// registry it matches once the registry is used
+		if isRegistryAddressPattern(registryHostname) {
+			log.Println("[DEBUG] Matching registry auths against:", registryHostname)
+			authConfigs.patterns = append(authConfigs.patterns, newRegistryAuthPattern(registryHostname, auth, transports))
+			continue
+		}
+
+		serverAddress := transports.normalizeRegistryAddress(auth["address"].(string))
+		if plainHTTP {
+			serverAddress = transports.normalizeRegistryAddress(registryHostname)
+		}
+		authConfig, token, ok, err := registryAuthFromBlock(transports, auth, serverAddress)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if token != nil {
+			authConfigs.tokens[authConfig.ServerAddress] = token
+		}
 		authConfigs.Configs[authConfig.ServerAddress] = authConfig
 	}
+	sortRegistryAuthPatterns(authConfigs.patterns)
 
 	return &authConfigs, nil
 }
 
+// registryAuthFromBlock returns the credentials of the registry_auth block
+// for the registry with the server address. It returns false if the config
+// file of the block cannot be read, the block is ignored then.
+func registryAuthFromBlock(transports *registryTransports, auth map[string]interface{}, serverAddress string) (types.AuthConfig, *registryToken, bool, error) {
+	authConfig := types.AuthConfig{ServerAddress: serverAddress}
+	registryHostname := convertToHostname(serverAddress)
+	var token *registryToken
+
+	// For each registry_auth block, generate an AuthConfiguration using either
+	// a token, a credential helper, username/password or the given config file
+	if source, err := registryAuthTokenSource(transports, auth, serverAddress); err != nil {
+		return authConfig, nil, false, err
+	} else if source != nil {
+		token = newRegistryToken(source)
+		tokenConfig, err := token.get(false)
+		if err != nil {
+			return authConfig, nil, false, err
+		}
+		authConfig.Username = tokenConfig.Username
+		authConfig.Password = tokenConfig.Password
+		authConfig.IdentityToken = tokenConfig.IdentityToken
+		authConfig.RegistryToken = tokenConfig.RegistryToken
+	} else if helper, ok := auth["credential_helper"].(string); ok && helper != "" {
+		log.Printf("[DEBUG] Using docker-credential-%s for registry auths: %s", helper, serverAddress)
+		helperConfig, err := credentialHelperAuth(helper, registryHostname)
+		if err != nil {
+			return authConfig, nil, false, fmt.Errorf("Error getting the credentials of registry '%s' from docker-credential-%s: %s", registryHostname, helper, err)
+		}
+		authConfig.Username = helperConfig.Username
+		authConfig.Password = helperConfig.Password
+		authConfig.IdentityToken = helperConfig.IdentityToken
+	} else if username, ok := auth["username"]; ok && username.(string) != "" {
+		log.Println("[DEBUG] Using username for registry auths:", serverAddress)
+		authConfig.Username = auth["username"].(string)
+		authConfig.Password = auth["password"].(string)
+
+		// Note: check for config_file_content first because config_file has a default which would be used
+		// nevertheless config_file_content is set or not. The default has to be kept to check for the
+		// environment variable and to be backwards compatible
+	} else if configFileContent, ok := auth["config_file_content"]; ok && configFileContent.(string) != "" {
+		log.Println("[DEBUG] Parsing file content for registry auths:", serverAddress)
+		r := strings.NewReader(configFileContent.(string))
+
+		c, err := loadConfigFile(r)
+		if err != nil {
+			return authConfig, nil, false, fmt.Errorf("Error parsing docker registry config json: %v", err)
+		}
+		authFileConfig, err := getAuthConfigFromConfigFile(c, registryHostname)
+		if err != nil {
+			return authConfig, nil, false, fmt.Errorf("Couldn't find registry config for '%s' in file content: %v", registryHostname, err)
+		}
+		authConfig.Username = authFileConfig.Username
+		authConfig.Password = authFileConfig.Password
+
+		// As last step we check if a config file path is given
+	} else if configFile, ok := auth["config_file"]; ok && configFile.(string) != "" {
+		filePath := configFile.(string)
+		log.Println("[DEBUG] Parsing file for registry auths:", filePath)
+
+		// We manually expand the path and do not use the 'pathexpand' interpolation function
+		// because in the default of this varable we refer to '~/.docker/config.json'. Like
+		// DOCKER_CONFIG, the path may also be the directory of the config file.
+		c, err := loadConfigFilePath(filePath)
+		if err != nil {
+			// a missing default config file is no error, registries are often public
+			if filePath != defaultRegistryConfigFile || !os.IsNotExist(err) {
+				log.Printf("[WARN] Ignoring the registry auth of '%s', reading '%s' failed: %s", registryHostname, filePath, err)
+			}
+			return authConfig, nil, false, nil
+		}
+		authFileConfig, err := getAuthConfigFromConfigFile(c, registryHostname)
+		if err != nil {
+			log.Printf("[WARN] Couldn't get the credentials of registry '%s' from '%s': %s", registryHostname, filePath, err)
+			return authConfig, nil, false, nil
+		}
+		authConfig.Username = authFileConfig.Username
+		authConfig.Password = authFileConfig.Password
+	}
+
+	// only the registry_auth of resources has a registry token
+	if registryToken, ok := auth["registry_token"].(string); ok && registryToken != "" {
+		log.Println("[DEBUG] Using registry token for registry auths:", serverAddress)
+		authConfig.RegistryToken = registryToken
+	}
+
+	return authConfig, token, true, nil
+}
+
+// resourceRegistryAuthSchema is the schema of the registry_auth block of
+// resources. In contrast to the one of the provider it is resolved when the
+// resource is created or updated, so credentials which are only known during
+// the apply can be used.
+var resourceRegistryAuthSchema = &schema.Schema{
+	Type:        schema.TypeSet,
+	Optional:    true,
+	Description: "Registry credentials used for this resource only, overriding the ones of the provider",
+	Elem: &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"address": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "Address of the registry",
+			},
+
+			"username": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "Username for the registry",
+			},
+
+			"password": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "Password for the registry",
+			},
+
+			"config_file_content": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "Plain content of the docker json file for registry auth",
+			},
+
+			"credential_helper": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Name of the docker-credential-<name> binary which returns the credentials of the registry",
+			},
+
+			"registry_token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "Bearer token the Docker daemon sends to the registry for pulls and pushes instead of a username and password",
+			},
+
+			"ecr_auth": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Exchange the AWS credentials for an authorization token of the ECR registry",
+			},
+
+			"gcr_auth": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Authenticate to gcr.io or Artifact Registry with Google access tokens",
+			},
+
+			"gcr_credentials": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Description: "JSON key of the service account of gcr_auth, the Application Default Credentials are used if not set",
+			},
+
+			"auth_command": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Command printing the credentials of the registry as JSON, run when they are needed",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	},
+}
+
+// registryAuthTokenSource returns the source of the tokens of the
+// registry_auth block with ecr_auth, gcr_auth or an auth_command, nil
+// otherwise
+func registryAuthTokenSource(transports *registryTransports, auth map[string]interface{}, address string) (registryTokenSource, error) {
+	if ecrAuth, ok := auth["ecr_auth"].(bool); ok && ecrAuth {
+		log.Println("[DEBUG] Using ECR token for registry auths:", address)
+		return ecrTokenSource(transports, address)
+	}
+	if gcrAuth, ok := auth["gcr_auth"].(bool); ok && gcrAuth {
+		log.Println("[DEBUG] Using Google access token for registry auths:", address)
+		return gcrTokenSource(transports, address, auth["gcr_credentials"].(string))
+	}
+	if rawCommand, ok := auth["auth_command"].([]interface{}); ok && len(rawCommand) > 0 {
+		log.Println("[DEBUG] Using auth_command for registry auths:", address)
+		return authCommandTokenSource(address, stringListToStringSlice(rawCommand))
+	}
+	return nil, nil
+}
+
+// resourceAuthConfigs returns the auth configs of the provider merged with the
+// ones of the registry_auth block of the resource. A new map is returned on
+// every call, so the configs shared by all resources are never modified.
+func resourceAuthConfigs(d resourceGetter, meta interface{}) (*AuthConfigs, error) {
+	authConfigs, err := providerAuthConfigs(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := d.Get("registry_auth").(*schema.Set)
+	if !ok || v.Len() == 0 {
+		return authConfigs, nil
+	}
+	resourceConfigs, err := providerSetToRegistryAuth(v, authConfigs.transports)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading registry auth config: %s", err)
+	}
+	for address, authConfig := range resourceConfigs.Configs {
+		authConfigs.Configs[address] = authConfig
+		delete(authConfigs.tokens, address)
+		if token, ok := resourceConfigs.tokens[address]; ok {
+			authConfigs.tokens[address] = token
+		}
+	}
+	// the wildcards of the resource are matched before the ones of the provider
+	authConfigs.patterns = append(resourceConfigs.patterns, authConfigs.patterns...)
+	log.Printf("[DEBUG] Using resource registry auth for '%v'", registryAddresses(resourceConfigs.Configs))
+
+	return authConfigs, nil
+}
+
+// providerAuthConfigs returns a copy of the auth configs of the provider with
+// valid tokens, which expire during long applies
+func providerAuthConfigs(meta interface{}) (*AuthConfigs, error) {
+	authConfigs := &AuthConfigs{
+		Configs: make(map[string]types.AuthConfig),
+		tokens:  make(map[string]*registryToken),
+	}
+	if providerAuthConfigs := meta.(*ProviderConfig).AuthConfigs; providerAuthConfigs != nil {
+		for address, authConfig := range providerAuthConfigs.Configs {
+			authConfigs.Configs[address] = authConfig
+		}
+		for address, token := range providerAuthConfigs.tokens {
+			authConfigs.tokens[address] = token
+		}
+		authConfigs.patterns = providerAuthConfigs.patterns
+		authConfigs.transports = providerAuthConfigs.transports
+		authConfigs.defaultConfig = providerAuthConfigs.defaultConfig
+	}
+	if err := refreshRegistryTokens(authConfigs); err != nil {
+		return nil, err
+	}
+	return authConfigs, nil
+}
+
+// registryAddresses returns the registry addresses of the given auth configs
+// so they can be logged without leaking any credentials
+func registryAddresses(authConfigs map[string]types.AuthConfig) []string {
+	addresses := make([]string, 0, len(authConfigs))
+	for address := range authConfigs {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
 func loadConfigFile(configData io.Reader) (*configfile.ConfigFile, error) {
 	configFile := configfile.New("")
 	if err := configFile.LoadFromReader(configData); err != nil {
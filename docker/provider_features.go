@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// providerFeatures are the opt-in behavior changes of the features block of
+// the provider. They are off by default, so existing configurations keep
+// working until they enable them.
+type providerFeatures struct {
+	Image imageFeatures
+}
+
+// imageFeatures are the features of docker_image
+type imageFeatures struct {
+	// DetectDigestDrift replaces a pulled image if its tag points to another
+	// digest in the registry
+	DetectDigestDrift bool
+	// DeleteRemoteTagsOnDestroy deletes the pushed images from the registry
+	// when the resource is destroyed
+	DeleteRemoteTagsOnDestroy bool
+}
+
+var providerFeaturesSchema = &schema.Schema{
+	Type:        schema.TypeList,
+	Optional:    true,
+	MaxItems:    1,
+	Description: "Opt-in behavior changes of the resources",
+	Elem: &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"image": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Features of docker_image",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"detect_digest_drift": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+							Description: "Replace pulled images whose tag points to another digest in the registry",
+						},
+
+						"delete_remote_tags_on_destroy": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+							Description: "Delete the images pushed with push_remote and push_targets from the registry on destroy",
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func providerSetToFeatures(rawFeatures []interface{}) providerFeatures {
+	features := providerFeatures{}
+	if len(rawFeatures) == 0 || rawFeatures[0] == nil {
+		return features
+	}
+	rawImages := rawFeatures[0].(map[string]interface{})["image"].([]interface{})
+	if len(rawImages) > 0 && rawImages[0] != nil {
+		rawImage := rawImages[0].(map[string]interface{})
+		features.Image.DetectDigestDrift = rawImage["detect_digest_drift"].(bool)
+		features.Image.DeleteRemoteTagsOnDestroy = rawImage["delete_remote_tags_on_destroy"].(bool)
+	}
+	return features
+}
@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func TestProviderSetToFeatures(t *testing.T) {
+	if features := providerSetToFeatures(nil); features.Image.DetectDigestDrift || features.Image.DeleteRemoteTagsOnDestroy {
+		t.Errorf("expected the features to be off by default, got %+v", features)
+	}
+
+	d := schema.TestResourceDataRaw(t, Provider().(*schema.Provider).Schema, map[string]interface{}{
+		"features": []interface{}{
+			map[string]interface{}{
+				"image": []interface{}{
+					map[string]interface{}{"detect_digest_drift": true},
+				},
+			},
+		},
+	})
+	features := providerSetToFeatures(d.Get("features").([]interface{}))
+	if !features.Image.DetectDigestDrift {
+		t.Errorf("expected detect_digest_drift to be enabled, got %+v", features)
+	}
+	if features.Image.DeleteRemoteTagsOnDestroy {
+		t.Errorf("expected delete_remote_tags_on_destroy to be disabled, got %+v", features)
+	}
+
+	// an empty block keeps the defaults
+	d = schema.TestResourceDataRaw(t, Provider().(*schema.Provider).Schema, map[string]interface{}{
+		"features": []interface{}{map[string]interface{}{}},
+	})
+	if features := providerSetToFeatures(d.Get("features").([]interface{})); features.Image.DetectDigestDrift {
+		t.Errorf("expected the features to be off for an empty block, got %+v", features)
+	}
+}
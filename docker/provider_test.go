@@ -1,10 +1,14 @@
 package docker
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os/exec"
 	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/docker/docker/api/types"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
@@ -39,6 +43,92 @@ func TestAccDockerProvider_WithIncompleteRegistryAuth(t *testing.T) {
 	})
 }
 
+func TestResourceAuthConfigs(t *testing.T) {
+	providerConfig := &ProviderConfig{
+		AuthConfigs: &AuthConfigs{
+			Configs: map[string]types.AuthConfig{
+				"https://provider.example.com": {Username: "provider"},
+				"https://resource.example.com": {Username: "provider"},
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, resourceDockerImage().Schema, map[string]interface{}{
+		"name": "resource.example.com/foo:1.0",
+		"registry_auth": []interface{}{
+			map[string]interface{}{
+				"address":  "resource.example.com",
+				"username": "resource",
+				"password": "secret",
+			},
+			map[string]interface{}{
+				"address":        "tenant.example.com",
+				"registry_token": "token",
+			},
+		},
+	})
+
+	authConfigs, err := resourceAuthConfigs(d, providerConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if username := authConfigs.Configs["https://provider.example.com"].Username; username != "provider" {
+		t.Errorf("expected provider credentials to be kept, got %q", username)
+	}
+	if username := authConfigs.Configs["https://resource.example.com"].Username; username != "resource" {
+		t.Errorf("expected resource credentials to override the provider ones, got %q", username)
+	}
+	if token := authConfigs.Configs["https://tenant.example.com"].RegistryToken; token != "token" {
+		t.Errorf("expected the registry token of the resource, got %q", token)
+	}
+	if username := providerConfig.AuthConfigs.Configs["https://resource.example.com"].Username; username != "provider" {
+		t.Errorf("expected provider credentials not to be modified, got %q", username)
+	}
+}
+
+func TestRegistryTransports(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", "sha256:1234")
+	})
+	plainServer := httptest.NewServer(handler)
+	defer plainServer.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	plainHost := strings.TrimPrefix(plainServer.URL, "http://")
+	tlsHost := strings.TrimPrefix(tlsServer.URL, "https://")
+
+	if _, err := getImageDigest(newRegistryTransports("", ""), tlsHost, "foo", "1.0", "", "", false); err == nil {
+		t.Fatal("expected the self-signed certificate to be rejected")
+	}
+
+	d := schema.TestResourceDataRaw(t, testAccProvider.Schema, map[string]interface{}{
+		"registry_auth": []interface{}{
+			map[string]interface{}{"address": plainHost, "username": "plain", "plain_http": true},
+			map[string]interface{}{"address": "https://" + tlsHost, "username": "tls", "insecure_skip_verify": true},
+		},
+	})
+	authConfigs, err := providerSetToRegistryAuth(d.Get("registry_auth").(*schema.Set), newRegistryTransports("", ""))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if authConfigs.Configs["http://"+plainHost].Username != "plain" || authConfigs.transports.normalizeRegistryAddress(plainHost) != "http://"+plainHost {
+		t.Errorf("expected the plain HTTP registry to be normalized to http://, got %v", authConfigs.Configs)
+	}
+	for _, host := range []string{plainHost, tlsHost} {
+		if digest, err := getImageDigest(authConfigs.transports, host, "foo", "1.0", "", "", false); err != nil || digest != "sha256:1234" {
+			t.Errorf("expected the digest from %s, got %q and %v", host, digest, err)
+		}
+	}
+	// the addresses of images are normalized to https://, the transport of
+	// the registry sends the requests over HTTP
+	if descriptor, err := getManifestDescriptor(authConfigs.transports, createPushImageOptions(plainHost+"/foo:1.0"), "", ""); err != nil || descriptor.Digest != "sha256:1234" {
+		t.Errorf("expected the manifest of the image from the plain HTTP registry, got %v and %v", descriptor, err)
+	}
+	if normalizeRegistryAddress(plainHost) != "https://"+plainHost {
+		t.Errorf("expected the transport options to be scoped to the provider, got %s", normalizeRegistryAddress(plainHost))
+	}
+}
+
 func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = Provider()
 }
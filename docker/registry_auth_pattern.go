@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/docker/api/types"
+)
+
+// registryAuthPattern is a registry_auth block with wildcards in its address,
+// e.g. *.dkr.ecr.*.amazonaws.com for the ECR registries of all the accounts
+// and regions. Its credentials are resolved for each registry it matches
+// when the registry is first used, so a token is only requested for the
+// registries the resources use.
+type registryAuthPattern struct {
+	hostname   string
+	auth       map[string]interface{}
+	transports *registryTransports
+
+	mutex    sync.Mutex
+	resolved map[string]registryAuthMatch
+}
+
+// registryAuthMatch are the credentials a registryAuthPattern resolved for
+// the registry of a server address
+type registryAuthMatch struct {
+	authConfig types.AuthConfig
+	token      *registryToken
+	ok         bool
+}
+
+func newRegistryAuthPattern(hostname string, auth map[string]interface{}, transports *registryTransports) *registryAuthPattern {
+	return &registryAuthPattern{
+		hostname:   hostname,
+		auth:       auth,
+		transports: transports,
+		resolved:   make(map[string]registryAuthMatch),
+	}
+}
+
+// isRegistryAddressPattern reports whether the hostname of a registry_auth
+// has wildcards
+func isRegistryAddressPattern(registryHostname string) bool {
+	return strings.Contains(registryHostname, "*")
+}
+
+// matchRegistryHostname reports whether the hostname matches the pattern
+// label by label. A * only matches within a label, so *.example.com matches
+// eu.example.com but neither example.com nor a.eu.example.com.
+func matchRegistryHostname(pattern, registryHostname string) bool {
+	patternLabels := strings.Split(pattern, ".")
+	labels := strings.Split(registryHostname, ".")
+	if len(patternLabels) != len(labels) {
+		return false
+	}
+	for i, label := range labels {
+		if ok, err := path.Match(patternLabels[i], label); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRegistryAuthPatterns sorts the patterns by the number of characters
+// which are not wildcards, so the most specific pattern matching a registry
+// is used
+func sortRegistryAuthPatterns(patterns []*registryAuthPattern) {
+	literals := func(p *registryAuthPattern) int {
+		return len(p.hostname) - strings.Count(p.hostname, "*")
+	}
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return literals(patterns[i]) > literals(patterns[j])
+	})
+}
+
+// resolve returns the credentials of the block for the registry of the
+// server address. A token of the registry is refreshed once it is about to
+// expire.
+func (p *registryAuthPattern) resolve(serverAddress string) (registryAuthMatch, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	match, ok := p.resolved[serverAddress]
+	if !ok {
+		authConfig, token, ok, err := registryAuthFromBlock(p.transports, p.auth, serverAddress)
+		if err != nil {
+			return registryAuthMatch{}, err
+		}
+		match = registryAuthMatch{authConfig: authConfig, token: token, ok: ok}
+		p.resolved[serverAddress] = match
+		return match, nil
+	}
+	if match.token != nil {
+		tokenConfig, err := match.token.get(false)
+		if err != nil {
+			return registryAuthMatch{}, err
+		}
+		match.authConfig.Username = tokenConfig.Username
+		match.authConfig.Password = tokenConfig.Password
+	}
+	return match, nil
+}
+
+// credentialHelperAuth returns the credentials of the registry from the
+// docker-credential-<helper> binary, like the credHelpers of the docker
+// config file do
+func credentialHelperAuth(helper, registryHostname string) (types.AuthConfig, error) {
+	c := configfile.New("")
+	c.CredentialHelpers = map[string]string{registryHostname: helper}
+	if isDockerHubRegistry(registryHostname) {
+		c.CredentialHelpers[dockerHubAuthAddress] = helper
+	}
+	return getAuthConfigFromConfigFile(c, registryHostname)
+}
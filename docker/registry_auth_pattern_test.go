@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func TestMatchRegistryHostname(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		hostname string
+		expected bool
+	}{
+		{"*.dkr.ecr.*.amazonaws.com", "123456789012.dkr.ecr.eu-west-1.amazonaws.com", true},
+		{"*.dkr.ecr.*.amazonaws.com", "123456789012.dkr.ecr.eu-west-1.amazonaws.com.cn", false},
+		{"*.dkr.ecr.*.amazonaws.com", "dkr.ecr.eu-west-1.amazonaws.com", false},
+		{"*-docker.pkg.dev", "europe-west1-docker.pkg.dev", true},
+		{"*.example.com", "a.b.example.com", false},
+		{"*.example.com:5000", "registry.example.com:5000", true},
+		{"*.example.com:5000", "registry.example.com", false},
+	}
+	for _, c := range cases {
+		if actual := matchRegistryHostname(c.pattern, c.hostname); actual != c.expected {
+			t.Errorf("expected %t for %s matching %s, got %t", c.expected, c.hostname, c.pattern, actual)
+		}
+	}
+}
+
+func TestRegistryAuthPatterns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test credential helper is a shell script")
+	}
+	defer testCredentialHelper(t)()
+
+	d := schema.TestResourceDataRaw(t, testAccProvider.Schema, map[string]interface{}{
+		"registry_auth": []interface{}{
+			map[string]interface{}{"address": "*.*.example.com", "username": "wide", "password": "secret"},
+			map[string]interface{}{"address": "*.mirror.example.com", "credential_helper": "test"},
+			map[string]interface{}{"address": "eu.mirror.example.com", "username": "exact", "password": "secret"},
+		},
+	})
+	authConfigs, err := providerSetToRegistryAuth(d.Get("registry_auth").(*schema.Set), newRegistryTransports("", ""))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(authConfigs.patterns) != 2 || authConfigs.patterns[0].hostname != "*.mirror.example.com" {
+		t.Fatalf("expected the most specific pattern first, got %+v", authConfigs.patterns)
+	}
+
+	cases := map[string][2]string{
+		"eu.mirror.example.com":   {"exact", "secret"},
+		"us.mirror.example.com":   {"mirror", "us.mirror.example.com"},
+		"registry.eu.example.com": {"wide", "secret"},
+		"example.com":             {"", ""},
+	}
+	for registry, expected := range cases {
+		authConfig, err := registryAuthConfig(authConfigs, registry)
+		if err != nil {
+			t.Errorf("err for %s: %s", registry, err)
+			continue
+		}
+		if actual := [2]string{authConfig.Username, authConfig.Password}; actual != expected {
+			t.Errorf("expected %v for %s, got %v", expected, registry, actual)
+		}
+	}
+	if authConfig := authConfigs.Configs["https://us.mirror.example.com"]; authConfig.ServerAddress != "https://us.mirror.example.com" {
+		t.Errorf("expected the credentials of the matched registry to be kept by its address, got %+v", authConfig)
+	}
+
+	d = schema.TestResourceDataRaw(t, testAccProvider.Schema, map[string]interface{}{
+		"registry_auth": []interface{}{
+			map[string]interface{}{"address": "*.registry.example.com", "credential_helper": "missing"},
+		},
+	})
+	authConfigs, err = providerSetToRegistryAuth(d.Get("registry_auth").(*schema.Set), newRegistryTransports("", ""))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := registryAuthConfig(authConfigs, "eu.registry.example.com"); err == nil || !strings.Contains(err.Error(), "*.registry.example.com") {
+		t.Errorf("expected the error of the missing credential helper, got %v", err)
+	}
+}
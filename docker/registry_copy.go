@@ -0,0 +1,308 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const ociIndexMediaType = "application/vnd.oci.image.index.v1+json"
+
+// registryManifest holds the references of image manifests, manifest lists
+// and their OCI equivalents
+type registryManifest struct {
+	MediaType string               `json:"mediaType"`
+	Config    *manifestDescriptor  `json:"config"`
+	Layers    []manifestDescriptor `json:"layers"`
+	Manifests []manifestDescriptor `json:"manifests"`
+}
+
+// registryEndpoint is a repository of a registry with its credentials
+type registryEndpoint struct {
+	opts       internalImageOptions
+	username   string
+	password   string
+	transports *registryTransports
+}
+
+// registryImageReference splits the image into the options of its
+// repository and the tag or digest of the manifest
+func registryImageReference(image string) (internalImageOptions, string) {
+	name, digest := image, ""
+	if i := strings.Index(image, "@"); i != -1 {
+		name, digest = image[:i], image[i+1:]
+	}
+	opts := createPushImageOptions(name)
+	// Docker prefixes 'library' to official images in the path
+	if opts.Registry == "registry.hub.docker.com" && !strings.Contains(opts.Repository, "/") {
+		opts.Repository = "library/" + opts.Repository
+	}
+	if opts.Tag == "" {
+		opts.Tag = "latest"
+	}
+	if digest != "" {
+		return opts, digest
+	}
+	return opts, opts.Tag
+}
+
+func (e registryEndpoint) url(path string) string {
+	return e.opts.NormalizedRegistry + "/v2/" + e.opts.Repository + path
+}
+
+func (e registryEndpoint) do(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	return doRegistryRequest(e.transports, func() (*http.Request, error) {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		return req.WithContext(ctx), nil
+	}, e.username, e.password)
+}
+
+// getManifest returns the manifest of the reference as the registry serves
+// it, so its digest is kept by a copy
+func (e registryEndpoint) getManifest(ctx context.Context, reference string) ([]byte, string, error) {
+	resp, err := e.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", e.url("/manifests/"+reference), nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range []string{manifestV2MediaType, manifestListMediaType, ociManifestMediaType, ociIndexMediaType} {
+			req.Header.Add("Accept", mediaType)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("Got bad response from registry for manifest %s of %s: %s", reference, e.opts.Repository, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error reading registry response body: %s", err)
+	}
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	if mediaType == "" || mediaType == "application/json" {
+		var manifest registryManifest
+		if err := json.Unmarshal(body, &manifest); err == nil && manifest.MediaType != "" {
+			mediaType = manifest.MediaType
+		}
+	}
+	return body, mediaType, nil
+}
+
+func (e registryEndpoint) putManifest(ctx context.Context, reference, mediaType string, body []byte) error {
+	resp, err := e.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", e.url("/manifests/"+reference), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Unable to push manifest %s to %s: %s %s", reference, e.opts.Repository, resp.Status, msg)
+	}
+	return nil
+}
+
+func (e registryEndpoint) hasBlob(ctx context.Context, digest string) (bool, error) {
+	resp, err := e.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest("HEAD", e.url("/blobs/"+digest), nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// uploadBlob uploads the blob opened by open with a monolithic upload.
+// open is called for each attempt of the upload request.
+func (e registryEndpoint) uploadBlob(ctx context.Context, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	resp, err := e.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest("POST", e.url("/blobs/uploads/"), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("Unable to start blob upload to %s: %s", e.opts.Repository, resp.Status)
+	}
+
+	base, err := url.Parse(e.opts.NormalizedRegistry + "/v2/")
+	if err != nil {
+		return err
+	}
+	location, err := base.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("Invalid blob upload location of %s: %s", e.opts.Repository, err)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = e.do(ctx, func() (*http.Request, error) {
+		body, err := open()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest("PUT", location.String(), body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Unable to upload blob %s to %s: %s %s", digest, e.opts.Repository, resp.Status, msg)
+	}
+	return nil
+}
+
+// openBlob streams the blob from the registry
+func (e registryEndpoint) openBlob(ctx context.Context, digest string) (io.ReadCloser, error) {
+	resp, err := e.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest("GET", e.url("/blobs/"+digest), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Got bad response from registry for blob %s of %s: %s", digest, e.opts.Repository, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// copyRegistryManifest copies the manifest of the reference with its blobs
+// from the source to the reference of the destination, without pulling the
+// image into a daemon, and returns the digest of the copied manifest.
+// Manifest lists are copied with all their manifests.
+func copyRegistryManifest(ctx context.Context, source registryEndpoint, sourceReference string, destination registryEndpoint, destinationReference string, copies int) (string, error) {
+	body, mediaType, err := source.getManifest(ctx, sourceReference)
+	if err != nil {
+		return "", err
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+
+	var manifest registryManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return "", fmt.Errorf("Error parsing manifest %s of %s: %s", sourceReference, source.opts.Repository, err)
+	}
+
+	switch mediaType {
+	case manifestListMediaType, ociIndexMediaType:
+		for _, child := range manifest.Manifests {
+			if _, err := copyRegistryManifest(ctx, source, child.Digest, destination, child.Digest, copies); err != nil {
+				return "", err
+			}
+		}
+	case manifestV2MediaType, ociManifestMediaType:
+		blobs := manifest.Layers
+		if manifest.Config != nil {
+			blobs = append([]manifestDescriptor{*manifest.Config}, blobs...)
+		}
+		distributable := make([]manifestDescriptor, 0, len(blobs))
+		for _, blob := range blobs {
+			// foreign layers, like the base layers of Windows images, are not
+			// stored in the registry
+			if strings.Contains(blob.MediaType, "foreign") || strings.Contains(blob.MediaType, "nondistributable") {
+				continue
+			}
+			distributable = append(distributable, blob)
+		}
+		if err := copyRegistryBlobs(ctx, source, destination, distributable, copies); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("Unsupported media type %s of manifest %s of %s", mediaType, sourceReference, source.opts.Repository)
+	}
+
+	if err := destination.putManifest(ctx, destinationReference, mediaType, body); err != nil {
+		return "", err
+	}
+	log.Printf("[DEBUG] Copied manifest %s of %s to %s of %s", digest, source.opts.Repository, destinationReference, destination.opts.Repository)
+	return digest, nil
+}
+
+// copyRegistryBlobs copies the blobs with up to copies of them in parallel,
+// a copy downloads and uploads its blob at the same time. The remaining
+// copies are canceled and no more are started once one fails.
+func copyRegistryBlobs(ctx context.Context, source, destination registryEndpoint, blobs []manifestDescriptor, copies int) error {
+	if copies < 1 {
+		copies = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	slots := make(chan struct{}, copies)
+	errs := make(chan error, len(blobs))
+	var wg sync.WaitGroup
+	for _, blob := range blobs {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(blob manifestDescriptor) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := copyRegistryBlob(ctx, source, destination, blob); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(blob)
+	}
+	wg.Wait()
+	close(errs)
+	if err, ok := <-errs; ok {
+		return err
+	}
+	return ctx.Err()
+}
+
+func copyRegistryBlob(ctx context.Context, source, destination registryEndpoint, blob manifestDescriptor) error {
+	exists, err := destination.hasBlob(ctx, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Printf("[DEBUG] Blob %s exists in %s", blob.Digest, destination.opts.Repository)
+		return nil
+	}
+	return destination.uploadBlob(ctx, blob.Digest, blob.Size, func() (io.ReadCloser, error) {
+		return source.openBlob(ctx, blob.Digest)
+	})
+}
@@ -0,0 +1,187 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegistry is an in-memory registry serving the manifests and blobs of
+// a single repository
+type testRegistry struct {
+	mutex     sync.Mutex
+	manifests map[string][]byte
+	types     map[string]string
+	blobs     map[string][]byte
+	blobGets  int
+	uploads   int
+}
+
+func newTestRegistry() *testRegistry {
+	return &testRegistry{
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		blobs:     make(map[string][]byte),
+	}
+}
+
+func (r *testRegistry) addBlob(content string) manifestDescriptor {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	r.blobs[digest] = []byte(content)
+	return manifestDescriptor{MediaType: "application/octet-stream", Size: int64(len(content)), Digest: digest}
+}
+
+func (r *testRegistry) addManifest(reference, mediaType string, manifest interface{}) manifestDescriptor {
+	body, _ := json.Marshal(manifest)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	for _, ref := range []string{reference, digest} {
+		r.manifests[ref] = body
+		r.types[ref] = mediaType
+	}
+	return manifestDescriptor{MediaType: mediaType, Size: int64(len(body)), Digest: digest}
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	body, _ := ioutil.ReadAll(req.Body)
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/v2/repo/manifests/"):
+		reference := strings.TrimPrefix(req.URL.Path, "/v2/repo/manifests/")
+		if req.Method == "PUT" {
+			digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+			for _, ref := range []string{reference, digest} {
+				r.manifests[ref] = body
+				r.types[ref] = req.Header.Get("Content-Type")
+			}
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		manifest, ok := r.manifests[reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", r.types[reference])
+		w.Write(manifest)
+	case req.Method == "POST" && req.URL.Path == "/v2/repo/blobs/uploads/":
+		r.uploads++
+		w.Header().Set("Location", "/v2/repo/blobs/uploads/1")
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == "PUT" && req.URL.Path == "/v2/repo/blobs/uploads/1":
+		digest := req.URL.Query().Get("digest")
+		if digest != fmt.Sprintf("sha256:%x", sha256.Sum256(body)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(req.URL.Path, "/v2/repo/blobs/"):
+		blob, ok := r.blobs[strings.TrimPrefix(req.URL.Path, "/v2/repo/blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == "GET" {
+			r.blobGets++
+			w.Write(blob)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCopyRegistryManifest(t *testing.T) {
+	source := newTestRegistry()
+	var manifests []manifestDescriptor
+	for _, platform := range []string{"amd64", "arm64"} {
+		config := source.addBlob("config " + platform)
+		manifests = append(manifests, source.addManifest(platform, manifestV2MediaType, registryManifest{
+			MediaType: manifestV2MediaType,
+			Config:    &config,
+			Layers:    []manifestDescriptor{source.addBlob("layer " + platform), source.addBlob("shared layer")},
+		}))
+	}
+	list := source.addManifest("1.0", manifestListMediaType, registryManifest{MediaType: manifestListMediaType, Manifests: manifests})
+	sourceServer := httptest.NewServer(source)
+	defer sourceServer.Close()
+
+	destination := newTestRegistry()
+	destination.addBlob("shared layer")
+	destinationServer := httptest.NewServer(destination)
+	defer destinationServer.Close()
+
+	ctx := context.Background()
+	sourceEndpoint := registryEndpoint{opts: internalImageOptions{NormalizedRegistry: sourceServer.URL, Repository: "repo"}}
+	destinationEndpoint := registryEndpoint{opts: internalImageOptions{NormalizedRegistry: destinationServer.URL, Repository: "repo"}}
+	digest, err := copyRegistryManifest(ctx, sourceEndpoint, "1.0", destinationEndpoint, "prod", 2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if digest != list.Digest || string(destination.manifests["prod"]) != string(source.manifests["1.0"]) || destination.types["prod"] != manifestListMediaType {
+		t.Errorf("expected the manifest list to be copied unchanged, got %s", digest)
+	}
+	for _, manifest := range manifests {
+		if _, ok := destination.manifests[manifest.Digest]; !ok {
+			t.Errorf("expected manifest %s to be copied", manifest.Digest)
+		}
+	}
+	for blobDigest := range source.blobs {
+		if string(destination.blobs[blobDigest]) != string(source.blobs[blobDigest]) {
+			t.Errorf("expected blob %s to be copied", blobDigest)
+		}
+	}
+	if source.blobGets != 4 {
+		t.Errorf("expected the existing blob not to be copied, got %d blob downloads", source.blobGets)
+	}
+
+	if _, err := copyRegistryManifest(ctx, sourceEndpoint, "missing", destinationEndpoint, "prod", 1); err == nil {
+		t.Error("expected an error for a missing manifest")
+	}
+}
+
+func TestCopyRegistryBlobsStopsOnFailure(t *testing.T) {
+	// the source has none of the blobs, so the first copy fails
+	source := newTestRegistry()
+	blobs := []manifestDescriptor{}
+	for _, content := range []string{"a", "b", "c", "d", "e"} {
+		blobs = append(blobs, newTestRegistry().addBlob(content))
+	}
+	sourceServer := httptest.NewServer(source)
+	defer sourceServer.Close()
+	destination := newTestRegistry()
+	destinationServer := httptest.NewServer(destination)
+	defer destinationServer.Close()
+
+	sourceEndpoint := registryEndpoint{opts: internalImageOptions{NormalizedRegistry: sourceServer.URL, Repository: "repo"}}
+	destinationEndpoint := registryEndpoint{opts: internalImageOptions{NormalizedRegistry: destinationServer.URL, Repository: "repo"}}
+	if err := copyRegistryBlobs(context.Background(), sourceEndpoint, destinationEndpoint, blobs, 1); err == nil {
+		t.Fatal("expected an error for a missing blob")
+	}
+	if destination.uploads != 1 {
+		t.Errorf("expected no copies to start after the first failure, got %d uploads", destination.uploads)
+	}
+}
+
+func TestRegistryImageReference(t *testing.T) {
+	cases := map[string][3]string{
+		"alpine":                               {"registry.hub.docker.com", "library/alpine", "latest"},
+		"example/app:1.0":                      {"registry.hub.docker.com", "example/app", "1.0"},
+		"localhost:5000/app:dev":               {"localhost:5000", "app", "dev"},
+		"localhost:5000/team/app@sha256:1234a": {"localhost:5000", "team/app", "sha256:1234a"},
+	}
+	for image, expected := range cases {
+		opts, reference := registryImageReference(image)
+		if actual := [3]string{opts.Registry, opts.Repository, reference}; actual != expected {
+			t.Errorf("registryImageReference(%q) = %v, expected %v", image, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// registryTokenRefreshWindow is the remaining validity below which a token
+// is requested again, so it does not expire during a pull or push
+const registryTokenRefreshWindow = 15 * time.Minute
+
+// registryTokenSource requests a short-lived token of a registry and returns
+// the credentials with it and its expiry
+type registryTokenSource func() (types.AuthConfig, time.Time, error)
+
+// registryToken caches the token of a registry with ecr_auth, gcr_auth or
+// an auth_command
+type registryToken struct {
+	mutex      sync.Mutex
+	source     registryTokenSource
+	authConfig types.AuthConfig
+	expiresAt  time.Time
+}
+
+func newRegistryToken(source registryTokenSource) *registryToken {
+	return &registryToken{source: source}
+}
+
+// get returns the cached credentials, a new token is requested if refresh is
+// set or the cached one expires soon
+func (t *registryToken) get(refresh bool) (types.AuthConfig, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !refresh && time.Until(t.expiresAt) > registryTokenRefreshWindow {
+		return t.authConfig, nil
+	}
+	authConfig, expiresAt, err := t.source()
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+	t.authConfig, t.expiresAt = authConfig, expiresAt
+	return authConfig, nil
+}
+
+// refreshRegistryTokens replaces the credentials of the registries with
+// tokens by valid ones
+func refreshRegistryTokens(authConfigs *AuthConfigs) error {
+	for address, token := range authConfigs.tokens {
+		authConfig, err := token.get(false)
+		if err != nil {
+			return err
+		}
+		authConfig.ServerAddress = address
+		authConfigs.Configs[address] = authConfig
+	}
+	return nil
+}
+
+// maxRegistryAuthRefreshes limits the retries with refreshed credentials of
+// a pull or push, so tokens which are rejected for another reason than their
+// expiry do not retry it forever
+const maxRegistryAuthRefreshes = 3
+
+// refreshRegistryAuth resolves the credentials of the registry of the address
+// again. Tokens of ecr_auth, gcr_auth and auth_command are requested again
+// and credential helpers of the default docker config invoked again, as they
+// might return short-lived tokens too. Static credentials cannot be refreshed.
+func refreshRegistryAuth(authConfigs *AuthConfigs, address string) (types.AuthConfig, bool, error) {
+	if authConfigs == nil {
+		authConfigs = &AuthConfigs{}
+	}
+	if token, ok := authConfigs.tokens[address]; ok {
+		auth, err := token.get(true)
+		if err != nil {
+			return types.AuthConfig{}, false, err
+		}
+		auth.ServerAddress = address
+		authConfigs.Configs[address] = auth
+		return auth, true, nil
+	}
+	if _, ok := authConfigs.Configs[address]; ok || address == "" {
+		return types.AuthConfig{}, false, nil
+	}
+	registryHostname := convertToHostname(address)
+	if isDockerHubRegistry(registryHostname) {
+		registryHostname = "registry.hub.docker.com"
+	}
+	if authConfigs.defaultConfig != nil {
+		authConfigs.defaultConfig.authConfigs.Delete(registryHostname)
+	}
+	auth, ok := authConfigs.defaultConfig.registryAuth(authConfigs.transports, registryHostname)
+	return auth, ok, nil
+}
+
+// retryWithRefreshedAuth calls f again with refreshed credentials as long as
+// the registry of the address rejects the credentials of the previous call,
+// e.g. because a token expired in the middle of a long push. The daemon
+// skips the layers which were already transferred, so a retried push or pull
+// resumes where the previous one stopped.
+func retryWithRefreshedAuth(authConfigs *AuthConfigs, address string, auth types.AuthConfig, f func(types.AuthConfig) error) error {
+	err := f(auth)
+	for refreshes := 0; err != nil && refreshes < maxRegistryAuthRefreshes && isRegistryAuthError(err); refreshes++ {
+		refreshed, ok, refreshErr := refreshRegistryAuth(authConfigs, address)
+		if refreshErr != nil {
+			return fmt.Errorf("%s, refreshing the credentials of %s failed: %s", err, address, refreshErr)
+		}
+		// the same credentials would be rejected again
+		if !ok || refreshed == auth {
+			return err
+		}
+		log.Printf("[DEBUG] Retrying with refreshed credentials of %s after: %s", address, err)
+		auth = refreshed
+		err = f(auth)
+	}
+	return err
+}
+
+// isRegistryAuthError reports whether the registry rejected the credentials,
+// e.g. because a token expired
+func isRegistryAuthError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range []string{"authorization token has expired", "no basic auth credentials", "unauthorized", "denied"} {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -40,6 +40,9 @@ func resourceDockerConfig() *schema.Resource {
 }
 
 func resourceDockerConfigCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := requireDockerEngine(meta, "docker_config, a Swarm config,"); err != nil {
+		return err
+	}
 	client := meta.(*ProviderConfig).DockerClient
 	data, _ := base64.StdEncoding.DecodeString(d.Get("data").(string))
 
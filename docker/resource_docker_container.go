@@ -2,6 +2,7 @@ package docker
 
 import (
 	"log"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 )
@@ -12,11 +13,17 @@ func resourceDockerContainer() *schema.Resource {
 		Read:          resourceDockerContainerRead,
 		Update:        resourceDockerContainerUpdate,
 		Delete:        resourceDockerContainerDelete,
+		CustomizeDiff: resourceDockerContainerCustomizeDiff,
 		MigrateState:  resourceDockerContainerMigrateState,
 		SchemaVersion: 2,
 		Importer: &schema.ResourceImporter{
 			State: schema.ImportStatePassthrough,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
 		StateUpgraders: []schema.StateUpgrader{
 			{
 				Version: 1,
@@ -69,6 +76,38 @@ func resourceDockerContainer() *schema.Resource {
 				Optional: true,
 			},
 
+			"wait": {
+				Type:          schema.TypeBool,
+				Description:   "Wait for the container to be healthy after its creation, or running if it has no healthcheck",
+				Default:       false,
+				Optional:      true,
+				ConflictsWith: []string{"attach"},
+			},
+
+			"wait_for_exit": {
+				Type:          schema.TypeBool,
+				Description:   "Wait for the container to exit after its creation, store its exit code and logs and fail on a non-zero exit code",
+				Default:       false,
+				Optional:      true,
+				ConflictsWith: []string{"attach", "wait", "rm"},
+			},
+
+			"wait_for_exit_timeout": {
+				Type:         schema.TypeString,
+				Description:  "Maximum time to wait for the container to exit (ms|s|m|h), 0s for the create timeout",
+				Default:      "0s",
+				Optional:     true,
+				ValidateFunc: validateDurationGeq0(),
+			},
+
+			"wait_timeout": {
+				Type:         schema.TypeString,
+				Description:  "Maximum time to wait for the container to be healthy (ms|s|m|h)",
+				Default:      "1m",
+				Optional:     true,
+				ValidateFunc: validateDurationGeq0(),
+			},
+
 			// Indicates whether the container must be running.
 			//
 			// An assumption is made that configured containers
@@ -110,6 +149,16 @@ func resourceDockerContainer() *schema.Resource {
 				// DiffSuppressFunc: suppressIfSHAwasAdded(), // TODO mvogel
 			},
 
+			"image_id": {
+				Type:        schema.TypeString,
+				Description: "ID of the image the container runs, a change of the image a name points to replaces the container",
+				Computed:    true,
+			},
+
+			"registry_auth": resourceRegistryAuthSchema,
+
+			"timings": timingsSchema,
+
 			"hostname": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -191,8 +240,9 @@ func resourceDockerContainer() *schema.Resource {
 			},
 
 			"max_retry_count": {
-				Type:     schema.TypeInt,
-				Optional: true,
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validateIntegerGeqThan(0),
 			},
 			"working_dir": {
 				Type:     schema.TypeString,
@@ -246,6 +296,23 @@ func resourceDockerContainer() *schema.Resource {
 				Description: "List of string values to customize labels for MLS systems, such as SELinux. See https://docs.docker.com/engine/reference/run/#security-configuration",
 				Set:         schema.HashString,
 			},
+			"seccomp_profile": {
+				Type:        schema.TypeString,
+				Description: "Path of a local JSON file with the seccomp profile of the container, or unconfined",
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"seccomp_profile_hash": {
+				Type:        schema.TypeString,
+				Description: "Hash of the content of the seccomp profile, a change replaces the container",
+				Computed:    true,
+			},
+			"apparmor_profile": {
+				Type:        schema.TypeString,
+				Description: "Name of the AppArmor profile of the container loaded on the host, or unconfined",
+				Optional:    true,
+				ForceNew:    true,
+			},
 			"mounts": {
 				Type:        schema.TypeSet,
 				Description: "Specification for mounts to be added to containers created as part of the service",
@@ -267,13 +334,19 @@ func resourceDockerContainer() *schema.Resource {
 							Type:         schema.TypeString,
 							Description:  "The mount type",
 							Required:     true,
-							ValidateFunc: validateStringMatchesPattern(`^(bind|volume|tmpfs)$`),
+							ValidateFunc: validateStringMatchesPattern(`^(bind|volume|tmpfs|npipe)$`),
 						},
 						"read_only": {
 							Type:        schema.TypeBool,
 							Description: "Whether the mount should be read-only",
 							Optional:    true,
 						},
+						"consistency": {
+							Type:         schema.TypeString,
+							Description:  "The consistency requirement of the mount, e.g. cached for bind mounts on Docker Desktop",
+							Optional:     true,
+							ValidateFunc: validateStringMatchesPattern(`^(default|consistent|cached|delegated)$`),
+						},
 						"bind_options": {
 							Type:        schema.TypeList,
 							Description: "Optional configuration for the bind type",
@@ -386,8 +459,12 @@ func resourceDockerContainer() *schema.Resource {
 				},
 			},
 			"tmpfs": {
-				Type:     schema.TypeMap,
-				Optional: true,
+				Type:         schema.TypeMap,
+				Description:  "tmpfs mounts by their path in the container with their mount options, e.g. rw,size=64m",
+				Optional:     true,
+				ForceNew:     true,
+				Elem:         &schema.Schema{Type: schema.TypeString},
+				ValidateFunc: validateDockerContainerPathKeys,
 			},
 			"ports": {
 				Type:     schema.TypeList,
@@ -462,19 +539,22 @@ func resourceDockerContainer() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"name": {
-							Type:     schema.TypeString,
-							Required: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Required:     true,
+							ForceNew:     true,
+							ValidateFunc: validateUlimitName(),
 						},
 						"soft": {
-							Type:     schema.TypeInt,
-							Required: true,
-							ForceNew: true,
+							Type:         schema.TypeInt,
+							Required:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerGeqThan(-1),
 						},
 						"hard": {
-							Type:     schema.TypeInt,
-							Required: true,
-							ForceNew: true,
+							Type:         schema.TypeInt,
+							Required:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerGeqThan(-1),
 						},
 					},
 				},
@@ -571,21 +651,86 @@ func resourceDockerContainer() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"host_path": {
-							Type:     schema.TypeString,
-							Required: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Required:     true,
+							ForceNew:     true,
+							ValidateFunc: validateDockerContainerPath,
 						},
 
 						"container_path": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateDockerContainerPath,
 						},
 
 						"permissions": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Description:  "Cgroup permissions of the device, a combination of r (read), w (write) and m (mknod)",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateStringMatchesPattern(`^[rwm]{1,3}$`),
+						},
+					},
+				},
+			},
+
+			"device_cgroup_rules": {
+				Type:        schema.TypeSet,
+				Description: "Rules added to the devices cgroup of the container, e.g. c 10:232 rwm for /dev/kvm",
+				Optional:    true,
+				ForceNew:    true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateStringMatchesPattern(`^[abc] (\d+|\*):(\d+|\*) [rwm]{1,3}$`),
+				},
+			},
+
+			"device_requests": {
+				Type:        schema.TypeList,
+				Description: "Requests for devices of device drivers like GPUs, as with --gpus",
+				Optional:    true,
+				ForceNew:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"driver": {
+							Type:        schema.TypeString,
+							Description: "Name of the device driver, e.g. nvidia",
+							Optional:    true,
+							ForceNew:    true,
+						},
+
+						"count": {
+							Type:         schema.TypeInt,
+							Description:  "Number of devices to request, -1 for all",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerGeqThan(-1),
+						},
+
+						"device_ids": {
+							Type:        schema.TypeList,
+							Description: "IDs of the devices as recognized by the device driver, cannot be used with count",
+							Optional:    true,
+							ForceNew:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+
+						"capabilities": {
+							Type:        schema.TypeSet,
+							Description: "Capabilities the devices must have, defaults to gpu",
+							Optional:    true,
+							Computed:    true,
+							ForceNew:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+
+						"options": {
+							Type:        schema.TypeMap,
+							Description: "Options passed to the device driver",
+							Optional:    true,
+							ForceNew:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
 						},
 					},
 				},
@@ -596,6 +741,23 @@ func resourceDockerContainer() *schema.Resource {
 				Optional: true,
 			},
 
+			"stop_signal": {
+				Type:         schema.TypeString,
+				Description:  "Signal to stop the container, defaults to the one of the image or SIGTERM",
+				Optional:     true,
+				ForceNew:     true,
+				Computed:     true,
+				ValidateFunc: validateStringMatchesPattern(`^[A-Z0-9+-]+$`),
+			},
+
+			"stop_timeout": {
+				Type:         schema.TypeInt,
+				Description:  "Seconds to wait for the container to stop after the stop signal before it is killed",
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateIntegerGeqThan(0),
+			},
+
 			"labels": {
 				Type:     schema.TypeSet,
 				Optional: true,
@@ -636,6 +798,90 @@ func resourceDockerContainer() *schema.Resource {
 				ValidateFunc: validateStringMatchesPattern(`^\d+([,-]\d+)*$`),
 			},
 
+			"cpus": {
+				Type:         schema.TypeString,
+				Description:  "Number of CPUs the container can use, e.g. 1.5",
+				Optional:     true,
+				ValidateFunc: validateStringMatchesPattern(`^\d+(\.\d+)?$`),
+				DiffSuppressFunc: func(k, oldV, newV string, d *schema.ResourceData) bool {
+					// 1.50 and 1.5 are the same number of CPUs
+					return cpusToNanoCPUs(oldV) == cpusToNanoCPUs(newV)
+				},
+			},
+
+			"memory_reservation": {
+				Type:         schema.TypeInt,
+				Description:  "Soft memory limit of the container in MBs",
+				Optional:     true,
+				ValidateFunc: validateIntegerGeqThan(0),
+			},
+
+			"pids_limit": {
+				Type:         schema.TypeInt,
+				Description:  "Maximum number of processes of the container, -1 for unlimited",
+				Optional:     true,
+				ValidateFunc: validateIntegerGeqThan(-1),
+			},
+
+			"blkio_weight": {
+				Type:         schema.TypeInt,
+				Description:  "Relative weight of the block IO of the container from 10 to 1000, 0 to disable",
+				Optional:     true,
+				ValidateFunc: validateIntegerInRange(0, 1000),
+			},
+
+			"blkio_device": {
+				Type:        schema.TypeSet,
+				Description: "Block IO weight and throttling of a device",
+				Optional:    true,
+				ForceNew:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:        schema.TypeString,
+							Description: "Path of the device on the host, e.g. /dev/sda",
+							Required:    true,
+							ForceNew:    true,
+						},
+						"weight": {
+							Type:         schema.TypeInt,
+							Description:  "Relative weight of the block IO of the device from 10 to 1000",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerInRange(0, 1000),
+						},
+						"read_bps": {
+							Type:         schema.TypeString,
+							Description:  "Maximum read rate from the device in bytes per second, e.g. 10MB",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateStringIsHumanSize(),
+						},
+						"write_bps": {
+							Type:         schema.TypeString,
+							Description:  "Maximum write rate to the device in bytes per second, e.g. 10MB",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateStringIsHumanSize(),
+						},
+						"read_iops": {
+							Type:         schema.TypeInt,
+							Description:  "Maximum read rate from the device in IO per second",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerGeqThan(0),
+						},
+						"write_iops": {
+							Type:         schema.TypeInt,
+							Description:  "Maximum write rate to the device in IO per second",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerGeqThan(0),
+						},
+					},
+				},
+			},
+
 			"log_driver": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -644,9 +890,12 @@ func resourceDockerContainer() *schema.Resource {
 			},
 
 			"log_opts": {
-				Type:     schema.TypeMap,
-				Optional: true,
-				ForceNew: true,
+				Type:        schema.TypeMap,
+				Description: "Options of the logging driver, e.g. max-size of json-file",
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
 			},
 
 			"network_alias": {
@@ -703,29 +952,49 @@ func resourceDockerContainer() *schema.Resource {
 							Set:      schema.HashString,
 						},
 						"ipv4_address": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Description:  "Static IPv4 address of the container in the network, which needs a configured subnet",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIPAddress(4),
 						},
 						"ipv6_address": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Description:  "Static IPv6 address of the container in the network, which needs a configured subnet",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIPAddress(6),
 						},
 					},
 				},
 			},
 
 			"pid_mode": {
-				Type:     schema.TypeString,
-				Optional: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateStringMatchesPattern(`^(host|container:.+)$`),
 			},
 			"userns_mode": {
 				Type:     schema.TypeString,
 				Optional: true,
 				ForceNew: true,
 			},
+			"uts_mode": {
+				Type:          schema.TypeString,
+				Description:   "UTS namespace mode of the container, host shares the hostname of the host",
+				Optional:      true,
+				ForceNew:      true,
+				ValidateFunc:  validateStringMatchesPattern(`^host$`),
+				ConflictsWith: []string{"hostname", "domainname"},
+			},
+			"runtime": {
+				Type:        schema.TypeString,
+				Description: "Runtime of the container, e.g. nvidia, kata or runsc, defaults to the one of the daemon",
+				Optional:    true,
+				ForceNew:    true,
+				Computed:    true,
+			},
 
 			"upload": {
 				Type:     schema.TypeSet,
@@ -757,6 +1026,27 @@ func resourceDockerContainer() *schema.Resource {
 							ForceNew: true,
 							Default:  false,
 						},
+						"permissions": {
+							Type:         schema.TypeString,
+							Description:  "Octal file mode of the file, e.g. 0640, takes precedence over executable",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateStringMatchesPattern(`^0?[0-7]{3}$`),
+						},
+						"uid": {
+							Type:         schema.TypeInt,
+							Description:  "User ID of the owner of the file",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerGeqThan(0),
+						},
+						"gid": {
+							Type:         schema.TypeInt,
+							Description:  "Group ID of the owner of the file",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateIntegerGeqThan(0),
+						},
 						"source": {
 							Type:     schema.TypeString,
 							Optional: true,
@@ -822,25 +1112,54 @@ func resourceDockerContainer() *schema.Resource {
 				Optional: true,
 				ForceNew: true,
 			},
-			"ipc_mode": {
-				Type:        schema.TypeString,
-				Description: "IPC sharing mode for the container",
+			"storage_opts": {
+				Type:        schema.TypeMap,
+				Description: "Options of the storage driver for the writable layer of the container, e.g. size",
 				Optional:    true,
 				ForceNew:    true,
-				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"ipc_mode": {
+				Type:         schema.TypeString,
+				Description:  "IPC sharing mode for the container",
+				Optional:     true,
+				ForceNew:     true,
+				Computed:     true,
+				ValidateFunc: validateStringMatchesPattern(`^(none|private|shareable|host|container:.+)$`),
 			},
 			"group_add": {
 				Type:        schema.TypeSet,
 				Description: "Additional groups for the container user",
 				Optional:    true,
 				ForceNew:    true,
-				Elem:        &schema.Schema{Type: schema.TypeString},
-				Set:         schema.HashString,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateStringMatchesPattern(`^([a-zA-Z_][a-zA-Z0-9_.-]*\$?|\d+)$`),
+				},
+				Set: schema.HashString,
 			},
 			"init": {
-				Type:     schema.TypeBool,
-				Optional: true,
-				Computed: true,
+				Type:        schema.TypeBool,
+				Description: "Run an init process as PID 1 which forwards signals and reaps zombies, defaults to the setting of the daemon",
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+			},
+
+			"tty": {
+				Type:        schema.TypeBool,
+				Description: "Allocate a pseudo-TTY for the container, like docker run -t",
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+			},
+
+			"stdin_open": {
+				Type:        schema.TypeBool,
+				Description: "Keep the STDIN of the container open although nothing is attached, like docker run -i",
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
 			},
 		},
 	}
@@ -0,0 +1,198 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func resourceDockerContainerExec() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceDockerContainerExecCreate,
+		Read:   resourceDockerContainerExecRead,
+		Delete: resourceDockerContainerExecDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"container": {
+				Type:        schema.TypeString,
+				Description: "ID or name of the running container the command is run in",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"command": {
+				Type:        schema.TypeList,
+				Description: "The command to run with its arguments",
+				Required:    true,
+				ForceNew:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+
+			"env": {
+				Type:        schema.TypeSet,
+				Description: "Environment variables of the command in the form KEY=VALUE",
+				Optional:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+
+			"user": {
+				Type:        schema.TypeString,
+				Description: "User the command runs as, defaults to the user of the container",
+				Optional:    true,
+				ForceNew:    true,
+			},
+
+			"working_dir": {
+				Type:        schema.TypeString,
+				Description: "Working directory of the command, defaults to the one of the container",
+				Optional:    true,
+				ForceNew:    true,
+			},
+
+			"privileged": {
+				Type:        schema.TypeBool,
+				Description: "Give extended privileges to the command",
+				Optional:    true,
+				ForceNew:    true,
+			},
+
+			"triggers": {
+				Type:        schema.TypeMap,
+				Description: "A change of any value runs the command again",
+				Optional:    true,
+				ForceNew:    true,
+			},
+
+			"fail_on_error": {
+				Type:        schema.TypeBool,
+				Description: "Fail if the command exits with a non-zero exit code",
+				Optional:    true,
+				ForceNew:    true,
+				Default:     true,
+			},
+
+			"container_id": {
+				Type:        schema.TypeString,
+				Description: "ID of the container the command ran in",
+				Computed:    true,
+			},
+
+			"exit_code": {
+				Type:        schema.TypeInt,
+				Description: "The exit code of the command",
+				Computed:    true,
+			},
+
+			"stdout": {
+				Type:        schema.TypeString,
+				Description: "The standard output of the command",
+				Computed:    true,
+			},
+
+			"stderr": {
+				Type:        schema.TypeString,
+				Description: "The standard error of the command",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceDockerContainerExecCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*ProviderConfig).DockerClient
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
+	containerName := d.Get("container").(string)
+	container, err := client.ContainerInspect(ctx, containerName)
+	if err != nil {
+		return classifyError(fmt.Errorf("Unable to inspect container %s: %s", containerName, err), "container")
+	}
+	if !container.State.Running {
+		return classifyError(fmt.Errorf("Container %s is not running", containerName), "container")
+	}
+
+	execConfig := types.ExecConfig{
+		Cmd:          stringListToStringSlice(d.Get("command").([]interface{})),
+		Env:          stringSetToStringSlice(d.Get("env").(*schema.Set)),
+		User:         d.Get("user").(string),
+		WorkingDir:   d.Get("working_dir").(string),
+		Privileged:   d.Get("privileged").(bool),
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	exitCode, stdout, stderr, execID, err := runContainerExec(ctx, client, container.ID, execConfig)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(execID)
+	d.Set("container_id", container.ID)
+	d.Set("exit_code", exitCode)
+	d.Set("stdout", stdout)
+	d.Set("stderr", stderr)
+	if exitCode != 0 && d.Get("fail_on_error").(bool) {
+		// the resource is tainted, so the command runs again with the next apply
+		return fmt.Errorf("Command %v in container %s exited with code %d:\n%s", execConfig.Cmd, containerName, exitCode, lastLines(stderr, containerExitLogLines))
+	}
+	return nil
+}
+
+// runContainerExec runs the command in the container and returns its exit
+// code, its output and the ID of the exec instance
+func runContainerExec(ctx context.Context, client *client.Client, containerID string, execConfig types.ExecConfig) (int, string, string, string, error) {
+	execResponse, err := client.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return 0, "", "", "", fmt.Errorf("Unable to create exec in container %s: %s", containerID, err)
+	}
+	log.Printf("[INFO] Running %v in container %s", execConfig.Cmd, containerID)
+	attach, err := client.ContainerExecAttach(ctx, execResponse.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, "", "", "", fmt.Errorf("Unable to start exec in container %s: %s", containerID, err)
+	}
+	defer attach.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, attach.Reader); err != nil {
+		return 0, "", "", "", fmt.Errorf("Unable to read the output of exec in container %s: %s", containerID, err)
+	}
+	inspect, err := client.ContainerExecInspect(ctx, execResponse.ID)
+	if err != nil {
+		return 0, "", "", "", fmt.Errorf("Unable to inspect exec in container %s: %s", containerID, err)
+	}
+	return inspect.ExitCode, stdout.String(), stderr.String(), execResponse.ID, nil
+}
+
+func resourceDockerContainerExecRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*ProviderConfig).DockerClient
+	container, err := client.ContainerInspect(context.Background(), d.Get("container").(string))
+	if err != nil && !strings.Contains(err.Error(), "No such container") {
+		return fmt.Errorf("Unable to inspect container %s: %s", d.Get("container").(string), err)
+	}
+	// the command runs again in a replaced container
+	if err != nil || container.ID != d.Get("container_id").(string) {
+		log.Printf("[INFO] Container %s of exec %s is gone, removing from state", d.Get("container").(string), d.Id())
+		d.SetId("")
+	}
+	return nil
+}
+
+func resourceDockerContainerExecDelete(d *schema.ResourceData, meta interface{}) error {
+	// the effects of the command cannot be undone
+	d.SetId("")
+	return nil
+}
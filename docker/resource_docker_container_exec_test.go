@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+)
+
+func TestAccDockerContainerExec_basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccDockerContainerExecConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("docker_container_exec.init", "exit_code", "0"),
+					resource.TestCheckResourceAttr("docker_container_exec.init", "stdout", "tf-test /tmp root\n"),
+					resource.TestCheckResourceAttrPair("docker_container_exec.init", "container_id", "docker_container.foo", "id"),
+				),
+			},
+			{
+				Config:      testAccDockerContainerExecFailingConfig,
+				ExpectError: regexp.MustCompile(`exited with code 2:\s+failed`),
+			},
+		},
+	})
+}
+
+const testAccDockerContainerExecConfig = `
+resource "docker_image" "foo" {
+	name = "busybox:latest"
+	keep_locally = true
+}
+
+resource "docker_container" "foo" {
+	name = "tf-test"
+	image = "${docker_image.foo.latest}"
+	command = ["sleep", "300"]
+}
+
+resource "docker_container_exec" "init" {
+	container = "${docker_container.foo.name}"
+	command = ["sh", "-c", "echo $NAME $(pwd) $(whoami)"]
+	env = ["NAME=tf-test"]
+	working_dir = "/tmp"
+}
+`
+
+const testAccDockerContainerExecFailingConfig = `
+resource "docker_image" "foo" {
+	name = "busybox:latest"
+	keep_locally = true
+}
+
+resource "docker_container" "foo" {
+	name = "tf-test"
+	image = "${docker_image.foo.latest}"
+	command = ["sleep", "300"]
+}
+
+resource "docker_container_exec" "init" {
+	container = "${docker_container.foo.name}"
+	command = ["sh", "-c", "echo failed >&2 && exit 2"]
+}
+`
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -19,12 +20,15 @@ import (
 	"context"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/blkiodev"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/docker/go-units"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 )
 
@@ -35,17 +39,31 @@ var (
 func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) error {
 	var err error
 	client := meta.(*ProviderConfig).DockerClient
-	authConfigs := meta.(*ProviderConfig).AuthConfigs
 	image := d.Get("image").(string)
-	_, err = findImage(image, client, authConfigs)
+	ctx, cancel := context.WithTimeout(context.Background(), resourceTimeout(d, meta, schema.TimeoutCreate, "pull"))
+	defer cancel()
+	authConfigs, err := resourceAuthConfigs(d, meta)
 	if err != nil {
-		return fmt.Errorf("Unable to create container with image %s: %s", image, err)
+		return err
+	}
+	timings := meta.(*ProviderConfig).TimingReport.timingsFor("docker_container", d.Get("name").(string))
+	pullStart := time.Now()
+	pullCtx, cancelPull := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "pull")
+	defer cancelPull()
+	_, pullSummary, err := findOrPullImage(pullCtx, image, client, authConfigs, providerPullOptions(meta), "")
+	if err != nil {
+		return classifyError(fmt.Errorf("Unable to create container with image %s: %s", image, err), "image")
+	}
+	if !pullSummary.Skipped {
+		timings.record("pull", pullStart)
 	}
 
 	config := &container.Config{
 		Image:      image,
 		Hostname:   d.Get("hostname").(string),
 		Domainname: d.Get("domainname").(string),
+		Tty:        d.Get("tty").(bool),
+		OpenStdin:  d.Get("stdin_open").(bool),
 	}
 
 	if v, ok := d.GetOk("env"); ok {
@@ -81,6 +99,13 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 	if v, ok := d.GetOk("working_dir"); ok {
 		config.WorkingDir = v.(string)
 	}
+	if v, ok := d.GetOk("stop_signal"); ok {
+		config.StopSignal = v.(string)
+	}
+	if v, ok := d.GetOkExists("stop_timeout"); ok {
+		stopTimeout := v.(int)
+		config.StopTimeout = &stopTimeout
+	}
 	extraHosts := []string{}
 	if v, ok := d.GetOk("host"); ok {
 		extraHosts = extraHostsSetToDockerExtraHosts(v.(*schema.Set))
@@ -88,7 +113,9 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 
 	extraUlimits := []*units.Ulimit{}
 	if v, ok := d.GetOk("ulimit"); ok {
-		extraUlimits = ulimitsToDockerUlimits(v.(*schema.Set))
+		if extraUlimits, err = ulimitsToDockerUlimits(v.(*schema.Set)); err != nil {
+			return classifyError(err, "ulimit")
+		}
 	}
 	volumes := map[string]struct{}{}
 	binds := []string{}
@@ -104,9 +131,7 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 		config.Volumes = volumes
 	}
 
-	if v, ok := d.GetOk("labels"); ok {
-		config.Labels = labelSetToMap(v.(*schema.Set))
-	}
+	config.Labels = withDefaultLabels(meta, labelSetToMap(d.Get("labels").(*schema.Set)))
 
 	if value, ok := d.GetOk("healthcheck"); ok {
 		config.Healthcheck = &container.HealthConfig{}
@@ -146,6 +171,9 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 			if value, ok := rawMount["read_only"]; ok {
 				mountInstance.ReadOnly = value.(bool)
 			}
+			if value, ok := rawMount["consistency"]; ok {
+				mountInstance.Consistency = mount.Consistency(value.(string))
+			}
 
 			if mountType == mount.TypeBind {
 				if value, ok := rawMount["bind_options"]; ok {
@@ -256,6 +284,14 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 		hostConfig.Devices = deviceSetToDockerDevices(v.(*schema.Set))
 	}
 
+	if v, ok := d.GetOk("device_requests"); ok {
+		hostConfig.DeviceRequests = deviceRequestsToDockerDeviceRequests(v.([]interface{}))
+	}
+
+	if v, ok := d.GetOk("device_cgroup_rules"); ok {
+		hostConfig.DeviceCgroupRules = stringSetToStringSlice(v.(*schema.Set))
+	}
+
 	if v, ok := d.GetOk("dns"); ok {
 		hostConfig.DNS = stringSetToStringSlice(v.(*schema.Set))
 	}
@@ -275,6 +311,11 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 	if v, ok := d.GetOk("security_opts"); ok {
 		hostConfig.SecurityOpt = stringSetToStringSlice(v.(*schema.Set))
 	}
+	profileOpts, err := securityProfileOpts(d)
+	if err != nil {
+		return classifyError(err, "seccomp_profile")
+	}
+	hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, profileOpts...)
 
 	if v, ok := d.GetOk("memory"); ok {
 		hostConfig.Memory = int64(v.(int)) * 1024 * 1024
@@ -300,6 +341,29 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 		hostConfig.CpusetCpus = v.(string)
 	}
 
+	if v, ok := d.GetOk("cpus"); ok {
+		hostConfig.NanoCPUs = cpusToNanoCPUs(v.(string))
+	}
+
+	if v, ok := d.GetOk("memory_reservation"); ok {
+		hostConfig.MemoryReservation = int64(v.(int)) * 1024 * 1024
+	}
+
+	if v, ok := d.GetOk("pids_limit"); ok {
+		pidsLimit := int64(v.(int))
+		hostConfig.PidsLimit = &pidsLimit
+	}
+
+	if v, ok := d.GetOk("blkio_weight"); ok {
+		hostConfig.BlkioWeight = uint16(v.(int))
+	}
+
+	if v, ok := d.GetOk("blkio_device"); ok {
+		if err := blkioDevicesToResources(v.(*schema.Set), &hostConfig.Resources); err != nil {
+			return classifyError(err, "blkio_device")
+		}
+	}
+
 	if v, ok := d.GetOk("log_opts"); ok {
 		hostConfig.LogConfig.Config = mapTypeMapValsToString(v.(map[string]interface{}))
 	}
@@ -315,10 +379,19 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 	if v, ok := d.GetOk("pid_mode"); ok {
 		hostConfig.PidMode = container.PidMode(v.(string))
 	}
+	if v, ok := d.GetOk("uts_mode"); ok {
+		hostConfig.UTSMode = container.UTSMode(v.(string))
+	}
+	if v, ok := d.GetOk("runtime"); ok {
+		hostConfig.Runtime = v.(string)
+	}
 
 	if v, ok := d.GetOk("sysctls"); ok {
 		hostConfig.Sysctls = mapTypeMapValsToString(v.(map[string]interface{}))
 	}
+	if v, ok := d.GetOk("storage_opts"); ok {
+		hostConfig.StorageOpt = mapTypeMapValsToString(v.(map[string]interface{}))
+	}
 	if v, ok := d.GetOk("ipc_mode"); ok {
 		hostConfig.IpcMode = container.IpcMode(v.(string))
 	}
@@ -326,20 +399,24 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 		hostConfig.GroupAdd = stringSetToStringSlice(v.(*schema.Set))
 	}
 
-	init := d.Get("init").(bool)
-	hostConfig.Init = &init
+	// an unset init is left to the default of the daemon
+	if v, ok := d.GetOkExists("init"); ok {
+		init := v.(bool)
+		hostConfig.Init = &init
+	}
 
 	var retContainer container.ContainerCreateCreatedBody
 
-	if retContainer, err = client.ContainerCreate(context.Background(), config, hostConfig, networkingConfig, d.Get("name").(string)); err != nil {
-		return fmt.Errorf("Unable to create container: %s", err)
+	createStart := time.Now()
+	if retContainer, err = client.ContainerCreate(ctx, config, hostConfig, networkingConfig, d.Get("name").(string)); err != nil {
+		return classifyError(fmt.Errorf("Unable to create container: %s", err), "name")
 	}
 
 	d.SetId(retContainer.ID)
 
 	// Still support the deprecated properties
 	if v, ok := d.GetOk("networks"); ok {
-		if err := client.NetworkDisconnect(context.Background(), "bridge", retContainer.ID, false); err != nil {
+		if err := client.NetworkDisconnect(ctx, "bridge", retContainer.ID, false); err != nil {
 			if !strings.Contains(err.Error(), "is not connected to the network bridge") {
 				return fmt.Errorf("Unable to disconnect the default network: %s", err)
 			}
@@ -351,7 +428,7 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 
 		for _, rawNetwork := range v.(*schema.Set).List() {
 			networkID := rawNetwork.(string)
-			if err := client.NetworkConnect(context.Background(), networkID, retContainer.ID, endpointConfig); err != nil {
+			if err := client.NetworkConnect(ctx, networkID, retContainer.ID, endpointConfig); err != nil {
 				return fmt.Errorf("Unable to connect to network '%s': %s", networkID, err)
 			}
 		}
@@ -359,7 +436,7 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 
 	// But overwrite them with the future ones, if set
 	if v, ok := d.GetOk("networks_advanced"); ok {
-		if err := client.NetworkDisconnect(context.Background(), "bridge", retContainer.ID, false); err != nil {
+		if err := client.NetworkDisconnect(ctx, "bridge", retContainer.ID, false); err != nil {
 			if !strings.Contains(err.Error(), "is not connected to the network bridge") {
 				return fmt.Errorf("Unable to disconnect the default network: %s", err)
 			}
@@ -379,17 +456,21 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 			if v, ok := rawNetwork.(map[string]interface{})["ipv6_address"]; ok {
 				endpointIPAMConfig.IPv6Address = v.(string)
 			}
-			endpointConfig.IPAMConfig = endpointIPAMConfig
+			staticAddress := endpointIPAMConfig.IPv4Address != "" || endpointIPAMConfig.IPv6Address != ""
+			if staticAddress {
+				endpointConfig.IPAMConfig = endpointIPAMConfig
+			}
 
-			if err := client.NetworkConnect(context.Background(), networkID, retContainer.ID, endpointConfig); err != nil {
+			if err := client.NetworkConnect(ctx, networkID, retContainer.ID, endpointConfig); err != nil {
+				if staticAddress && strings.Contains(err.Error(), "user configured subnets") {
+					return classifyError(fmt.Errorf("Unable to connect to network '%s' with a static address, the network needs an ipam_config with a subnet: %s", networkID, err), "networks_advanced")
+				}
 				return fmt.Errorf("Unable to connect to network '%s': %s", networkID, err)
 			}
 		}
 	}
 
 	if v, ok := d.GetOk("upload"); ok {
-
-		var mode int64
 		for _, upload := range v.(*schema.Set).List() {
 			content := upload.(map[string]interface{})["content"].(string)
 			contentBase64 := upload.(map[string]interface{})["content_base64"].(string)
@@ -425,21 +506,10 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 				}
 				contentToUpload = string(sourceContent)
 			}
-			file := upload.(map[string]interface{})["file"].(string)
-			executable := upload.(map[string]interface{})["executable"].(bool)
 
 			buf := new(bytes.Buffer)
 			tw := tar.NewWriter(buf)
-			if executable {
-				mode = 0744
-			} else {
-				mode = 0644
-			}
-			hdr := &tar.Header{
-				Name: file,
-				Mode: mode,
-				Size: int64(len(contentToUpload)),
-			}
+			hdr := uploadFileHeader(upload.(map[string]interface{}), int64(len(contentToUpload)))
 			if err := tw.WriteHeader(hdr); err != nil {
 				return fmt.Errorf("Error creating tar archive: %s", err)
 			}
@@ -453,7 +523,7 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 			dstPath := "/"
 			uploadContent := bytes.NewReader(buf.Bytes())
 			options := types.CopyToContainerOptions{}
-			if err := client.CopyToContainer(context.Background(), retContainer.ID, dstPath, uploadContent, options); err != nil {
+			if err := client.CopyToContainer(ctx, retContainer.ID, dstPath, uploadContent, options); err != nil {
 				return fmt.Errorf("Unable to upload volume content: %s", err)
 			}
 		}
@@ -462,16 +532,34 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 	if d.Get("start").(bool) {
 		creationTime = time.Now()
 		options := types.ContainerStartOptions{}
-		if err := client.ContainerStart(context.Background(), retContainer.ID, options); err != nil {
+		if err := client.ContainerStart(ctx, retContainer.ID, options); err != nil {
 			return fmt.Errorf("Unable to start container: %s", err)
 		}
 	}
+	if d.Get("start").(bool) && d.Get("wait").(bool) {
+		waitTimeout, _ := time.ParseDuration(d.Get("wait_timeout").(string))
+		if err := waitForContainerHealthy(ctx, client, retContainer.ID, waitTimeout); err != nil {
+			return classifyError(err, "wait_timeout")
+		}
+	}
+	if d.Get("start").(bool) && d.Get("wait_for_exit").(bool) {
+		waitTimeout, _ := time.ParseDuration(d.Get("wait_for_exit_timeout").(string))
+		exitCode, logs, err := waitForContainerExit(ctx, client, retContainer.ID, config.Tty, waitTimeout)
+		if err != nil {
+			return classifyError(err, "wait_for_exit_timeout")
+		}
+		d.Set("exit_code", exitCode)
+		d.Set("container_logs", logs)
+		if exitCode != 0 {
+			return fmt.Errorf("Container %s exited with code %d:\n%s", d.Get("name").(string), exitCode, lastLines(logs, containerExitLogLines))
+		}
+	}
+	timings.record("create", createStart)
+	d.Set("timings", timings.flatten())
 
 	if d.Get("attach").(bool) {
 		var b bytes.Buffer
 
-		ctx := context.Background()
-
 		if d.Get("logs").(bool) {
 			go func() {
 				reader, err := client.ContainerLogs(ctx, retContainer.ID, types.ContainerLogsOptions{
@@ -515,6 +603,235 @@ func resourceDockerContainerCreate(d *schema.ResourceData, meta interface{}) err
 	return resourceDockerContainerRead(d, meta)
 }
 
+// containerHealthPollInterval is the interval the state of a container is
+// polled in while waiting for it to be healthy
+var containerHealthPollInterval = time.Second
+
+// waitForContainerHealthy waits for the healthcheck of the started container
+// to report healthy, so dependent resources start against a ready service.
+// A container without a healthcheck only has to be running.
+func waitForContainerHealthy(ctx context.Context, client *client.Client, containerID string, timeout time.Duration) error {
+	log.Printf("[INFO] Waiting for container '%s' to be healthy: max '%v'", containerID, timeout)
+	stateConf := &resource.StateChangeConf{
+		Pending: []string{types.Starting},
+		Target:  []string{types.Healthy},
+		Refresh: func() (interface{}, string, error) {
+			container, err := client.ContainerInspect(ctx, containerID)
+			if err != nil {
+				return nil, "", fmt.Errorf("Error inspecting container %s: %s", containerID, err)
+			}
+			status, err := containerHealthStatus(container.State)
+			return container, status, err
+		},
+		Timeout:      timeout,
+		PollInterval: containerHealthPollInterval,
+	}
+	if _, err := stateConf.WaitForState(); err != nil {
+		return fmt.Errorf("Container %s is not healthy after %v: %s", containerID, timeout, err)
+	}
+	return nil
+}
+
+// uploadFileHeader returns the tar header of the file of an upload block. The
+// daemon keeps the owner of the header when it extracts the file.
+func uploadFileHeader(upload map[string]interface{}, size int64) *tar.Header {
+	var mode int64 = 0644
+	if upload["executable"].(bool) {
+		mode = 0744
+	}
+	if permissions, _ := upload["permissions"].(string); permissions != "" {
+		// the permissions are validated as octal
+		mode, _ = strconv.ParseInt(permissions, 8, 64)
+	}
+	uid, _ := upload["uid"].(int)
+	gid, _ := upload["gid"].(int)
+	return &tar.Header{
+		Name: upload["file"].(string),
+		Mode: mode,
+		Size: size,
+		Uid:  uid,
+		Gid:  gid,
+	}
+}
+
+// containerExitLogLines is the number of lines of the logs of a failed
+// one-shot container in the error
+const containerExitLogLines = 20
+
+// waitForContainerExit waits for the one-shot container to exit and returns
+// its exit code and its logs, e.g. of a migration or a seed job
+func waitForContainerExit(ctx context.Context, client *client.Client, containerID string, tty bool, timeout time.Duration) (int64, string, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	log.Printf("[INFO] Waiting for container '%s' to exit", containerID)
+	var exitCode int64
+	statusCh, errCh := client.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return 0, "", fmt.Errorf("Unable to wait for container %s to exit: %s", containerID, err)
+		}
+	case status := <-statusCh:
+		if status.Error != nil {
+			return 0, "", fmt.Errorf("Unable to wait for container %s to exit: %s", containerID, status.Error.Message)
+		}
+		exitCode = status.StatusCode
+	}
+
+	reader, err := client.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("Unable to read the logs of container %s: %s", containerID, err)
+	}
+	defer reader.Close()
+	var logs bytes.Buffer
+	if tty {
+		_, err = io.Copy(&logs, reader)
+	} else {
+		// the streams of a container without a TTY are multiplexed
+		_, err = stdcopy.StdCopy(&logs, &logs, reader)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("Unable to read the logs of container %s: %s", containerID, err)
+	}
+	return exitCode, logs.String(), nil
+}
+
+// lastLines returns the last n lines of the text
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// containerHealthStatus returns the health status of the container, an
+// unhealthy or exited container fails the wait right away
+func containerHealthStatus(state *types.ContainerState) (string, error) {
+	if state == nil {
+		return types.Starting, nil
+	}
+	if !state.Running {
+		if state.Status == "created" {
+			return types.Starting, nil
+		}
+		return "", fmt.Errorf("container is %s with exit code %d", state.Status, state.ExitCode)
+	}
+	if state.Health == nil || state.Health.Status == types.NoHealthcheck {
+		return types.Healthy, nil
+	}
+	switch state.Health.Status {
+	case types.Healthy:
+		return types.Healthy, nil
+	case types.Unhealthy:
+		output := ""
+		if len(state.Health.Log) > 0 {
+			output = strings.TrimSpace(state.Health.Log[len(state.Health.Log)-1].Output)
+		}
+		return "", fmt.Errorf("container is unhealthy after %d failed checks: %s", state.Health.FailingStreak, output)
+	default:
+		return types.Starting, nil
+	}
+}
+
+func resourceDockerContainerCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	if err := validateRestartPolicy(d.Get("restart").(string), d.Get("max_retry_count").(int), d.Get("rm").(bool)); err != nil {
+		return err
+	}
+	if d.Get("wait_for_exit").(bool) && d.Get("must_run").(bool) {
+		return fmt.Errorf("wait_for_exit requires must_run to be false, the exited container would be replaced")
+	}
+	if err := imageDriftCustomizeDiff(d, meta); err != nil {
+		return err
+	}
+	if err := liftedLimitsCustomizeDiff(d); err != nil {
+		return err
+	}
+	return seccompProfileCustomizeDiff(d)
+}
+
+// imageDriftCustomizeDiff replaces the container if the image is configured by
+// its name and the name points to another local image than the one the
+// container runs, e.g. after docker_image pulled a new latest
+func imageDriftCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	image := d.Get("image").(string)
+	if d.Id() == "" || !d.NewValueKnown("image") || d.HasChange("image") || strings.HasPrefix(image, "sha256:") {
+		return nil
+	}
+	client := meta.(*ProviderConfig).DockerClient
+	localImage, _, err := client.ImageInspectWithRaw(context.Background(), image)
+	if err != nil {
+		// the image is pulled again when the container is replaced
+		log.Printf("[DEBUG] Unable to inspect image %s of container %s: %s", image, d.Id(), err)
+		return nil
+	}
+	if localImage.ID == d.Get("image_id").(string) {
+		return nil
+	}
+	log.Printf("[INFO] Image %s of container %s changed to %s", image, d.Id(), localImage.ID)
+	if err := d.SetNew("image_id", localImage.ID); err != nil {
+		return err
+	}
+	return d.ForceNew("image_id")
+}
+
+// containerUpdateKeptLimits are the limits ContainerUpdate keeps when they
+// are zero, so they cannot be lifted in place
+var containerUpdateKeptLimits = []string{
+	"cpu_shares", "memory", "cpu_set", "memory_swap", "cpus", "memory_reservation", "blkio_weight",
+}
+
+// liftedLimitsCustomizeDiff replaces the container if one of its limits is
+// removed, the other changes of the limits are updated in place
+func liftedLimitsCustomizeDiff(d *schema.ResourceDiff) error {
+	if d.Id() == "" {
+		return nil
+	}
+	for _, attr := range containerUpdateKeptLimits {
+		if !d.HasChange(attr) {
+			continue
+		}
+		if limitLifted(d.GetChange(attr)) {
+			if err := d.ForceNew(attr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// limitLifted returns whether a limit was removed, the zero value is no limit
+func limitLifted(old, new interface{}) bool {
+	isZero := func(v interface{}) bool {
+		switch v := v.(type) {
+		case int:
+			return v == 0
+		case string:
+			return v == ""
+		}
+		return v == nil
+	}
+	return isZero(new) && !isZero(old)
+}
+
+// validateRestartPolicy rejects the combinations of the restart policy the
+// daemon only rejects when the container is created
+func validateRestartPolicy(restart string, maxRetryCount int, autoRemove bool) error {
+	if maxRetryCount > 0 && restart != "on-failure" {
+		return fmt.Errorf("max_retry_count can only be used with the restart policy on-failure, not %s", restart)
+	}
+	if autoRemove && restart != "no" {
+		return fmt.Errorf("rm cannot be used with the restart policy %s", restart)
+	}
+	return nil
+}
+
 func resourceDockerContainerRead(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
 
@@ -614,15 +931,22 @@ func resourceDockerContainerRead(d *schema.ResourceData, meta interface{}) error
 	// logs
 	// "must_run" can't be imported
 	// container_logs
-	d.Set("image", container.Image)
+	// the name of the image is kept, image_id tracks which image it points to
+	if image := d.Get("image").(string); image == "" || strings.HasPrefix(image, "sha256:") {
+		d.Set("image", container.Image)
+	}
+	d.Set("image_id", container.Image)
 	d.Set("hostname", container.Config.Hostname)
 	d.Set("domainname", container.Config.Domainname)
 	d.Set("command", container.Config.Cmd)
 	d.Set("entrypoint", container.Config.Entrypoint)
 	d.Set("user", container.Config.User)
+	d.Set("tty", container.Config.Tty)
+	d.Set("stdin_open", container.Config.OpenStdin)
 	d.Set("dns", container.HostConfig.DNS)
 	d.Set("dns_opts", container.HostConfig.DNSOptions)
-	d.Set("security_opts", container.HostConfig.SecurityOpt)
+	d.Set("security_opts", withoutSecurityProfileOpts(container.HostConfig.SecurityOpt, d.Get("seccomp_profile").(string), d.Get("apparmor_profile").(string)))
+	// "seccomp_profile" and "apparmor_profile" can't be imported
 	d.Set("dns_search", container.HostConfig.DNSSearch)
 	d.Set("publish_all_ports", container.HostConfig.PublishAllPorts)
 	d.Set("restart", container.HostConfig.RestartPolicy.Name)
@@ -678,7 +1002,13 @@ func resourceDockerContainerRead(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 	d.Set("devices", devices)
+	d.Set("device_requests", flattenDeviceRequests(container.HostConfig.DeviceRequests))
+	d.Set("device_cgroup_rules", container.HostConfig.DeviceCgroupRules)
 	// "destroy_grace_seconds" can't be imported
+	d.Set("stop_signal", container.Config.StopSignal)
+	if container.Config.StopTimeout != nil {
+		d.Set("stop_timeout", *container.Config.StopTimeout)
+	}
 	d.Set("memory", container.HostConfig.Memory/1024/1024)
 	if container.HostConfig.MemorySwap > 0 {
 		d.Set("memory_swap", container.HostConfig.MemorySwap/1024/1024)
@@ -688,14 +1018,32 @@ func resourceDockerContainerRead(d *schema.ResourceData, meta interface{}) error
 	d.Set("shm_size", container.HostConfig.ShmSize/1024/1024)
 	d.Set("cpu_shares", container.HostConfig.CPUShares)
 	d.Set("cpu_set", container.HostConfig.CpusetCpus)
+	if container.HostConfig.NanoCPUs > 0 {
+		d.Set("cpus", strconv.FormatFloat(float64(container.HostConfig.NanoCPUs)/1e9, 'f', -1, 64))
+	} else {
+		d.Set("cpus", "")
+	}
+	d.Set("memory_reservation", container.HostConfig.MemoryReservation/1024/1024)
+	if container.HostConfig.PidsLimit != nil && *container.HostConfig.PidsLimit > 0 {
+		d.Set("pids_limit", *container.HostConfig.PidsLimit)
+	} else {
+		// unlimited is reported as nil, 0 or -1 depending on the daemon
+		d.Set("pids_limit", 0)
+	}
+	d.Set("blkio_weight", container.HostConfig.BlkioWeight)
+	// "blkio_device" can't be imported
 	d.Set("log_driver", container.HostConfig.LogConfig.Type)
-	d.Set("log_opts", container.HostConfig.LogConfig.Config)
+	d.Set("log_opts", configuredLogOpts(d.Get("log_opts").(map[string]interface{}), container.HostConfig.LogConfig.Config))
 	// "network_alias" is deprecated
 	d.Set("network_mode", container.HostConfig.NetworkMode)
 	// networks
-	// networks_advanced
+	if v, ok := d.GetOk("networks_advanced"); ok && container.NetworkSettings != nil {
+		d.Set("networks_advanced", flattenNetworksAdvanced(v.(*schema.Set).List(), container.NetworkSettings.Networks, container.ID, strings.TrimPrefix(container.Name, "/")))
+	}
 	d.Set("pid_mode", container.HostConfig.PidMode)
 	d.Set("userns_mode", container.HostConfig.UsernsMode)
+	d.Set("uts_mode", container.HostConfig.UTSMode)
+	d.Set("runtime", container.HostConfig.Runtime)
 	// "upload" can't be imported
 	if container.Config.Healthcheck != nil {
 		d.Set("healthcheck", []interface{}{
@@ -709,14 +1057,19 @@ func resourceDockerContainerRead(d *schema.ResourceData, meta interface{}) error
 		})
 	}
 	d.Set("sysctls", container.HostConfig.Sysctls)
+	d.Set("storage_opts", container.HostConfig.StorageOpt)
 	d.Set("ipc_mode", container.HostConfig.IpcMode)
 	d.Set("group_add", container.HostConfig.GroupAdd)
 	return nil
 }
 
 func resourceDockerContainerUpdate(d *schema.ResourceData, meta interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
 	attrs := []string{
 		"restart", "max_retry_count", "cpu_shares", "memory", "cpu_set", "memory_swap",
+		"cpus", "memory_reservation", "pids_limit", "blkio_weight",
 	}
 	for _, attr := range attrs {
 		if d.HasChange(attr) {
@@ -736,12 +1089,23 @@ func resourceDockerContainerUpdate(d *schema.ResourceData, meta interface{}) err
 					MaximumRetryCount: d.Get("max_retry_count").(int),
 				},
 				Resources: container.Resources{
-					CPUShares:  int64(d.Get("cpu_shares").(int)),
-					Memory:     int64(d.Get("memory").(int)) * 1024 * 1024,
-					CpusetCpus: d.Get("cpu_set").(string),
+					CPUShares:         int64(d.Get("cpu_shares").(int)),
+					Memory:            int64(d.Get("memory").(int)) * 1024 * 1024,
+					CpusetCpus:        d.Get("cpu_set").(string),
+					NanoCPUs:          cpusToNanoCPUs(d.Get("cpus").(string)),
+					MemoryReservation: int64(d.Get("memory_reservation").(int)) * 1024 * 1024,
+					BlkioWeight:       uint16(d.Get("blkio_weight").(int)),
 					// Ulimits:    ulimits,
 				},
 			}
+			if d.HasChange("pids_limit") {
+				pidsLimit := int64(d.Get("pids_limit").(int))
+				if pidsLimit == 0 {
+					// a removed limit has to be lifted explicitly
+					pidsLimit = -1
+				}
+				updateConfig.Resources.PidsLimit = &pidsLimit
+			}
 
 			if ms, ok := d.GetOk("memory_swap"); ok {
 				a := int64(ms.(int))
@@ -751,7 +1115,7 @@ func resourceDockerContainerUpdate(d *schema.ResourceData, meta interface{}) err
 				updateConfig.Resources.MemorySwap = a
 			}
 			client := meta.(*ProviderConfig).DockerClient
-			_, err := client.ContainerUpdate(context.Background(), d.Id(), updateConfig)
+			_, err := client.ContainerUpdate(ctx, d.Id(), updateConfig)
 			if err != nil {
 				return fmt.Errorf("Unable to update a container: %w", err)
 			}
@@ -763,6 +1127,8 @@ func resourceDockerContainerUpdate(d *schema.ResourceData, meta interface{}) err
 
 func resourceDockerContainerDelete(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+	defer cancel()
 
 	if d.Get("rm").(bool) {
 		d.SetId("")
@@ -774,7 +1140,12 @@ func resourceDockerContainerDelete(d *schema.ResourceData, meta interface{}) err
 		if d.Get("destroy_grace_seconds").(int) > 0 {
 			timeout := time.Duration(int32(d.Get("destroy_grace_seconds").(int))) * time.Second
 
-			if err := client.ContainerStop(context.Background(), d.Id(), &timeout); err != nil {
+			if err := client.ContainerStop(ctx, d.Id(), &timeout); err != nil {
+				return fmt.Errorf("Error stopping container %s: %s", d.Id(), err)
+			}
+		} else if hasStopOptions(d) {
+			// the daemon sends the stop_signal and waits for the stop_timeout
+			if err := client.ContainerStop(ctx, d.Id(), nil); err != nil {
 				return fmt.Errorf("Error stopping container %s: %s", d.Id(), err)
 			}
 		}
@@ -785,11 +1156,11 @@ func resourceDockerContainerDelete(d *schema.ResourceData, meta interface{}) err
 		Force:         true,
 	}
 
-	if err := client.ContainerRemove(context.Background(), d.Id(), removeOpts); err != nil {
+	if err := client.ContainerRemove(ctx, d.Id(), removeOpts); err != nil {
 		return fmt.Errorf("Error deleting container %s: %s", d.Id(), err)
 	}
 
-	waitOkC, errorC := client.ContainerWait(context.Background(), d.Id(), container.WaitConditionRemoved)
+	waitOkC, errorC := client.ContainerWait(ctx, d.Id(), container.WaitConditionRemoved)
 	select {
 	case waitOk := <-waitOkC:
 		log.Printf("[INFO] Container exited with code [%v]: '%s'", waitOk.StatusCode, d.Id())
@@ -803,6 +1174,16 @@ func resourceDockerContainerDelete(d *schema.ResourceData, meta interface{}) err
 	return nil
 }
 
+// hasStopOptions reports whether the container has a stop_signal or a
+// stop_timeout, so it is stopped gracefully before it is removed
+func hasStopOptions(d *schema.ResourceData) bool {
+	if _, ok := d.GetOk("stop_signal"); ok {
+		return true
+	}
+	_, ok := d.GetOkExists("stop_timeout")
+	return ok
+}
+
 // TODO extract to structures_container.go
 type byPortAndProtocol []string
 
@@ -867,6 +1248,49 @@ func flattenContainerNetworks(in *types.NetworkSettings) []interface{} {
 	return out
 }
 
+// flattenNetworksAdvanced reads the attachments of the networks_advanced
+// blocks, so a disconnected network or a lost alias is a diff. A network is
+// configured by its name or ID. The aliases the daemon adds itself, the short
+// ID and the name of the container, are not stored unless they are configured.
+func flattenNetworksAdvanced(configured []interface{}, networks map[string]*network.EndpointSettings, containerID, containerName string) []interface{} {
+	out := make([]interface{}, 0, len(configured))
+	for _, rawNetwork := range configured {
+		rawNetwork := rawNetwork.(map[string]interface{})
+		name := rawNetwork["name"].(string)
+		var endpoint *network.EndpointSettings
+		for networkName, networkData := range networks {
+			if networkName == name || (networkData != nil && networkData.NetworkID == name) {
+				endpoint = networkData
+				break
+			}
+		}
+		if endpoint == nil {
+			continue
+		}
+
+		configuredAliases := rawNetwork["aliases"].(*schema.Set)
+		aliases := []string{}
+		for _, alias := range endpoint.Aliases {
+			if (alias == containerName || (len(containerID) >= 12 && alias == containerID[:12])) && !configuredAliases.Contains(alias) {
+				continue
+			}
+			aliases = append(aliases, alias)
+		}
+		m := map[string]interface{}{
+			"name":         name,
+			"aliases":      aliases,
+			"ipv4_address": rawNetwork["ipv4_address"],
+			"ipv6_address": rawNetwork["ipv6_address"],
+		}
+		if endpoint.IPAMConfig != nil {
+			m["ipv4_address"] = endpoint.IPAMConfig.IPv4Address
+			m["ipv6_address"] = endpoint.IPAMConfig.IPv6Address
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
 // TODO move to separate flattener file
 func stringListToStringSlice(stringList []interface{}) []string {
 	ret := []string{}
@@ -958,7 +1382,66 @@ func portSetToDockerPorts(ports []interface{}) (map[nat.Port]struct{}, map[nat.P
 	return retExposedPorts, retPortBindings
 }
 
-func ulimitsToDockerUlimits(extraUlimits *schema.Set) []*units.Ulimit {
+// cpusToNanoCPUs converts the number of CPUs like the --cpus flag of the
+// docker CLI, the value is already validated
+func cpusToNanoCPUs(cpus string) int64 {
+	if cpus == "" {
+		return 0
+	}
+	value, _ := strconv.ParseFloat(cpus, 64)
+	return int64(value * 1e9)
+}
+
+// blkioDevicesToResources sets the block IO weights and throttling of the
+// blkio_device blocks
+func blkioDevicesToResources(devices *schema.Set, resources *container.Resources) error {
+	for _, rawDevice := range devices.List() {
+		rawDevice := rawDevice.(map[string]interface{})
+		path := rawDevice["path"].(string)
+		if weight := rawDevice["weight"].(int); weight > 0 {
+			resources.BlkioWeightDevice = append(resources.BlkioWeightDevice, &blkiodev.WeightDevice{Path: path, Weight: uint16(weight)})
+		}
+		for attr, throttle := range map[string]*[]*blkiodev.ThrottleDevice{
+			"read_bps":  &resources.BlkioDeviceReadBps,
+			"write_bps": &resources.BlkioDeviceWriteBps,
+		} {
+			if rate := rawDevice[attr].(string); rate != "" {
+				bytes, err := units.RAMInBytes(rate)
+				if err != nil {
+					return fmt.Errorf("Invalid %s of the blkio device %s: %s", attr, path, err)
+				}
+				*throttle = append(*throttle, &blkiodev.ThrottleDevice{Path: path, Rate: uint64(bytes)})
+			}
+		}
+		if iops := rawDevice["read_iops"].(int); iops > 0 {
+			resources.BlkioDeviceReadIOps = append(resources.BlkioDeviceReadIOps, &blkiodev.ThrottleDevice{Path: path, Rate: uint64(iops)})
+		}
+		if iops := rawDevice["write_iops"].(int); iops > 0 {
+			resources.BlkioDeviceWriteIOps = append(resources.BlkioDeviceWriteIOps, &blkiodev.ThrottleDevice{Path: path, Rate: uint64(iops)})
+		}
+	}
+	return nil
+}
+
+// configuredLogOpts returns the options of the logging driver which are
+// configured. The daemon adds its default log-opts to the containers with its
+// default driver, which would replace the container on every plan.
+func configuredLogOpts(configured map[string]interface{}, logOpts map[string]string) map[string]string {
+	if len(configured) == 0 {
+		return logOpts
+	}
+	opts := make(map[string]string, len(configured))
+	for name, value := range logOpts {
+		if _, ok := configured[name]; ok {
+			opts[name] = value
+		}
+	}
+	return opts
+}
+
+// ulimitsToDockerUlimits maps the ulimit blocks to the ulimits of the host
+// config, -1 is unlimited like in the docker CLI
+func ulimitsToDockerUlimits(extraUlimits *schema.Set) ([]*units.Ulimit, error) {
 	retExtraUlimits := []*units.Ulimit{}
 
 	for _, ulimitInt := range extraUlimits.List() {
@@ -968,10 +1451,13 @@ func ulimitsToDockerUlimits(extraUlimits *schema.Set) []*units.Ulimit {
 			Soft: int64(ulimits["soft"].(int)),
 			Hard: int64(ulimits["hard"].(int)),
 		}
+		if u.Hard != -1 && (u.Soft == -1 || u.Soft > u.Hard) {
+			return nil, fmt.Errorf("The soft limit of ulimit %s cannot be higher than its hard limit: %d > %d", u.Name, u.Soft, u.Hard)
+		}
 		retExtraUlimits = append(retExtraUlimits, u)
 	}
 
-	return retExtraUlimits
+	return retExtraUlimits, nil
 }
 func extraHostsSetToDockerExtraHosts(extraHosts *schema.Set) []string {
 	retExtraHosts := []string{}
@@ -1031,11 +1517,10 @@ func deviceSetToDockerDevices(devices *schema.Set) []container.DeviceMapping {
 		containerPath := deviceMap["container_path"].(string)
 		permissions := deviceMap["permissions"].(string)
 
-		switch {
-		case len(containerPath) == 0:
+		if len(containerPath) == 0 {
 			containerPath = hostPath
-			fallthrough
-		case len(permissions) == 0:
+		}
+		if len(permissions) == 0 {
 			permissions = "rwm"
 		}
 
@@ -1049,14 +1534,55 @@ func deviceSetToDockerDevices(devices *schema.Set) []container.DeviceMapping {
 	return retDevices
 }
 
+// deviceRequestsToDockerDeviceRequests maps the device_requests blocks to the
+// device requests of the host config. The devices need the gpu capability by
+// default, like the ones of --gpus.
+func deviceRequestsToDockerDeviceRequests(rawRequests []interface{}) []container.DeviceRequest {
+	requests := []container.DeviceRequest{}
+	for _, rawRequest := range rawRequests {
+		rawRequest := rawRequest.(map[string]interface{})
+		capabilities := stringSetToStringSlice(rawRequest["capabilities"].(*schema.Set))
+		if len(capabilities) == 0 {
+			capabilities = []string{"gpu"}
+		}
+		requests = append(requests, container.DeviceRequest{
+			Driver:       rawRequest["driver"].(string),
+			Count:        rawRequest["count"].(int),
+			DeviceIDs:    stringListToStringSlice(rawRequest["device_ids"].([]interface{})),
+			Capabilities: [][]string{capabilities},
+			Options:      mapTypeMapValsToString(rawRequest["options"].(map[string]interface{})),
+		})
+	}
+	return requests
+}
+
+func flattenDeviceRequests(requests []container.DeviceRequest) []interface{} {
+	rawRequests := make([]interface{}, len(requests))
+	for i, request := range requests {
+		capabilities := []string{}
+		for _, andCapabilities := range request.Capabilities {
+			capabilities = append(capabilities, andCapabilities...)
+		}
+		rawRequests[i] = map[string]interface{}{
+			"driver":       request.Driver,
+			"count":        request.Count,
+			"device_ids":   request.DeviceIDs,
+			"capabilities": capabilities,
+			"options":      request.Options,
+		}
+	}
+	return rawRequests
+}
+
 func getDockerContainerMounts(container types.ContainerJSON) []map[string]interface{} {
 	mounts := []map[string]interface{}{}
 	for _, mount := range container.HostConfig.Mounts {
 		m := map[string]interface{}{
-			"target":    mount.Target,
-			"source":    mount.Source,
-			"type":      mount.Type,
-			"read_only": mount.ReadOnly,
+			"target":      mount.Target,
+			"source":      mount.Source,
+			"type":        mount.Type,
+			"read_only":   mount.ReadOnly,
+			"consistency": mount.Consistency,
 		}
 		if mount.BindOptions != nil {
 			m["bind_options"] = []map[string]interface{}{
@@ -1069,18 +1595,20 @@ func getDockerContainerMounts(container types.ContainerJSON) []map[string]interf
 			labels := []map[string]string{}
 			for k, v := range mount.VolumeOptions.Labels {
 				labels = append(labels, map[string]string{
-					"label":  k,
-					"volume": v,
+					"label": k,
+					"value": v,
 				})
 			}
-			m["volume_options"] = []map[string]interface{}{
-				{
-					"no_copy":        mount.VolumeOptions.NoCopy,
-					"labels":         labels,
-					"driver_name":    mount.VolumeOptions.DriverConfig.Name,
-					"driver_options": mount.VolumeOptions.DriverConfig.Options,
-				},
+			volumeOptions := map[string]interface{}{
+				"no_copy": mount.VolumeOptions.NoCopy,
+				"labels":  labels,
+			}
+			// the driver is only set if driver_name or driver_options are
+			if mount.VolumeOptions.DriverConfig != nil {
+				volumeOptions["driver_name"] = mount.VolumeOptions.DriverConfig.Name
+				volumeOptions["driver_options"] = mount.VolumeOptions.DriverConfig.Options
 			}
+			m["volume_options"] = []map[string]interface{}{volumeOptions}
 		}
 		if mount.TmpfsOptions != nil {
 			m["tmpfs_options"] = []map[string]interface{}{
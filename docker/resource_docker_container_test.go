@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"regexp"
@@ -14,11 +16,15 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 
 	"context"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
 )
 
@@ -32,6 +38,220 @@ func TestMapTypeMapValsToStringSlice(t *testing.T) {
 	}
 }
 
+func TestDeviceSetToDockerDevices(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceDockerContainer().Schema, map[string]interface{}{
+		"devices": []interface{}{
+			map[string]interface{}{"host_path": "/dev/kvm", "permissions": "rw"},
+		},
+	})
+	devices := deviceSetToDockerDevices(d.Get("devices").(*schema.Set))
+	expected := []container.DeviceMapping{
+		{PathOnHost: "/dev/kvm", PathInContainer: "/dev/kvm", CgroupPermissions: "rw"},
+	}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("expected %+v, got %+v", expected, devices)
+	}
+}
+
+func TestDeviceRequestsToDockerDeviceRequests(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceDockerContainer().Schema, map[string]interface{}{
+		"device_requests": []interface{}{
+			map[string]interface{}{"driver": "nvidia", "count": -1},
+			map[string]interface{}{
+				"device_ids":   []interface{}{"GPU-1"},
+				"capabilities": []interface{}{"compute"},
+				"options":      map[string]interface{}{"foo": "bar"},
+			},
+		},
+	})
+	requests := deviceRequestsToDockerDeviceRequests(d.Get("device_requests").([]interface{}))
+	expected := []container.DeviceRequest{
+		{Driver: "nvidia", Count: -1, DeviceIDs: []string{}, Capabilities: [][]string{{"gpu"}}, Options: map[string]string{}},
+		{DeviceIDs: []string{"GPU-1"}, Capabilities: [][]string{{"compute"}}, Options: map[string]string{"foo": "bar"}},
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %+v, got %+v", expected, requests)
+	}
+}
+
+func TestConfiguredLogOpts(t *testing.T) {
+	logOpts := map[string]string{"max-size": "10m", "max-file": "3"}
+	if opts := configuredLogOpts(map[string]interface{}{}, logOpts); !reflect.DeepEqual(opts, logOpts) {
+		t.Errorf("expected all the options without configured ones, got %v", opts)
+	}
+	// the default log-opts of the daemon are not a diff
+	opts := configuredLogOpts(map[string]interface{}{"max-size": "20m"}, logOpts)
+	if expected := map[string]string{"max-size": "10m"}; !reflect.DeepEqual(opts, expected) {
+		t.Errorf("expected %v, got %v", expected, opts)
+	}
+}
+
+func TestGetDockerContainerMounts(t *testing.T) {
+	mounts := getDockerContainerMounts(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &container.HostConfig{
+				Mounts: []mount.Mount{
+					{Type: mount.TypeVolume, Source: "data", Target: "/data", VolumeOptions: &mount.VolumeOptions{Labels: map[string]string{"foo": "bar"}}},
+					{Type: mount.TypeNamedPipe, Source: `\\.\pipe\docker_engine`, Target: `\\.\pipe\docker_engine`, Consistency: mount.ConsistencyDefault},
+				},
+			},
+		},
+	})
+	if len(mounts) != 2 {
+		t.Fatalf("expected 2 mounts, got %v", mounts)
+	}
+	volumeOptions := mounts[0]["volume_options"].([]map[string]interface{})[0]
+	if _, ok := volumeOptions["driver_name"]; ok {
+		t.Errorf("expected no driver without a driver config, got %v", volumeOptions)
+	}
+	if labels := volumeOptions["labels"].([]map[string]string); labels[0]["value"] != "bar" {
+		t.Errorf("expected the value of the label, got %v", labels)
+	}
+	if mounts[1]["type"] != mount.TypeNamedPipe || mounts[1]["consistency"] != mount.ConsistencyDefault {
+		t.Errorf("expected the npipe mount with its consistency, got %v", mounts[1])
+	}
+}
+
+func TestCpusToNanoCPUs(t *testing.T) {
+	cases := map[string]int64{"": 0, "1": 1000000000, "1.5": 1500000000, "0.25": 250000000}
+	for cpus, expected := range cases {
+		if nanoCPUs := cpusToNanoCPUs(cpus); nanoCPUs != expected {
+			t.Errorf("expected %d nano CPUs for %q, got %d", expected, cpus, nanoCPUs)
+		}
+	}
+}
+
+func TestBlkioDevicesToResources(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceDockerContainer().Schema, map[string]interface{}{
+		"blkio_device": []interface{}{
+			map[string]interface{}{"path": "/dev/sda", "weight": 200, "read_bps": "1MB", "write_iops": 100},
+		},
+	})
+	resources := container.Resources{}
+	if err := blkioDevicesToResources(d.Get("blkio_device").(*schema.Set), &resources); err != nil {
+		t.Fatal(err)
+	}
+	if len(resources.BlkioWeightDevice) != 1 || resources.BlkioWeightDevice[0].Weight != 200 {
+		t.Errorf("expected the weight of /dev/sda, got %v", resources.BlkioWeightDevice)
+	}
+	if len(resources.BlkioDeviceReadBps) != 1 || resources.BlkioDeviceReadBps[0].Rate != 1024*1024 {
+		t.Errorf("expected the read rate of /dev/sda, got %v", resources.BlkioDeviceReadBps)
+	}
+	if len(resources.BlkioDeviceWriteIOps) != 1 || resources.BlkioDeviceWriteIOps[0].Rate != 100 {
+		t.Errorf("expected the write IOps of /dev/sda, got %v", resources.BlkioDeviceWriteIOps)
+	}
+	if len(resources.BlkioDeviceWriteBps) != 0 || len(resources.BlkioDeviceReadIOps) != 0 {
+		t.Errorf("expected no other throttling, got %+v", resources)
+	}
+}
+
+func TestFlattenNetworksAdvanced(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceDockerContainer().Schema, map[string]interface{}{
+		"networks_advanced": []interface{}{
+			map[string]interface{}{"name": "backend", "aliases": []interface{}{"db"}},
+			map[string]interface{}{"name": "0123456789ab", "ipv4_address": "10.0.0.2"},
+			map[string]interface{}{"name": "gone"},
+		},
+	})
+	networks := map[string]*network.EndpointSettings{
+		"backend":  {NetworkID: "fedcba987654", Aliases: []string{"db", "abcdef012345", "tf-test"}},
+		"frontend": {NetworkID: "0123456789ab", IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "10.0.0.2"}},
+	}
+	flattened := flattenNetworksAdvanced(d.Get("networks_advanced").(*schema.Set).List(), networks, "abcdef0123456789", "tf-test")
+	if len(flattened) != 2 {
+		t.Fatalf("expected the disconnected network to be missing, got %v", flattened)
+	}
+	for _, rawNetwork := range flattened {
+		rawNetwork := rawNetwork.(map[string]interface{})
+		switch rawNetwork["name"] {
+		case "backend":
+			if aliases := rawNetwork["aliases"].([]string); !reflect.DeepEqual(aliases, []string{"db"}) {
+				t.Errorf("expected only the configured alias, got %v", aliases)
+			}
+		case "0123456789ab":
+			if rawNetwork["ipv4_address"] != "10.0.0.2" {
+				t.Errorf("expected the network by its ID with its address, got %v", rawNetwork)
+			}
+		default:
+			t.Errorf("unexpected network %v", rawNetwork)
+		}
+	}
+}
+
+func TestValidateRestartPolicy(t *testing.T) {
+	if err := validateRestartPolicy("on-failure", 5, false); err != nil {
+		t.Errorf("expected on-failure with a max retry count to be valid, got %s", err)
+	}
+	if err := validateRestartPolicy("no", 0, true); err != nil {
+		t.Errorf("expected rm without a restart policy to be valid, got %s", err)
+	}
+	if err := validateRestartPolicy("always", 5, false); err == nil {
+		t.Errorf("expected an error for always with a max retry count")
+	}
+	if err := validateRestartPolicy("unless-stopped", 0, true); err == nil {
+		t.Errorf("expected an error for rm with a restart policy")
+	}
+}
+
+func TestLimitLifted(t *testing.T) {
+	if !limitLifted(512, 0) || !limitLifted("1.5", "") {
+		t.Errorf("expected removed limits to be lifted")
+	}
+	if limitLifted(512, 1024) || limitLifted("", "0") || limitLifted(0, 512) {
+		t.Errorf("expected changed and added limits not to be lifted")
+	}
+}
+
+func TestResourceDockerContainerDeleteStopSignal(t *testing.T) {
+	requests := []string{}
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path[strings.Index(r.URL.Path, "/containers/"):])
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/wait"):
+			w.Write([]byte(`{"StatusCode":0}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(daemon.URL, "http://")), client.WithVersion("1.40"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stopSignal := range []string{"SIGQUIT", ""} {
+		requests = []string{}
+		d := schema.TestResourceDataRaw(t, resourceDockerContainer().Schema, map[string]interface{}{
+			"name":        "foo",
+			"image":       "nginx:latest",
+			"stop_signal": stopSignal,
+		})
+		d.SetId("abc")
+		if err := resourceDockerContainerDelete(d, &ProviderConfig{DockerClient: cli}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		expected := []string{"DELETE /containers/abc", "POST /containers/abc/wait"}
+		if stopSignal != "" {
+			// the container is stopped with its stop_signal before it is killed
+			expected = append([]string{"POST /containers/abc/stop"}, expected...)
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Errorf("expected %v for stop_signal %q, got %v", expected, stopSignal, requests)
+		}
+	}
+}
+
+func TestUploadFileHeader(t *testing.T) {
+	upload := map[string]interface{}{"file": "/foo.sh", "executable": true, "permissions": "", "uid": 0, "gid": 0}
+	if hdr := uploadFileHeader(upload, 3); hdr.Mode != 0744 || hdr.Size != 3 || hdr.Name != "/foo.sh" {
+		t.Errorf("expected an executable file, got %+v", hdr)
+	}
+	upload = map[string]interface{}{"file": "/foo.conf", "executable": true, "permissions": "0640", "uid": 101, "gid": 102}
+	if hdr := uploadFileHeader(upload, 3); hdr.Mode != 0640 || hdr.Uid != 101 || hdr.Gid != 102 {
+		t.Errorf("expected the permissions and the owner, got %+v", hdr)
+	}
+}
+
 func TestAccDockerContainer_private_image(t *testing.T) {
 	registry := "127.0.0.1:15000"
 	image := "127.0.0.1:15000/tftest-service:v1"
@@ -85,6 +305,10 @@ func TestAccDockerContainer_basic(t *testing.T) {
 					"restart",
 					"rm",
 					"start",
+					"wait",
+					"wait_timeout",
+					"wait_for_exit",
+					"wait_for_exit_timeout",
 					"container_logs",
 					"destroy_grace_seconds",
 					"upload",
@@ -113,6 +337,7 @@ func TestAccDockerContainer_init(t *testing.T) {
 				Config: testAccDockerContainerInitConfig,
 				Check: resource.ComposeTestCheckFunc(
 					testAccContainerRunning(resourceName, &c),
+					resource.TestCheckResourceAttr(resourceName, "runtime", "runc"),
 				),
 			},
 			{
@@ -127,6 +352,10 @@ func TestAccDockerContainer_init(t *testing.T) {
 					"restart",
 					"rm",
 					"start",
+					"wait",
+					"wait_timeout",
+					"wait_for_exit",
+					"wait_for_exit_timeout",
 					"container_logs",
 					"destroy_grace_seconds",
 					"upload",
@@ -374,6 +603,64 @@ func TestAccDockerContainer_sysctls(t *testing.T) {
 	})
 }
 
+func TestAccDockerContainer_stop(t *testing.T) {
+	var c types.ContainerJSON
+
+	testCheck := func(*terraform.State) error {
+		if c.Config.StopSignal != "SIGQUIT" {
+			return fmt.Errorf("Container has wrong stop signal: %s", c.Config.StopSignal)
+		}
+		if c.Config.StopTimeout == nil || *c.Config.StopTimeout != 30 {
+			return fmt.Errorf("Container has wrong stop timeout: %v", c.Config.StopTimeout)
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccDockerContainerStopConfig,
+				Check: resource.ComposeTestCheckFunc(
+					testAccContainerRunning("docker_container.foo", &c),
+					testCheck,
+					resource.TestCheckResourceAttr("docker_container.foo", "stop_signal", "SIGQUIT"),
+					resource.TestCheckResourceAttr("docker_container.foo", "stop_timeout", "30"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerContainer_tty(t *testing.T) {
+	var c types.ContainerJSON
+
+	testCheck := func(*terraform.State) error {
+		if !c.Config.Tty || !c.Config.OpenStdin {
+			return fmt.Errorf("Container has no TTY and open STDIN: tty %t, stdin_open %t", c.Config.Tty, c.Config.OpenStdin)
+		}
+		return nil
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				// a shell without a TTY and STDIN exits immediately
+				Config: testAccDockerContainerTtyConfig,
+				Check: resource.ComposeTestCheckFunc(
+					testAccContainerRunning("docker_container.foo", &c),
+					testCheck,
+					resource.TestCheckResourceAttr("docker_container.foo", "tty", "true"),
+					resource.TestCheckResourceAttr("docker_container.foo", "stdin_open", "true"),
+				),
+			},
+		},
+	})
+}
+
 func TestAccDockerContainer_groupadd_id(t *testing.T) {
 	var c types.ContainerJSON
 
@@ -492,6 +779,14 @@ func TestAccDockerContainer_customized(t *testing.T) {
 			return fmt.Errorf("Container has wrong cpu set setting: %s", c.HostConfig.CpusetCpus)
 		}
 
+		if c.HostConfig.MemoryReservation != (256 * 1024 * 1024) {
+			return fmt.Errorf("Container has wrong memory reservation setting: %d", c.HostConfig.MemoryReservation)
+		}
+
+		if c.HostConfig.PidsLimit == nil || *c.HostConfig.PidsLimit != 100 {
+			return fmt.Errorf("Container has wrong pids limit setting: %v", c.HostConfig.PidsLimit)
+		}
+
 		if len(c.HostConfig.DNS) != 1 {
 			return fmt.Errorf("Container does not have the correct number of dns entries: %d", len(c.HostConfig.DNS))
 		}
@@ -606,6 +901,9 @@ func TestAccDockerContainer_customized(t *testing.T) {
 		if c.HostConfig.UsernsMode != "testuser:231072:65536" {
 			return fmt.Errorf("Container doesn't have a correct userns mode")
 		}
+		if c.HostConfig.UTSMode != "host" {
+			return fmt.Errorf("Container doesn't have a correct uts mode")
+		}
 		if c.Config.WorkingDir != "/tmp" {
 			return fmt.Errorf("Container doesn't have a correct working dir")
 		}
@@ -1345,6 +1643,92 @@ func TestAccDockerContainer_healthcheck(t *testing.T) {
 	})
 }
 
+func TestAccDockerContainer_waitHealthy(t *testing.T) {
+	var c types.ContainerJSON
+	testCheck := func(*terraform.State) error {
+		if c.State.Health == nil || c.State.Health.Status != types.Healthy {
+			return fmt.Errorf("Container is not healthy after its creation: %v", c.State.Health)
+		}
+		return nil
+	}
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccDockerContainerWaitHealthyConfig,
+				Check: resource.ComposeTestCheckFunc(
+					testAccContainerRunning("docker_container.foo", &c),
+					testCheck,
+				),
+			},
+			{
+				Config:      testAccDockerContainerWaitUnhealthyConfig,
+				ExpectError: regexp.MustCompile(`is unhealthy`),
+			},
+		},
+	})
+}
+
+func TestAccDockerContainer_waitForExit(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccDockerContainerWaitForExitConfig, 0),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("docker_container.foo", "exit_code", "0"),
+					resource.TestCheckResourceAttr("docker_container.foo", "container_logs", "migrated\n"),
+				),
+			},
+			{
+				Config:      fmt.Sprintf(testAccDockerContainerWaitForExitConfig, 3),
+				ExpectError: regexp.MustCompile(`exited with code 3:\s+migrated`),
+			},
+		},
+	})
+}
+
+func TestLastLines(t *testing.T) {
+	if lines := lastLines("a\nb\nc\n", 2); lines != "b\nc" {
+		t.Errorf("expected the last 2 lines, got %q", lines)
+	}
+	if lines := lastLines("a\n", 2); lines != "a" {
+		t.Errorf("expected all the lines, got %q", lines)
+	}
+}
+
+func TestContainerHealthStatus(t *testing.T) {
+	cases := []struct {
+		state    *types.ContainerState
+		expected string
+		err      bool
+	}{
+		{state: &types.ContainerState{Status: "created"}, expected: types.Starting},
+		{state: &types.ContainerState{Status: "running", Running: true}, expected: types.Healthy},
+		{state: &types.ContainerState{Status: "running", Running: true, Health: &types.Health{Status: types.Starting}}, expected: types.Starting},
+		{state: &types.ContainerState{Status: "running", Running: true, Health: &types.Health{Status: types.Healthy}}, expected: types.Healthy},
+		{state: &types.ContainerState{Status: "running", Running: true, Health: &types.Health{Status: types.Unhealthy}}, err: true},
+		{state: &types.ContainerState{Status: "exited", ExitCode: 1}, err: true},
+	}
+	for _, c := range cases {
+		status, err := containerHealthStatus(c.state)
+		if c.err {
+			if err == nil {
+				t.Errorf("expected an error for %+v, got %s", c.state, status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %+v: %s", c.state, err)
+		}
+		if status != c.expected {
+			t.Errorf("expected %s for %+v, got %s", c.expected, c.state, status)
+		}
+	}
+}
+
 func TestAccDockerContainer_nostart(t *testing.T) {
 	var c types.ContainerJSON
 	resource.Test(t, resource.TestCase{
@@ -1749,6 +2133,34 @@ resource "docker_container" "fooinit" {
 	name = "tf-test"
 	image = "${docker_image.fooinit.latest}"
 	init = true
+	runtime = "runc"
+}
+`
+
+const testAccDockerContainerStopConfig = `
+resource "docker_image" "foo" {
+	name = "nginx:latest"
+}
+
+resource "docker_container" "foo" {
+	name         = "tf-test"
+	image        = "${docker_image.foo.latest}"
+	stop_signal  = "SIGQUIT"
+	stop_timeout = 30
+}
+`
+
+const testAccDockerContainerTtyConfig = `
+resource "docker_image" "foo" {
+	name = "busybox:latest"
+}
+
+resource "docker_container" "foo" {
+	name       = "tf-test"
+	image      = "${docker_image.foo.latest}"
+	command    = ["sh"]
+	tty        = true
+	stdin_open = true
 }
 `
 
@@ -1871,6 +2283,8 @@ resource "docker_container" "foo" {
 	memory = 512
 	shm_size = 128
 	memory_swap = 2048
+	memory_reservation = 256
+	pids_limit = 100
 	cpu_shares = 32
 	cpu_set = "0-1"
 
@@ -1932,6 +2346,7 @@ resource "docker_container" "foo" {
 
 	pid_mode 		= "host"
 	userns_mode = "testuser:231072:65536"
+	uts_mode = "host"
 	ipc_mode = "private"
 	working_dir = "/tmp"
 }
@@ -2160,6 +2575,60 @@ resource "docker_container" "foo" {
   }
 }
 `
+const testAccDockerContainerWaitForExitConfig = `
+resource "docker_image" "foo" {
+  name         = "busybox:latest"
+  keep_locally = true
+}
+
+resource "docker_container" "foo" {
+  name          = "tf-test"
+  image         = "${docker_image.foo.latest}"
+  command       = ["sh", "-c", "echo migrated && exit %d"]
+  must_run      = false
+  wait_for_exit = true
+}
+`
+
+const testAccDockerContainerWaitHealthyConfig = `
+resource "docker_image" "foo" {
+  name         = "nginx:latest"
+  keep_locally = true
+}
+
+resource "docker_container" "foo" {
+  name  = "tf-test"
+  image = "${docker_image.foo.latest}"
+  wait  = true
+
+  healthcheck {
+    test     = ["CMD", "/bin/true"]
+    interval = "1s"
+    retries  = 3
+  }
+}
+`
+
+const testAccDockerContainerWaitUnhealthyConfig = `
+resource "docker_image" "foo" {
+  name         = "nginx:latest"
+  keep_locally = true
+}
+
+resource "docker_container" "foo" {
+  name         = "tf-test"
+  image        = "${docker_image.foo.latest}"
+  wait         = true
+  wait_timeout = "30s"
+
+  healthcheck {
+    test     = ["CMD", "/bin/false"]
+    interval = "1s"
+    retries  = 2
+  }
+}
+`
+
 const testAccDockerContainerNoStartConfig = `
 resource "docker_image" "foo" {
   name         = "nginx:latest"
@@ -1,6 +1,8 @@
 package docker
 
 import (
+	"time"
+
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 )
 
@@ -11,6 +13,32 @@ func resourceDockerImage() *schema.Resource {
 		Update: resourceDockerImageUpdate,
 		Delete: resourceDockerImageDelete,
 
+		CustomizeDiff: resourceDockerImageCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		SchemaVersion: 2,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceDockerImageV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: func(rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+					return migrateImagePushPullOutput(rawState), nil
+				},
+			},
+			{
+				Version: 1,
+				Type:    resourceDockerImageV1().CoreConfigSchema().ImpliedType(),
+				Upgrade: func(rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+					return migrateImageLatestToImageID(rawState), nil
+				},
+			},
+		},
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -18,8 +46,79 @@ func resourceDockerImage() *schema.Resource {
 			},
 
 			"latest": {
-				Type:     schema.TypeString,
-				Computed: true,
+				Type:       schema.TypeString,
+				Computed:   true,
+				Deprecated: "Use the image_id attribute instead",
+			},
+
+			"image_id": {
+				Type:        schema.TypeString,
+				Description: "The ID of the local image",
+				Computed:    true,
+			},
+
+			"repo_digest": {
+				Type:        schema.TypeString,
+				Description: "The repo digest of the image for the repository of its name, empty if the image was never pushed or pulled",
+				Computed:    true,
+			},
+
+			"labels": {
+				Type:        schema.TypeMap,
+				Description: "Labels of the image",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"entrypoint": {
+				Type:        schema.TypeList,
+				Description: "Entrypoint of the image",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"exposed_ports": {
+				Type:        schema.TypeList,
+				Description: "Ports exposed by the image in the form 'port/protocol'",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"env": {
+				Type:        schema.TypeList,
+				Description: "Environment variables of the image in the form 'KEY=value'",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"registry_auth": resourceRegistryAuthSchema,
+
+			"timings": timingsSchema,
+
+			"build_context_hash": {
+				Type:        schema.TypeString,
+				Description: "Hash of the build context, a change causes a rebuild",
+				Computed:    true,
+			},
+
+			"dockerfile_hash": {
+				Type:        schema.TypeString,
+				Description: "Hash of the Dockerfile, a change causes a rebuild",
+				Computed:    true,
+			},
+
+			"rebuild_reason": {
+				Type:        schema.TypeString,
+				Description: "Why the image will be built by the planned apply",
+				Computed:    true,
 			},
 
 			"keep_locally": {
@@ -27,16 +126,120 @@ func resourceDockerImage() *schema.Resource {
 				Optional: true,
 			},
 
+			"keep_old_releases": {
+				Type:         schema.TypeInt,
+				Description:  "Number of superseded images of the name which are retained with a release tag, older ones are removed",
+				Optional:     true,
+				ValidateFunc: validateIntegerGeqThan(0),
+			},
+
+			"retained_releases": {
+				Type:        schema.TypeList,
+				Description: "Release tags of the retained superseded images, the newest first",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"save_path": {
+				Type:        schema.TypeString,
+				Description: "Path of a tar file the image is saved to after it was pulled or built",
+				Optional:    true,
+			},
+
+			"load_path": {
+				Type:          schema.TypeString,
+				Description:   "Path of a tar file created by 'docker save' the image is loaded from instead of pulling it",
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"build", "import"},
+			},
+
+			"import": {
+				Type:          schema.TypeList,
+				Description:   "Creates the image from a tarball of a root filesystem like 'docker import' instead of pulling it",
+				Optional:      true,
+				ForceNew:      true,
+				MaxItems:      1,
+				ConflictsWith: []string{"build", "load_path"},
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"source": {
+							Type:        schema.TypeString,
+							Description: "Path or http(s) URL of the tarball, URLs are downloaded by the daemon",
+							Required:    true,
+							ForceNew:    true,
+						},
+						"changes": {
+							Type:        schema.TypeList,
+							Description: "Dockerfile instructions applied to the image, e.g. 'CMD [\"/bin/sh\"]' or 'ENV PATH=/bin'",
+							Optional:    true,
+							ForceNew:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"message": {
+							Type:        schema.TypeString,
+							Description: "Commit message of the imported image",
+							Optional:    true,
+							ForceNew:    true,
+						},
+						"platform": {
+							Type:        schema.TypeString,
+							Description: "Platform of the imported image, e.g. 'linux/arm64'",
+							Optional:    true,
+							ForceNew:    true,
+						},
+					},
+				},
+			},
+
+			"platform": {
+				Type:        schema.TypeString,
+				Description: "Platform of the pulled image in the format 'os/arch[/variant]', e.g. 'linux/arm64'",
+				Optional:    true,
+				ForceNew:    true,
+			},
+
 			"push_remote": {
 				Type:     schema.TypeBool,
 				Optional: true,
 			},
 
+			"push_targets": {
+				Type:        schema.TypeList,
+				Description: "Additional names the image is tagged with and pushed to, e.g. in other registries",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"push_verification_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1m",
+				ValidateFunc: validateDurationGeq0(),
+				Description:  "Time to wait for the pushed manifest to be available in the registry (ms|s|m|h)",
+			},
+
 			"force_build": {
 				Type:     schema.TypeBool,
 				Optional: true,
 			},
 
+			"triggers": {
+				Type:        schema.TypeMap,
+				Description: "Arbitrary values which rebuild or pull the image again when they change",
+				Optional:    true,
+				ForceNew:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
 			"pull_trigger": {
 				Type:          schema.TypeString,
 				Optional:      true,
@@ -54,13 +257,17 @@ func resourceDockerImage() *schema.Resource {
 			},
 
 			"pull_output": {
-				Type:     schema.TypeString,
-				Computed: true,
+				Type:        schema.TypeList,
+				Description: "Summary of the last pull of the image",
+				Computed:    true,
+				Elem:        pushPullOutputSchema,
 			},
 
 			"push_output": {
-				Type:     schema.TypeString,
-				Computed: true,
+				Type:        schema.TypeList,
+				Description: "Summary of the last push of the image",
+				Computed:    true,
+				Elem:        pushPullOutputSchema,
 			},
 
 			"build_output": {
@@ -68,6 +275,110 @@ func resourceDockerImage() *schema.Resource {
 				Computed: true,
 			},
 
+			"scan": {
+				Type:        schema.TypeList,
+				Description: "Scans the image for vulnerabilities before it is pushed",
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"command": {
+							Type:        schema.TypeList,
+							Description: "Command printing a trivy JSON report of the image appended to it",
+							Optional:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"severity_threshold": {
+							Type:         schema.TypeString,
+							Description:  "Lowest severity failing the scan, 'UNKNOWN', 'LOW', 'MEDIUM', 'HIGH' or 'CRITICAL'",
+							Optional:     true,
+							ValidateFunc: validateStringMatchesPattern(`^(UNKNOWN|LOW|MEDIUM|HIGH|CRITICAL)$`),
+						},
+						"ignore_unfixed": {
+							Type:        schema.TypeBool,
+							Description: "Ignore vulnerabilities without a fixed version",
+							Optional:    true,
+						},
+					},
+				},
+			},
+
+			"scan_results": {
+				Type:        schema.TypeMap,
+				Description: "Number of vulnerabilities of the last scan by severity",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
+
+			"sign": {
+				Type:        schema.TypeList,
+				Description: "Signs the pushed image like cosign with the key or keyless with the identity token",
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:        schema.TypeString,
+							Description: "PEM encoded ECDSA private key, e.g. the content of cosign.key",
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"password": {
+							Type:        schema.TypeString,
+							Description: "Password of an encrypted cosign key",
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"identity_token": {
+							Type:        schema.TypeString,
+							Description: "OIDC identity token to sign keyless with a Fulcio certificate instead of a key",
+							Optional:    true,
+							Sensitive:   true,
+						},
+						"fulcio_url": {
+							Type:        schema.TypeString,
+							Description: "URL of the Fulcio certificate authority for keyless signing",
+							Optional:    true,
+							Default:     defaultFulcioURL,
+						},
+						"rekor_url": {
+							Type:        schema.TypeString,
+							Description: "URL of the Rekor transparency log for keyless signing",
+							Optional:    true,
+							Default:     defaultRekorURL,
+						},
+					},
+				},
+			},
+
+			"signature_ref": {
+				Type:        schema.TypeString,
+				Description: "Reference of the signature of the pushed image",
+				Computed:    true,
+			},
+
+			"push_target_digests": {
+				Type:        schema.TypeMap,
+				Description: "Digests of the pushed push targets by name",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"platform_digests": {
+				Type:        schema.TypeMap,
+				Description: "Digests of the pushed images of a multi-platform build by platform",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
 			"build": {
 				Type:          schema.TypeSet,
 				Optional:      true,
@@ -77,7 +388,7 @@ func resourceDockerImage() *schema.Resource {
 					Schema: map[string]*schema.Schema{
 						"path": {
 							Type:        schema.TypeString,
-							Description: "Context path",
+							Description: "Context path, or the URL of a git repository or a tarball",
 							Required:    true,
 							ForceNew:    true,
 						},
@@ -88,6 +399,58 @@ func resourceDockerImage() *schema.Resource {
 							Default:     "Dockerfile",
 							ForceNew:    true,
 						},
+						"dockerfile_contents": {
+							Type:        schema.TypeString,
+							Description: "Contents of the Dockerfile, takes precedence over dockerfile",
+							Optional:    true,
+						},
+						"excludes": {
+							Type:        schema.TypeList,
+							Description: "Patterns of files excluded from the context in addition to the .dockerignore",
+							Optional:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"builder": {
+							Type:        schema.TypeList,
+							Description: "Buildx builder which builds the image instead of the daemon of the provider",
+							Optional:    true,
+							MaxItems:    1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"name": {
+										Type:        schema.TypeString,
+										Description: "Name of an existing buildx builder, like 'docker buildx build --builder'",
+										Optional:    true,
+									},
+									"endpoint": {
+										Type:         schema.TypeString,
+										Description:  "Address of a BuildKit daemon, e.g. 'tcp://buildkitd:1234', or of a Docker host running BuildKit, e.g. 'ssh://user@builder'",
+										Optional:     true,
+										ValidateFunc: validateStringMatchesPattern(`^(tcp|ssh)://`),
+									},
+									"command": {
+										Type:        schema.TypeList,
+										Description: "Command running buildx, defaults to 'docker buildx'",
+										Optional:    true,
+										Elem:        &schema.Schema{Type: schema.TypeString},
+									},
+								},
+							},
+						},
+						"builder_version": {
+							Type:         schema.TypeString,
+							Description:  "Version of the builder, '1' for the classic builder (default) or '2' for BuildKit",
+							Optional:     true,
+							ValidateFunc: validateStringMatchesPattern(`^(1|2)$`),
+						},
+						"progress": {
+							Type:         schema.TypeString,
+							Description:  "Progress output of BuildKit stored in build_output, 'auto', 'plain', 'tty' or 'quiet'",
+							Optional:     true,
+							ValidateFunc: validateStringMatchesPattern(`^(auto|plain|tty|quiet)$`),
+						},
 						"tag": {
 							Type:        schema.TypeList,
 							Description: "Name and optionally a tag in the 'name:tag' format",
@@ -112,11 +475,122 @@ func resourceDockerImage() *schema.Resource {
 							Description: "Do not use cache when building the image",
 							Optional:    true,
 						},
+						"pull_parent": {
+							Type:        schema.TypeBool,
+							Description: "Pull the images of the FROM instructions even if they are present locally",
+							Optional:    true,
+						},
 						"target": {
 							Type:        schema.TypeString,
 							Description: "Set the target build stage to build",
 							Optional:    true,
 						},
+						"platforms": {
+							Type:        schema.TypeList,
+							Description: "Platforms to build the image for, combined into a manifest list when pushed",
+							Optional:    true,
+							ForceNew:    true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validateStringMatchesPattern(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`),
+							},
+						},
+						"cpu_shares": {
+							Type:        schema.TypeInt,
+							Description: "CPU shares (relative weight) of the build containers",
+							Optional:    true,
+						},
+						"cpu_quota": {
+							Type:        schema.TypeInt,
+							Description: "Microseconds of CPU time that the build containers can get in a CPU period",
+							Optional:    true,
+						},
+						"cpu_period": {
+							Type:        schema.TypeInt,
+							Description: "Length of a CPU period in microseconds",
+							Optional:    true,
+						},
+						"memory": {
+							Type:        schema.TypeInt,
+							Description: "Memory limit of the build containers in bytes",
+							Optional:    true,
+						},
+						"memory_swap": {
+							Type:        schema.TypeInt,
+							Description: "Total memory (memory + swap) of the build containers in bytes, -1 to enable unlimited swap",
+							Optional:    true,
+						},
+						"cgroup_parent": {
+							Type:        schema.TypeString,
+							Description: "Parent cgroup of the build containers",
+							Optional:    true,
+						},
+						"shm_size": {
+							Type:        schema.TypeInt,
+							Description: "Size of /dev/shm of the build containers in bytes",
+							Optional:    true,
+						},
+						"isolation": {
+							Type:         schema.TypeString,
+							Description:  "Isolation technology of the build containers. (Windows only)",
+							Optional:     true,
+							ValidateFunc: validateStringMatchesPattern(`^(default|process|hyperv)$`),
+						},
+						"network_mode": {
+							Type:        schema.TypeString,
+							Description: "Set the networking mode for the RUN instructions during build",
+							Optional:    true,
+						},
+						"extra_hosts": {
+							Type:        schema.TypeList,
+							Description: "A list of hostnames/IP mappings to add to the /etc/hosts file of the RUN instructions in the form 'hostname:IP'",
+							Optional:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"cache_from": {
+							Type:        schema.TypeList,
+							Description: "Images to consider as cache sources",
+							Optional:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"platform": {
+							Type:         schema.TypeString,
+							Description:  "Platform of the image in the 'os/arch[/variant]' format if the server is multi-platform capable",
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateStringMatchesPattern(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`),
+						},
+						"output": {
+							Type:        schema.TypeList,
+							Description: "Writes the files of the built image to disk in addition to loading it into the daemon, requires builder_version 2",
+							Optional:    true,
+							MaxItems:    1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"type": {
+										Type:         schema.TypeString,
+										Description:  "'tar' writes a tarball, 'local' a directory",
+										Required:     true,
+										ValidateFunc: validateStringMatchesPattern(`^(tar|local)$`),
+									},
+									"dest": {
+										Type:        schema.TypeString,
+										Description: "Path of the tarball or directory",
+										Required:    true,
+									},
+								},
+							},
+						},
+						"cache_to": {
+							Type:         schema.TypeString,
+							Description:  "Cache export, 'inline' embeds the build cache into the image, requires builder_version 2",
+							Optional:     true,
+							ValidateFunc: validateStringMatchesPattern(`^(type=)?inline$`),
+						},
 						"build_arg": {
 							Type:        schema.TypeMap,
 							Description: "Set build-time variables",
@@ -134,9 +608,77 @@ func resourceDockerImage() *schema.Resource {
 								Type: schema.TypeString,
 							},
 						},
+						"secrets": {
+							Type:        schema.TypeList,
+							Description: "Secrets exposed to the build with RUN --mount=type=secret, requires builder_version 2",
+							Optional:    true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"id": {
+										Type:        schema.TypeString,
+										Description: "ID of the secret",
+										Required:    true,
+									},
+									"src": {
+										Type:        schema.TypeString,
+										Description: "Path of the file containing the secret",
+										Optional:    true,
+									},
+									"env": {
+										Type:        schema.TypeString,
+										Description: "Name of the environment variable containing the secret",
+										Optional:    true,
+									},
+								},
+							},
+						},
+						"ssh": {
+							Type:        schema.TypeList,
+							Description: "SSH agents forwarded to the build with RUN --mount=type=ssh, requires builder_version 2",
+							Optional:    true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"id": {
+										Type:        schema.TypeString,
+										Description: "ID of the agent, 'default' is used by mounts without an id",
+										Required:    true,
+									},
+									"socket": {
+										Type:        schema.TypeString,
+										Description: "Path of the agent socket (default is SSH_AUTH_SOCK)",
+										Optional:    true,
+									},
+								},
+							},
+						},
 					},
 				},
 			},
 		},
 	}
 }
+
+var pushPullOutputSchema = &schema.Resource{
+	Schema: map[string]*schema.Schema{
+		"digest": {
+			Type:        schema.TypeString,
+			Description: "The repo digest reported by the registry",
+			Computed:    true,
+		},
+		"layers": {
+			Type:        schema.TypeInt,
+			Description: "Number of layers of the image",
+			Computed:    true,
+		},
+		"bytes": {
+			Type:        schema.TypeInt,
+			Description: "Number of bytes transferred",
+			Computed:    true,
+		},
+		"skipped": {
+			Type:        schema.TypeBool,
+			Description: "True if nothing was transferred because the content was already present",
+			Computed:    true,
+		},
+	},
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func resourceDockerImageBake() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceDockerImageBakeCreate,
+		Read:   resourceDockerImageBakeRead,
+		Update: resourceDockerImageBakeUpdate,
+		Delete: resourceDockerImageBakeDelete,
+
+		CustomizeDiff: resourceDockerImageBakeCustomizeDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"file": {
+				Type:        schema.TypeString,
+				Description: "Path of the docker-bake.hcl, docker-bake.json or compose file",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"targets": {
+				Type:        schema.TypeList,
+				Description: "Targets or groups to build, the default group or all targets if empty",
+				Optional:    true,
+				ForceNew:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"builder_version": {
+				Type:         schema.TypeString,
+				Description:  "Version of the builder, '1' for the classic builder (default) or '2' for BuildKit",
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateStringMatchesPattern(`^(1|2)$`),
+			},
+
+			"no_cache": {
+				Type:        schema.TypeBool,
+				Description: "Do not use the cache for any of the targets",
+				Optional:    true,
+				ForceNew:    true,
+			},
+
+			"keep_locally": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+
+			"build_hash": {
+				Type:        schema.TypeString,
+				Description: "Hash of the targets, their contexts and Dockerfiles",
+				Computed:    true,
+			},
+
+			"build_output": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"images": {
+				Type:        schema.TypeList,
+				Description: "The images built for the targets",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"target": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"tags": {
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"image_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
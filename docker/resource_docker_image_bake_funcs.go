@@ -0,0 +1,206 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// bakeBuild is a target of the bake file in the format of the build block of
+// docker_image
+type bakeBuild struct {
+	target   bakeTarget
+	rawBuild map[string]interface{}
+}
+
+type resourceGetter interface {
+	Get(key string) interface{}
+}
+
+// bakeBuilds reads the bake file of the resource and returns the builds of
+// the selected targets
+func bakeBuilds(d resourceGetter) ([]bakeBuild, error) {
+	path, err := homedir.Expand(d.Get("file").(string))
+	if err != nil {
+		return nil, err
+	}
+	file, err := readBakeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := file.resolve(stringListToStringSlice(d.Get("targets").([]interface{})))
+	if err != nil {
+		return nil, err
+	}
+
+	builds := make([]bakeBuild, 0, len(targets))
+	for _, target := range targets {
+		rawBuild, err := target.rawBuild(file.dir, d.Get("builder_version").(string), d.Get("no_cache").(bool))
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, bakeBuild{target: target, rawBuild: rawBuild})
+	}
+	return builds, nil
+}
+
+// bakeBuildHash hashes the builds with the hashes of their contexts and
+// Dockerfiles, so changes of the bake file, the variables from the
+// environment or the sources of a target are detected
+func bakeBuildHash(builds []bakeBuild) (string, error) {
+	hash := sha256.New()
+	for _, build := range builds {
+		contextHash, dockerfileHash, err := getDockerImageBuildHashes(build.rawBuild)
+		if err != nil {
+			return "", fmt.Errorf("Unable to hash the build context of target %s: %s", build.target.Name, err)
+		}
+		rawBuild, err := json.Marshal(build.rawBuild)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n", build.target.Name, rawBuild, contextHash, dockerfileHash)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func resourceDockerImageBakeCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*ProviderConfig).DockerClient
+	ctx, cancel := context.WithTimeout(context.Background(), resourceTimeout(d, meta, schema.TimeoutCreate, "build"))
+	defer cancel()
+	if d.Get("builder_version").(string) == string(types.BuilderBuildKit) {
+		if err := requireDockerEngine(meta, "BuildKit, builder_version 2,"); err != nil {
+			return err
+		}
+	}
+
+	builds, err := bakeBuilds(d)
+	if err != nil {
+		return err
+	}
+	buildHash, err := bakeBuildHash(builds)
+	if err != nil {
+		return err
+	}
+
+	var output strings.Builder
+	images := make([]interface{}, 0, len(builds))
+	for _, build := range builds {
+		imageName := build.target.imageName()
+		if err := providerPullOptions(meta).checkBuild(build.rawBuild); err != nil {
+			return classifyError(fmt.Errorf("Unable to build target %s: %s", build.target.Name, err), "build")
+		}
+		fmt.Fprintf(&output, "Building target %s\n", build.target.Name)
+		buildCtx, cancelBuild := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "build")
+		buildOutput, err := buildDockerImagePlatforms(buildCtx, withDefaultBuildLabels(meta, build.rawBuild, "label"), imageName, client, meta.(*ProviderConfig).Operations, meta.(*ProviderConfig).ContextSizeWarningThreshold)
+		cancelBuild()
+		output.WriteString(buildOutput)
+		d.Set("build_output", output.String())
+		if err != nil {
+			return classifyError(fmt.Errorf("Unable to build target %s: %s\n\n%s", build.target.Name, err, buildOutput), "build")
+		}
+
+		image, _, err := client.ImageInspectWithRaw(ctx, imageName)
+		if err != nil {
+			return fmt.Errorf("Unable to inspect image %s of target %s: %s", imageName, build.target.Name, err)
+		}
+		images = append(images, map[string]interface{}{
+			"target":   build.target.Name,
+			"name":     imageName,
+			"tags":     builtImageNames(build.rawBuild, imageName),
+			"image_id": image.ID,
+		})
+	}
+
+	d.SetId(buildHash)
+	d.Set("build_hash", buildHash)
+	d.Set("images", images)
+	return resourceDockerImageBakeRead(d, meta)
+}
+
+func resourceDockerImageBakeRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*ProviderConfig).DockerClient
+	var data Data
+	if err := fetchLocalImages(context.Background(), &data, client); err != nil {
+		return fmt.Errorf("Error reading docker image list: %s", err)
+	}
+
+	// the images are built again if one of them is gone
+	for _, rawImage := range d.Get("images").([]interface{}) {
+		image := rawImage.(map[string]interface{})
+		foundImage := searchLocalImages(data, image["name"].(string))
+		if foundImage == nil || foundImage.ID != image["image_id"].(string) {
+			log.Printf("[INFO] Image %s of target %s is gone, removing the bake from state", image["name"], image["target"])
+			d.SetId("")
+			return nil
+		}
+	}
+	return nil
+}
+
+func resourceDockerImageBakeUpdate(d *schema.ResourceData, meta interface{}) error {
+	// only keep_locally can be updated
+	return resourceDockerImageBakeRead(d, meta)
+}
+
+func resourceDockerImageBakeDelete(d *schema.ResourceData, meta interface{}) error {
+	if d.Get("keep_locally").(bool) {
+		d.SetId("")
+		return nil
+	}
+
+	client := meta.(*ProviderConfig).DockerClient
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+	var data Data
+	if err := fetchLocalImages(ctx, &data, client); err != nil {
+		return err
+	}
+
+	for _, rawImage := range d.Get("images").([]interface{}) {
+		image := rawImage.(map[string]interface{})
+		// removing the tags removes the image once it has none left
+		for _, tag := range stringListToStringSlice(image["tags"].([]interface{})) {
+			if searchLocalImages(data, tag) == nil {
+				continue
+			}
+			if _, err := client.ImageRemove(ctx, tag, types.ImageRemoveOptions{}); err != nil {
+				return fmt.Errorf("Unable to remove image %s of target %s: %s", tag, image["target"], err)
+			}
+		}
+	}
+	d.SetId("")
+	return nil
+}
+
+// resourceDockerImageBakeCustomizeDiff replaces the images if the targets,
+// their contexts or Dockerfiles changed
+func resourceDockerImageBakeCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	// the apply reports errors of the bake file
+	builds, err := bakeBuilds(d)
+	if err != nil {
+		log.Printf("[DEBUG] Unable to read the targets of %s: %s", d.Get("file").(string), err)
+		return nil
+	}
+	buildHash, err := bakeBuildHash(builds)
+	if err != nil {
+		log.Printf("[DEBUG] Unable to hash the targets of %s: %s", d.Get("file").(string), err)
+		return nil
+	}
+
+	if err := d.SetNew("build_hash", buildHash); err != nil {
+		return err
+	}
+	if old, _ := d.GetChange("build_hash"); d.Id() != "" && old.(string) != buildHash {
+		log.Printf("[INFO] Targets of %s changed, the images will be built", d.Get("file").(string))
+		return d.ForceNew("build_hash")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+)
+
+func TestAccDockerImageBake_basic(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile.bake")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileBakeExample), 0644)
+	defer os.Remove(dfPath)
+	bakePath := path.Join(wd, "docker-bake.hcl")
+	ioutil.WriteFile(bakePath, []byte(testDockerBakeFileExample), 0644)
+	defer os.Remove(bakePath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageBakeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImageBake,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("docker_image_bake.test", "images.#", "2"),
+					resource.TestCheckResourceAttr("docker_image_bake.test", "images.0.name", "tftest-bake-app:1.0"),
+					resource.TestCheckResourceAttr("docker_image_bake.test", "images.1.name", "tftest-bake-tools"),
+					resource.TestMatchResourceAttr("docker_image_bake.test", "images.0.image_id", contentDigestRegexp),
+					resource.TestMatchResourceAttr("docker_image_bake.test", "build_output", regexp.MustCompile(`Building target tools`)),
+				),
+			},
+		},
+	})
+}
+
+func testAccDockerImageBakeDestroy(s *terraform.State) error {
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "docker_image_bake" {
+			continue
+		}
+
+		client := testAccProvider.Meta().(*ProviderConfig).DockerClient
+		for _, key := range []string{"images.0.image_id", "images.1.image_id"} {
+			if _, _, err := client.ImageInspectWithRaw(context.Background(), rs.Primary.Attributes[key]); err == nil {
+				return fmt.Errorf("Image %s still exists", rs.Primary.Attributes[key])
+			}
+		}
+	}
+	return nil
+}
+
+const testDockerFileBakeExample = `
+FROM alpine:3.11 AS app
+ARG mode
+RUN echo ${mode} > /mode.txt
+
+FROM app AS tools
+RUN echo tools > /tools.txt
+`
+
+const testDockerBakeFileExample = `
+variable "TAG" {
+  default = "1.0"
+}
+
+group "default" {
+  targets = ["app", "tools"]
+}
+
+target "base" {
+  dockerfile = "Dockerfile.bake"
+  args = {
+    mode = "test"
+  }
+}
+
+target "app" {
+  inherits = ["base"]
+  target   = "app"
+  tags     = ["tftest-bake-app:${TAG}"]
+}
+
+target "tools" {
+  inherits = ["base"]
+  target   = "tools"
+  tags     = ["tftest-bake-tools"]
+}
+`
+
+const testCreateDockerImageBake = `
+resource "docker_image_bake" "test" {
+  file = "docker-bake.hcl"
+}
+`
@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func resourceDockerImageCopy() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceDockerImageCopyCreate,
+		Read:   resourceDockerImageCopyRead,
+		Update: resourceDockerImageCopyUpdate,
+		Delete: resourceDockerImageCopyDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"source_image": {
+				Type:        schema.TypeString,
+				Description: "Name of the image to copy, with a tag or digest",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"destination_image": {
+				Type:         schema.TypeString,
+				Description:  "Name with a tag the image is copied to",
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateStringMatchesPattern(`^[^@]+$`),
+			},
+
+			"registry_auth": resourceRegistryAuthSchema,
+
+			"keep_remotely": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+
+			"sha256_digest": {
+				Type:        schema.TypeString,
+				Description: "Digest of the copied manifest",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceDockerImageCopyEndpoints(d *schema.ResourceData, meta interface{}) (registryEndpoint, string, registryEndpoint, error) {
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return registryEndpoint{}, "", registryEndpoint{}, err
+	}
+	sourceOpts, sourceReference := registryImageReference(d.Get("source_image").(string))
+	destinationOpts, _ := registryImageReference(d.Get("destination_image").(string))
+
+	source := registryEndpoint{opts: sourceOpts, transports: authConfigs.transports}
+	source.username, source.password, err = getDockerRegistryImageRegistryUserNameAndPassword(sourceOpts, authConfigs)
+	if err != nil {
+		return registryEndpoint{}, "", registryEndpoint{}, err
+	}
+	destination := registryEndpoint{opts: destinationOpts, transports: authConfigs.transports}
+	destination.username, destination.password, err = getDockerRegistryImageRegistryUserNameAndPassword(destinationOpts, authConfigs)
+	if err != nil {
+		return registryEndpoint{}, "", registryEndpoint{}, err
+	}
+	return source, sourceReference, destination, nil
+}
+
+func resourceDockerImageCopyCreate(d *schema.ResourceData, meta interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+	source, sourceReference, destination, err := resourceDockerImageCopyEndpoints(d, meta)
+	if err != nil {
+		return err
+	}
+
+	var digest string
+	err = meta.(*ProviderConfig).RegistryRetries.do(ctx, "copy of "+d.Get("source_image").(string), func() error {
+		var err error
+		digest, err = copyRegistryManifest(ctx, source, sourceReference, destination, destination.opts.Tag, meta.(*ProviderConfig).LayerCopies)
+		return err
+	})
+	if err != nil {
+		return classifyError(fmt.Errorf("Unable to copy image %s to %s: %s", d.Get("source_image"), d.Get("destination_image"), err), "source_image")
+	}
+
+	d.SetId(digest + d.Get("destination_image").(string))
+	d.Set("sha256_digest", digest)
+	return resourceDockerImageCopyRead(d, meta)
+}
+
+func resourceDockerImageCopyRead(d *schema.ResourceData, meta interface{}) error {
+	_, _, destination, err := resourceDockerImageCopyEndpoints(d, meta)
+	if err != nil {
+		return err
+	}
+
+	// the image is copied again if the tag is gone or points to another image
+	digest, err := getImageDigestWithFallback(destination.transports, destination.opts, destination.username, destination.password)
+	if err != nil || !strings.EqualFold(digest, d.Get("sha256_digest").(string)) {
+		log.Printf("[INFO] Copy %s of %s is gone or changed, removing from state: %v", d.Get("destination_image"), d.Get("source_image"), err)
+		d.SetId("")
+		return nil
+	}
+	return nil
+}
+
+func resourceDockerImageCopyUpdate(d *schema.ResourceData, meta interface{}) error {
+	// only keep_remotely and registry_auth can be updated
+	return resourceDockerImageCopyRead(d, meta)
+}
+
+func resourceDockerImageCopyDelete(d *schema.ResourceData, meta interface{}) error {
+	if d.Get("keep_remotely").(bool) {
+		return nil
+	}
+	_, _, destination, err := resourceDockerImageCopyEndpoints(d, meta)
+	if err != nil {
+		return err
+	}
+	if err := deleteDockerRegistryImage(destination.transports, destination.opts, d.Get("sha256_digest").(string), destination.username, destination.password, false); err != nil {
+		return fmt.Errorf("Unable to delete image %s: %s", d.Get("destination_image"), err)
+	}
+	return nil
+}
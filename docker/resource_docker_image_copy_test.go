@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+)
+
+func TestAccDockerImageCopy_basic(t *testing.T) {
+	destination := createPushImageOptions("127.0.0.1:15000/tftest-service:copy")
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testDockerRegistryImageNotInRegistry(destination),
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccDockerImageCopyConfig, destination.Registry, "127.0.0.1:15000/tftest-service:v1", destination.Name),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image_copy.foo", "sha256_digest", registryDigestRegexp),
+					testDockerRegistryImageInRegistry(destination, false),
+				),
+			},
+		},
+	})
+}
+
+const testAccDockerImageCopyConfig = `
+provider "docker" {
+	alias = "private"
+	registry_auth {
+		address = "%s"
+	}
+}
+resource "docker_image_copy" "foo" {
+	provider = "docker.private"
+	source_image = "%s"
+	destination_image = "%s"
+}
+`
@@ -2,17 +2,25 @@ package docker
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
 
-	"github.com/docker/cli/cli/command/image/build"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/jsonmessage"
@@ -20,23 +28,52 @@ import (
 	homedir "github.com/mitchellh/go-homedir"
 )
 
-var (
-	pullOutput string
-	pushOutput string
-)
-
-func getBuildContext(filePath string, excludes []string) io.Reader {
+func getBuildContext(filePath string, excludes []string) (io.ReadCloser, error) {
 	filePath, _ = homedir.Expand(filePath)
-	ctx, _ := archive.TarWithOptions(filePath, &archive.TarOptions{
+	return archive.TarWithOptions(filePath, &archive.TarOptions{
 		ExcludePatterns: excludes,
 	})
-	return ctx
 }
 
-func decodeBuildMessages(response types.ImageBuildResponse) (string, error) {
+// openLocalBuildContext checks the context directory and returns the stream
+// of the context which is uploaded to the daemon
+func openLocalBuildContext(contextDir, dockerfile, dockerfileContents string, extraExcludes []string, contextSizeWarningThreshold int64) (io.ReadCloser, error) {
+	excludes, err := buildContextExcludes(contextDir, dockerfile, extraExcludes)
+	if err != nil {
+		return nil, err
+	}
+
+	// the context is checked upfront, as the tar stream skips failing files silently
+	contextSize, err := inspectBuildContext(contextDir, excludes)
+	if err != nil {
+		return nil, err
+	}
+	warnOnLargeBuildContext(contextDir, contextSize, contextSizeWarningThreshold)
+
+	buildContext, err := getBuildContext(contextDir, excludes)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read build context: %s", err)
+	}
+	if dockerfileContents != "" {
+		buildContext = addDockerfileToBuildContext(buildContext, dockerfileContents)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{newProgressReader(buildContext, contextDir, contextSize), buildContext}, nil
+}
+
+// decodeBuildMessages renders the messages of a build and returns the output.
+// The output is also logged line by line as it arrives, so the progress of
+// long builds is visible in the terraform log.
+func decodeBuildMessages(response types.ImageBuildResponse, imageName, progressMode string) (string, error) {
 	buf := new(bytes.Buffer)
 	buildErr := error(nil)
+	progress := newBuildLogWriter(imageName)
+	defer progress.Flush()
+	out := io.MultiWriter(buf, progress)
 
+	buildkit := newBuildkitProgress(progressMode)
 	dec := json.NewDecoder(response.Body)
 	for dec.More() {
 		var m jsonmessage.JSONMessage
@@ -45,87 +82,327 @@ func decodeBuildMessages(response types.ImageBuildResponse) (string, error) {
 			return buf.String(), fmt.Errorf("Problem decoding message from docker daemon: %s", err)
 		}
 
-		m.Display(buf, false)
+		if m.ID == buildkitTraceID && m.Aux != nil {
+			traceBuf := new(bytes.Buffer)
+			if err := buildkit.write(traceBuf, *m.Aux); err != nil {
+				return buf.String(), err
+			}
+			// the log always gets the plain progress
+			if buildkit.plain() {
+				out.Write(traceBuf.Bytes())
+			} else {
+				progress.Write(traceBuf.Bytes())
+			}
+			continue
+		}
+		// aux messages like the id of the built image carry no output
+		if m.Aux != nil {
+			continue
+		}
+		m.Display(out, false)
 
 		if m.Error != nil {
 			buildErr = fmt.Errorf("Unable to build image")
 		}
 	}
-	log.Printf("[DEBUG] build: %s", buf.String())
+	buildkit.render(buf)
 
 	return buf.String(), buildErr
 }
 
-func decodePushPullMessages(responseBody io.Reader) (string, error) {
+// buildLogWriter logs the complete lines written to it
+type buildLogWriter struct {
+	imageName string
+	line      []byte
+}
+
+func newBuildLogWriter(imageName string) *buildLogWriter {
+	return &buildLogWriter{imageName: imageName}
+}
+
+func (w *buildLogWriter) Write(p []byte) (int, error) {
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.log(w.line[:i])
+		w.line = w.line[i+1:]
+	}
+}
+
+// Flush logs the last line even if it is incomplete
+func (w *buildLogWriter) Flush() {
+	if len(w.line) > 0 {
+		w.log(w.line)
+		w.line = nil
+	}
+}
+
+func (w *buildLogWriter) log(line []byte) {
+	if line := strings.TrimRight(string(line), "\r"); strings.TrimSpace(line) != "" {
+		log.Printf("[INFO] Building %s: %s", w.imageName, line)
+	}
+}
+
+// pushPullSummary is a bounded summary of the messages the daemon streams
+// back while pulling or pushing an image.
+type pushPullSummary struct {
+	Digest  string
+	Layers  int
+	Bytes   int64
+	Skipped bool
+}
+
+func (s *pushPullSummary) flatten() []interface{} {
+	if s == nil {
+		return []interface{}{}
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"digest":  s.Digest,
+			"layers":  s.Layers,
+			"bytes":   int(s.Bytes),
+			"skipped": s.Skipped,
+		},
+	}
+}
+
+func decodePushPullMessages(responseBody io.Reader) (*pushPullSummary, error) {
 	buf := new(bytes.Buffer)
-	buildErr := error(nil)
+	summary := &pushPullSummary{}
+	layerBytes := make(map[string]int64)
+	transferred := false
+	pushPullErr := error(nil)
 
 	dec := json.NewDecoder(responseBody)
 	for dec.More() {
 		var m jsonmessage.JSONMessage
 		err := dec.Decode(&m)
 		if err != nil {
-			return buf.String(), fmt.Errorf("Problem decoding message from docker daemon: %s", err)
+			return summary, fmt.Errorf("Problem decoding message from docker daemon: %s", err)
 		}
 
 		m.Display(buf, false)
 
 		if m.Error != nil {
-			buildErr = fmt.Errorf("Unable to build image")
+			pushPullErr = fmt.Errorf("%s", m.Error.Message)
+			continue
+		}
+
+		if m.Aux != nil {
+			var pushResult types.PushResult
+			if err := json.Unmarshal(*m.Aux, &pushResult); err == nil && pushResult.Digest != "" {
+				summary.Digest = pushResult.Digest
+			}
+		}
+
+		if strings.HasPrefix(m.Status, "Digest: ") {
+			summary.Digest = strings.TrimPrefix(m.Status, "Digest: ")
+		}
+
+		status := m.Status
+		if strings.HasPrefix(status, "Mounted from") {
+			status = "Mounted from"
+		}
+
+		switch status {
+		case "Pulling fs layer", "Already exists", "Preparing", "Layer already exists", "Mounted from":
+			if _, ok := layerBytes[m.ID]; !ok {
+				layerBytes[m.ID] = 0
+			}
+		case "Downloading", "Pushing":
+			if m.Progress != nil && m.Progress.Total > layerBytes[m.ID] {
+				layerBytes[m.ID] = m.Progress.Total
+			}
+			transferred = true
+		case "Pull complete", "Pushed":
+			transferred = true
 		}
 	}
 	log.Printf("[DEBUG] push-pull: %s", buf.String())
 
-	return buf.String(), buildErr
+	summary.Layers = len(layerBytes)
+	for _, b := range layerBytes {
+		summary.Bytes += b
+	}
+	summary.Skipped = !transferred
+
+	return summary, pushPullErr
 }
 
 func resourceDockerImageCreate(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
 	imageName := d.Get("name").(string)
+	ctx, cancel := context.WithTimeout(context.Background(), resourceTimeout(d, meta, schema.TimeoutCreate, "build", "pull", "push"))
+	defer cancel()
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return err
+	}
+	timings := meta.(*ProviderConfig).TimingReport.timingsFor("docker_image", imageName)
+	// the image of the name before the apply, e.g. kept by keep_locally, is
+	// retained as a release if it is superseded
+	previousImageID := ""
+	if d.Get("keep_old_releases").(int) > 0 {
+		var data Data
+		if err := fetchLocalImages(ctx, &data, client); err != nil {
+			return err
+		}
+		if previousImage := searchLocalImages(data, imageName); previousImage != nil {
+			previousImageID = previousImage.ID
+		}
+	}
 
 	if value, ok := d.GetOk("build"); ok {
-		doBuild := d.Get("force_build").(bool)
+		for _, rawBuild := range value.(*schema.Set).List() {
+			contextHash, dockerfileHash, err := getDockerImageBuildHashes(rawBuild.(map[string]interface{}))
+			if err != nil {
+				log.Printf("[DEBUG] Unable to hash the build context of %s: %s", imageName, err)
+				continue
+			}
+			d.Set("build_context_hash", contextHash)
+			d.Set("dockerfile_hash", dockerfileHash)
+		}
+		doBuild := d.Get("force_build").(bool) || buildInputsChanged(d.Get("rebuild_reason").(string))
 
 		if !doBuild {
-			_, err := findImage(imageName, client, meta.(*ProviderConfig).AuthConfigs)
+			pullCtx, cancelPull := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "pull")
+			defer cancelPull()
+			_, err := findImage(pullCtx, imageName, client, authConfigs, providerPullOptions(meta), d.Get("platform").(string))
 			if err != nil {
 				doBuild = true
 				log.Printf("[DEBUG] Error pulling image [%s]: %v", imageName, err)
 			}
 		}
 		if doBuild {
+			for _, rawBuild := range value.(*schema.Set).List() {
+				if rawBuild.(map[string]interface{})["builder_version"].(string) == string(types.BuilderBuildKit) {
+					if err := requireDockerEngine(meta, "BuildKit, builder_version 2,"); err != nil {
+						return classifyError(err, "build")
+					}
+				}
+			}
+			buildStart := time.Now()
+			buildCtx, cancelBuild := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "build")
+			defer cancelBuild()
 			for _, rawBuild := range value.(*schema.Set).List() {
 				rawBuild := rawBuild.(map[string]interface{})
+				if err := providerPullOptions(meta).checkBuild(rawBuild); err != nil {
+					return classifyError(err, "build")
+				}
 
-				buildOutput, err := buildDockerImage(rawBuild, imageName, client)
+				builder, err := buildxBuilderFromList(rawBuild["builder"].([]interface{}))
+				if err != nil {
+					return classifyError(err, "build")
+				}
+				var buildOutput string
+				if builder != nil {
+					buildOutput, err = builder.build(buildCtx, withDefaultBuildLabels(meta, rawBuild, "label"), imageName, client, meta.(*ProviderConfig).Operations)
+				} else {
+					buildOutput, err = buildDockerImagePlatforms(buildCtx, withDefaultBuildLabels(meta, rawBuild, "label"), imageName, client, meta.(*ProviderConfig).Operations, meta.(*ProviderConfig).ContextSizeWarningThreshold)
+				}
 
 				d.Set("build_output", buildOutput)
 
 				if err != nil {
-					return fmt.Errorf("%s\n\n%s", err, buildOutput)
+					return classifyError(fmt.Errorf("%s\n\n%s", err, buildOutput), "build")
 				}
 			}
+			timings.record("build", buildStart)
+		}
+	}
+	loadPath := d.Get("load_path").(string)
+	if loadPath != "" {
+		loadStart := time.Now()
+		if err := loadImageFile(ctx, client, loadPath); err != nil {
+			return classifyError(err, "load_path")
+		}
+		var data Data
+		if err := fetchLocalImages(ctx, &data, client); err != nil {
+			return err
+		}
+		if searchLocalImages(data, imageName) == nil {
+			return fmt.Errorf("Image %s is not in the archive %s", imageName, loadPath)
+		}
+		timings.record("load", loadStart)
+	}
+	if rawImports := d.Get("import").([]interface{}); len(rawImports) > 0 && rawImports[0] != nil {
+		importStart := time.Now()
+		if err := importImage(ctx, client, rawImports[0].(map[string]interface{}), imageName); err != nil {
+			return classifyError(err, "import")
+		}
+		timings.record("import", importStart)
+	}
+
+	pullStart := time.Now()
+	pullCtx, cancelPull := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "pull")
+	defer cancelPull()
+	var forcedPullSummary *pushPullSummary
+	_, isImport := d.GetOk("import")
+	if _, ok := d.GetOk("build"); !ok && loadPath == "" && !isImport && hasPullTriggers(d) {
+		// a change of the triggers replaces the resource, so the image is
+		// pulled even if the tag is present locally, e.g. kept by keep_locally
+		forcedPullSummary, err = pullImage(pullCtx, &Data{}, client, authConfigs, providerPullOptions(meta), imageName, d.Get("platform").(string))
+		if err != nil {
+			return classifyError(fmt.Errorf("Unable to pull image %s: %s", imageName, err), "name")
 		}
 	}
-	apiImage, err := findImage(imageName, client, meta.(*ProviderConfig).AuthConfigs)
+	apiImage, pullSummary, err := findOrPullImage(pullCtx, imageName, client, authConfigs, providerPullOptions(meta), d.Get("platform").(string))
 	if err != nil {
-		return fmt.Errorf("Unable to read Docker image into resource: %s", err)
+		return classifyError(fmt.Errorf("Unable to read Docker image into resource: %s", err), "name")
+	}
+	if forcedPullSummary != nil {
+		pullSummary = forcedPullSummary
+	}
+	if !pullSummary.Skipped {
+		timings.record("pull", pullStart)
 	}
 
 	d.SetId(apiImage.ID + d.Get("name").(string))
+	d.Set("pull_output", pullSummary.flatten())
+	if err := retainReleases(ctx, d, client, previousImageID, apiImage.ID); err != nil {
+		return err
+	}
+
+	scanStart := time.Now()
+	if err := scanDockerImage(ctx, d, imageName); err != nil {
+		return err
+	}
+	if _, ok := d.GetOk("scan"); ok {
+		timings.record("scan", scanStart)
+	}
 
-	if pushRemote := d.Get("push_remote").(bool); pushRemote {
-		if err := pushImage(client, meta.(*ProviderConfig).AuthConfigs, imageName); err != nil {
-			return fmt.Errorf("Unable to push image [%s]: %s", imageName, err)
+	if pushRemote, pushTargets := d.Get("push_remote").(bool), d.Get("push_targets").([]interface{}); pushRemote || len(pushTargets) > 0 {
+		pushStart := time.Now()
+		pushCtx, cancelPush := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "push")
+		defer cancelPush()
+		if pushRemote {
+			if err := pushDockerImage(pushCtx, d, client, authConfigs, meta.(*ProviderConfig).RegistryRetries, meta.(*ProviderConfig).Operations, imageName); err != nil {
+				return err
+			}
+		}
+		if err := pushDockerImageTargets(pushCtx, d, client, authConfigs, meta.(*ProviderConfig).RegistryRetries, meta.(*ProviderConfig).Operations, imageName); err != nil {
+			return err
 		}
+		timings.record("push", pushStart)
 	}
+	if savePath := d.Get("save_path").(string); savePath != "" {
+		if err := saveImageFile(ctx, client, imageName, savePath); err != nil {
+			return classifyError(err, "save_path")
+		}
+	}
+	d.Set("timings", timings.flatten())
+	// the reason is only relevant for the plan
+	d.Set("rebuild_reason", "")
 	return resourceDockerImageRead(d, meta)
 }
 
 func resourceDockerImageRead(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
 	var data Data
-	if err := fetchLocalImages(&data, client); err != nil {
+	if err := fetchLocalImages(context.Background(), &data, client); err != nil {
 		return fmt.Errorf("Error reading docker image list: %s", err)
 	}
 	for id := range data.DockerImages {
@@ -134,21 +411,60 @@ func resourceDockerImageRead(d *schema.ResourceData, meta interface{}) error {
 	foundImage := searchLocalImages(data, d.Get("name").(string))
 
 	if foundImage == nil {
+		if d.Get("build").(*schema.Set).Len() > 0 {
+			// the plan builds the missing image again and shows why
+			log.Printf("[INFO] Built image %s is missing", d.Get("name").(string))
+			d.Set("latest", "")
+			d.Set("image_id", "")
+			d.Set("rebuild_reason", "")
+			return nil
+		}
 		d.SetId("")
 		return nil
 	}
 
 	d.SetId(foundImage.ID + d.Get("name").(string))
 	d.Set("latest", foundImage.ID)
+	d.Set("image_id", foundImage.ID)
+	d.Set("repo_digest", imageRepoDigest(d, foundImage.RepoDigests))
+	releases := []string{}
+	if d.Get("keep_old_releases").(int) > 0 {
+		var err error
+		if releases, err = listReleases(context.Background(), client, d.Get("name").(string)); err != nil {
+			return err
+		}
+	}
+	d.Set("retained_releases", releases)
+
+	image, _, err := client.ImageInspectWithRaw(context.Background(), foundImage.ID)
+	if err != nil {
+		return fmt.Errorf("Unable to inspect image %s: %s", d.Get("name").(string), err)
+	}
+	return setImageConfig(d, image.Config)
+}
 
-	if pullOutput != "" {
-		d.Set("pull_output", pullOutput)
+// setImageConfig sets the attributes of the config of the image, so other
+// resources can reference e.g. its labels or ports
+func setImageConfig(d *schema.ResourceData, config *container.Config) error {
+	if config == nil {
+		config = &container.Config{}
 	}
-	if pushOutput != "" {
-		d.Set("push_output", pushOutput)
+	exposedPorts := make([]string, 0, len(config.ExposedPorts))
+	for port := range config.ExposedPorts {
+		exposedPorts = append(exposedPorts, string(port))
 	}
+	sort.Strings(exposedPorts)
 
-	return nil
+	if err := d.Set("labels", config.Labels); err != nil {
+		return err
+	}
+	if err := d.Set("entrypoint", []string(config.Entrypoint)); err != nil {
+		return err
+	}
+	if err := d.Set("exposed_ports", exposedPorts); err != nil {
+		return err
+	}
+	return d.Set("env", config.Env)
 }
 
 func resourceDockerImageUpdate(d *schema.ResourceData, meta interface{}) error {
@@ -156,31 +472,438 @@ func resourceDockerImageUpdate(d *schema.ResourceData, meta interface{}) error {
 	// the value of "latest" or others
 	client := meta.(*ProviderConfig).DockerClient
 	imageName := d.Get("name").(string)
-	apiImage, err := findImage(imageName, client, meta.(*ProviderConfig).AuthConfigs)
+	ctx, cancel := context.WithTimeout(context.Background(), resourceTimeout(d, meta, schema.TimeoutUpdate, "pull", "push"))
+	defer cancel()
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return err
+	}
+	timings := meta.(*ProviderConfig).TimingReport.timingsFor("docker_image", imageName)
+	pullStart := time.Now()
+	pullCtx, cancelPull := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "pull")
+	defer cancelPull()
+	apiImage, pullSummary, err := findOrPullImage(pullCtx, imageName, client, authConfigs, providerPullOptions(meta), d.Get("platform").(string))
 	if err != nil {
-		return fmt.Errorf("Unable to read Docker image into resource: %s", err)
+		return classifyError(fmt.Errorf("Unable to read Docker image into resource: %s", err), "name")
+	}
+	if !pullSummary.Skipped {
+		timings.record("pull", pullStart)
+	}
+	if err := retainReleases(ctx, d, client, d.Get("image_id").(string), apiImage.ID); err != nil {
+		return err
 	}
 
 	d.Set("latest", apiImage.ID)
-	if pushRemote := d.Get("push_remote").(bool); pushRemote {
-		if err := pushImage(client, meta.(*ProviderConfig).AuthConfigs, imageName); err != nil {
-			return fmt.Errorf("Unable to push image [%s]: %s", imageName, err)
+	d.Set("image_id", apiImage.ID)
+	if !pullSummary.Skipped {
+		d.Set("pull_output", pullSummary.flatten())
+	}
+	if pushRemote, pushTargets := d.Get("push_remote").(bool), d.Get("push_targets").([]interface{}); pushRemote || len(pushTargets) > 0 {
+		scanStart := time.Now()
+		if err := scanDockerImage(ctx, d, imageName); err != nil {
+			return err
+		}
+		if _, ok := d.GetOk("scan"); ok {
+			timings.record("scan", scanStart)
+		}
+
+		pushStart := time.Now()
+		pushCtx, cancelPush := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "push")
+		defer cancelPush()
+		if pushRemote {
+			if err := pushDockerImage(pushCtx, d, client, authConfigs, meta.(*ProviderConfig).RegistryRetries, meta.(*ProviderConfig).Operations, imageName); err != nil {
+				return err
+			}
+		}
+		if err := pushDockerImageTargets(pushCtx, d, client, authConfigs, meta.(*ProviderConfig).RegistryRetries, meta.(*ProviderConfig).Operations, imageName); err != nil {
+			return err
+		}
+		timings.record("push", pushStart)
+	}
+	if savePath := d.Get("save_path").(string); savePath != "" && (d.HasChange("save_path") || !pullSummary.Skipped) {
+		if err := saveImageFile(ctx, client, imageName, savePath); err != nil {
+			return classifyError(err, "save_path")
 		}
 	}
+	d.Set("timings", timings.flatten())
 
 	return resourceDockerImageRead(d, meta)
 }
 
+// hasPullTriggers reports whether any of the triggers, pull_triggers or
+// pull_trigger of the image are set
+func hasPullTriggers(d *schema.ResourceData) bool {
+	if len(d.Get("triggers").(map[string]interface{})) > 0 {
+		return true
+	}
+	if d.Get("pull_triggers").(*schema.Set).Len() > 0 {
+		return true
+	}
+	return d.Get("pull_trigger").(string) != ""
+}
+
+// pushDockerImage pushes the image, or the images of all platforms of a
+// multi-platform build combined into a manifest list, and signs it
+func pushDockerImage(ctx context.Context, d *schema.ResourceData, client *client.Client, authConfigs *AuthConfigs, retries registryRetries, operations *operationLimit, imageName string) error {
+	summary, platformDigests, err := pushDockerImagePlatforms(ctx, d, client, authConfigs, retries, operations, imageName)
+	if err != nil {
+		return err
+	}
+	d.Set("push_output", summary.flatten())
+	if platformDigests != nil {
+		d.Set("platform_digests", platformDigests)
+	}
+	return signDockerImage(d, authConfigs, imageName, summary.Digest)
+}
+
+// pushDockerImageTargets tags the image with each of the push targets and
+// pushes them. The registry auth is resolved for each target.
+func pushDockerImageTargets(ctx context.Context, d *schema.ResourceData, client *client.Client, authConfigs *AuthConfigs, retries registryRetries, operations *operationLimit, imageName string) error {
+	targets := stringListToStringSlice(d.Get("push_targets").([]interface{}))
+	if len(targets) == 0 {
+		return nil
+	}
+	digests := make(map[string]interface{}, len(targets))
+	for _, target := range targets {
+		if err := client.ImageTag(ctx, imageName, target); err != nil {
+			return fmt.Errorf("Unable to tag image %s as %s: %s", imageName, target, err)
+		}
+		for _, platform := range imageBuildPlatforms(d) {
+			if err := client.ImageTag(ctx, platformImageName(imageName, platform), platformImageName(target, platform)); err != nil {
+				return fmt.Errorf("Unable to tag image %s as %s: %s", platformImageName(imageName, platform), platformImageName(target, platform), err)
+			}
+		}
+		summary, _, err := pushDockerImagePlatforms(ctx, d, client, authConfigs, retries, operations, target)
+		if err != nil {
+			return err
+		}
+		digests[target] = summary.Digest
+	}
+	d.Set("push_target_digests", digests)
+	return nil
+}
+
+// pushDockerImagePlatforms pushes the image, or the images of all platforms
+// and their manifest list, and returns the summary and the digests of the
+// platforms
+func pushDockerImagePlatforms(ctx context.Context, d *schema.ResourceData, client *client.Client, authConfigs *AuthConfigs, retries registryRetries, operations *operationLimit, imageName string) (*pushPullSummary, map[string]interface{}, error) {
+	platforms := imageBuildPlatforms(d)
+	if len(platforms) == 0 {
+		pushSummary, err := pushImage(ctx, client, authConfigs, retries, operations, imageName)
+		if err != nil {
+			return nil, nil, classifyError(fmt.Errorf("Unable to push image [%s]: %s", imageName, err), "name")
+		}
+		if err := verifyPushedImage(d, authConfigs, imageName, pushSummary.Digest); err != nil {
+			return nil, nil, err
+		}
+		return pushSummary, nil, nil
+	}
+
+	list := manifestList{}
+	platformDigests := make(map[string]interface{}, len(platforms))
+	summary := &pushPullSummary{}
+	for _, platform := range platforms {
+		platformImage := platformImageName(imageName, platform)
+		pushSummary, err := pushImage(ctx, client, authConfigs, retries, operations, platformImage)
+		if err != nil {
+			return nil, nil, classifyError(fmt.Errorf("Unable to push image [%s]: %s", platformImage, err), "name")
+		}
+		if err := verifyPushedImage(d, authConfigs, platformImage, pushSummary.Digest); err != nil {
+			return nil, nil, err
+		}
+		summary.Layers += pushSummary.Layers
+		summary.Bytes += pushSummary.Bytes
+
+		pushOpts := createPushImageOptions(platformImage)
+		username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+		if err != nil {
+			return nil, nil, err
+		}
+		descriptor, err := getManifestDescriptor(authConfigs.transports, pushOpts, username, password)
+		if err != nil {
+			return nil, nil, classifyError(err, "name")
+		}
+		descriptor.Platform = parsePlatform(platform)
+		list.Manifests = append(list.Manifests, *descriptor)
+		platformDigests[platform] = descriptor.Digest
+	}
+
+	pushOpts := createPushImageOptions(imageName)
+	username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest, err := putManifestList(authConfigs.transports, pushOpts, username, password, list)
+	if err != nil {
+		return nil, nil, classifyError(err, "name")
+	}
+	if err := verifyPushedImage(d, authConfigs, imageName, digest); err != nil {
+		return nil, nil, err
+	}
+	summary.Digest = digest
+	return summary, platformDigests, nil
+}
+
+// imageBuildPlatforms returns the platforms of a multi-platform build
+func imageBuildPlatforms(d *schema.ResourceData) []string {
+	for _, rawBuild := range d.Get("build").(*schema.Set).List() {
+		return stringListToStringSlice(rawBuild.(map[string]interface{})["platforms"].([]interface{}))
+	}
+	return nil
+}
+
+// verifyPushedImage waits for the pushed image to be available in the registry
+func verifyPushedImage(d *schema.ResourceData, authConfigs *AuthConfigs, imageName, digest string) error {
+	verificationTimeout, _ := time.ParseDuration(d.Get("push_verification_timeout").(string))
+	if verificationTimeout <= 0 {
+		return nil
+	}
+	pushOpts := createPushImageOptions(imageName)
+	username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+	if err != nil {
+		return err
+	}
+	if _, err := waitForImageDigest(authConfigs.transports, pushOpts, username, password, digest, verificationTimeout); err != nil {
+		return classifyError(err, "push_verification_timeout")
+	}
+	return nil
+}
+
+const (
+	rebuildReasonForceBuild        = "force_build is set"
+	rebuildReasonImageMissing      = "image missing"
+	rebuildReasonContextChanged    = "context changed"
+	rebuildReasonDockerfileChanged = "Dockerfile changed"
+	rebuildReasonTriggersChanged   = "triggers changed"
+)
+
+// resourceDockerImageCustomizeDiff hashes the build context and the Dockerfile
+// if the build block changed, so the plan shows whether the image will be
+// built and why
+func resourceDockerImageCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	if err := detectImageDigestDrift(d, meta); err != nil {
+		return err
+	}
+	rawBuilds := d.Get("build").(*schema.Set).List()
+	if len(rawBuilds) == 0 {
+		return nil
+	}
+	rawBuild := rawBuilds[0].(map[string]interface{})
+
+	if d.Id() == "" {
+		// the create records the hashes. The SDK computes the diff of a
+		// replacement a second time without the state, leaving the hashes
+		// and the reason out of it keeps the ones of the diff against the
+		// state
+		for _, key := range []string{"build_context_hash", "dockerfile_hash"} {
+			if err := d.Clear(key); err != nil {
+				return err
+			}
+		}
+		if !d.Get("force_build").(bool) {
+			return d.Clear("rebuild_reason")
+		}
+		log.Printf("[INFO] Image %s will be built: %s", d.Get("name").(string), rebuildReasonForceBuild)
+		return d.SetNew("rebuild_reason", rebuildReasonForceBuild)
+	}
+
+	reasons := []string{}
+	// the read keeps a built image which is missing in the daemon with an
+	// empty ID
+	imageMissing := d.Get("image_id").(string) == "" && d.Get("latest").(string) == ""
+	if imageMissing {
+		reasons = append(reasons, rebuildReasonImageMissing)
+	}
+	if d.HasChange("triggers") {
+		reasons = append(reasons, rebuildReasonTriggersChanged)
+	}
+
+	forceNewKeys := []string{}
+	if d.HasChange("build") || d.HasChange("triggers") {
+		contextHash, dockerfileHash, err := getDockerImageBuildHashes(rawBuild)
+		if err != nil {
+			// the build itself reports a missing context during the apply
+			log.Printf("[DEBUG] Unable to hash the build context of %s: %s", d.Get("name").(string), err)
+		} else {
+			// states of earlier versions have no hashes or hashes of another
+			// format, these are only recorded
+			if old, _ := d.GetChange("build_context_hash"); strings.HasPrefix(old.(string), buildContextHashPrefix) && old.(string) != contextHash {
+				reasons = append(reasons, rebuildReasonContextChanged)
+				forceNewKeys = append(forceNewKeys, "build_context_hash")
+			}
+			if old, _ := d.GetChange("dockerfile_hash"); old.(string) != "" && old.(string) != dockerfileHash {
+				reasons = append(reasons, rebuildReasonDockerfileChanged)
+				forceNewKeys = append(forceNewKeys, "dockerfile_hash")
+			}
+			if err := d.SetNew("build_context_hash", contextHash); err != nil {
+				return err
+			}
+			if err := d.SetNew("dockerfile_hash", dockerfileHash); err != nil {
+				return err
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	log.Printf("[INFO] Image %s will be built: %s", d.Get("name").(string), strings.Join(reasons, ", "))
+	if err := d.SetNew("rebuild_reason", strings.Join(reasons, ", ")); err != nil {
+		return err
+	}
+	if imageMissing {
+		for _, key := range []string{"image_id", "latest"} {
+			if err := d.SetNewComputed(key); err != nil {
+				return err
+			}
+		}
+		forceNewKeys = append(forceNewKeys, "rebuild_reason")
+	}
+	for _, key := range forceNewKeys {
+		if err := d.ForceNew(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detectImageDigestDrift replaces a pulled image if its tag points to another
+// digest in the registry than the pulled one. It is gated by the
+// detect_digest_drift feature of the provider, as it queries the registry on
+// every plan.
+func detectImageDigestDrift(d *schema.ResourceDiff, meta interface{}) error {
+	providerConfig, ok := meta.(*ProviderConfig)
+	if !ok || !providerConfig.Features.Image.DetectDigestDrift || providerConfig.DisableRemotePull || d.Id() == "" {
+		return nil
+	}
+	if d.Get("build").(*schema.Set).Len() > 0 || d.Get("load_path").(string) != "" || len(d.Get("import").([]interface{})) > 0 {
+		return nil
+	}
+	imageName := d.Get("name").(string)
+	repoDigest := d.Get("repo_digest").(string)
+	if repoDigest == "" || strings.Contains(imageName, "@") {
+		return nil
+	}
+
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return err
+	}
+	pullOpts := createPushImageOptions(imageName)
+	username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pullOpts, authConfigs)
+	if err != nil {
+		return err
+	}
+	digest, err := getImageDigestWithFallback(authConfigs.transports, pullOpts, username, password)
+	if err != nil {
+		// an unreachable registry must not block the plan
+		log.Printf("[WARN] Unable to check the digest of %s for drift: %s", imageName, err)
+		return nil
+	}
+	if strings.HasSuffix(repoDigest, "@"+digest) {
+		return nil
+	}
+
+	log.Printf("[INFO] Image %s points to %s in the registry instead of %s", imageName, digest, repoDigest)
+	if err := d.SetNew("repo_digest", familiarRepository(imageName)+"@"+digest); err != nil {
+		return err
+	}
+	return d.ForceNew("repo_digest")
+}
+
+// buildInputsChanged returns true if the rebuild reason requires a build
+// even if the image could be pulled
+func buildInputsChanged(rebuildReason string) bool {
+	return strings.Contains(rebuildReason, rebuildReasonContextChanged) ||
+		strings.Contains(rebuildReason, rebuildReasonDockerfileChanged) ||
+		strings.Contains(rebuildReason, rebuildReasonTriggersChanged)
+}
+
+// getDockerImageBuildHashes returns the hash of the build context, using the
+// same tar hash as docker_registry_image, and the hash of the Dockerfile
+func getDockerImageBuildHashes(rawBuild map[string]interface{}) (string, string, error) {
+	contextDir := rawBuild["path"].(string)
+	if isRemoteBuildContext(contextDir) {
+		// changes of a remote context are only detected if its URL changes
+		contextHash := sha256.Sum256([]byte(contextDir))
+		return hex.EncodeToString(contextHash[:]), "", nil
+	}
+	contextDir, _ = homedir.Expand(contextDir)
+	dockerfileName := rawBuild["dockerfile"].(string)
+	if rawBuild["dockerfile_contents"].(string) != "" {
+		dockerfileName = inlineDockerfileName
+	}
+	excludes, err := buildContextExcludes(contextDir, dockerfileName, stringListToStringSlice(rawBuild["excludes"].([]interface{})))
+	if err != nil {
+		return "", "", err
+	}
+	contextHash, err := hashBuildContext(contextDir, excludes)
+	if err != nil {
+		return "", "", err
+	}
+
+	dockerfile := []byte(rawBuild["dockerfile_contents"].(string))
+	if len(dockerfile) == 0 {
+		dockerfile, err = ioutil.ReadFile(filepath.Join(contextDir, rawBuild["dockerfile"].(string)))
+		if err != nil {
+			return "", "", err
+		}
+	}
+	dockerfileHash := sha256.Sum256(dockerfile)
+
+	return contextHash, hex.EncodeToString(dockerfileHash[:]), nil
+}
+
 func resourceDockerImageDelete(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
-	err := removeImage(d, client)
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+	err := removeImage(ctx, d, client)
 	if err != nil {
 		return fmt.Errorf("Unable to remove Docker image: %s", err)
 	}
+	if meta.(*ProviderConfig).Features.Image.DeleteRemoteTagsOnDestroy {
+		if err := deleteRemoteImageTags(d, meta); err != nil {
+			return err
+		}
+	}
 	d.SetId("")
 	return nil
 }
 
+// deleteRemoteImageTags deletes the images pushed by push_remote and
+// push_targets from their registries, like docker_registry_image does
+func deleteRemoteImageTags(d *schema.ResourceData, meta interface{}) error {
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return err
+	}
+	digests := map[string]string{}
+	if d.Get("push_remote").(bool) {
+		if repoDigest := d.Get("repo_digest").(string); strings.Contains(repoDigest, "@") {
+			digests[d.Get("name").(string)] = repoDigest[strings.LastIndex(repoDigest, "@")+1:]
+		}
+	}
+	for target, digest := range d.Get("push_target_digests").(map[string]interface{}) {
+		digests[target] = digest.(string)
+	}
+
+	for name, digest := range digests {
+		pushOpts := createPushImageOptions(name)
+		username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+		if err != nil {
+			return err
+		}
+		log.Printf("[INFO] Deleting pushed image %s from the registry", name)
+		if err := deleteDockerRegistryImage(authConfigs.transports, pushOpts, digest, username, password, false); err != nil {
+			if err := deleteDockerRegistryImage(authConfigs.transports, pushOpts, pushOpts.Tag, username, password, true); err != nil {
+				return fmt.Errorf("Unable to delete pushed image %s from the registry: %s", name, err)
+			}
+		}
+	}
+	return nil
+}
+
 func searchLocalImages(data Data, imageName string) *types.ImageSummary {
 	log.Print("[DEBUG] searching local images")
 
@@ -193,17 +916,66 @@ func searchLocalImages(data Data, imageName string) *types.ImageSummary {
 		imageName = imageName + ":latest"
 		return apiImage
 	}
+	// the Docker-compatible API of Podman reports fully qualified names
+	for _, qualifiedName := range qualifiedImageNames(imageName) {
+		if apiImage, ok := data.DockerImages[qualifiedName]; ok {
+			log.Printf("[DEBUG] found local image via qualified name: %v", qualifiedName)
+			return apiImage
+		}
+	}
 	return nil
 }
 
-func removeImage(d *schema.ResourceData, client *client.Client) error {
+// repoDigestForImage returns the entry of repoDigests which belongs to the
+// repository of imageName, or an empty string if there is none.
+func repoDigestForImage(imageName string, repoDigests []string) string {
+	repository := familiarRepository(imageName)
+	for _, repoDigest := range repoDigests {
+		if familiarRepository(repoDigest) == repository {
+			return repoDigest
+		}
+	}
+	return ""
+}
+
+// imageRepoDigest returns the repo digest of the image. The manifest list of
+// a multi-platform push is not known to the daemon, so its digest is taken
+// from the push.
+func imageRepoDigest(d *schema.ResourceData, repoDigests []string) string {
+	name := d.Get("name").(string)
+	if len(imageBuildPlatforms(d)) > 0 {
+		for _, rawOutput := range d.Get("push_output").([]interface{}) {
+			if digest := rawOutput.(map[string]interface{})["digest"].(string); digest != "" {
+				return familiarRepository(name) + "@" + digest
+			}
+		}
+	}
+	return repoDigestForImage(name, repoDigests)
+}
+
+// familiarRepository strips the tag or digest of an image reference and
+// shortens docker hub repositories the way the daemon reports them.
+func familiarRepository(image string) string {
+	if i := strings.Index(image, "@"); i != -1 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	for _, prefix := range []string{"docker.io/", "index.docker.io/", "registry-1.docker.io/"} {
+		image = strings.TrimPrefix(image, prefix)
+	}
+	return strings.TrimPrefix(image, "library/")
+}
+
+func removeImage(ctx context.Context, d *schema.ResourceData, client *client.Client) error {
 	var data Data
 
 	if keepLocally := d.Get("keep_locally").(bool); keepLocally {
 		return nil
 	}
 
-	if err := fetchLocalImages(&data, client); err != nil {
+	if err := fetchLocalImages(ctx, &data, client); err != nil {
 		return err
 	}
 
@@ -212,10 +984,41 @@ func removeImage(d *schema.ResourceData, client *client.Client) error {
 		return fmt.Errorf("Empty image name is not allowed")
 	}
 
+	// the images of a multi-platform build and the push targets carry
+	// additional names
+	for _, target := range append([]string{imageName}, stringListToStringSlice(d.Get("push_targets").([]interface{}))...) {
+		names := []string{}
+		if target != imageName {
+			names = append(names, target)
+		}
+		for _, platform := range imageBuildPlatforms(d) {
+			names = append(names, platformImageName(target, platform))
+		}
+		for _, name := range names {
+			if searchLocalImages(data, name) == nil {
+				continue
+			}
+			if _, err := client.ImageRemove(ctx, name, types.ImageRemoveOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+
 	foundImage := searchLocalImages(data, imageName)
 
+	if keep := d.Get("keep_old_releases").(int); keep > 0 && foundImage != nil && !strings.Contains(imageName, "@") {
+		// the image is kept by its release tag, so only the name is removed
+		if err := client.ImageTag(ctx, foundImage.ID, releaseTag(imageName, foundImage.ID)); err != nil {
+			return fmt.Errorf("Unable to retain image %s as a release: %s", imageName, err)
+		}
+		if _, err := client.ImageRemove(ctx, imageName, types.ImageRemoveOptions{}); err != nil {
+			return err
+		}
+		return pruneReleases(ctx, client, imageName, keep)
+	}
+
 	if foundImage != nil {
-		imageDeleteResponseItems, err := client.ImageRemove(context.Background(), foundImage.ID, types.ImageRemoveOptions{})
+		imageDeleteResponseItems, err := client.ImageRemove(ctx, foundImage.ID, types.ImageRemoveOptions{})
 		if err != nil {
 			return err
 		}
@@ -225,9 +1028,9 @@ func removeImage(d *schema.ResourceData, client *client.Client) error {
 	return nil
 }
 
-func fetchLocalImages(data *Data, client *client.Client) error {
+func fetchLocalImages(ctx context.Context, data *Data, client *client.Client) error {
 	log.Print("[DEBUG] fetching local images")
-	images, err := client.ImageList(context.Background(), types.ImageListOptions{All: false})
+	images, err := client.ImageList(ctx, types.ImageListOptions{All: false})
 	if err != nil {
 		return fmt.Errorf("Unable to list Docker images: %s", err)
 	}
@@ -253,46 +1056,140 @@ func fetchLocalImages(data *Data, client *client.Client) error {
 	return nil
 }
 
-func pullImage(data *Data, client *client.Client, authConfig *AuthConfigs, image string) error {
-	log.Printf("[DEBUG] pulling image: %s", image)
+// pullOptions are the options of the provider for the pulls of images
+type pullOptions struct {
+	retries    registryRetries
+	operations *operationLimit
+	mirrors    []string
+	// disabled fails the pulls on air-gapped hosts, which only run the
+	// images loaded into the daemon beforehand
+	disabled bool
+}
 
-	pullOpts := parseImageOptions(image)
+func providerPullOptions(meta interface{}) pullOptions {
+	return pullOptions{
+		retries:    meta.(*ProviderConfig).RegistryRetries,
+		operations: meta.(*ProviderConfig).Operations,
+		mirrors:    meta.(*ProviderConfig).RegistryMirrors,
+		disabled:   meta.(*ProviderConfig).DisableRemotePull,
+	}
+}
 
-	log.Printf("[DEBUG] Registry: %s", pullOpts.Registry)
-	// If a registry was specified in the image name, try to find auth for it
-	auth := types.AuthConfig{}
-	if pullOpts.Registry != "" {
-		if authConfig, ok := authConfig.Configs[normalizeRegistryAddress(pullOpts.Registry)]; ok {
-			auth = authConfig
+// checkBuild rejects a build which refreshes its base images, the daemon
+// would pull them despite disable_remote_pull
+func (o pullOptions) checkBuild(rawBuild map[string]interface{}) error {
+	if pullParent, ok := rawBuild["pull_parent"].(bool); o.disabled && ok && pullParent {
+		return fmt.Errorf("pull_parent cannot be used with disable_remote_pull of the provider")
+	}
+	return nil
+}
+
+// pullImage pulls the image for the platform. Docker Hub images are pulled
+// from the first mirror serving them, falling back to Docker Hub.
+func pullImage(ctx context.Context, data *Data, client *client.Client, authConfig *AuthConfigs, options pullOptions, image, platform string) (*pushPullSummary, error) {
+	if options.disabled {
+		return nil, fmt.Errorf("the provider is configured with disable_remote_pull, load the image into the daemon beforehand, e.g. with docker load or the load_path of a docker_image")
+	}
+	retries := options.retries
+	for _, mirror := range options.mirrors {
+		mirrorImage, ok := mirrorImageName(mirror, image)
+		if !ok {
+			break
 		}
-	} else {
-		// Try to find an auth config for the public docker hub if a registry wasn't given
-		if authConfig, ok := authConfig.Configs["https://registry.hub.docker.com"]; ok {
-			auth = authConfig
+		pullSummary, err := pullImageFromRegistry(ctx, client, authConfig, retries, options.operations, mirrorImage, platform)
+		if err != nil {
+			log.Printf("[WARN] Unable to pull image %s from mirror %s, trying the next one: %s", image, mirror, err)
+			continue
+		}
+		// the image is tagged with its name only, like a pull of the daemon
+		// from its registry-mirrors
+		if err := client.ImageTag(ctx, mirrorImage, image); err != nil {
+			return nil, fmt.Errorf("Unable to tag image %s pulled from mirror %s: %s", image, mirror, err)
 		}
+		if _, err := client.ImageRemove(ctx, mirrorImage, types.ImageRemoveOptions{}); err != nil {
+			return nil, fmt.Errorf("Unable to untag image %s pulled from mirror %s: %s", image, mirror, err)
+		}
+		return pullSummary, nil
 	}
+	return pullImageFromRegistry(ctx, client, authConfig, retries, options.operations, image, platform)
+}
 
-	encodedJSON, err := json.Marshal(auth)
-	if err != nil {
-		return fmt.Errorf("error creating auth config: %s", err)
+// mirrorImageName is the name of the Docker Hub image in the mirror, e.g.
+// mirror.example.com/library/alpine:latest for alpine. Images of other
+// registries and digest references are not mirrored.
+func mirrorImageName(mirror, image string) (string, bool) {
+	opts := parseImageOptions(image)
+	repository := opts.Repository
+	switch opts.Registry {
+	case "":
+	case "docker.io", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		repository = strings.TrimPrefix(repository, opts.Registry+"/")
+	default:
+		return "", false
+	}
+	if strings.Contains(image, "@") {
+		return "", false
+	}
+	if !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	tag := opts.Tag
+	if tag == "" {
+		tag = "latest"
 	}
+	mirror = strings.TrimPrefix(strings.TrimPrefix(mirror, "https://"), "http://")
+	return fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(mirror, "/"), repository, tag), true
+}
 
-	responseBody, err := client.ImagePull(context.Background(), pullOpts.FqName, types.ImagePullOptions{
-		RegistryAuth: base64.URLEncoding.EncodeToString(encodedJSON),
-	})
+func pullImageFromRegistry(ctx context.Context, client *client.Client, authConfig *AuthConfigs, retries registryRetries, operations *operationLimit, image, platform string) (*pushPullSummary, error) {
+	log.Printf("[DEBUG] pulling image: %s", image)
+
+	pullOpts := parseImageOptions(image)
+
+	log.Printf("[DEBUG] Registry: %s", pullOpts.Registry)
+	// Find the auth of the registry in the image name, or of the public docker
+	// hub if a registry wasn't given
+	auth, err := registryAuthConfig(authConfig, pullOpts.Registry)
 	if err != nil {
-		return fmt.Errorf("error pulling image %s: %s", pullOpts.FqName, err)
+		return nil, err
 	}
-	defer responseBody.Close()
 
-	pullOutput, err = decodePushPullMessages(responseBody)
-	if err != nil {
-		return fmt.Errorf("error decoding pull image messages: %s", err)
+	var pullSummary *pushPullSummary
+	pull := func(auth types.AuthConfig) error {
+		encodedJSON, err := json.Marshal(auth)
+		if err != nil {
+			return fmt.Errorf("error creating auth config: %s", err)
+		}
+		return retries.do(ctx, "pull of "+pullOpts.FqName, func() error {
+			release, err := operations.acquire(ctx, "pull of "+pullOpts.FqName)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			responseBody, err := client.ImagePull(ctx, pullOpts.FqName, types.ImagePullOptions{
+				RegistryAuth: base64.URLEncoding.EncodeToString(encodedJSON),
+				Platform:     platform,
+			})
+			if err != nil {
+				return fmt.Errorf("error pulling image %s: %s", pullOpts.FqName, err)
+			}
+			defer responseBody.Close()
+
+			pullSummary, err = decodePushPullMessages(responseBody)
+			if err != nil {
+				return fmt.Errorf("error decoding pull image messages: %s", err)
+			}
+			return nil
+		})
+	}
+	if err := retryWithRefreshedAuth(authConfig, auth.ServerAddress, auth, pull); err != nil {
+		return nil, err
 	}
 
-	log.Printf("[DEBUG] image pull output: %s", pullOutput)
+	log.Printf("[DEBUG] image pull summary: %+v", *pullSummary)
 
-	return nil
+	return pullSummary, nil
 }
 
 type internalImageOptions struct {
@@ -329,94 +1226,384 @@ func parseImageOptions(image string) internalImageOptions {
 	}
 
 	pullOpts.NormalizedRegistry = normalizeRegistryAddress(pullOpts.Registry)
-	if pullOpts.Registry == "" {
-		pullOpts.FqName = fmt.Sprintf("%s:%s", pullOpts.Repository, pullOpts.Tag)
-	} else {
-		pullOpts.FqName = fmt.Sprintf("%s/%s:%s", pullOpts.Registry, pullOpts.Repository, pullOpts.Tag)
-	}
+	// the repository includes the registry
+	pullOpts.FqName = fmt.Sprintf("%s:%s", pullOpts.Repository, pullOpts.Tag)
 	return pullOpts
 }
 
-func pushImage(client *client.Client, authConfig *AuthConfigs, image string) error {
+func pushImage(ctx context.Context, client *client.Client, authConfig *AuthConfigs, retries registryRetries, operations *operationLimit, image string) (*pushPullSummary, error) {
 	log.Printf("[DEBUG] pushing image: %s", image)
 
 	pushOpts := parseImageOptions(image)
 
-	// If a registry was specified in the image name, try to find auth for it
-	auth := types.AuthConfig{}
-	if pushOpts.Registry != "" {
-		if authConfig, ok := authConfig.Configs[normalizeRegistryAddress(pushOpts.Registry)]; ok {
-			auth = authConfig
-		}
-	} else {
-		// Try to find an auth config for the public docker hub if a registry wasn't given
-		if authConfig, ok := authConfig.Configs["https://registry.hub.docker.com"]; ok {
-			auth = authConfig
-		}
-	}
-
-	encodedJSON, err := json.Marshal(auth)
+	// Find the auth of the registry in the image name, or of the public docker
+	// hub if a registry wasn't given
+	auth, err := registryAuthConfig(authConfig, pushOpts.Registry)
 	if err != nil {
-		return fmt.Errorf("error creating auth config: %s", err)
+		return nil, err
 	}
 
-	responseBody, err := client.ImagePush(context.Background(), pushOpts.FqName, types.ImagePushOptions{
-		RegistryAuth: base64.URLEncoding.EncodeToString(encodedJSON),
-	})
+	var pushSummary *pushPullSummary
+	push := func(auth types.AuthConfig) error {
+		encodedJSON, err := json.Marshal(auth)
+		if err != nil {
+			return fmt.Errorf("error creating auth config: %s", err)
+		}
+		return retries.do(ctx, "push of "+pushOpts.FqName, func() error {
+			release, err := operations.acquire(ctx, "push of "+pushOpts.FqName)
+			if err != nil {
+				return err
+			}
+			defer release()
 
-	if err != nil {
-		return fmt.Errorf("error pushing image [%s][%s]: %s", image, pushOpts.FqName, err)
-	}
-	defer responseBody.Close()
+			responseBody, err := client.ImagePush(ctx, pushOpts.FqName, types.ImagePushOptions{
+				RegistryAuth: base64.URLEncoding.EncodeToString(encodedJSON),
+			})
 
-	pushOutput, err = decodePushPullMessages(responseBody)
-	if err != nil {
-		return fmt.Errorf("error decoding push image messages: %s", err)
+			if err != nil {
+				return fmt.Errorf("error pushing image [%s][%s]: %s", image, pushOpts.FqName, err)
+			}
+			defer responseBody.Close()
+
+			pushSummary, err = decodePushPullMessages(responseBody)
+			if err != nil {
+				return fmt.Errorf("error decoding push image messages: %s", err)
+			}
+			return nil
+		})
+	}
+	if err := retryWithRefreshedAuth(authConfig, auth.ServerAddress, auth, push); err != nil {
+		return nil, err
 	}
 
-	return nil
+	log.Printf("[DEBUG] image push summary: %+v", *pushSummary)
+
+	return pushSummary, nil
+}
+
+func findImage(ctx context.Context, imageName string, client *client.Client, authConfig *AuthConfigs, options pullOptions, platform string) (*types.ImageSummary, error) {
+	foundImage, _, err := findOrPullImage(ctx, imageName, client, authConfig, options, platform)
+	return foundImage, err
 }
 
-func findImage(imageName string, client *client.Client, authConfig *AuthConfigs) (*types.ImageSummary, error) {
+// findOrPullImage looks up the image locally and pulls it if it is missing.
+// The returned summary is marked as skipped if the image was already present.
+// If the platform is set, a local image for another platform is replaced by a
+// pull of the platform.
+func findOrPullImage(ctx context.Context, imageName string, client *client.Client, authConfig *AuthConfigs, options pullOptions, platform string) (*types.ImageSummary, *pushPullSummary, error) {
 	log.Printf("[DEBUG] findImage: [%s]", imageName)
 
 	if imageName == "" {
-		return nil, fmt.Errorf("Empty image name is not allowed")
+		return nil, nil, fmt.Errorf("Empty image name is not allowed")
 	}
 
 	var data Data
 	// load local images into the data structure
-	if err := fetchLocalImages(&data, client); err != nil {
-		return nil, err
+	if err := fetchLocalImages(ctx, &data, client); err != nil {
+		return nil, nil, err
 	}
 
 	foundImage := searchLocalImages(data, imageName)
 	if foundImage != nil {
-		return foundImage, nil
+		matches, err := imageMatchesPlatform(ctx, client, foundImage.ID, platform)
+		if err != nil {
+			return nil, nil, err
+		}
+		if matches {
+			return foundImage, &pushPullSummary{Skipped: true}, nil
+		}
+		log.Printf("[DEBUG] Local image %s is not for platform %s", imageName, platform)
 	}
 
-	if err := pullImage(&data, client, authConfig, imageName); err != nil {
-		return nil, fmt.Errorf("Unable to pull image %s: %s", imageName, err)
+	pullSummary, err := pullImage(ctx, &data, client, authConfig, options, imageName, platform)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to pull image %s: %s", imageName, err)
 	}
 
 	// update the data structure of the images
-	if err := fetchLocalImages(&data, client); err != nil {
-		return nil, err
+	if err := fetchLocalImages(ctx, &data, client); err != nil {
+		return nil, nil, err
 	}
 
 	foundImage = searchLocalImages(data, imageName)
 	if foundImage != nil {
-		return foundImage, nil
+		return foundImage, pullSummary, nil
 	}
 
-	return nil, fmt.Errorf("Unable to find or pull image %s", imageName)
+	return nil, nil, fmt.Errorf("Unable to find or pull image %s", imageName)
 }
 
-func buildDockerImage(rawBuild map[string]interface{}, imageName string, client *client.Client) (string, error) {
+// releaseTag is the tag retaining the superseded image of the name, e.g.
+// foo:1.0-release-0123456789ab for foo:1.0
+func releaseTag(imageName, imageID string) string {
+	id := strings.TrimPrefix(imageID, "sha256:")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return releaseTagPrefix(imageName) + id
+}
+
+func releaseTagPrefix(imageName string) string {
+	opts := parseImageOptions(imageName)
+	tag := opts.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return fmt.Sprintf("%s:%s-release-", opts.Repository, tag)
+}
+
+// retainReleases tags the previous image of the resource with its release
+// tag if the image was superseded by the current one, and removes the
+// releases beyond keep_old_releases
+func retainReleases(ctx context.Context, d *schema.ResourceData, client *client.Client, previousImageID, currentImageID string) error {
+	keep := d.Get("keep_old_releases").(int)
+	imageName := d.Get("name").(string)
+	if keep == 0 || strings.Contains(imageName, "@") {
+		return nil
+	}
+	if previousImageID != "" && previousImageID != currentImageID {
+		log.Printf("[DEBUG] Retaining image %s superseded by %s as a release of %s", previousImageID, currentImageID, imageName)
+		if err := client.ImageTag(ctx, previousImageID, releaseTag(imageName, previousImageID)); err != nil {
+			// the image was removed in the meantime
+			log.Printf("[WARN] Unable to retain image %s as a release of %s: %s", previousImageID, imageName, err)
+		}
+	}
+	return pruneReleases(ctx, client, imageName, keep)
+}
+
+// listReleases returns the release tags of the name, the newest image first
+func listReleases(ctx context.Context, client *client.Client, imageName string) ([]string, error) {
+	prefix := releaseTagPrefix(imageName)
+	images, err := client.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", prefix+"*")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the releases of image %s: %s", imageName, err)
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Created > images[j].Created
+	})
+	releases := []string{}
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if strings.HasPrefix(tag, prefix) {
+				releases = append(releases, tag)
+			}
+		}
+	}
+	return releases, nil
+}
+
+// pruneReleases removes the release tags of the name beyond the newest keep
+// ones, and with them the images without other references. Releases used by
+// containers are kept.
+func pruneReleases(ctx context.Context, client *client.Client, imageName string, keep int) error {
+	releases, err := listReleases(ctx, client, imageName)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(releases); i++ {
+		log.Printf("[DEBUG] Removing release %s of image %s", releases[i], imageName)
+		if _, err := client.ImageRemove(ctx, releases[i], types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+			log.Printf("[WARN] Unable to remove release %s of image %s: %s", releases[i], imageName, err)
+		}
+	}
+	return nil
+}
+
+// imageMatchesPlatform reports whether the local image is for the platform
+// in the 'os/arch[/variant]' format. The variant is not compared because the
+// daemon does not report it. Every image matches an empty platform.
+func imageMatchesPlatform(ctx context.Context, client *client.Client, imageID, platform string) (bool, error) {
+	if platform == "" {
+		return true, nil
+	}
+	image, _, err := client.ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		return false, fmt.Errorf("Unable to inspect image %s: %s", imageID, err)
+	}
+	p := parsePlatform(platform)
+	return strings.EqualFold(image.Os, p.OS) && (p.Architecture == "" || strings.EqualFold(image.Architecture, p.Architecture)), nil
+}
+
+// builtImageNames returns the names of the images a build creates
+func builtImageNames(rawBuild map[string]interface{}, imageName string) []string {
+	names := append([]string{imageName}, stringListToStringSlice(rawBuild["tag"].([]interface{}))...)
+	for _, platform := range stringListToStringSlice(rawBuild["platforms"].([]interface{})) {
+		names = append(names, platformImageName(imageName, platform))
+	}
+	return names
+}
+
+// loadImageArchive loads the images of the tar archive, in the format of
+// 'docker save', into the daemon
+func loadImageArchive(ctx context.Context, client *client.Client, archive io.Reader) error {
+	response, err := client.ImageLoad(ctx, archive, true)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return decodeDaemonMessages(response.Body)
+}
+
+// importImage creates the image from the root filesystem tarball of the
+// import block like 'docker import'. The daemon downloads http(s) sources.
+func importImage(ctx context.Context, client *client.Client, rawImport map[string]interface{}, imageName string) error {
+	source := types.ImageImportSource{SourceName: rawImport["source"].(string)}
+	if !strings.HasPrefix(source.SourceName, "http://") && !strings.HasPrefix(source.SourceName, "https://") {
+		file, err := os.Open(source.SourceName)
+		if err != nil {
+			return fmt.Errorf("Unable to open the tarball of image %s: %s", imageName, err)
+		}
+		defer file.Close()
+		source = types.ImageImportSource{Source: file, SourceName: "-"}
+	}
+	log.Printf("[DEBUG] Importing image %s from %s", imageName, rawImport["source"])
+
+	response, err := client.ImageImport(ctx, source, imageName, types.ImageImportOptions{
+		Changes:  stringListToStringSlice(rawImport["changes"].([]interface{})),
+		Message:  rawImport["message"].(string),
+		Platform: rawImport["platform"].(string),
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to import image %s from %s: %s", imageName, rawImport["source"], err)
+	}
+	defer response.Close()
+	if err := decodeDaemonMessages(response); err != nil {
+		return fmt.Errorf("Unable to import image %s from %s: %s", imageName, rawImport["source"], err)
+	}
+	return nil
+}
+
+// decodeDaemonMessages reads the JSON messages of a load or import and
+// returns the error reported by the daemon
+func decodeDaemonMessages(body io.Reader) error {
+	dec := json.NewDecoder(body)
+	for dec.More() {
+		var m jsonmessage.JSONMessage
+		if err := dec.Decode(&m); err != nil {
+			return fmt.Errorf("Problem decoding message from docker daemon: %s", err)
+		}
+		if m.Error != nil {
+			return fmt.Errorf("%s", m.Error.Message)
+		}
+	}
+	return nil
+}
+
+// loadImageFile loads the images of the file created by 'docker save' or
+// save_path
+func loadImageFile(ctx context.Context, client *client.Client, path string) error {
+	log.Printf("[DEBUG] Loading images from %s", path)
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Unable to open image archive: %s", err)
+	}
+	defer file.Close()
+	if err := loadImageArchive(ctx, client, file); err != nil {
+		return fmt.Errorf("Unable to load the images of %s: %s", path, err)
+	}
+	return nil
+}
+
+// saveImageFile saves the image to the file like 'docker save'. The file is
+// replaced once the image is saved completely.
+func saveImageFile(ctx context.Context, client *client.Client, imageName, path string) error {
+	log.Printf("[DEBUG] Saving image %s to %s", imageName, path)
+	images, err := client.ImageSave(ctx, []string{imageName})
+	if err != nil {
+		return fmt.Errorf("Unable to save image %s: %s", imageName, err)
+	}
+	defer images.Close()
+
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("Unable to create the file of image %s: %s", imageName, err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, images); err != nil {
+		file.Close()
+		return fmt.Errorf("Unable to save image %s to %s: %s", imageName, path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Unable to save image %s to %s: %s", imageName, path, err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("Unable to save image %s to %s: %s", imageName, path, err)
+	}
+	return nil
+}
+
+// buildDockerImagePlatforms builds the image once for each of the platforms of
+// the build. The images are named by platformImageName and the one of the
+// first platform is also tagged with imageName and the tags of the build.
+// Builds for a single platform write the output of the build, if set.
+func buildDockerImagePlatforms(ctx context.Context, rawBuild map[string]interface{}, imageName string, client *client.Client, operations *operationLimit, contextSizeWarningThreshold int64) (string, error) {
+	platforms := stringListToStringSlice(rawBuild["platforms"].([]interface{}))
+	hasOutput := len(rawBuild["output"].([]interface{})) > 0
+	imageBuild := make(map[string]interface{}, len(rawBuild))
+	for k, v := range rawBuild {
+		imageBuild[k] = v
+	}
+	imageBuild["output"] = []interface{}{}
+
+	if len(platforms) == 0 {
+		buildOutput, err := buildDockerImage(ctx, imageBuild, imageName, client, operations, contextSizeWarningThreshold)
+		if err != nil || !hasOutput {
+			return buildOutput, err
+		}
+		// the export is a second build which reuses the cache of the first one,
+		// as the daemon supports only one exporter per build
+		exportOutput, err := buildDockerImage(ctx, rawBuild, imageName, client, operations, contextSizeWarningThreshold)
+		return buildOutput + exportOutput, err
+	}
+	if rawBuild["platform"].(string) != "" {
+		return "", fmt.Errorf("Only one of platform or platforms can be set for a build")
+	}
+	if hasOutput {
+		return "", fmt.Errorf("Build output is not supported together with platforms")
+	}
+
+	var output strings.Builder
+	for i, platform := range platforms {
+		platformBuild := make(map[string]interface{}, len(imageBuild))
+		for k, v := range imageBuild {
+			platformBuild[k] = v
+		}
+		platformBuild["platform"] = platform
+		if i == 0 {
+			platformBuild["tag"] = append([]interface{}{imageName}, rawBuild["tag"].([]interface{})...)
+		} else {
+			platformBuild["tag"] = []interface{}{}
+		}
+
+		fmt.Fprintf(&output, "Building for platform %s\n", platform)
+		buildOutput, err := buildDockerImage(ctx, platformBuild, platformImageName(imageName, platform), client, operations, contextSizeWarningThreshold)
+		output.WriteString(buildOutput)
+		if err != nil {
+			return output.String(), err
+		}
+	}
+	return output.String(), nil
+}
+
+// buildkitInlineCacheArg is the build arg which makes BuildKit embed the
+// cache metadata into the built image
+const buildkitInlineCacheArg = "BUILDKIT_INLINE_CACHE"
+
+func buildDockerImage(ctx context.Context, rawBuild map[string]interface{}, imageName string, client *client.Client, operations *operationLimit, contextSizeWarningThreshold int64) (string, error) {
 	buildOptions := types.ImageBuildOptions{}
 
+	// an unset builder_version would send an empty version
 	buildOptions.Version = types.BuilderV1
+	if builderVersion := rawBuild["builder_version"].(string); builderVersion != "" {
+		buildOptions.Version = types.BuilderVersion(builderVersion)
+	}
 	buildOptions.Dockerfile = rawBuild["dockerfile"].(string)
+	dockerfileContents := rawBuild["dockerfile_contents"].(string)
+	if dockerfileContents != "" {
+		buildOptions.Dockerfile = inlineDockerfileName
+	}
 
 	tags := []string{imageName}
 	for _, t := range rawBuild["tag"].([]interface{}) {
@@ -427,15 +1614,41 @@ func buildDockerImage(rawBuild map[string]interface{}, imageName string, client
 	buildOptions.ForceRemove = rawBuild["force_remove"].(bool)
 	buildOptions.Remove = rawBuild["remove"].(bool)
 	buildOptions.NoCache = rawBuild["no_cache"].(bool)
+	buildOptions.PullParent = rawBuild["pull_parent"].(bool)
 	buildOptions.Target = rawBuild["target"].(string)
+	buildOptions.Platform = rawBuild["platform"].(string)
+	buildOptions.CPUShares = int64(rawBuild["cpu_shares"].(int))
+	buildOptions.CPUQuota = int64(rawBuild["cpu_quota"].(int))
+	buildOptions.CPUPeriod = int64(rawBuild["cpu_period"].(int))
+	buildOptions.Memory = int64(rawBuild["memory"].(int))
+	buildOptions.MemorySwap = int64(rawBuild["memory_swap"].(int))
+	buildOptions.ShmSize = int64(rawBuild["shm_size"].(int))
+	buildOptions.CgroupParent = rawBuild["cgroup_parent"].(string)
+	buildOptions.Isolation = container.Isolation(rawBuild["isolation"].(string))
+	buildOptions.NetworkMode = rawBuild["network_mode"].(string)
+	buildOptions.ExtraHosts = stringListToStringSlice(rawBuild["extra_hosts"].([]interface{}))
+	buildOptions.CacheFrom = stringListToStringSlice(rawBuild["cache_from"].([]interface{}))
+	log.Printf("[DEBUG] Cache from: %v\n", buildOptions.CacheFrom)
 
 	buildArgs := make(map[string]*string)
+	buildArgNames := make([]string, 0)
 	for k, v := range rawBuild["build_arg"].(map[string]interface{}) {
 		val := v.(string)
 		buildArgs[k] = &val
+		buildArgNames = append(buildArgNames, k)
+	}
+	if rawBuild["cache_to"].(string) != "" {
+		if buildOptions.Version != types.BuilderBuildKit {
+			return "", fmt.Errorf("Build cache_to requires builder_version 2")
+		}
+		// the daemon only supports the inline cache, which is pushed with the image
+		inlineCache := "1"
+		buildArgs[buildkitInlineCacheArg] = &inlineCache
+		buildArgNames = append(buildArgNames, buildkitInlineCacheArg)
 	}
 	buildOptions.BuildArgs = buildArgs
-	log.Printf("[DEBUG] Build Args: %v\n", buildArgs)
+	// only the names are logged as build args regularly carry credentials
+	log.Printf("[DEBUG] Build Args: %v\n", buildArgNames)
 
 	labels := make(map[string]string)
 	for k, v := range rawBuild["label"].(map[string]interface{}) {
@@ -444,19 +1657,84 @@ func buildDockerImage(rawBuild map[string]interface{}, imageName string, client
 	buildOptions.Labels = labels
 	log.Printf("[DEBUG] Labels: %v\n", labels)
 
+	secrets, err := buildSecretsFromList(rawBuild["secrets"].([]interface{}))
+	if err != nil {
+		return "", err
+	}
+	if len(secrets) > 0 && buildOptions.Version != types.BuilderBuildKit {
+		return "", fmt.Errorf("Build secrets require builder_version 2")
+	}
+	sshs, err := buildSSHFromList(rawBuild["ssh"].([]interface{}))
+	if err != nil {
+		return "", err
+	}
+	if len(sshs) > 0 && buildOptions.Version != types.BuilderBuildKit {
+		return "", fmt.Errorf("Build ssh requires builder_version 2")
+	}
+	if progress := rawBuild["progress"].(string); progress != "" && progress != buildkitProgressAuto && buildOptions.Version != types.BuilderBuildKit {
+		return "", fmt.Errorf("Build progress requires builder_version 2")
+	}
+	output, err := buildOutputFromList(rawBuild["output"].([]interface{}))
+	if err != nil {
+		return "", err
+	}
+	if output != nil {
+		if buildOptions.Version != types.BuilderBuildKit {
+			return "", fmt.Errorf("Build output requires builder_version 2")
+		}
+		// local outputs are extracted from the tar stream by the provider
+		buildOptions.Outputs = []types.ImageBuildOutput{{Type: buildOutputTypeTar}}
+	}
+
 	contextDir := rawBuild["path"].(string)
-	excludes, err := build.ReadDockerignore(contextDir)
+	excludes := stringListToStringSlice(rawBuild["excludes"].([]interface{}))
+	var buildContext io.Reader
+	if isRemoteBuildContext(contextDir) {
+		if dockerfileContents != "" {
+			return "", fmt.Errorf("dockerfile_contents is not supported for the remote build context %s", contextDir)
+		}
+		if len(excludes) > 0 {
+			return "", fmt.Errorf("excludes is not supported for the remote build context %s", contextDir)
+		}
+		// the daemon fetches the context itself
+		buildOptions.RemoteContext = contextDir
+	} else {
+		contextDir, _ = homedir.Expand(contextDir)
+		localContext, err := openLocalBuildContext(contextDir, buildOptions.Dockerfile, dockerfileContents, excludes, contextSizeWarningThreshold)
+		if err != nil {
+			return "", err
+		}
+		defer localContext.Close()
+		buildContext = localContext
+	}
+
+	if buildOptions.Version == types.BuilderBuildKit {
+		session, err := newBuildSession(contextDir)
+		if err != nil {
+			return "", err
+		}
+		session.addSecrets(secrets)
+		session.addSSH(sshs)
+		session.addOutput(output)
+		if err := session.start(ctx, client); err != nil {
+			return "", err
+		}
+		defer session.close()
+		buildOptions.SessionID = session.id
+	}
+
+	release, err := operations.acquire(ctx, "build of "+imageName)
 	if err != nil {
 		return "", err
 	}
-	excludes = build.TrimBuildFilesFromExcludes(excludes, buildOptions.Dockerfile, false)
+	defer release()
 
 	var response types.ImageBuildResponse
-	response, err = client.ImageBuild(context.Background(), getBuildContext(contextDir, excludes), buildOptions)
+	response, err = client.ImageBuild(ctx, buildContext, buildOptions)
 	if err != nil {
 		return "", err
 	}
 	defer response.Body.Close()
 
-	return decodeBuildMessages(response)
+	return decodeBuildMessages(response, imageName, rawBuild["progress"].(string))
 }
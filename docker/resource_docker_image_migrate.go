@@ -0,0 +1,21 @@
+package docker
+
+// migrateImagePushPullOutput drops the free-text pull_output and push_output
+// values of v0 states. They are replaced by structured summaries which are
+// set again on the next pull or push.
+func migrateImagePushPullOutput(rawState map[string]interface{}) map[string]interface{} {
+	delete(rawState, "pull_output")
+	delete(rawState, "push_output")
+
+	return rawState
+}
+
+// migrateImageLatestToImageID copies the misleadingly named latest attribute
+// of v1 states into image_id. repo_digest is set on the next refresh.
+func migrateImageLatestToImageID(rawState map[string]interface{}) map[string]interface{} {
+	if latest, ok := rawState["latest"]; ok {
+		rawState["image_id"] = latest
+	}
+
+	return rawState
+}
@@ -1,15 +1,28 @@
 package docker
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
 )
 
@@ -25,6 +38,8 @@ func TestAccDockerImage_basic(t *testing.T) {
 				Config: testAccDockerImageConfig,
 				Check: resource.ComposeTestCheckFunc(
 					resource.TestMatchResourceAttr("docker_image.foo", "latest", contentDigestRegexp),
+					resource.TestMatchResourceAttr("docker_image.foo", "image_id", contentDigestRegexp),
+					resource.TestMatchResourceAttr("docker_image.foo", "repo_digest", regexp.MustCompile(`\Aalpine@sha256:[A-Fa-f0-9]+\z`)),
 				),
 			},
 		},
@@ -108,6 +123,28 @@ func TestAccDockerImage_data_pull_trigger(t *testing.T) {
 	})
 }
 
+func TestAccDockerImage_data_pull_triggers_keep_locally(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:                  func() { testAccPreCheck(t) },
+		Providers:                 testAccProviders,
+		PreventPostDestroyRefresh: true,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccDockerImagePullTriggersKeepLocallyConfig, "first"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.foobarbazoo", "latest", contentDigestRegexp),
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccDockerImagePullTriggersKeepLocallyConfig, "second"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("docker_image.foobarbazoo", "pull_output.0.skipped", "false"),
+				),
+			},
+		},
+	})
+}
+
 func TestAccDockerImage_data_private(t *testing.T) {
 	registry := "127.0.0.1:15000"
 	image := "127.0.0.1:15000/tftest-service:v1"
@@ -150,6 +187,30 @@ func TestAccDockerImage_data_private_config_file(t *testing.T) {
 	})
 }
 
+func TestAccDockerImage_pushTargets(t *testing.T) {
+	registry := "127.0.0.1:15000"
+	image := "127.0.0.1:15000/tftest-service:v1"
+	target := "127.0.0.1:15000/tftest-service:push-target"
+	wd, _ := os.Getwd()
+	dockerConfig := wd + "/../scripts/testing/dockerconfig.json"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                  func() { testAccPreCheck(t) },
+		Providers:                 testAccProviders,
+		PreventPostDestroyRefresh: true,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccDockerImagePushTargetsConfig, registry, dockerConfig, image, target),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.foo_private", "push_target_digests."+target, contentDigestRegexp),
+					resource.TestMatchResourceAttr("docker_image.foo_private", "repo_digest", regexp.MustCompile(`\A127\.0\.0\.1:15000/tftest-service@sha256:[A-Fa-f0-9]+\z`)),
+				),
+			},
+		},
+		CheckDestroy: checkAndRemoveImages,
+	})
+}
+
 func TestAccDockerImage_data_private_config_file_content(t *testing.T) {
 	registry := "127.0.0.1:15000"
 	image := "127.0.0.1:15000/tftest-service:v1"
@@ -188,6 +249,648 @@ func TestAccDockerImage_sha265(t *testing.T) {
 	})
 }
 
+func TestDecodePushPullMessages(t *testing.T) {
+	pullMessages := `{"status":"Pulling from library/alpine","id":"3.1"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"aaa"}
+{"status":"Already exists","progressDetail":{},"id":"bbb"}
+{"status":"Downloading","progressDetail":{"current":100,"total":2000},"id":"aaa"}
+{"status":"Downloading","progressDetail":{"current":2000,"total":2000},"id":"aaa"}
+{"status":"Pull complete","progressDetail":{},"id":"aaa"}
+{"status":"Digest: sha256:1111"}
+{"status":"Status: Downloaded newer image for alpine:3.1"}
+`
+	summary, err := decodePushPullMessages(strings.NewReader(pullMessages))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := pushPullSummary{Digest: "sha256:1111", Layers: 2, Bytes: 2000}
+	if *summary != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *summary)
+	}
+
+	pushMessages := `{"status":"The push refers to repository [127.0.0.1:15000/foo]"}
+{"status":"Preparing","progressDetail":{},"id":"aaa"}
+{"status":"Layer already exists","progressDetail":{},"id":"aaa"}
+{"status":"latest: digest: sha256:2222 size: 528"}
+{"progressDetail":{},"aux":{"Tag":"latest","Digest":"sha256:2222","Size":528}}
+`
+	summary, err = decodePushPullMessages(strings.NewReader(pushMessages))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = pushPullSummary{Digest: "sha256:2222", Layers: 1, Skipped: true}
+	if *summary != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *summary)
+	}
+
+	_, err = decodePushPullMessages(strings.NewReader(`{"errorDetail":{"message":"denied"},"error":"denied"}`))
+	if err == nil || err.Error() != "denied" {
+		t.Fatalf("expected error 'denied', got %v", err)
+	}
+}
+
+func TestMigrateImagePushPullOutput(t *testing.T) {
+	v0State := map[string]interface{}{
+		"name":        "alpine:3.1",
+		"pull_output": "3.1: Pulling from library/alpine",
+		"push_output": "",
+	}
+
+	v1State := migrateImagePushPullOutput(v0State)
+	v1Config := terraform.NewResourceConfigRaw(v1State)
+	warns, errs := resourceDockerImage().Validate(v1Config)
+	if len(warns) > 0 || len(errs) > 0 {
+		t.Fatalf("migrated image config is invalid: %v %v", warns, errs)
+	}
+}
+
+func TestMigrateImageLatestToImageID(t *testing.T) {
+	v1State := map[string]interface{}{
+		"name":   "alpine:3.1",
+		"latest": "sha256:1111",
+	}
+
+	v2State := migrateImageLatestToImageID(v1State)
+	if v2State["image_id"] != "sha256:1111" {
+		t.Fatalf("expected image_id to be migrated from latest, got %v", v2State["image_id"])
+	}
+}
+
+func TestRepoDigestForImage(t *testing.T) {
+	repoDigests := []string{
+		"alpine@sha256:1111",
+		"localhost:5000/foo/alpine@sha256:2222",
+	}
+	cases := map[string]string{
+		"alpine":                             "alpine@sha256:1111",
+		"alpine:3.1":                         "alpine@sha256:1111",
+		"docker.io/library/alpine:3.1":       "alpine@sha256:1111",
+		"localhost:5000/foo/alpine:latest":   "localhost:5000/foo/alpine@sha256:2222",
+		"localhost:5000/foo/alpine@sha256:2": "localhost:5000/foo/alpine@sha256:2222",
+		"busybox:latest":                     "",
+	}
+	for name, expected := range cases {
+		if actual := repoDigestForImage(name, repoDigests); actual != expected {
+			t.Errorf("repoDigestForImage(%q) = %q, expected %q", name, actual, expected)
+		}
+	}
+}
+
+func TestGetDockerImageBuildHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-image-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dfPath := path.Join(dir, "Dockerfile")
+	rawBuild := map[string]interface{}{
+		"path":                dir,
+		"dockerfile":          "Dockerfile",
+		"dockerfile_contents": "",
+		"excludes":            []interface{}{"*.tfstate", ".terraform"},
+	}
+
+	if err := ioutil.WriteFile(dfPath, []byte(testDockerFileExample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	contextHash, dockerfileHash, err := getDockerImageBuildHashes(rawBuild)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := ioutil.WriteFile(dfPath, []byte(testDockerFileExample+"RUN true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changedContextHash, changedDockerfileHash, err := getDockerImageBuildHashes(rawBuild)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if changedDockerfileHash == dockerfileHash {
+		t.Errorf("expected the Dockerfile hash to change")
+	}
+	if changedContextHash == contextHash {
+		t.Errorf("expected the context hash to change")
+	}
+
+	// excluded files do not change the hash
+	if err := ioutil.WriteFile(path.Join(dir, "terraform.tfstate"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	excludedContextHash, _, err := getDockerImageBuildHashes(rawBuild)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if excludedContextHash != changedContextHash {
+		t.Errorf("expected the excluded file not to change the context hash")
+	}
+
+	rawBuild["dockerfile_contents"] = testDockerFileExample
+	_, inlineDockerfileHash, err := getDockerImageBuildHashes(rawBuild)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if inlineDockerfileHash != dockerfileHash {
+		t.Errorf("expected the hash of the inline Dockerfile to equal the one of the same file")
+	}
+
+	if !buildInputsChanged(rebuildReasonContextChanged + ", " + rebuildReasonDockerfileChanged) {
+		t.Errorf("expected changed build inputs to require a build")
+	}
+	if !buildInputsChanged(rebuildReasonTriggersChanged) {
+		t.Errorf("expected changed triggers to require a build")
+	}
+	if buildInputsChanged(rebuildReasonImageMissing) {
+		t.Errorf("expected a missing image to be pulled before it is built")
+	}
+}
+
+func TestDockerImageReplacementRebuildReason(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-image-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "Dockerfile"), []byte(testDockerFileExample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":  "foo:latest",
+		"build": []interface{}{map[string]interface{}{"path": dir}},
+	})
+
+	created, err := resourceDockerImage().Diff(nil, config, nil)
+	if err != nil {
+		t.Fatalf("Unable to diff the image: %s", err)
+	}
+	state := &terraform.InstanceState{ID: "sha256:foofoo:latest", Attributes: map[string]string{}}
+	for k, attr := range created.Attributes {
+		if !attr.NewComputed {
+			state.Attributes[k] = attr.New
+		}
+	}
+	state.Attributes["image_id"] = "sha256:foo"
+	state.Attributes["latest"] = "sha256:foo"
+
+	unchanged, err := resourceDockerImage().Diff(state, config, nil)
+	if err != nil {
+		t.Fatalf("Unable to diff the image: %s", err)
+	}
+	if unchanged != nil && (unchanged.RequiresNew() || unchanged.Attributes["build_context_hash"] != nil || unchanged.Attributes["rebuild_reason"] != nil) {
+		t.Fatalf("expected an unchanged build to be neither hashed nor replaced, got %+v", unchanged.Attributes)
+	}
+
+	state.Attributes["build_context_hash"] = buildContextHashPrefix + "changed"
+	changedConfig := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":  "foo:latest",
+		"build": []interface{}{map[string]interface{}{"path": dir, "excludes": []interface{}{"*.md"}}},
+	})
+	replaced, err := resourceDockerImage().Diff(state, changedConfig, nil)
+	if err != nil {
+		t.Fatalf("Unable to diff the image: %s", err)
+	}
+	if !replaced.RequiresNew() {
+		t.Fatalf("expected a changed context to replace the image")
+	}
+	if reason := replaced.Attributes["rebuild_reason"]; reason == nil || reason.New != rebuildReasonContextChanged {
+		t.Errorf("expected the rebuild reason %q in the diff of the replacement, got %+v", rebuildReasonContextChanged, reason)
+	}
+
+	state.Attributes["image_id"] = ""
+	state.Attributes["latest"] = ""
+	missing, err := resourceDockerImage().Diff(state, config, nil)
+	if err != nil {
+		t.Fatalf("Unable to diff the image: %s", err)
+	}
+	if !missing.RequiresNew() {
+		t.Fatalf("expected a missing image to replace the resource")
+	}
+	if reason := missing.Attributes["rebuild_reason"]; reason == nil || reason.New != rebuildReasonImageMissing {
+		t.Errorf("expected the rebuild reason %q in the diff of the replacement, got %+v", rebuildReasonImageMissing, reason)
+	}
+}
+
+func TestBuiltImageNames(t *testing.T) {
+	rawBuild := map[string]interface{}{
+		"tag":       []interface{}{"foo:stable"},
+		"platforms": []interface{}{"linux/amd64", "linux/arm64"},
+	}
+	expected := []string{"foo:1.0", "foo:stable", "foo:1.0-linux-amd64", "foo:1.0-linux-arm64"}
+	if names := builtImageNames(rawBuild, "foo:1.0"); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestFindOrPullImagePlatform(t *testing.T) {
+	imageID, architecture, pulledPlatform := "sha256:aaaaaaaaaaaaaaaa", "amd64", ""
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/json"):
+			fmt.Fprintf(w, `[{"Id":%q,"RepoTags":["foo:1.0"]}]`, imageID)
+		case strings.HasSuffix(r.URL.Path, "/images/"+imageID+"/json"):
+			fmt.Fprintf(w, `{"Id":%q,"Os":"linux","Architecture":%q}`, imageID, architecture)
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			pulledPlatform = r.URL.Query().Get("platform")
+			imageID, architecture = "sha256:bbbbbbbbbbbbbbbb", "arm64"
+			w.Write([]byte(`{"status":"Downloaded newer image for foo:1.0"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	image, pullSummary, err := findOrPullImage(ctx, "foo:1.0", cli, &AuthConfigs{}, pullOptions{}, "")
+	if err != nil || !pullSummary.Skipped || image.ID != "sha256:aaaaaaaaaaaaaaaa" {
+		t.Fatalf("expected the local image without a platform, got %v and %v", image, err)
+	}
+	image, _, err = findOrPullImage(ctx, "foo:1.0", cli, &AuthConfigs{}, pullOptions{}, "linux/arm64/v8")
+	if err != nil || image.ID != "sha256:bbbbbbbbbbbbbbbb" || pulledPlatform != "linux/arm64/v8" {
+		t.Fatalf("expected the image of the platform to be pulled, got %v and %v", image, err)
+	}
+	pulledPlatform = ""
+	if _, pullSummary, err := findOrPullImage(ctx, "foo:1.0", cli, &AuthConfigs{}, pullOptions{}, "linux/arm64"); err != nil || !pullSummary.Skipped || pulledPlatform != "" {
+		t.Errorf("expected the local image of the platform, got %v", err)
+	}
+}
+
+func TestFindOrPullImageDisableRemotePull(t *testing.T) {
+	pulls := 0
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/json"):
+			w.Write([]byte(`[{"Id":"sha256:aaaaaaaaaaaaaaaa","RepoTags":["foo:1.0"]}]`))
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			pulls++
+			w.Write([]byte(`{"status":"Downloaded newer image for bar:1.0"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := pullOptions{disabled: true}
+	if image, _, err := findOrPullImage(context.Background(), "foo:1.0", cli, &AuthConfigs{}, options, ""); err != nil || image.ID != "sha256:aaaaaaaaaaaaaaaa" {
+		t.Errorf("expected the pre-loaded image, got %v and %v", image, err)
+	}
+	if _, _, err := findOrPullImage(context.Background(), "bar:1.0", cli, &AuthConfigs{}, options, ""); err == nil || !strings.Contains(err.Error(), "disable_remote_pull") {
+		t.Errorf("expected the pull to be refused, got %v", err)
+	}
+	if pulls != 0 {
+		t.Errorf("expected no pulls, got %d", pulls)
+	}
+	if err := options.checkBuild(map[string]interface{}{"pull_parent": true}); err == nil {
+		t.Error("expected a build with pull_parent to be refused")
+	}
+}
+
+func TestParseImageOptions(t *testing.T) {
+	cases := map[string][3]string{
+		"alpine:3.11":                {"", "alpine", "alpine:3.11"},
+		"localhost:5000/foo:1.0":     {"localhost:5000", "localhost:5000/foo", "localhost:5000/foo:1.0"},
+		"mirror.example.com/a/b:1.0": {"mirror.example.com", "mirror.example.com/a/b", "mirror.example.com/a/b:1.0"},
+	}
+	for image, expected := range cases {
+		opts := parseImageOptions(image)
+		if actual := [3]string{opts.Registry, opts.Repository, opts.FqName}; actual != expected {
+			t.Errorf("parseImageOptions(%q) = %v, expected %v", image, actual, expected)
+		}
+	}
+}
+
+func TestMirrorImageName(t *testing.T) {
+	cases := map[string]string{
+		"alpine":                     "mirror.example.com/library/alpine:latest",
+		"example/app:1.0":            "mirror.example.com/example/app:1.0",
+		"docker.io/library/alpine:3": "mirror.example.com/library/alpine:3",
+		"localhost:5000/app:dev":     "",
+		"quay.io/example/app:1.0":    "",
+		"alpine@sha256:1234":         "",
+	}
+	for image, expected := range cases {
+		actual, ok := mirrorImageName("https://mirror.example.com/", image)
+		if actual != expected || ok != (expected != "") {
+			t.Errorf("mirrorImageName(%q) = %q, expected %q", image, actual, expected)
+		}
+	}
+}
+
+func TestPullImageMirrors(t *testing.T) {
+	requests := []string{}
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			image := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+			requests = append(requests, "pull "+image)
+			if strings.HasPrefix(image, "broken.example.com/") {
+				w.Write([]byte(`{"errorDetail":{"message":"manifest unknown"},"error":"manifest unknown"}`))
+				return
+			}
+			w.Write([]byte(`{"status":"Pull complete","id":"1234"}`))
+		case strings.HasSuffix(r.URL.Path, "/tag"):
+			requests = append(requests, "tag "+r.URL.Query().Get("repo")+":"+r.URL.Query().Get("tag"))
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "DELETE":
+			requests = append(requests, "remove "+strings.SplitN(r.URL.Path, "/images/", 2)[1])
+			w.Write([]byte("[]"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mirrors := []string{"broken.example.com", "mirror.example.com"}
+	if _, err := pullImage(context.Background(), &Data{}, cli, &AuthConfigs{}, pullOptions{mirrors: mirrors}, "alpine:3.11", ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{
+		"pull broken.example.com/library/alpine:3.11",
+		"pull mirror.example.com/library/alpine:3.11",
+		"tag alpine:3.11",
+		"remove mirror.example.com/library/alpine:3.11",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected the image to be pulled from the second mirror, got %v", requests)
+	}
+
+	requests = []string{}
+	if _, err := pullImage(context.Background(), &Data{}, cli, &AuthConfigs{}, pullOptions{mirrors: []string{"broken.example.com"}}, "alpine:3.11", ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(requests, []string{"pull broken.example.com/library/alpine:3.11", "pull alpine:3.11"}) {
+		t.Errorf("expected a fallback to Docker Hub, got %v", requests)
+	}
+}
+
+func TestPushImageRefreshesExpiredToken(t *testing.T) {
+	passwords := []string{}
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/push") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		encoded, _ := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+		auth := types.AuthConfig{}
+		json.Unmarshal(encoded, &auth)
+		passwords = append(passwords, auth.Password)
+		w.Write([]byte(`{"status":"The push refers to repository [registry.example.com/foo]"}` + "\n"))
+		if auth.Password != "token 3" {
+			// the token expires after the first layers were pushed
+			w.Write([]byte(`{"status":"Pushed","progressDetail":{},"id":"1111"}` + "\n"))
+			w.Write([]byte(`{"errorDetail":{"message":"unauthorized: authentication required"},"error":"unauthorized: authentication required"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"Layer already exists","progressDetail":{},"id":"1111"}` + "\n"))
+		w.Write([]byte(`{"progressDetail":{},"aux":{"Tag":"1.0","Digest":"sha256:2222","Size":528}}`))
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := 0
+	address := "https://registry.example.com"
+	token := newRegistryToken(func() (types.AuthConfig, time.Time, error) {
+		tokens++
+		return types.AuthConfig{Username: "oauth2accesstoken", Password: fmt.Sprintf("token %d", tokens)}, time.Now().Add(time.Hour), nil
+	})
+	auth, _ := token.get(false)
+	auth.ServerAddress = address
+	authConfigs := &AuthConfigs{
+		Configs: map[string]types.AuthConfig{address: auth},
+		tokens:  map[string]*registryToken{address: token},
+	}
+	summary, err := pushImage(context.Background(), cli, authConfigs, registryRetries{}, nil, "registry.example.com/foo:1.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(passwords, []string{"token 1", "token 2", "token 3"}) || summary.Digest != "sha256:2222" {
+		t.Errorf("expected the push to be retried with new tokens, got %v and %+v", passwords, summary)
+	}
+
+	passwords = []string{}
+	authConfigs = &AuthConfigs{Configs: map[string]types.AuthConfig{address: {Username: "user", Password: "static", ServerAddress: address}}}
+	if _, err := pushImage(context.Background(), cli, authConfigs, registryRetries{}, nil, "registry.example.com/foo:1.0"); err == nil || len(passwords) != 1 {
+		t.Errorf("expected static credentials not to be retried, got %v", passwords)
+	}
+}
+
+func TestRetainReleases(t *testing.T) {
+	// tags of the images of the daemon by image ID, the IDs are ordered by creation
+	tags := map[string][]string{
+		"sha256:111111111111aa": {"foo:1.0-release-111111111111"},
+		"sha256:222222222222aa": {"foo:1.0-release-222222222222", "bar:1.0"},
+		"sha256:333333333333aa": {},
+		"sha256:444444444444aa": {"foo:1.0"},
+	}
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/images/json"):
+			images := []types.ImageSummary{}
+			for id, repoTags := range tags {
+				images = append(images, types.ImageSummary{ID: id, RepoTags: repoTags, Created: int64(id[7] - '0')})
+			}
+			json.NewEncoder(w).Encode(images)
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/tag"):
+			id := path.Base(path.Dir(r.URL.Path))
+			tags[id] = append(tags[id], r.URL.Query().Get("repo")+":"+r.URL.Query().Get("tag"))
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "DELETE":
+			name := strings.SplitN(r.URL.Path, "/images/", 2)[1]
+			for id, repoTags := range tags {
+				for i, tag := range repoTags {
+					if tag == name {
+						tags[id] = append(repoTags[:i:i], repoTags[i+1:]...)
+					}
+				}
+			}
+			w.Write([]byte("[]"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceDockerImage().Schema, map[string]interface{}{
+		"name":              "foo:1.0",
+		"keep_old_releases": 2,
+	})
+	if err := retainReleases(context.Background(), d, cli, "sha256:333333333333aa", "sha256:444444444444aa"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	releases, err := listReleases(context.Background(), cli, "foo:1.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{"foo:1.0-release-333333333333", "foo:1.0-release-222222222222"}
+	if !reflect.DeepEqual(releases, expected) {
+		t.Errorf("expected the superseded image to be retained and the oldest release to be removed, got %v", releases)
+	}
+	if len(tags["sha256:111111111111aa"]) != 0 || len(tags["sha256:222222222222aa"]) != 2 || len(tags["sha256:444444444444aa"]) != 1 {
+		t.Errorf("expected only the oldest release to be removed, got %v", tags)
+	}
+
+	if releaseTag("localhost:5000/foo", "sha256:0123456789abcdef") != "localhost:5000/foo:latest-release-0123456789ab" {
+		t.Errorf("unexpected release tag %s", releaseTag("localhost:5000/foo", "sha256:0123456789abcdef"))
+	}
+}
+
+func TestSaveAndLoadImageFile(t *testing.T) {
+	loaded := ""
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images/get") && r.URL.Query()["names"][0] == "foo:1.0":
+			w.Write([]byte("image-tarball"))
+		case strings.HasSuffix(r.URL.Path, "/images/load"):
+			body, _ := ioutil.ReadAll(r.Body)
+			loaded = string(body)
+			if loaded != "image-tarball" {
+				w.Write([]byte(`{"errorDetail":{"message":"invalid tar header"},"error":"invalid tar header"}`))
+				return
+			}
+			w.Write([]byte(`{"stream":"Loaded image: foo:1.0\n"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "docker-image-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := path.Join(dir, "foo.tar")
+	if err := saveImageFile(context.Background(), cli, "foo:1.0", archive); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if saved, _ := ioutil.ReadFile(archive); string(saved) != "image-tarball" {
+		t.Errorf("expected the saved image in %s, got %q", archive, saved)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected no temporary files to be left, got %d files", len(files))
+	}
+
+	if err := loadImageFile(context.Background(), cli, archive); err != nil || loaded != "image-tarball" {
+		t.Errorf("expected the saved image to be loaded, got %q and %v", loaded, err)
+	}
+	ioutil.WriteFile(archive, []byte("broken"), 0644)
+	if err := loadImageFile(context.Background(), cli, archive); err == nil || !strings.Contains(err.Error(), "invalid tar header") {
+		t.Errorf("expected the error of the daemon, got %v", err)
+	}
+	if err := saveImageFile(context.Background(), cli, "bar:1.0", archive); err == nil {
+		t.Error("expected an error for a missing image")
+	}
+}
+
+func TestImportImage(t *testing.T) {
+	var query url.Values
+	var body string
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/images/create") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query()
+		content, _ := ioutil.ReadAll(r.Body)
+		body = string(content)
+		if query.Get("fromSrc") == "https://example.com/missing.tar" {
+			w.Write([]byte(`{"errorDetail":{"message":"404 Not Found"},"error":"404 Not Found"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"sha256:1234"}`))
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://" + strings.TrimPrefix(daemon.URL, "http://")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "docker-image-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rootfs := path.Join(dir, "rootfs.tar")
+	ioutil.WriteFile(rootfs, []byte("rootfs-tarball"), 0644)
+
+	err = importImage(context.Background(), cli, map[string]interface{}{
+		"source":   rootfs,
+		"changes":  []interface{}{`CMD ["/bin/sh"]`, "ENV PATH=/bin"},
+		"message":  "imported",
+		"platform": "",
+	}, "foo:1.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if query.Get("fromSrc") != "-" || body != "rootfs-tarball" || query.Get("repo") != "foo:1.0" || query.Get("message") != "imported" {
+		t.Errorf("expected the tarball to be sent, got %v and %q", query, body)
+	}
+	if changes := query["changes"]; !reflect.DeepEqual(changes, []string{`CMD ["/bin/sh"]`, "ENV PATH=/bin"}) {
+		t.Errorf("expected the changes to be applied, got %v", changes)
+	}
+
+	err = importImage(context.Background(), cli, map[string]interface{}{
+		"source":   "https://example.com/missing.tar",
+		"changes":  []interface{}{},
+		"message":  "",
+		"platform": "",
+	}, "foo:1.0")
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") || body != "" {
+		t.Errorf("expected the daemon to download the URL and fail, got %v", err)
+	}
+}
+
+func TestBuildLogWriter(t *testing.T) {
+	logged := new(bytes.Buffer)
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(logged)
+
+	w := newBuildLogWriter("foo:1.0")
+	w.Write([]byte("Step 1/2 : FROM alpine\n Step 2/2"))
+	if strings.Contains(logged.String(), "Step 2/2") {
+		t.Errorf("expected incomplete lines not to be logged, got %q", logged.String())
+	}
+	w.Write([]byte(" : RUN true\n\n"))
+	w.Write([]byte("Successfully built"))
+	w.Flush()
+
+	expected := []string{
+		"[INFO] Building foo:1.0: Step 1/2 : FROM alpine",
+		"[INFO] Building foo:1.0:  Step 2/2 : RUN true",
+		"[INFO] Building foo:1.0: Successfully built",
+	}
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), lines)
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Errorf("expected line %q, got %q", expected[i], line)
+		}
+	}
+}
+
 func testAccDockerImageDestroy(s *terraform.State) error {
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "docker_image" {
@@ -223,6 +926,254 @@ func TestAccDockerImage_build(t *testing.T) {
 	})
 }
 
+func TestAccDockerImage_buildConfig(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileConfigExample), 0644)
+	defer os.Remove(dfPath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImageConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("docker_image.test", "labels.org.example.team", "platform"),
+					resource.TestCheckResourceAttr("docker_image.test", "entrypoint.#", "2"),
+					resource.TestCheckResourceAttr("docker_image.test", "entrypoint.0", "/bin/sh"),
+					resource.TestCheckResourceAttr("docker_image.test", "exposed_ports.#", "2"),
+					resource.TestCheckResourceAttr("docker_image.test", "exposed_ports.0", "53/udp"),
+					resource.TestCheckResourceAttr("docker_image.test", "exposed_ports.1", "8080/tcp"),
+					resource.TestCheckResourceAttr("docker_image.test", "env.1", "MODE=release"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildTriggers(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileExample), 0644)
+	defer os.Remove(dfPath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testCreateDockerImageTriggers, "1.0"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "build_output", regexp.MustCompile(`Step 1`)),
+				),
+			},
+			{
+				// the image is kept, so it is only present again if it was built
+				Config: fmt.Sprintf(testCreateDockerImageTriggers, "1.1"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "build_output", regexp.MustCompile(`Step 1`)),
+					resource.TestCheckResourceAttr("docker_image.test", "triggers.app_version", "1.1"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildCacheFrom(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileExample), 0644)
+	defer os.Remove(dfPath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImageCacheFrom,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+					resource.TestCheckResourceAttr("docker_image.test", "build.#", "1"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildPlatform(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileBuildkitExample), 0644)
+	defer os.Remove(dfPath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImagePlatform,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildPlatforms(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileBuildkitExample), 0644)
+	defer os.Remove(dfPath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImagePlatforms,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+					resource.TestMatchResourceAttr("docker_image.test", "build_output", regexp.MustCompile(`Building for platform linux/386`)),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildDockerfileContents(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImageDockerfileContents,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+					resource.TestMatchResourceAttr("docker_image.test", "build_output", regexp.MustCompile(`inline`)),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildRemoteContext(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImageRemoteContext,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildNetwork(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileExtraHostsExample), 0644)
+	defer os.Remove(dfPath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImageNetwork,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildOutput(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileBuildkitExample), 0644)
+	defer os.Remove(dfPath)
+	outputDir, err := ioutil.TempDir("", "tf-test-build-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outputDir)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testCreateDockerImageOutput, outputDir),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+					func(*terraform.State) error {
+						if _, err := os.Stat(path.Join(outputDir, "rootfs", "etc", "alpine-release")); err != nil {
+							return fmt.Errorf("expected the files of the image to be exported: %s", err)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildBuildkit(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileBuildkitExample), 0644)
+	defer os.Remove(dfPath)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testCreateDockerImageBuildkit,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+					resource.TestMatchResourceAttr("docker_image.test", "build_output", regexp.MustCompile(`RUN --mount=type=cache`)),
+					resource.TestMatchResourceAttr("docker_image.test", "build_output", regexp.MustCompile(`\[\+\] Building [0-9.]+s \([0-9]+/[0-9]+\) FINISHED`)),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDockerImage_buildSecrets(t *testing.T) {
+	wd, _ := os.Getwd()
+	dfPath := path.Join(wd, "Dockerfile")
+	ioutil.WriteFile(dfPath, []byte(testDockerFileSecretsExample), 0644)
+	defer os.Remove(dfPath)
+	os.Setenv("TF_DOCKER_TEST_BUILD_SECRET", "s3cr3t")
+	defer os.Unsetenv("TF_DOCKER_TEST_BUILD_SECRET")
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerImageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config:      testCreateDockerImageSecretsWithoutBuildkit,
+				ExpectError: regexp.MustCompile(`Build secrets require builder_version 2`),
+			},
+			{
+				Config: testCreateDockerImageSecrets,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("docker_image.test", "image_id", contentDigestRegexp),
+					resource.TestCheckResourceAttr("docker_image.test", "build.#", "1"),
+				),
+			},
+		},
+	})
+}
+
 const testAccDockerImageConfig = `
 resource "docker_image" "foo" {
 	name = "alpine:3.1"
@@ -262,6 +1213,14 @@ resource "docker_image" "foobarbazoo" {
 }
 `
 
+const testAccDockerImagePullTriggersKeepLocallyConfig = `
+resource "docker_image" "foobarbazoo" {
+	name = "alpine:3.1"
+	keep_locally = true
+	pull_triggers = ["%s"]
+}
+`
+
 const testAccDockerImageFromDataPrivateConfig = `
 provider "docker" {
 	alias = "private"
@@ -281,6 +1240,21 @@ resource "docker_image" "foo_private" {
 }
 `
 
+const testAccDockerImagePushTargetsConfig = `
+provider "docker" {
+	alias = "private"
+	registry_auth {
+		address = "%s"
+		config_file = "%s"
+	}
+}
+resource "docker_image" "foo_private" {
+	provider = "docker.private"
+	name = "%s"
+	push_targets = ["%s"]
+}
+`
+
 const testAccDockerImageFromDataPrivateConfigFile = `
 provider "docker" {
 	alias = "private"
@@ -333,6 +1307,192 @@ resource "docker_image" "test" {
   }  
 `
 
+const testCreateDockerImageNetwork = `
+resource "docker_image" "test" {
+	name = "tf-test-network:latest"
+	build {
+	  path          = "."
+	  dockerfile    = "Dockerfile"
+	  network_mode  = "host"
+	  extra_hosts   = ["mirror.internal:10.0.0.1"]
+	  memory        = 268435456
+	  cpu_shares    = 512
+	  shm_size      = 67108864
+	  isolation     = "default"
+	  cgroup_parent = "/tftest"
+	  pull_parent   = true
+	}
+}
+`
+
+const testDockerFileExtraHostsExample = `
+FROM alpine:3.11
+
+RUN grep "10.0.0.1.*mirror.internal" /etc/hosts
+`
+
+const testCreateDockerImageCacheFrom = `
+resource "docker_image" "cache" {
+	name = "python:3-stretch"
+}
+
+resource "docker_image" "test" {
+	name = "tf-test-cache-from:latest"
+	build {
+	  path       = "."
+	  dockerfile = "Dockerfile"
+	  cache_from = [docker_image.cache.name]
+	}
+}
+`
+
+const testCreateDockerImageTriggers = `
+resource "docker_image" "test" {
+	name         = "tf-test-triggers:latest"
+	keep_locally = true
+	triggers = {
+	  app_version = "%s"
+	}
+	build {
+	  path       = "."
+	  dockerfile = "Dockerfile"
+	}
+}
+`
+
+const testDockerFileConfigExample = `
+FROM alpine:3.11
+LABEL org.example.team=platform
+ENV MODE=release
+EXPOSE 8080 53/udp
+ENTRYPOINT ["/bin/sh", "-c"]
+`
+
+const testCreateDockerImageConfig = `
+resource "docker_image" "test" {
+	name = "tf-test-config:latest"
+	build {
+	  path       = "."
+	  dockerfile = "Dockerfile"
+	}
+}
+`
+
+const testCreateDockerImagePlatform = `
+resource "docker_image" "test" {
+	name = "tf-test-platform:latest"
+	build {
+	  path            = "."
+	  dockerfile      = "Dockerfile"
+	  builder_version = "2"
+	  platform        = "linux/amd64"
+	}
+}
+`
+
+const testCreateDockerImagePlatforms = `
+resource "docker_image" "test" {
+	name = "tf-test-platforms:latest"
+	build {
+	  path            = "."
+	  dockerfile      = "Dockerfile"
+	  builder_version = "2"
+	  platforms       = ["linux/amd64", "linux/386"]
+	}
+}
+`
+
+const testCreateDockerImageDockerfileContents = `
+resource "docker_image" "test" {
+	name = "tf-test-dockerfile-contents:latest"
+	build {
+	  path                = "."
+	  dockerfile_contents = <<-EOT
+	    FROM alpine:3.11
+	    RUN echo inline
+	  EOT
+	}
+}
+`
+
+const testCreateDockerImageRemoteContext = `
+resource "docker_image" "test" {
+	name = "tf-test-remote-context:latest"
+	build {
+	  path = "https://github.com/docker-library/hello-world.git#master:amd64/hello-world"
+	}
+}
+`
+
+const testCreateDockerImageOutput = `
+resource "docker_image" "test" {
+	name = "tf-test-output:latest"
+	build {
+	  path            = "."
+	  dockerfile      = "Dockerfile"
+	  builder_version = "2"
+	  output {
+	    type = "local"
+	    dest = "%s/rootfs"
+	  }
+	}
+}
+`
+
+const testCreateDockerImageBuildkit = `
+resource "docker_image" "test" {
+	name = "tf-test-buildkit:latest"
+	build {
+	  path            = "."
+	  dockerfile      = "Dockerfile"
+	  builder_version = "2"
+	  cache_to        = "inline"
+	  progress        = "tty"
+	}
+}
+`
+
+const testCreateDockerImageSecretsWithoutBuildkit = `
+resource "docker_image" "test" {
+	name = "tf-test-secrets:latest"
+	build {
+	  path       = "."
+	  dockerfile = "Dockerfile"
+	  secrets {
+	    id  = "token"
+	    env = "TF_DOCKER_TEST_BUILD_SECRET"
+	  }
+	}
+}
+`
+
+const testCreateDockerImageSecrets = `
+resource "docker_image" "test" {
+	name = "tf-test-secrets:latest"
+	build {
+	  path            = "."
+	  dockerfile      = "Dockerfile"
+	  builder_version = "2"
+	  secrets {
+	    id  = "token"
+	    env = "TF_DOCKER_TEST_BUILD_SECRET"
+	  }
+	}
+}
+`
+
+const testDockerFileSecretsExample = `# syntax = docker/dockerfile:1.2
+FROM alpine:3.11
+
+RUN --mount=type=secret,id=token test "$(cat /run/secrets/token)" = "s3cr3t"
+`
+
+const testDockerFileBuildkitExample = `# syntax = docker/dockerfile:1.2
+FROM alpine:3.11
+
+RUN --mount=type=cache,target=/var/cache/apk apk add --update curl
+`
+
 const testDockerFileExample = `
 FROM python:3-stretch
 
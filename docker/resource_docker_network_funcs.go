@@ -19,9 +19,7 @@ func resourceDockerNetworkCreate(d *schema.ResourceData, meta interface{}) error
 	client := meta.(*ProviderConfig).DockerClient
 
 	createOpts := types.NetworkCreate{}
-	if v, ok := d.GetOk("labels"); ok {
-		createOpts.Labels = labelSetToMap(v.(*schema.Set))
-	}
+	createOpts.Labels = withDefaultLabels(meta, labelSetToMap(d.Get("labels").(*schema.Set)))
 	if v, ok := d.GetOk("check_duplicate"); ok {
 		createOpts.CheckDuplicate = v.(bool)
 	}
@@ -59,10 +57,13 @@ func resourceDockerNetworkCreate(d *schema.ResourceData, meta interface{}) error
 		createOpts.IPAM = ipamOpts
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
+
 	retNetwork := types.NetworkCreateResponse{}
-	retNetwork, err := client.NetworkCreate(context.Background(), d.Get("name").(string), createOpts)
+	retNetwork, err := client.NetworkCreate(ctx, d.Get("name").(string), createOpts)
 	if err != nil {
-		return fmt.Errorf("Unable to create network: %s", err)
+		return classifyError(fmt.Errorf("Unable to create network: %s", err), "name")
 	}
 
 	d.SetId(retNetwork.ID)
@@ -92,13 +93,13 @@ func resourceDockerNetworkRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceDockerNetworkDelete(d *schema.ResourceData, meta interface{}) error {
-	log.Printf("[INFO] Waiting for network: '%s' to be removed: max '%v seconds'", d.Id(), 30)
+	log.Printf("[INFO] Waiting for network: '%s' to be removed: max '%v'", d.Id(), d.Timeout(schema.TimeoutDelete))
 
 	stateConf := &resource.StateChangeConf{
 		Pending:    []string{"pending"},
 		Target:     []string{"removed"},
 		Refresh:    resourceDockerNetworkRemoveRefreshFunc(d, meta),
-		Timeout:    30 * time.Second,
+		Timeout:    d.Timeout(schema.TimeoutDelete),
 		MinTimeout: 5 * time.Second,
 		Delay:      2 * time.Second,
 	}
@@ -153,7 +154,7 @@ func resourceDockerNetworkReadRefreshFunc(
 		log.Printf("[DEBUG] Docker network inspect: %s", jsonObj)
 
 		d.Set("name", retNetwork.Name)
-		d.Set("labels", mapToLabelSet(retNetwork.Labels))
+		d.Set("labels", mapToLabelSet(withoutDefaultLabels(meta, retNetwork.Labels, labelSetToMap(d.Get("labels").(*schema.Set)))))
 		d.Set("driver", retNetwork.Driver)
 		d.Set("internal", retNetwork.Internal)
 		d.Set("attachable", retNetwork.Attachable)
@@ -2,6 +2,7 @@ package docker
 
 import (
 	"os"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 )
@@ -13,6 +14,10 @@ func resourceDockerRegistryImage() *schema.Resource {
 		Delete: resourceDockerRegistryImageDelete,
 		Update: resourceDockerRegistryImageUpdate,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -20,6 +25,18 @@ func resourceDockerRegistryImage() *schema.Resource {
 				ForceNew: true,
 			},
 
+			"registry_auth": resourceRegistryAuthSchema,
+
+			"timings": timingsSchema,
+
+			"push_verification_timeout": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1m",
+				ValidateFunc: validateDurationGeq0(),
+				Description:  "Time to wait for the pushed manifest to be available in the registry (ms|s|m|h)",
+			},
+
 			"keep_remotely": {
 				Type:     schema.TypeBool,
 				Optional: true,
@@ -164,16 +181,19 @@ func resourceDockerRegistryImage() *schema.Resource {
 										Required: true,
 									},
 									"user_name": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:      schema.TypeString,
+										Optional:  true,
+										Sensitive: true,
 									},
 									"password": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:      schema.TypeString,
+										Optional:  true,
+										Sensitive: true,
 									},
 									"auth": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:      schema.TypeString,
+										Optional:  true,
+										Sensitive: true,
 									},
 									"email": &schema.Schema{
 										Type:     schema.TypeString,
@@ -184,12 +204,14 @@ func resourceDockerRegistryImage() *schema.Resource {
 										Optional: true,
 									},
 									"identity_token": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:      schema.TypeString,
+										Optional:  true,
+										Sensitive: true,
 									},
 									"registry_token": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:      schema.TypeString,
+										Optional:  true,
+										Sensitive: true,
 									},
 								},
 							},
@@ -5,7 +5,6 @@ import (
 	"bufio"
 	"context"
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -17,13 +16,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-units"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 )
 
@@ -123,7 +123,7 @@ func createImageBuildOptions(buildOptions map[string]interface{}) types.ImageBui
 	return buildImageOptions
 }
 
-func buildDockerRegistryImage(client *client.Client, buildOptions map[string]interface{}, fqName string) error {
+func buildDockerRegistryImage(ctx context.Context, client *client.Client, operations *operationLimit, buildOptions map[string]interface{}, fqName string, contextSizeWarningThreshold int64) error {
 
 	type ErrorDetailMessage struct {
 		Code    int    `json:"code,omitempty"`
@@ -131,11 +131,14 @@ func buildDockerRegistryImage(client *client.Client, buildOptions map[string]int
 	}
 
 	type BuildImageResponseMessage struct {
+		Stream      string              `json:"stream,omitempty"`
 		Error       string              `json:"error,omitempty"`
 		ErrorDetail *ErrorDetailMessage `json:"errorDetail,omitempty"`
 	}
 
 	getError := func(body io.ReadCloser) error {
+		progress := newBuildLogWriter(fqName)
+		defer progress.Flush()
 		dec := json.NewDecoder(body)
 		for {
 			message := BuildImageResponseMessage{}
@@ -145,6 +148,7 @@ func buildDockerRegistryImage(client *client.Client, buildOptions map[string]int
 				}
 				return err
 			}
+			progress.Write([]byte(message.Stream))
 			if message.ErrorDetail != nil {
 				detail := message.ErrorDetail
 				return fmt.Errorf("%v: %s", detail.Code, detail.Message)
@@ -171,9 +175,36 @@ func buildDockerRegistryImage(client *client.Client, buildOptions map[string]int
 	}
 	defer os.Remove(dockerContextTarPath)
 	dockerBuildContext, err := os.Open(dockerContextTarPath)
+	if err != nil {
+		return fmt.Errorf("Unable to build context %v", err)
+	}
 	defer dockerBuildContext.Close()
+	contextInfo, err := dockerBuildContext.Stat()
+	if err != nil {
+		return fmt.Errorf("Unable to build context %v", err)
+	}
+	warnOnLargeBuildContext(buildContext, contextInfo.Size(), contextSizeWarningThreshold)
+
+	// BuildKit requires a session, unless one is given
+	if imageBuildOptions.Version == types.BuilderBuildKit && imageBuildOptions.SessionID == "" {
+		session, err := newBuildSession(buildContext)
+		if err != nil {
+			return err
+		}
+		if err := session.start(ctx, client); err != nil {
+			return err
+		}
+		defer session.close()
+		imageBuildOptions.SessionID = session.id
+	}
+
+	release, err := operations.acquire(ctx, "build of "+fqName)
+	if err != nil {
+		return err
+	}
+	defer release()
 
-	buildResponse, err := client.ImageBuild(context.Background(), dockerBuildContext, imageBuildOptions)
+	buildResponse, err := client.ImageBuild(ctx, newProgressReader(dockerBuildContext, buildContext, contextInfo.Size()), imageBuildOptions)
 	if err != nil {
 		return err
 	}
@@ -188,6 +219,11 @@ func buildDockerRegistryImage(client *client.Client, buildOptions map[string]int
 }
 
 func buildDockerImageContextTar(buildContext string) (string, error) {
+	buildContext, err := filepath.Abs(buildContext)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read build context - %v", err.Error())
+	}
+
 	// Create our Temp File:  This will create a filename like /tmp/terraform-provider-docker-123456.tar
 	tmpFile, err := ioutil.TempFile(os.TempDir(), "terraform-provider-docker-*.tar")
 	if err != nil {
@@ -197,6 +233,7 @@ func buildDockerImageContextTar(buildContext string) (string, error) {
 	defer tmpFile.Close()
 
 	if _, err = os.Stat(buildContext); err != nil {
+		os.Remove(tmpFile.Name())
 		return "", fmt.Errorf("Unable to read build context - %v", err.Error())
 	}
 
@@ -210,8 +247,14 @@ func buildDockerImageContextTar(buildContext string) (string, error) {
 			return err
 		}
 
+		// sockets and devices are skipped, symlinks are stored with their target
+		link, skip, err := checkBuildContextEntry(buildContext, file, info)
+		if err != nil || skip {
+			return err
+		}
+
 		// create a new dir/file header
-		header, err := tar.FileInfoHeader(info, info.Name())
+		header, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return err
 		}
@@ -237,6 +280,7 @@ func buildDockerImageContextTar(buildContext string) (string, error) {
 
 		// copy file data into tar writer
 		if _, err := io.Copy(tw, f); err != nil {
+			f.Close()
 			return err
 		}
 
@@ -247,22 +291,30 @@ func buildDockerImageContextTar(buildContext string) (string, error) {
 		return nil
 
 	})
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("Unable to read build context - %v", err.Error())
+	}
 
 	return tmpFile.Name(), nil
 }
 
 func getDockerImageContextTarHash(dockerContextTarPath string) (string, error) {
 	hasher := sha256.New()
-	s, err := ioutil.ReadFile(dockerContextTarPath)
+	f, err := os.Open(dockerContextTarPath)
 	if err != nil {
 		return "", err
 	}
-	hasher.Write(s)
+	defer f.Close()
+	// the tar is streamed as contexts can be bigger than the available memory
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
 	contextHash := hex.EncodeToString(hasher.Sum(nil))
 	return contextHash, nil
 }
 
-func pushDockerRegistryImage(client *client.Client, pushOpts internalImageOptions, username string, password string) error {
+func pushDockerRegistryImage(ctx context.Context, client *client.Client, operations *operationLimit, pushOpts internalImageOptions, username string, password string) error {
 	pushOptions := types.ImagePushOptions{}
 	if username != "" {
 		auth := types.AuthConfig{Username: username, Password: password}
@@ -274,7 +326,13 @@ func pushDockerRegistryImage(client *client.Client, pushOpts internalImageOption
 		pushOptions.RegistryAuth = authBase64
 	}
 
-	out, err := client.ImagePush(context.Background(), pushOpts.FqName, pushOptions)
+	release, err := operations.acquire(ctx, "push of "+pushOpts.FqName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	out, err := client.ImagePush(ctx, pushOpts.FqName, pushOptions)
 	if err != nil {
 		return err
 	}
@@ -301,32 +359,13 @@ func pushDockerRegistryImage(client *client.Client, pushOpts internalImageOption
 
 func getDockerRegistryImageRegistryUserNameAndPassword(
 	pushOpts internalImageOptions,
-	providerConfig *ProviderConfig) (string, string) {
-	registry := pushOpts.NormalizedRegistry
-	username := ""
-	password := ""
-	if authConfig, ok := providerConfig.AuthConfigs.Configs[registry]; ok {
-		username = authConfig.Username
-		password = authConfig.Password
-	}
-	return username, password
+	authConfigs *AuthConfigs) (string, string, error) {
+	authConfig, err := registryAuthConfig(authConfigs, pushOpts.Registry)
+	return authConfig.Username, authConfig.Password, err
 }
 
-func deleteDockerRegistryImage(pushOpts internalImageOptions, sha256Digest, username, password string, fallback bool) error {
-	client := http.DefaultClient
-
-	// Allow insecure registries only for ACC tests
-	// cuz we don't have a valid certs for this case
-	if env, okEnv := os.LookupEnv("TF_ACC"); okEnv {
-		if i, errConv := strconv.Atoi(env); errConv == nil && i >= 1 {
-			cfg := &tls.Config{
-				InsecureSkipVerify: true,
-			}
-			client.Transport = &http.Transport{
-				TLSClientConfig: cfg,
-			}
-		}
-	}
+func deleteDockerRegistryImage(transports *registryTransports, pushOpts internalImageOptions, sha256Digest, username, password string, fallback bool) error {
+	client := registryHTTPClient(transports, pushOpts.Registry)
 
 	req, err := http.NewRequest("DELETE", pushOpts.NormalizedRegistry+"/v2/"+pushOpts.Repository+"/manifests/"+sha256Digest, nil)
 	if err != nil {
@@ -412,10 +451,10 @@ func deleteDockerRegistryImage(pushOpts internalImageOptions, sha256Digest, user
 	}
 }
 
-func getImageDigestWithFallback(opts internalImageOptions, username, password string) (string, error) {
-	digest, err := getImageDigest(opts.Registry, opts.Repository, opts.Tag, username, password, false)
+func getImageDigestWithFallback(transports *registryTransports, opts internalImageOptions, username, password string) (string, error) {
+	digest, err := getImageDigest(transports, opts.Registry, opts.Repository, opts.Tag, username, password, false)
 	if err != nil {
-		digest, err = getImageDigest(opts.Registry, opts.Repository, opts.Tag, username, password, true)
+		digest, err = getImageDigest(transports, opts.Registry, opts.Repository, opts.Tag, username, password, true)
 		if err != nil {
 			return "", fmt.Errorf("Unable to get digest: %s", err)
 		}
@@ -423,6 +462,45 @@ func getImageDigestWithFallback(opts internalImageOptions, username, password st
 	return digest, nil
 }
 
+// imageDigestPollInterval is the interval the registry is polled in for a
+// pushed manifest
+var imageDigestPollInterval = 2 * time.Second
+
+// waitForImageDigest polls the registry until the manifest of the pushed image
+// is available, as eventually consistent registries may not serve it right
+// after the push. If expectedDigest is given, the registry has to return it.
+func waitForImageDigest(transports *registryTransports, opts internalImageOptions, username, password, expectedDigest string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return getImageDigestWithFallback(transports, opts, username, password)
+	}
+
+	log.Printf("[INFO] Waiting for image '%s' to be available in the registry: max '%v'", opts.FqName, timeout)
+	stateConf := &resource.StateChangeConf{
+		Pending: []string{"pending"},
+		Target:  []string{"available"},
+		Refresh: func() (interface{}, string, error) {
+			digest, err := getImageDigestWithFallback(transports, opts, username, password)
+			if err != nil {
+				log.Printf("[DEBUG] Image '%s' not yet available: %s", opts.FqName, err)
+				return "", "pending", nil
+			}
+			if expectedDigest != "" && digest != expectedDigest {
+				log.Printf("[DEBUG] Registry still serves digest %s for '%s' instead of %s", digest, opts.FqName, expectedDigest)
+				return "", "pending", nil
+			}
+			return digest, "available", nil
+		},
+		Timeout:      timeout,
+		PollInterval: imageDigestPollInterval,
+	}
+
+	digest, err := stateConf.WaitForState()
+	if err != nil {
+		return "", fmt.Errorf("Image %s is not available in the registry after %v: %s", opts.FqName, timeout, err)
+	}
+	return digest.(string), nil
+}
+
 func createPushImageOptions(image string) internalImageOptions {
 	pullOpts := parseImageOptions(image)
 	if pullOpts.Registry == "" {
@@ -443,26 +521,47 @@ func createPushImageOptions(image string) internalImageOptions {
 
 func resourceDockerRegistryImageCreate(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
-	providerConfig := meta.(*ProviderConfig)
+	ctx, cancel := context.WithTimeout(context.Background(), resourceTimeout(d, meta, schema.TimeoutCreate, "build", "push"))
+	defer cancel()
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return err
+	}
 	name := d.Get("name").(string)
 	log.Printf("[DEBUG] Creating docker image %s", name)
 
 	pushOpts := createPushImageOptions(name)
+	timings := meta.(*ProviderConfig).TimingReport.timingsFor("docker_registry_image", name)
 
 	if buildOptions, ok := d.GetOk("build"); ok {
 		buildOptionsMap := buildOptions.([]interface{})[0].(map[string]interface{})
-		err := buildDockerRegistryImage(client, buildOptionsMap, pushOpts.FqName)
+		buildStart := time.Now()
+		buildCtx, cancelBuild := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "build")
+		defer cancelBuild()
+		err := buildDockerRegistryImage(buildCtx, client, meta.(*ProviderConfig).Operations, withDefaultBuildLabels(meta, buildOptionsMap, "labels"), pushOpts.FqName, meta.(*ProviderConfig).ContextSizeWarningThreshold)
 		if err != nil {
-			return fmt.Errorf("Error building docker image: %s", err)
+			return classifyError(fmt.Errorf("Error building docker image: %s", err), "build")
 		}
+		timings.record("build", buildStart)
 	}
 
-	username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
-	if err := pushDockerRegistryImage(client, pushOpts, username, password); err != nil {
-		return fmt.Errorf("Error pushing docker image: %s", err)
+	username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+	if err != nil {
+		return err
+	}
+	pushStart := time.Now()
+	pushCtx, cancelPush := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "push")
+	defer cancelPush()
+	if err := meta.(*ProviderConfig).RegistryRetries.do(pushCtx, "push of "+pushOpts.FqName, func() error {
+		return pushDockerRegistryImage(pushCtx, client, meta.(*ProviderConfig).Operations, pushOpts, username, password)
+	}); err != nil {
+		return classifyError(fmt.Errorf("Error pushing docker image: %s", err), "name")
 	}
+	timings.record("push", pushStart)
+	d.Set("timings", timings.flatten())
 
-	digest, err := getImageDigestWithFallback(pushOpts, username, password)
+	verificationTimeout, _ := time.ParseDuration(d.Get("push_verification_timeout").(string))
+	digest, err := waitForImageDigest(authConfigs.transports, pushOpts, username, password, "", verificationTimeout)
 	if err != nil {
 		return fmt.Errorf("Unable to create image, image not found: %s", err)
 	}
@@ -472,11 +571,17 @@ func resourceDockerRegistryImageCreate(d *schema.ResourceData, meta interface{})
 }
 
 func resourceDockerRegistryImageRead(d *schema.ResourceData, meta interface{}) error {
-	providerConfig := meta.(*ProviderConfig)
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return err
+	}
 	name := d.Get("name").(string)
 	pushOpts := createPushImageOptions(name)
-	username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
-	digest, err := getImageDigestWithFallback(pushOpts, username, password)
+	username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+	if err != nil {
+		return err
+	}
+	digest, err := getImageDigestWithFallback(authConfigs.transports, pushOpts, username, password)
 	if err != nil {
 		log.Printf("Got error getting registry image digest: %s", err)
 		d.SetId("")
@@ -490,14 +595,20 @@ func resourceDockerRegistryImageDelete(d *schema.ResourceData, meta interface{})
 	if d.Get("keep_remotely").(bool) {
 		return nil
 	}
-	providerConfig := meta.(*ProviderConfig)
+	authConfigs, err := resourceAuthConfigs(d, meta)
+	if err != nil {
+		return err
+	}
 	name := d.Get("name").(string)
 	pushOpts := createPushImageOptions(name)
-	username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
+	username, password, err := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, authConfigs)
+	if err != nil {
+		return err
+	}
 	digest := d.Get("sha256_digest").(string)
-	err := deleteDockerRegistryImage(pushOpts, digest, username, password, false)
+	err = deleteDockerRegistryImage(authConfigs.transports, pushOpts, digest, username, password, false)
 	if err != nil {
-		err = deleteDockerRegistryImage(pushOpts, pushOpts.Tag, username, password, true)
+		err = deleteDockerRegistryImage(authConfigs.transports, pushOpts, pushOpts.Tag, username, password, true)
 		if err != nil {
 			return fmt.Errorf("Got error getting registry image digest: %s", err)
 		}
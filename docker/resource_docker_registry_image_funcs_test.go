@@ -2,9 +2,14 @@ package docker
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -14,6 +19,54 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
 )
 
+func TestWaitForImageDigest(t *testing.T) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case requests <= 2:
+			// the manifest is not yet replicated
+			w.WriteHeader(http.StatusNotFound)
+		case requests <= 4:
+			// the old manifest is still served
+			w.Header().Set("Docker-Content-Digest", "sha256:1111")
+		default:
+			w.Header().Set("Docker-Content-Digest", "sha256:2222")
+		}
+	}))
+	defer server.Close()
+
+	// the registry digest lookup only skips the certificate check for ACC tests
+	defaultTransport := http.DefaultClient.Transport
+	defer func() { http.DefaultClient.Transport = defaultTransport }()
+	tfAcc, tfAccSet := os.LookupEnv("TF_ACC")
+	os.Setenv("TF_ACC", "1")
+	defer func() {
+		if tfAccSet {
+			os.Setenv("TF_ACC", tfAcc)
+		} else {
+			os.Unsetenv("TF_ACC")
+		}
+	}()
+
+	defer func(interval time.Duration) { imageDigestPollInterval = interval }(imageDigestPollInterval)
+	imageDigestPollInterval = 10 * time.Millisecond
+
+	opts := createPushImageOptions(strings.TrimPrefix(server.URL, "https://") + "/foo:1.0")
+	digest, err := waitForImageDigest(nil, opts, "", "", "sha256:2222", 30*time.Second)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if digest != "sha256:2222" {
+		t.Errorf("expected digest sha256:2222, got %s", digest)
+	}
+
+	_, err = waitForImageDigest(nil, opts, "", "", "sha256:3333", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "is not available in the registry") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
 func TestAccDockerRegistryImageResource_mapping(t *testing.T) {
 
 	assert := func(condition bool, msg string) {
@@ -157,8 +210,8 @@ func TestAccDockerRegistryImageResource_pushMissingImage(t *testing.T) {
 func testDockerRegistryImageNotInRegistry(pushOpts internalImageOptions) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		providerConfig := testAccProvider.Meta().(*ProviderConfig)
-		username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
-		digest, _ := getImageDigestWithFallback(pushOpts, username, password)
+		username, password, _ := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig.AuthConfigs)
+		digest, _ := getImageDigestWithFallback(providerConfig.AuthConfigs.transports, pushOpts, username, password)
 		if digest != "" {
 			return fmt.Errorf("image found")
 		}
@@ -169,13 +222,13 @@ func testDockerRegistryImageNotInRegistry(pushOpts internalImageOptions) resourc
 func testDockerRegistryImageInRegistry(pushOpts internalImageOptions, cleanup bool) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		providerConfig := testAccProvider.Meta().(*ProviderConfig)
-		username, password := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig)
-		digest, err := getImageDigestWithFallback(pushOpts, username, password)
+		username, password, _ := getDockerRegistryImageRegistryUserNameAndPassword(pushOpts, providerConfig.AuthConfigs)
+		digest, err := getImageDigestWithFallback(providerConfig.AuthConfigs.transports, pushOpts, username, password)
 		if err != nil || len(digest) < 1 {
 			return fmt.Errorf("image not found")
 		}
 		if cleanup {
-			err := deleteDockerRegistryImage(pushOpts, digest, username, password, false)
+			err := deleteDockerRegistryImage(providerConfig.AuthConfigs.transports, pushOpts, digest, username, password, false)
 			if err != nil {
 				return fmt.Errorf("Unable to remove test image. %s", err)
 			}
@@ -84,6 +84,9 @@ func resourceDockerSecretV0() *schema.Resource {
 }
 
 func resourceDockerSecretCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := requireDockerEngine(meta, "docker_secret, a Swarm secret,"); err != nil {
+		return err
+	}
 	client := meta.(*ProviderConfig).DockerClient
 	data, _ := base64.StdEncoding.DecodeString(d.Get("data").(string))
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 )
@@ -21,6 +22,12 @@ func resourceDockerService() *schema.Resource {
 			State: schema.ImportStatePassthrough,
 		},
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"auth": {
 				Type:     schema.TypeMap,
@@ -38,6 +45,7 @@ func resourceDockerService() *schema.Resource {
 							Optional:    true,
 							ForceNew:    true,
 							DefaultFunc: schema.EnvDefaultFunc("DOCKER_REGISTRY_USER", ""),
+							Sensitive:   true,
 						},
 						"password": {
 							Type:        schema.TypeString,
@@ -977,6 +985,7 @@ func resourceDockerServiceV0() *schema.Resource {
 							Optional:    true,
 							ForceNew:    true,
 							DefaultFunc: schema.EnvDefaultFunc("DOCKER_REGISTRY_USER", ""),
+							Sensitive:   true,
 						},
 						"password": {
 							Type:        schema.TypeString,
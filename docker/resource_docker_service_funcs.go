@@ -49,6 +49,9 @@ func resourceDockerServiceExists(d *schema.ResourceData, meta interface{}) (bool
 }
 
 func resourceDockerServiceCreate(d *schema.ResourceData, meta interface{}) error {
+	if err := requireDockerEngine(meta, "docker_service, a Swarm service,"); err != nil {
+		return err
+	}
 	var err error
 	client := meta.(*ProviderConfig).DockerClient
 
@@ -61,11 +64,14 @@ func resourceDockerServiceCreate(d *schema.ResourceData, meta interface{}) error
 	marshalledAuth := retrieveAndMarshalAuth(d, meta, "create")
 	serviceOptions.EncodedRegistryAuth = base64.URLEncoding.EncodeToString(marshalledAuth)
 	serviceOptions.QueryRegistry = true
-	log.Printf("[DEBUG] Passing registry auth '%s'", serviceOptions.EncodedRegistryAuth)
+	log.Printf("[DEBUG] Passing registry auth for service '%s'", serviceSpec.Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
 
-	service, err := client.ServiceCreate(context.Background(), serviceSpec, serviceOptions)
+	service, err := client.ServiceCreate(ctx, serviceSpec, serviceOptions)
 	if err != nil {
-		return err
+		return classifyError(err, "name")
 	}
 	if v, ok := d.GetOk("converge_config"); ok {
 		convergeConfig := createConvergeConfig(v.([]interface{}))
@@ -84,7 +90,7 @@ func resourceDockerServiceCreate(d *schema.ResourceData, meta interface{}) error
 		_, err := stateConf.WaitForState()
 		if err != nil {
 			// the service will be deleted in case it cannot be converged
-			if deleteErr := deleteService(service.ID, d, client); deleteErr != nil {
+			if deleteErr := deleteService(ctx, service.ID, d, client); deleteErr != nil {
 				return deleteErr
 			}
 			if strings.Contains(err.Error(), "timeout while waiting for state") {
@@ -183,7 +189,10 @@ func resourceDockerServiceReadRefreshFunc(
 func resourceDockerServiceUpdate(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
 
-	service, _, err := client.ServiceInspectWithRaw(context.Background(), d.Id(), types.ServiceInspectOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	service, _, err := client.ServiceInspectWithRaw(ctx, d.Id(), types.ServiceInspectOptions{})
 	if err != nil {
 		return err
 	}
@@ -200,7 +209,7 @@ func resourceDockerServiceUpdate(d *schema.ResourceData, meta interface{}) error
 	}
 	updateOptions.EncodedRegistryAuth = base64.URLEncoding.EncodeToString(marshalledAuth)
 
-	updateResponse, err := client.ServiceUpdate(context.Background(), d.Id(), service.Version, serviceSpec, updateOptions)
+	updateResponse, err := client.ServiceUpdate(ctx, d.Id(), service.Version, serviceSpec, updateOptions)
 	if err != nil {
 		return err
 	}
@@ -238,7 +247,10 @@ func resourceDockerServiceUpdate(d *schema.ResourceData, meta interface{}) error
 func resourceDockerServiceDelete(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
 
-	if err := deleteService(d.Id(), d, client); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
+	if err := deleteService(ctx, d.Id(), d, client); err != nil {
 		return err
 	}
 
@@ -267,20 +279,20 @@ func fetchDockerService(ID string, name string, client *client.Client) (*swarm.S
 }
 
 // deleteService deletes the service with the given id
-func deleteService(serviceID string, d *schema.ResourceData, client *client.Client) error {
+func deleteService(ctx context.Context, serviceID string, d *schema.ResourceData, client *client.Client) error {
 	// get containerIDs of the running service because they do not exist after the service is deleted
 	serviceContainerIds := make([]string, 0)
 	if _, ok := d.GetOk("task_spec.0.container_spec.0.stop_grace_period"); ok {
 		filters := filters.NewArgs()
 		filters.Add("service", d.Get("name").(string))
-		tasks, err := client.TaskList(context.Background(), types.TaskListOptions{
+		tasks, err := client.TaskList(ctx, types.TaskListOptions{
 			Filters: filters,
 		})
 		if err != nil {
 			return err
 		}
 		for _, t := range tasks {
-			task, _, _ := client.TaskInspectWithRaw(context.Background(), t.ID)
+			task, _, _ := client.TaskInspectWithRaw(ctx, t.ID)
 			containerID := ""
 			if task.Status.ContainerStatus != nil {
 				containerID = task.Status.ContainerStatus.ContainerID
@@ -294,7 +306,7 @@ func deleteService(serviceID string, d *schema.ResourceData, client *client.Clie
 
 	// delete the service
 	log.Printf("[INFO] Deleting service: '%s'", serviceID)
-	if err := client.ServiceRemove(context.Background(), serviceID); err != nil {
+	if err := client.ServiceRemove(ctx, serviceID); err != nil {
 		return fmt.Errorf("Error deleting service %s: %s", serviceID, err)
 	}
 
@@ -303,10 +315,10 @@ func deleteService(serviceID string, d *schema.ResourceData, client *client.Clie
 		for _, containerID := range serviceContainerIds {
 			destroyGraceSeconds, _ := time.ParseDuration(v.(string))
 			log.Printf("[INFO] Waiting for container: '%s' to exit: max %v", containerID, destroyGraceSeconds)
-			ctx, cancel := context.WithTimeout(context.Background(), destroyGraceSeconds)
+			waitCtx, cancel := context.WithTimeout(ctx, destroyGraceSeconds)
 			// TODO why defer? see container_resource with handling return channels! why not remove then wait?
 			defer cancel()
-			exitCode, _ := client.ContainerWait(ctx, containerID, container.WaitConditionRemoved)
+			exitCode, _ := client.ContainerWait(waitCtx, containerID, container.WaitConditionRemoved)
 			log.Printf("[INFO] Container exited with code [%v]: '%s'", exitCode, containerID)
 
 			removeOpts := types.ContainerRemoveOptions{
@@ -315,7 +327,7 @@ func deleteService(serviceID string, d *schema.ResourceData, client *client.Clie
 			}
 
 			log.Printf("[INFO] Removing container: '%s'", containerID)
-			if err := client.ContainerRemove(context.Background(), containerID, removeOpts); err != nil {
+			if err := client.ContainerRemove(ctx, containerID, removeOpts); err != nil {
 				if !(strings.Contains(err.Error(), "No such container") || strings.Contains(err.Error(), "is already in progress")) {
 					return fmt.Errorf("Error deleting container %s: %s", containerID, err)
 				}
@@ -1345,7 +1357,7 @@ func retrieveAndMarshalAuth(d *schema.ResourceData, meta interface{}, stageType
 			<-time.After(3 * time.Second)
 			authConfigs = meta.(*ProviderConfig).AuthConfigs.Configs
 		}
-		log.Printf("[DEBUG] Getting configs from '%v'", authConfigs)
+		log.Printf("[DEBUG] Getting configs from '%v'", registryAddresses(authConfigs))
 		auth = fromRegistryAuth(d.Get("task_spec.0.container_spec.0.image").(string), authConfigs)
 	}
 
@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func resourceDockerTag() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceDockerTagCreate,
+		Read:   resourceDockerTagRead,
+		Update: resourceDockerTagUpdate,
+		Delete: resourceDockerTagDelete,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(1 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"source_image": {
+				Type:        schema.TypeString,
+				Description: "ID, name or name@digest of the local image to tag",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"target_image": {
+				Type:        schema.TypeString,
+				Description: "Name the image is tagged with",
+				Required:    true,
+				ForceNew:    true,
+			},
+
+			"push_remote": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+			},
+
+			"keep_locally": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+
+			"registry_auth": resourceRegistryAuthSchema,
+
+			"source_image_id": {
+				Type:        schema.TypeString,
+				Description: "ID of the tagged image",
+				Computed:    true,
+			},
+
+			"repo_digest": {
+				Type:        schema.TypeString,
+				Description: "Repo digest of the target image once it is pushed",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceDockerTagCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*ProviderConfig).DockerClient
+	ctx, cancel := context.WithTimeout(context.Background(), resourceTimeout(d, meta, schema.TimeoutCreate, "push"))
+	defer cancel()
+
+	sourceImage := d.Get("source_image").(string)
+	targetImage := d.Get("target_image").(string)
+	image, _, err := client.ImageInspectWithRaw(ctx, sourceImage)
+	if err != nil {
+		return classifyError(fmt.Errorf("Unable to inspect source image %s: %s", sourceImage, err), "source_image")
+	}
+	if err := client.ImageTag(ctx, image.ID, targetImage); err != nil {
+		return fmt.Errorf("Unable to tag image %s as %s: %s", sourceImage, targetImage, err)
+	}
+	d.SetId(image.ID + targetImage)
+	d.Set("source_image_id", image.ID)
+
+	if d.Get("push_remote").(bool) {
+		authConfigs, err := resourceAuthConfigs(d, meta)
+		if err != nil {
+			return err
+		}
+		pushCtx, cancelPush := meta.(*ProviderConfig).DefaultTimeouts.withTimeout(ctx, "push")
+		defer cancelPush()
+		if _, err := pushImage(pushCtx, client, authConfigs, meta.(*ProviderConfig).RegistryRetries, meta.(*ProviderConfig).Operations, targetImage); err != nil {
+			return classifyError(fmt.Errorf("Unable to push image [%s]: %s", targetImage, err), "target_image")
+		}
+	}
+	return resourceDockerTagRead(d, meta)
+}
+
+func resourceDockerTagRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*ProviderConfig).DockerClient
+	var data Data
+	if err := fetchLocalImages(context.Background(), &data, client); err != nil {
+		return fmt.Errorf("Error reading docker image list: %s", err)
+	}
+
+	// the image is tagged again if the tag is gone or moved to another image
+	targetImage := d.Get("target_image").(string)
+	foundImage := searchLocalImages(data, targetImage)
+	if foundImage == nil || foundImage.ID != d.Get("source_image_id").(string) {
+		log.Printf("[INFO] Tag %s of image %s is gone, removing from state", targetImage, d.Get("source_image_id"))
+		d.SetId("")
+		return nil
+	}
+	d.Set("repo_digest", repoDigestForImage(targetImage, foundImage.RepoDigests))
+	return nil
+}
+
+func resourceDockerTagUpdate(d *schema.ResourceData, meta interface{}) error {
+	// only keep_locally and registry_auth can be updated
+	return resourceDockerTagRead(d, meta)
+}
+
+func resourceDockerTagDelete(d *schema.ResourceData, meta interface{}) error {
+	if d.Get("keep_locally").(bool) {
+		d.SetId("")
+		return nil
+	}
+
+	client := meta.(*ProviderConfig).DockerClient
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+	var data Data
+	if err := fetchLocalImages(ctx, &data, client); err != nil {
+		return err
+	}
+
+	targetImage := d.Get("target_image").(string)
+	if foundImage := searchLocalImages(data, targetImage); foundImage != nil && foundImage.ID == d.Get("source_image_id").(string) {
+		if _, err := client.ImageRemove(ctx, targetImage, types.ImageRemoveOptions{}); err != nil {
+			return fmt.Errorf("Unable to remove tag %s: %s", targetImage, err)
+		}
+	}
+	d.SetId("")
+	return nil
+}
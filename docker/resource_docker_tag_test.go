@@ -0,0 +1,53 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+)
+
+func TestAccDockerTag_basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDockerTagDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccDockerTagConfig,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair("docker_tag.prod", "source_image_id", "docker_image.dev", "latest"),
+					resource.TestCheckResourceAttr("docker_tag.prod", "target_image", "tftest-tag:prod"),
+				),
+			},
+		},
+	})
+}
+
+func testAccDockerTagDestroy(s *terraform.State) error {
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "docker_tag" {
+			continue
+		}
+
+		client := testAccProvider.Meta().(*ProviderConfig).DockerClient
+		if _, _, err := client.ImageInspectWithRaw(context.Background(), rs.Primary.Attributes["target_image"]); err == nil {
+			return fmt.Errorf("Tag %s still exists", rs.Primary.Attributes["target_image"])
+		}
+	}
+	return nil
+}
+
+const testAccDockerTagConfig = `
+resource "docker_image" "dev" {
+	name = "alpine:3.11"
+	keep_locally = true
+}
+
+resource "docker_tag" "prod" {
+	source_image = "${docker_image.dev.latest}"
+	target_image = "tftest-tag:prod"
+}
+`
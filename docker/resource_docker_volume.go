@@ -22,6 +22,11 @@ func resourceDockerVolume() *schema.Resource {
 			State: schema.ImportStatePassthrough,
 		},
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(1 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -101,16 +106,15 @@ func resourceDockerVolumeV0() *schema.Resource {
 
 func resourceDockerVolumeCreate(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*ProviderConfig).DockerClient
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout(schema.TimeoutCreate))
+	defer cancel()
 
 	createOpts := volume.VolumeCreateBody{}
 
 	if v, ok := d.GetOk("name"); ok {
 		createOpts.Name = v.(string)
 	}
-	if v, ok := d.GetOk("labels"); ok {
-		createOpts.Labels = labelSetToMap(v.(*schema.Set))
-	}
+	createOpts.Labels = withDefaultLabels(meta, labelSetToMap(d.Get("labels").(*schema.Set)))
 	if v, ok := d.GetOk("driver"); ok {
 		createOpts.Driver = v.(string)
 	}
@@ -123,7 +127,7 @@ func resourceDockerVolumeCreate(d *schema.ResourceData, meta interface{}) error
 	retVolume, err = client.VolumeCreate(ctx, createOpts)
 
 	if err != nil {
-		return fmt.Errorf("Unable to create volume: %s", err)
+		return classifyError(fmt.Errorf("Unable to create volume: %s", err), "name")
 	}
 
 	d.SetId(retVolume.Name)
@@ -143,7 +147,7 @@ func resourceDockerVolumeRead(d *schema.ResourceData, meta interface{}) error {
 	}
 
 	d.Set("name", retVolume.Name)
-	d.Set("labels", mapToLabelSet(retVolume.Labels))
+	d.Set("labels", mapToLabelSet(withoutDefaultLabels(meta, retVolume.Labels, labelSetToMap(d.Get("labels").(*schema.Set)))))
 	d.Set("driver", retVolume.Driver)
 	d.Set("driver_opts", retVolume.Options)
 	d.Set("mountpoint", retVolume.Mountpoint)
@@ -152,13 +156,13 @@ func resourceDockerVolumeRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceDockerVolumeDelete(d *schema.ResourceData, meta interface{}) error {
-	log.Printf("[INFO] Waiting for volume: '%s' to get removed: max '%v seconds'", d.Id(), 30)
+	log.Printf("[INFO] Waiting for volume: '%s' to get removed: max '%v'", d.Id(), d.Timeout(schema.TimeoutDelete))
 
 	stateConf := &resource.StateChangeConf{
 		Pending:    []string{"in_use"},
 		Target:     []string{"removed"},
 		Refresh:    resourceDockerVolumeRemoveRefreshFunc(d.Id(), meta),
-		Timeout:    30 * time.Second,
+		Timeout:    d.Timeout(schema.TimeoutDelete),
 		MinTimeout: 5 * time.Second,
 		Delay:      2 * time.Second,
 	}
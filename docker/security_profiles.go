@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// seccompUnconfined disables the seccomp filtering of a container
+const seccompUnconfined = "unconfined"
+
+// readSeccompProfile reads the seccomp profile of the JSON file at path. The
+// daemon expects the content of the profile, not its path.
+func readSeccompProfile(path string) ([]byte, error) {
+	if path == seccompUnconfined {
+		return []byte(seccompUnconfined), nil
+	}
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the seccomp profile: %s", err)
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, profile); err != nil {
+		return nil, fmt.Errorf("The seccomp profile %s is not valid JSON: %s", path, err)
+	}
+	return compacted.Bytes(), nil
+}
+
+// seccompProfileHash returns the hash of the content of the seccomp profile,
+// so changes of the file are detected like the ones of a build context
+func seccompProfileHash(path string) (string, error) {
+	profile, err := readSeccompProfile(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(profile)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// securityProfileOpts returns the security options of the seccomp_profile and
+// apparmor_profile of the container
+func securityProfileOpts(d *schema.ResourceData) ([]string, error) {
+	opts := []string{}
+	if path := d.Get("seccomp_profile").(string); path != "" {
+		profile, err := readSeccompProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, "seccomp="+string(profile))
+	}
+	if profile := d.Get("apparmor_profile").(string); profile != "" {
+		opts = append(opts, "apparmor="+profile)
+	}
+	return opts, nil
+}
+
+// withoutSecurityProfileOpts removes the security options of the profiles
+// set by seccomp_profile and apparmor_profile from the ones the daemon
+// reports, so they do not show up as a diff of security_opts
+func withoutSecurityProfileOpts(securityOpts []string, seccompProfile, apparmorProfile string) []string {
+	filtered := []string{}
+	for _, opt := range securityOpts {
+		if seccompProfile != "" && (strings.HasPrefix(opt, "seccomp=") || strings.HasPrefix(opt, "seccomp:")) {
+			continue
+		}
+		if apparmorProfile != "" && (strings.HasPrefix(opt, "apparmor=") || strings.HasPrefix(opt, "apparmor:")) {
+			continue
+		}
+		filtered = append(filtered, opt)
+	}
+	return filtered
+}
+
+// seccompProfileCustomizeDiff replaces the container if the content of its
+// seccomp profile changes
+func seccompProfileCustomizeDiff(d *schema.ResourceDiff) error {
+	path := d.Get("seccomp_profile").(string)
+	if path == "" {
+		return nil
+	}
+	hash, err := seccompProfileHash(path)
+	if err != nil {
+		return err
+	}
+	if old, _ := d.GetChange("seccomp_profile_hash"); old.(string) == hash {
+		return nil
+	}
+	if err := d.SetNew("seccomp_profile_hash", hash); err != nil {
+		return err
+	}
+	if d.Id() != "" {
+		return d.ForceNew("seccomp_profile_hash")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSeccompProfileHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seccomp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profile.json")
+
+	if err := ioutil.WriteFile(path, []byte(`{"defaultAction": "SCMP_ACT_ERRNO"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := readSeccompProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(profile) != `{"defaultAction":"SCMP_ACT_ERRNO"}` {
+		t.Errorf("expected the compacted profile, got %s", profile)
+	}
+	hash, err := seccompProfileHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a changed profile is a diff
+	if err := ioutil.WriteFile(path, []byte(`{"defaultAction": "SCMP_ACT_ALLOW"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := seccompProfileHash(path); changed == hash {
+		t.Errorf("expected the hash to change with the profile, got %s", changed)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"defaultAction":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSeccompProfile(path); err == nil {
+		t.Errorf("expected an error for an invalid profile")
+	}
+	if profile, _ := readSeccompProfile(seccompUnconfined); string(profile) != seccompUnconfined {
+		t.Errorf("expected unconfined to be passed on, got %s", profile)
+	}
+}
+
+func TestWithoutSecurityProfileOpts(t *testing.T) {
+	opts := []string{"label=disable", `seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`, "apparmor=docker-nginx"}
+	if filtered := withoutSecurityProfileOpts(opts, "", ""); !reflect.DeepEqual(filtered, opts) {
+		t.Errorf("expected the options to be kept without profiles, got %v", filtered)
+	}
+	filtered := withoutSecurityProfileOpts(opts, "profile.json", "docker-nginx")
+	if expected := []string{"label=disable"}; !reflect.DeepEqual(filtered, expected) {
+		t.Errorf("expected %v, got %v", expected, filtered)
+	}
+}
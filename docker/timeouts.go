@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// defaultResourceTimeout is the default create and update timeout of the
+// resources pulling, pushing or building images
+const defaultResourceTimeout = 20 * time.Minute
+
+// timeoutOperations are the operations of the default_timeouts of the provider
+var timeoutOperations = []string{"connect", "pull", "push", "build"}
+
+// operationTimeouts are the default_timeouts of the provider by operation, an
+// operation without a timeout is only bounded by the timeout of the resource
+type operationTimeouts map[string]time.Duration
+
+func providerSetToOperationTimeouts(rawTimeouts []interface{}) (operationTimeouts, error) {
+	timeouts := operationTimeouts{}
+	if len(rawTimeouts) == 0 || rawTimeouts[0] == nil {
+		return timeouts, nil
+	}
+	rawTimeout := rawTimeouts[0].(map[string]interface{})
+	for _, operation := range timeoutOperations {
+		value := rawTimeout[operation].(string)
+		if value == "" {
+			continue
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing default_timeouts.%s: %s", operation, err)
+		}
+		timeouts[operation] = timeout
+	}
+	return timeouts, nil
+}
+
+// withTimeout bounds ctx by the default timeout of the operation
+func (t operationTimeouts) withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	if timeout := t[operation]; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// resourceTimeout returns the timeout of the resource for the key. As long as
+// the timeouts block of the resource does not change its default, the sum of
+// the default_timeouts of the operations the resource runs is used if it is
+// longer, so the operations are not cut short by the default of the resource.
+func resourceTimeout(d *schema.ResourceData, meta interface{}, key string, operations ...string) time.Duration {
+	timeout := d.Timeout(key)
+	if timeout != defaultResourceTimeout {
+		return timeout
+	}
+	var operationsTimeout time.Duration
+	for _, operation := range operations {
+		operationsTimeout += meta.(*ProviderConfig).DefaultTimeouts[operation]
+	}
+	if operationsTimeout > timeout {
+		return operationsTimeout
+	}
+	return timeout
+}
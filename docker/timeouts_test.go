@@ -0,0 +1,60 @@
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+)
+
+func TestProviderSetToOperationTimeouts(t *testing.T) {
+	timeouts, err := providerSetToOperationTimeouts([]interface{}{map[string]interface{}{
+		"connect": "30s",
+		"pull":    "1h",
+		"push":    "",
+		"build":   "2h",
+	}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := operationTimeouts{"connect": 30 * time.Second, "pull": time.Hour, "build": 2 * time.Hour}
+	if len(timeouts) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, timeouts)
+	}
+	for operation, timeout := range expected {
+		if timeouts[operation] != timeout {
+			t.Errorf("expected %s for %s, got %s", timeout, operation, timeouts[operation])
+		}
+	}
+
+	ctx, cancel := timeouts.withTimeout(context.Background(), "pull")
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Hour {
+		t.Errorf("expected the pull to be bounded by an hour, got %s", deadline)
+	}
+	ctx, cancel = timeouts.withTimeout(context.Background(), "push")
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline for an operation without a timeout")
+	}
+}
+
+func TestResourceTimeout(t *testing.T) {
+	meta := &ProviderConfig{DefaultTimeouts: operationTimeouts{"build": time.Hour, "push": 30 * time.Minute}}
+	d := resourceDockerRegistryImage().Data(&terraform.InstanceState{})
+	if timeout := resourceTimeout(d, meta, schema.TimeoutCreate, "build", "push"); timeout != 90*time.Minute {
+		t.Errorf("expected the timeouts of the build and the push, got %s", timeout)
+	}
+	if timeout := resourceTimeout(d, &ProviderConfig{}, schema.TimeoutCreate, "build", "push"); timeout != defaultResourceTimeout {
+		t.Errorf("expected the default of the resource, got %s", timeout)
+	}
+
+	resource := resourceDockerRegistryImage()
+	resource.Timeouts = &schema.ResourceTimeout{Create: schema.DefaultTimeout(5 * time.Minute)}
+	d = resource.Data(&terraform.InstanceState{})
+	if timeout := resourceTimeout(d, meta, schema.TimeoutCreate, "build", "push"); timeout != 5*time.Minute {
+		t.Errorf("expected the timeout of the resource to take precedence, got %s", timeout)
+	}
+}
@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// timingsSchema is the schema of the computed timings attribute which holds
+// the duration in seconds of each operation done by the last apply
+var timingsSchema = &schema.Schema{
+	Type:        schema.TypeMap,
+	Description: "Durations in seconds of the operations (build, pull, push, create) of the last apply",
+	Computed:    true,
+	Elem: &schema.Schema{
+		Type: schema.TypeFloat,
+	},
+}
+
+// operationTiming is a single entry of the timing report
+type operationTiming struct {
+	Resource  string    `json:"resource"`
+	Name      string    `json:"name"`
+	Operation string    `json:"operation"`
+	StartedAt time.Time `json:"started_at"`
+	Seconds   float64   `json:"duration_seconds"`
+}
+
+// timingReport collects the durations of the operations of an apply and
+// writes them as JSON to path, if one is given
+type timingReport struct {
+	path       string
+	mu         sync.Mutex
+	operations []operationTiming
+}
+
+// operationTimings records the durations of the operations of one resource
+type operationTimings struct {
+	report   *timingReport
+	resource string
+	name     string
+	timings  map[string]interface{}
+}
+
+func newTimingReport(path string) *timingReport {
+	return &timingReport{path: path}
+}
+
+// timingsFor returns the recorder for the operations of the given resource
+func (r *timingReport) timingsFor(resource, name string) *operationTimings {
+	return &operationTimings{
+		report:   r,
+		resource: resource,
+		name:     name,
+		timings:  make(map[string]interface{}),
+	}
+}
+
+// record stores the duration of operation since start and rewrites the
+// report, so it is complete even if the apply fails later on
+func (t *operationTimings) record(operation string, start time.Time) {
+	duration := time.Since(start)
+	seconds := duration.Round(time.Millisecond).Seconds()
+	t.timings[operation] = seconds
+	log.Printf("[DEBUG] %s '%s': %s took %v", t.resource, t.name, operation, duration)
+
+	if t.report == nil {
+		return
+	}
+	if err := t.report.add(operationTiming{
+		Resource:  t.resource,
+		Name:      t.name,
+		Operation: operation,
+		StartedAt: start.UTC(),
+		Seconds:   seconds,
+	}); err != nil {
+		log.Printf("[WARN] Unable to write timing report: %s", err)
+	}
+}
+
+func (t *operationTimings) flatten() map[string]interface{} {
+	return t.timings
+}
+
+func (r *timingReport) add(timing operationTiming) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.operations = append(r.operations, timing)
+	if r.path == "" {
+		return nil
+	}
+
+	report, err := json.MarshalIndent(map[string]interface{}{
+		"operations": r.operations,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(r.path, report, 0644); err != nil {
+		return fmt.Errorf("Error writing %s: %s", r.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimingReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-timing-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	reportPath := filepath.Join(dir, "report.json")
+
+	report := newTimingReport(reportPath)
+	timings := report.timingsFor("docker_image", "alpine:3.1")
+	timings.record("pull", time.Now().Add(-1500*time.Millisecond))
+	report.timingsFor("docker_container", "foo").record("create", time.Now())
+
+	if seconds := timings.flatten()["pull"].(float64); seconds < 1.5 {
+		t.Errorf("expected pull to take at least 1.5s, got %v", seconds)
+	}
+
+	content, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Operations []operationTiming `json:"operations"`
+	}
+	if err := json.Unmarshal(content, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Operations) != 2 {
+		t.Fatalf("expected 2 operations in the report, got %d", len(written.Operations))
+	}
+	if op := written.Operations[0]; op.Resource != "docker_image" || op.Name != "alpine:3.1" || op.Operation != "pull" {
+		t.Errorf("unexpected first operation %+v", op)
+	}
+}
+
+func TestTimingReportWithoutPath(t *testing.T) {
+	var report *timingReport
+	timings := report.timingsFor("docker_image", "alpine:3.1")
+	timings.record("pull", time.Now())
+	if _, ok := timings.flatten()["pull"]; !ok {
+		t.Errorf("expected pull to be recorded")
+	}
+
+	newTimingReport("").timingsFor("docker_image", "alpine:3.1").record("pull", time.Now())
+}
@@ -3,10 +3,12 @@ package docker
 import (
 	"encoding/base64"
 	"fmt"
+	"net"
 	"regexp"
 	"strconv"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 )
 
@@ -91,6 +93,30 @@ func validateDurationGeq0() schema.SchemaValidateFunc {
 	}
 }
 
+func validateStringIsHumanSize() schema.SchemaValidateFunc {
+	return func(v interface{}, k string) (ws []string, errors []error) {
+		value := v.(string)
+		if _, err := units.FromHumanSize(value); err != nil {
+			errors = append(errors, fmt.Errorf(
+				"%q is not a valid size, e.g. 500MB", k))
+		}
+		return
+	}
+}
+
+// validateUlimitName checks the name against the ulimits known to Docker,
+// e.g. nofile or memlock
+func validateUlimitName() schema.SchemaValidateFunc {
+	return func(v interface{}, k string) (ws []string, errors []error) {
+		value := v.(string)
+		if _, err := units.ParseUlimit(value + "=0"); err != nil {
+			errors = append(errors, fmt.Errorf(
+				"%q is not a valid ulimit name: %q", k, value))
+		}
+		return
+	}
+}
+
 func validateStringMatchesPattern(pattern string) schema.SchemaValidateFunc {
 	return func(v interface{}, k string) (ws []string, errors []error) {
 		compiledRegex, err := regexp.Compile(pattern)
@@ -132,3 +158,28 @@ func validateDockerContainerPath(v interface{}, k string) (ws []string, errors [
 
 	return
 }
+
+// validateIPAddress checks that the value is an IP address of the version,
+// 4 or 6
+func validateIPAddress(version int) schema.SchemaValidateFunc {
+	return func(v interface{}, k string) (ws []string, errors []error) {
+		value := v.(string)
+		ip := net.ParseIP(value)
+		if ip == nil || (version == 4) != (ip.To4() != nil) {
+			errors = append(errors, fmt.Errorf(
+				"%q is not a valid IPv%d address: %q", k, version, value))
+		}
+		return
+	}
+}
+
+// validateDockerContainerPathKeys checks that the keys of a map are absolute
+// paths in the container, e.g. the mount points of tmpfs
+func validateDockerContainerPathKeys(v interface{}, k string) (ws []string, errors []error) {
+	for path := range v.(map[string]interface{}) {
+		if _, pathErrors := validateDockerContainerPath(path, fmt.Sprintf("%s.%s", k, path)); len(pathErrors) > 0 {
+			errors = append(errors, pathErrors...)
+		}
+	}
+	return
+}
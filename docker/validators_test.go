@@ -125,3 +125,42 @@ func TestValidateStringShouldBeBase64Encoded(t *testing.T) {
 		t.Fatalf("%q should NOT be base64 decodeable", v)
 	}
 }
+
+func TestValidateUlimitName(t *testing.T) {
+	for _, v := range []string{"nofile", "memlock", "nproc"} {
+		if _, errors := validateUlimitName()(v, "name"); len(errors) != 0 {
+			t.Fatalf("%q should be a valid ulimit name: %q", v, errors)
+		}
+	}
+	for _, v := range []string{"", "files", "NOFILE"} {
+		if _, errors := validateUlimitName()(v, "name"); len(errors) == 0 {
+			t.Fatalf("%q should be an invalid ulimit name", v)
+		}
+	}
+}
+
+func TestValidateDockerContainerPathKeys(t *testing.T) {
+	if _, errors := validateDockerContainerPathKeys(map[string]interface{}{"/run": "", "/tmp": "rw,size=64m"}, "tmpfs"); len(errors) != 0 {
+		t.Fatalf("absolute paths should be valid: %q", errors)
+	}
+	if _, errors := validateDockerContainerPathKeys(map[string]interface{}{"tmp": ""}, "tmpfs"); len(errors) == 0 {
+		t.Fatalf("a relative path should be invalid")
+	}
+}
+
+func TestValidateIPAddress(t *testing.T) {
+	if _, errors := validateIPAddress(4)("10.0.0.2", "ipv4_address"); len(errors) != 0 {
+		t.Fatalf("10.0.0.2 should be a valid IPv4 address: %q", errors)
+	}
+	if _, errors := validateIPAddress(6)("fd00::2", "ipv6_address"); len(errors) != 0 {
+		t.Fatalf("fd00::2 should be a valid IPv6 address: %q", errors)
+	}
+	for _, v := range []string{"fd00::2", "10.0.0.0/24", "foo"} {
+		if _, errors := validateIPAddress(4)(v, "ipv4_address"); len(errors) == 0 {
+			t.Fatalf("%q should be an invalid IPv4 address", v)
+		}
+	}
+	if _, errors := validateIPAddress(6)("10.0.0.2", "ipv6_address"); len(errors) == 0 {
+		t.Fatalf("10.0.0.2 should be an invalid IPv6 address")
+	}
+}
@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+)
+
+// minDaemonAPIVersion is the API version of Docker 1.13, the first one with
+// the services, secrets and configs the provider manages
+const minDaemonAPIVersion = "1.25"
+
+// waitForDaemon is the wait_for_daemon block of the provider
+type waitForDaemon struct {
+	timeout time.Duration
+	os      string
+}
+
+func providerSetToWaitForDaemon(rawWaits []interface{}) (*waitForDaemon, error) {
+	if len(rawWaits) == 0 || rawWaits[0] == nil {
+		return nil, nil
+	}
+	rawWait := rawWaits[0].(map[string]interface{})
+	timeout, err := time.ParseDuration(rawWait["timeout"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing wait_for_daemon.timeout: %s", err)
+	}
+	return &waitForDaemon{timeout: timeout, os: rawWait["os"].(string)}, nil
+}
+
+// connect retries the connect of the config until the daemon answers or the
+// timeout elapses, then checks whether the provider can manage the daemon.
+// Without a wait_for_daemon block it connects once.
+func (w *waitForDaemon) connect(ctx context.Context, config *Config, engine string) (*client.Client, error) {
+	if w == nil {
+		return config.Connect(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	waitConfig := *config
+	waitConfig.ConnectMaxRetries = math.MaxInt32
+	if waitConfig.ConnectRetryBackoff <= 0 {
+		waitConfig.ConnectRetryBackoff = time.Second
+	}
+	cli, err := waitConfig.Connect(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("The Docker daemon at %s did not answer within %s: %s", config.Host, w.timeout, err)
+		}
+		return nil, err
+	}
+	config.Host = waitConfig.Host
+
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("Error reading the version of the Docker daemon at %s: %s", config.Host, err)
+	}
+	if err := checkDaemonVersion(version, config.APIVersion, engine, w.os); err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("The Docker daemon at %s cannot be used by the provider:\n%s", config.Host, err)
+	}
+	return cli, nil
+}
+
+// checkDaemonVersion returns all the problems of managing the daemon of the
+// version with the provider at once, e.g. an engine running Windows
+// containers or a pinned API version the daemon does not support
+func checkDaemonVersion(version types.Version, apiVersion, engine, os string) error {
+	problems := []string{}
+	if version.APIVersion != "" && versions.LessThan(version.APIVersion, minDaemonAPIVersion) {
+		problems = append(problems, fmt.Sprintf("The daemon serves API version %s, the provider requires %s (Docker 1.13) or newer", version.APIVersion, minDaemonAPIVersion))
+	}
+	if apiVersion != "" {
+		if version.APIVersion != "" && versions.GreaterThan(apiVersion, version.APIVersion) {
+			problems = append(problems, fmt.Sprintf("api_version %s is newer than the API version %s of the daemon", apiVersion, version.APIVersion))
+		}
+		if version.MinAPIVersion != "" && versions.LessThan(apiVersion, version.MinAPIVersion) {
+			problems = append(problems, fmt.Sprintf("api_version %s is older than the minimum API version %s of the daemon", apiVersion, version.MinAPIVersion))
+		}
+	}
+
+	isPodman := false
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), enginePodman) {
+			isPodman = true
+		}
+	}
+	if engine == enginePodman && !isPodman {
+		problems = append(problems, fmt.Sprintf("The provider is configured with engine = \"podman\", but the daemon is %s", daemonName(version)))
+	}
+	if engine != enginePodman && isPodman {
+		problems = append(problems, fmt.Sprintf("The daemon is %s, set engine = \"podman\" in the provider", daemonName(version)))
+	}
+
+	if os != "" && version.Os != "" && version.Os != os {
+		problems = append(problems, fmt.Sprintf("The daemon runs %s containers, wait_for_daemon expects %s ones", version.Os, os))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("* %s", strings.Join(problems, "\n* "))
+	}
+	return nil
+}
+
+// daemonName describes the daemon of the version for error messages
+func daemonName(version types.Version) string {
+	name := version.Platform.Name
+	if name == "" {
+		name = "Docker Engine"
+	}
+	return fmt.Sprintf("%s %s (%s/%s)", name, version.Version, version.Os, version.Arch)
+}
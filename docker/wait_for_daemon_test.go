@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestCheckDaemonVersion(t *testing.T) {
+	docker := types.Version{Version: "19.03.8", APIVersion: "1.40", MinAPIVersion: "1.12", Os: "linux", Arch: "amd64"}
+	podman := types.Version{Version: "3.0.1", APIVersion: "1.40", Os: "linux", Arch: "amd64",
+		Platform: struct{ Name string }{"linux/amd64/fedora-33"}, Components: []types.ComponentVersion{{Name: "Podman Engine"}}}
+
+	if err := checkDaemonVersion(docker, "", engineDocker, "linux"); err != nil {
+		t.Errorf("expected the daemon to be usable, got %s", err)
+	}
+	if err := checkDaemonVersion(podman, "1.40", enginePodman, ""); err != nil {
+		t.Errorf("expected Podman to be usable, got %s", err)
+	}
+
+	cases := []struct {
+		version    types.Version
+		apiVersion string
+		engine     string
+		os         string
+		problems   []string
+	}{
+		{types.Version{APIVersion: "1.24"}, "", engineDocker, "", []string{"requires 1.25"}},
+		{docker, "1.41", engineDocker, "", []string{"api_version 1.41 is newer"}},
+		{docker, "1.11", engineDocker, "", []string{"api_version 1.11 is older"}},
+		{podman, "", engineDocker, "", []string{`set engine = "podman"`}},
+		{docker, "", enginePodman, "windows", []string{"daemon is Docker Engine 19.03.8 (linux/amd64)", "expects windows ones"}},
+	}
+	for _, c := range cases {
+		err := checkDaemonVersion(c.version, c.apiVersion, c.engine, c.os)
+		if err == nil {
+			t.Errorf("expected %v, got no error", c.problems)
+			continue
+		}
+		for _, problem := range c.problems {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("expected %q, got %s", problem, err)
+			}
+		}
+		if problems := strings.Count(err.Error(), "* "); problems != len(c.problems) {
+			t.Errorf("expected %d problems, got %s", len(c.problems), err)
+		}
+	}
+}
+
+func TestWaitForDaemon(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.40")
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			json.NewEncoder(w).Encode(types.Version{Version: "19.03.8", APIVersion: "1.40", Os: "windows", Arch: "amd64"})
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer daemon.Close()
+	host := "tcp://" + strings.TrimPrefix(daemon.URL, "http://")
+
+	wait := &waitForDaemon{timeout: time.Second, os: "windows"}
+	if _, err := wait.connect(context.Background(), &Config{Host: host}, engineDocker); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	wait.os = "linux"
+	if _, err := wait.connect(context.Background(), &Config{Host: host}, engineDocker); err == nil || !strings.Contains(err.Error(), "cannot be used by the provider") {
+		t.Errorf("expected the OS mismatch, got %v", err)
+	}
+
+	daemon.Close()
+	start := time.Now()
+	_, err := wait.connect(context.Background(), &Config{Host: host, ConnectRetryBackoff: 100 * time.Millisecond}, engineDocker)
+	if err == nil || !strings.Contains(err.Error(), "did not answer within 1s") {
+		t.Errorf("expected the timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 3*time.Second {
+		t.Errorf("expected to wait for the timeout, waited %s", elapsed)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/terraform-providers/terraform-provider-docker
 require (
 	github.com/Azure/go-ansiterm v0.0.0-20170929234023-d6e3b3328b78 // indirect
 	github.com/Microsoft/hcsshim v0.8.9 // indirect
+	github.com/aws/aws-sdk-go v1.19.39
 	github.com/containerd/continuity v0.0.0-20200710164510-efbc4488d8fe // indirect
 	github.com/docker/cli v0.0.0-20200303215952-eb310fca4956 // v19.03.8
 	github.com/docker/distribution v0.0.0-20180522175653-f0cc92778478 // indirect
@@ -10,12 +11,20 @@ require (
 	github.com/docker/docker-credential-helpers v0.6.3
 	github.com/docker/go-connections v0.4.0
 	github.com/docker/go-units v0.4.0
+	github.com/golang/protobuf v1.3.2
 	github.com/gorilla/mux v1.7.2 // indirect
+	github.com/hashicorp/hcl2 v0.0.0-20190821123243-0c888d1241f6
 	github.com/hashicorp/terraform-plugin-sdk v1.0.0
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/morikuni/aec v0.0.0-20170113033406-39771216ff4c // indirect
 	github.com/opencontainers/image-spec v0.0.0-20171125024018-577479e4dc27 // indirect
 	github.com/opencontainers/runc v0.1.1 // indirect
+	github.com/zclconf/go-cty v1.1.0
+	golang.org/x/crypto v0.0.0-20190820162420-60c769a6c586
+	golang.org/x/net v0.0.0-20191004110552-13f9640d40b9
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
+	google.golang.org/grpc v1.23.1
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 go 1.15